@@ -0,0 +1,178 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+// exportCheckpoint is the progress of incremental export of a chat, messages are exported from newest to oldest
+type exportCheckpoint struct {
+	Peer   int64 `json:"peer"`
+	Thread int   `json:"thread"`
+	// Type and Input are export options of ranges, since ranges stopped by lower bound of options
+	// are also done, and they don't cover messages out of options.
+	Type  string `json:"type"`
+	Input []int  `json:"input"`
+	// Newest is the max message id of completed ranges, and later runs only fetch messages after it
+	Newest int `json:"newest"`
+	// Pending is the range left by an interrupted run, which is resumed first by next run
+	Pending *exportRange `json:"pending,omitempty"`
+}
+
+// exportRange is a range of messages being exported from newest to oldest
+type exportRange struct {
+	Low  int `json:"low"`  // exclusive lower bound, which is Newest when the range is started
+	High int `json:"high"` // the first message id of range, which becomes Newest when the range is done
+	Next int `json:"next"` // the last exported message id, and the range is resumed before it
+}
+
+// loadExportCheckpoint loads checkpoint of path if resume is true, otherwise a new one of peer, thread and options is returned.
+// Checkpoint of other chats or options is rejected, so that messages are never skipped by mistake.
+func loadExportCheckpoint(path string, resume bool, peer int64, thread int, typ ExportType, input []int) (*exportCheckpoint, error) {
+	cp := &exportCheckpoint{Peer: peer, Thread: thread, Type: typ.String(), Input: input}
+	if !resume {
+		return cp, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cp, nil
+		}
+		return nil, errors.Wrap(err, "read checkpoint")
+	}
+	loaded := &exportCheckpoint{}
+	if err = json.Unmarshal(b, loaded); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal checkpoint %s", path)
+	}
+	if loaded.Peer != peer || loaded.Thread != thread {
+		return nil, errors.Errorf("checkpoint %s is of chat %d(thread %d), not %d(thread %d)",
+			path, loaded.Peer, loaded.Thread, peer, thread)
+	}
+	if loaded.Type != cp.Type || !slices.Equal(loaded.Input, input) {
+		return nil, errors.Errorf("checkpoint %s is of type %s(input %v), not %s(input %v), export without --continue to start over",
+			path, loaded.Type, loaded.Input, typ, input)
+	}
+
+	return loaded, nil
+}
+
+func (cp *exportCheckpoint) save(path string) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrap(err, "marshal checkpoint")
+	}
+	if err = os.WriteFile(path, b, 0o644); err != nil {
+		return errors.Wrap(err, "write checkpoint")
+	}
+	return nil
+}
+
+// readExported returns messages of export file of path, and nothing if it doesn't exist
+func readExported(path string) ([]json.RawMessage, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read exported messages")
+	}
+
+	var exported struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err = json.Unmarshal(b, &exported); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal exported messages of %s", path)
+	}
+
+	return exported.Messages, nil
+}
+
+// msgIter is the iterator of messages from newest to oldest, e.g. *messages.Iterator
+type msgIter interface {
+	Next(ctx context.Context) bool
+	Value() messages.Elem
+	Err() error
+}
+
+// exporter exports messages in ranges of checkpoint, and checkpoint is updated as messages are exported
+type exporter struct {
+	opts   ExportOptions
+	cp     *exportCheckpoint
+	export func(m *tg.Message) (bool, error) // reports whether m is written, e.g. it's not filtered
+	count  int                               // number of written messages, which is used by ExportTypeLast
+}
+
+// run resumes pending range of checkpoint by iterator from resume, then exports messages after Newest
+// of checkpoint by latest iterator. Ranges are done only if they reach their lower bounds.
+func (e *exporter) run(ctx context.Context, resume func(offsetID int) msgIter, latest func() msgIter) error {
+	if r := e.cp.Pending; r != nil {
+		if err := e.exportRange(ctx, resume(r.Next), r); err != nil {
+			return err
+		}
+	}
+
+	return e.exportRange(ctx, latest(), &exportRange{Low: e.cp.Newest})
+}
+
+func (e *exporter) exportRange(ctx context.Context, iter msgIter, r *exportRange) error {
+	done, err := e.iterate(ctx, iter, r)
+	switch {
+	case done:
+		e.cp.Newest, e.cp.Pending = max(e.cp.Newest, r.High), nil
+	case r.High != 0:
+		e.cp.Pending = r
+	}
+	return err
+}
+
+// iterate exports messages of iter in r, and reports whether the lower bound of r or export options is reached
+func (e *exporter) iterate(ctx context.Context, iter msgIter, r *exportRange) (bool, error) {
+	for iter.Next(ctx) {
+		msg := iter.Value().Msg
+		if msg.GetID() <= r.Low {
+			return true, nil
+		}
+		switch e.opts.Type {
+		case ExportTypeTime:
+			if msg.GetDate() < e.opts.Input[0] {
+				return true, nil
+			}
+		case ExportTypeId:
+			if msg.GetID() < e.opts.Input[0] {
+				return true, nil
+			}
+		case ExportTypeLast:
+			if e.count >= e.opts.Input[0] {
+				return true, nil
+			}
+		}
+
+		if m, ok := msg.(*tg.Message); ok {
+			ok, err := e.export(m)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				e.count++
+			}
+		}
+
+		if r.High == 0 {
+			r.High = msg.GetID()
+		}
+		r.Next = msg.GetID()
+	}
+
+	// the oldest message is reached
+	if err := iter.Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// fixtureIter iterates fixture messages of ids from newest to oldest before offset,
+// and fails after limit messages if limit is positive
+type fixtureIter struct {
+	ids   []int
+	limit int
+	cur   int
+	err   error
+}
+
+func newFixtureIter(newest, offset, limit int) *fixtureIter {
+	ids := make([]int, 0)
+	for id := newest; id > 0; id-- {
+		if offset == 0 || id < offset {
+			ids = append(ids, id)
+		}
+	}
+	return &fixtureIter{ids: ids, limit: limit}
+}
+
+func (i *fixtureIter) Next(context.Context) bool {
+	if i.limit > 0 && i.cur >= i.limit {
+		i.err = errInterrupted
+		return false
+	}
+	if i.cur >= len(i.ids) {
+		return false
+	}
+	i.cur++
+	return true
+}
+
+func (i *fixtureIter) Value() messages.Elem {
+	id := i.ids[i.cur-1]
+	return messages.Elem{Msg: &tg.Message{ID: id, Date: id}}
+}
+
+func (i *fixtureIter) Err() error { return i.err }
+
+func TestExporter_Resume(t *testing.T) {
+	ctx := context.Background()
+	cp := &exportCheckpoint{}
+
+	run := func(newest, limit int, opts ExportOptions) ([]int, error) {
+		exported := make([]int, 0)
+		e := &exporter{opts: opts, cp: cp, export: func(m *tg.Message) (bool, error) {
+			exported = append(exported, m.ID)
+			return true, nil
+		}}
+		err := e.run(ctx,
+			func(offsetID int) msgIter { return newFixtureIter(newest, offsetID, limit) },
+			func() msgIter { return newFixtureIter(newest, 0, limit) })
+		return exported, err
+	}
+	all := ExportOptions{Type: ExportTypeTime, Input: []int{0, 1 << 30}}
+
+	// interrupted after 10..7
+	exported, err := run(10, 4, all)
+	require.ErrorIs(t, err, errInterrupted)
+	assert.Equal(t, []int{10, 9, 8, 7}, exported)
+	assert.Equal(t, &exportCheckpoint{Pending: &exportRange{Low: 0, High: 10, Next: 7}}, cp)
+
+	// resumed from 6 by next run with new messages
+	exported, err = run(12, 0, all)
+	require.NoError(t, err)
+	assert.Equal(t, []int{6, 5, 4, 3, 2, 1, 12, 11}, exported)
+	assert.Equal(t, &exportCheckpoint{Newest: 12}, cp)
+
+	// nothing new
+	exported, err = run(12, 0, all)
+	require.NoError(t, err)
+	assert.Empty(t, exported)
+	assert.Equal(t, 12, cp.Newest)
+
+}
+
+func TestExporter_LowerBound(t *testing.T) {
+	ctx := context.Background()
+	cp := &exportCheckpoint{}
+	opts := ExportOptions{Type: ExportTypeId, Input: []int{15, 1 << 30}}
+
+	run := func(newest int) []int {
+		exported := make([]int, 0)
+		e := &exporter{opts: opts, cp: cp, export: func(m *tg.Message) (bool, error) {
+			exported = append(exported, m.ID)
+			return true, nil
+		}}
+		require.NoError(t, e.run(ctx,
+			func(offsetID int) msgIter { return newFixtureIter(newest, offsetID, 0) },
+			func() msgIter { return newFixtureIter(newest, 0, 0) }))
+		return exported
+	}
+
+	// explicit lower bound of id range is respected, and range is done since checkpoint is bound to options
+	assert.Equal(t, []int{20, 19, 18, 17, 16, 15}, run(20))
+	assert.Equal(t, &exportCheckpoint{Newest: 20}, cp)
+
+	assert.Equal(t, []int{23, 22, 21}, run(23))
+	assert.Equal(t, &exportCheckpoint{Newest: 23}, cp)
+}
+
+func TestLoadExportCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.checkpoint.json")
+	input := []int{0, 100}
+
+	cp, err := loadExportCheckpoint(path, true, 1, 0, ExportTypeId, input)
+	require.NoError(t, err)
+	assert.Equal(t, &exportCheckpoint{Peer: 1, Type: "id", Input: input}, cp)
+
+	cp.Newest = 100
+	require.NoError(t, cp.save(path))
+
+	loaded, err := loadExportCheckpoint(path, true, 1, 0, ExportTypeId, input)
+	require.NoError(t, err)
+	assert.Equal(t, cp, loaded)
+
+	fresh, err := loadExportCheckpoint(path, false, 1, 0, ExportTypeId, input)
+	require.NoError(t, err)
+	assert.Zero(t, fresh.Newest)
+
+	_, err = loadExportCheckpoint(path, true, 2, 0, ExportTypeId, input)
+	assert.Error(t, err, "checkpoint of other chat")
+	_, err = loadExportCheckpoint(path, true, 1, 3, ExportTypeId, input)
+	assert.Error(t, err, "checkpoint of other thread")
+	_, err = loadExportCheckpoint(path, true, 1, 0, ExportTypeTime, input)
+	assert.Error(t, err, "checkpoint of other type")
+	_, err = loadExportCheckpoint(path, true, 1, 0, ExportTypeId, []int{50, 100})
+	assert.Error(t, err, "checkpoint of other input")
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/expr-lang/expr"
@@ -16,11 +17,15 @@ import (
 	"github.com/gotd/td/telegram/query/messages"
 	"github.com/gotd/td/tg"
 	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/spf13/viper"
 	"go.uber.org/multierr"
 
+	"github.com/iyear/tdl/core/middlewares/takeout"
 	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/tclient"
 	"github.com/iyear/tdl/core/tmedia"
 	"github.com/iyear/tdl/core/util/tutil"
+	"github.com/iyear/tdl/pkg/consts"
 	"github.com/iyear/tdl/pkg/prog"
 	"github.com/iyear/tdl/pkg/texpr"
 )
@@ -38,6 +43,16 @@ type ExportOptions struct {
 	WithContent bool
 	Raw         bool
 	All         bool
+	// Checkpoint is the path of JSON file recording exported message ranges, which is saved when export
+	// returns, including interruptions.
+	Checkpoint string
+	// Continue resumes the interrupted range recorded in Checkpoint, and only fetches messages newer than
+	// completed ranges, and messages of Output are kept. Otherwise, Checkpoint is overwritten.
+	Continue bool
+	// Takeout fetches messages in a takeout session of TakeoutScopes, which has lower flood limits,
+	// and the session is finished when export returns.
+	Takeout       bool
+	TakeoutScopes []string
 }
 
 type Message struct {
@@ -67,11 +82,22 @@ func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts E
 		return nil
 	}
 
+	if opts.Checkpoint != "" && opts.Type == ExportTypeLast {
+		return fmt.Errorf("checkpoint is not supported by export type %s", ExportTypeLast)
+	}
+
 	filter, err := expr.Compile(opts.Filter, expr.AsBool())
 	if err != nil {
 		return fmt.Errorf("failed to compile filter: %w", err)
 	}
 
+	var scopes takeout.Scopes
+	if opts.Takeout {
+		if scopes, err = parseTakeoutScopes(opts.TakeoutScopes); err != nil {
+			return err
+		}
+	}
+
 	var peer peers.Peer
 
 	manager := peers.Options{Storage: storage.NewPeers(kvd)}.Build(c.API())
@@ -88,6 +114,17 @@ func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts E
 	color.Cyan("Occasional suspensions are due to Telegram rate limitations, please wait a moment.")
 	fmt.Println()
 
+	api := c.API()
+	if opts.Takeout {
+		var finish func(success bool) error
+		if api, finish, err = beginTakeout(ctx, c, scopes); err != nil {
+			return err
+		}
+		defer func() {
+			multierr.AppendInto(&rerr, finish(rerr == nil))
+		}()
+	}
+
 	color.Blue("Type: %s | Input: %v", opts.Type, opts.Input)
 
 	pw := prog.New(progress.FormatNumber)
@@ -103,24 +140,71 @@ func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts E
 	var q messages.Query
 	switch {
 	case opts.Thread != 0: // topic messages, reply messages
-		q = query.NewQuery(c.API()).Messages().GetReplies(peer.InputPeer()).MsgID(opts.Thread)
+		q = query.NewQuery(api).Messages().GetReplies(peer.InputPeer()).MsgID(opts.Thread)
 	default: // history
-		q = query.NewQuery(c.API()).Messages().GetHistory(peer.InputPeer())
+		q = query.NewQuery(api).Messages().GetHistory(peer.InputPeer())
+	}
+	// iterators are resumed from the last message after transient disconnects
+	timeout := viper.GetDuration(consts.FlagReconnectTimeout)
+	latest := func() msgIter {
+		return tclient.NewResumableIter(func(offsetID int) tclient.MessageIter {
+			iter := messages.NewIterator(q, 100)
+			if offsetID != 0 {
+				return iter.OffsetID(offsetID)
+			}
+
+			switch opts.Type {
+			case ExportTypeTime:
+				iter = iter.OffsetDate(opts.Input[1] + 1)
+			case ExportTypeId:
+				iter = iter.OffsetID(opts.Input[1] + 1) // #89: retain the last msg id
+			case ExportTypeLast:
+			}
+			return iter
+		}, timeout)
+	}
+	resume := func(offsetID int) msgIter {
+		return tclient.NewResumableIter(func(last int) tclient.MessageIter {
+			if last != 0 {
+				offsetID = last
+			}
+			return messages.NewIterator(q, 100).OffsetID(offsetID)
+		}, timeout)
+	}
+
+	// checkpoint without path is never saved, so the whole range is exported
+	cp, err := loadExportCheckpoint(opts.Checkpoint, opts.Checkpoint != "" && opts.Continue,
+		peer.ID(), opts.Thread, opts.Type, opts.Input)
+	if err != nil {
+		return err
+	}
+	if opts.Checkpoint != "" {
+		defer func() {
+			multierr.AppendInto(&rerr, cp.save(opts.Checkpoint))
+		}()
 	}
-	iter := messages.NewIterator(q, 100)
 
-	switch opts.Type {
-	case ExportTypeTime:
-		iter = iter.OffsetDate(opts.Input[1] + 1)
-	case ExportTypeId:
-		iter = iter.OffsetID(opts.Input[1] + 1) // #89: retain the last msg id
-	case ExportTypeLast:
+	var kept []json.RawMessage
+	if opts.Checkpoint != "" && opts.Continue {
+		if kept, err = readExported(opts.Output); err != nil {
+			return err
+		}
 	}
 
-	f, err := os.Create(opts.Output)
+	// write to temp file and replace output when done, so that kept messages are never lost by truncating
+	f, err := os.CreateTemp(filepath.Dir(opts.Output), filepath.Base(opts.Output)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err := os.Chmod(f.Name(), 0o644); err != nil {
+			multierr.AppendInto(&rerr, fmt.Errorf("failed to chmod output: %w", err))
+		}
+		if err := os.Rename(f.Name(), opts.Output); err != nil {
+			_ = os.Remove(f.Name())
+			multierr.AppendInto(&rerr, fmt.Errorf("failed to replace output: %w", err))
+		}
+	}()
 	defer multierr.AppendInvoke(&rerr, multierr.Close(f))
 
 	enc := jx.NewStreamingEncoder(f, 512)
@@ -149,42 +233,25 @@ func Export(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts E
 	enc.ArrStart()
 	defer enc.ArrEnd()
 
-	count := int64(0)
+	for _, m := range kept {
+		enc.Raw(m)
+	}
 
-loop:
-	for iter.Next(ctx) {
-		msg := iter.Value()
-		switch opts.Type {
-		case ExportTypeTime:
-			if msg.Msg.GetDate() < opts.Input[0] {
-				break loop
-			}
-		case ExportTypeId:
-			if msg.Msg.GetID() < opts.Input[0] {
-				break loop
-			}
-		case ExportTypeLast:
-			if count >= int64(opts.Input[0]) {
-				break loop
-			}
-		}
+	count := int64(0)
 
-		m, ok := msg.Msg.(*tg.Message)
-		if !ok {
-			continue
-		}
+	export := func(m *tg.Message) (bool, error) {
 		// only get media messages
 		media, ok := tmedia.GetMedia(m)
 		if !ok && !opts.All {
-			continue
+			return false, nil
 		}
 
 		b, err := texpr.Run(filter, texpr.ConvertEnvMessage(m))
 		if err != nil {
-			return fmt.Errorf("failed to run filter: %w", err)
+			return false, fmt.Errorf("failed to run filter: %w", err)
 		}
 		if !b.(bool) { // filtered
-			continue
+			return false, nil
 		}
 
 		fileName := ""
@@ -206,15 +273,17 @@ loop:
 
 		mb, err := json.Marshal(t)
 		if err != nil {
-			return fmt.Errorf("failed to marshal message: %w", err)
+			return false, fmt.Errorf("failed to marshal message: %w", err)
 		}
 		enc.Raw(mb)
 
 		count++
 		tracker.SetValue(count)
+		return true, nil
 	}
 
-	if err = iter.Err(); err != nil {
+	e := &exporter{opts: opts, cp: cp, export: export}
+	if err = e.run(ctx, resume, latest); err != nil {
 		return err
 	}
 
@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/middlewares/takeout"
+)
+
+// takeoutRetryInterval is the interval of retrying takeout init after TAKEOUT_INIT_DELAY,
+// as user may confirm the export in official apps at any time
+const takeoutRetryInterval = time.Minute
+
+// takeoutFinishTimeout is the timeout of finishing takeout session, which is also done after interruptions
+const takeoutFinishTimeout = 10 * time.Second
+
+// TakeoutScopes are names of takeout scopes accepted by ExportOptions.TakeoutScopes.
+var TakeoutScopes = []string{"contacts", "users", "chats", "megagroups", "channels", "files"}
+
+// DefaultTakeoutScopes are scopes of messages of all kinds of chats, which are enough for export.
+var DefaultTakeoutScopes = []string{"users", "chats", "megagroups", "channels"}
+
+func parseTakeoutScopes(names []string) (takeout.Scopes, error) {
+	scopes := takeout.Scopes{}
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "contacts":
+			scopes.Contacts = true
+		case "users":
+			scopes.MessageUsers = true
+		case "chats":
+			scopes.MessageChats = true
+		case "megagroups":
+			scopes.MessageMegagroups = true
+		case "channels":
+			scopes.MessageChannels = true
+		case "files":
+			scopes.Files, scopes.FileMaxSize = true, takeout.DefaultScopes.FileMaxSize
+		default:
+			return takeout.Scopes{}, errors.Errorf("unknown takeout scope %q, must be one of %s",
+				name, strings.Join(TakeoutScopes, ", "))
+		}
+	}
+	if scopes == (takeout.Scopes{}) {
+		return takeout.Scopes{}, errors.New("no takeout scope")
+	}
+	return scopes, nil
+}
+
+// beginTakeout initializes takeout session of scopes, and returns client whose requests are invoked in the session.
+// finish must be called to finish the session, with whether the export is completed.
+func beginTakeout(ctx context.Context, invoker tg.Invoker, scopes takeout.Scopes) (_ *tg.Client, finish func(success bool) error, _ error) {
+	id, err := takeout.InitWait(ctx, invoker, scopes, takeoutRetryInterval, func(delay time.Duration) {
+		color.Yellow("WARN: Telegram delays takeout session for %s, confirm the data export request in official apps, "+
+			"and it will be retried every %s", delay, takeoutRetryInterval)
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "init takeout session")
+	}
+	logctx.From(ctx).Info("Init takeout session", zap.Int64("id", id))
+
+	api := tg.NewClient(takeout.Middleware(id).Handle(invoker))
+	return api, func(success bool) error {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), takeoutFinishTimeout)
+		defer cancel()
+
+		if err := takeout.Finish(ctx, api.Invoker(), success); err != nil {
+			return errors.Wrap(err, "finish takeout session")
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/core/middlewares/takeout"
+)
+
+func TestParseTakeoutScopes(t *testing.T) {
+	scopes, err := parseTakeoutScopes(DefaultTakeoutScopes)
+	require.NoError(t, err)
+	assert.Equal(t, takeout.Scopes{
+		MessageUsers:      true,
+		MessageChats:      true,
+		MessageMegagroups: true,
+		MessageChannels:   true,
+	}, scopes)
+
+	scopes, err = parseTakeoutScopes([]string{" Files", "contacts"})
+	require.NoError(t, err)
+	assert.True(t, scopes.Files && scopes.Contacts)
+	assert.Equal(t, takeout.DefaultScopes.FileMaxSize, scopes.FileMaxSize)
+
+	_, err = parseTakeoutScopes([]string{"stickers"})
+	assert.Error(t, err)
+	_, err = parseTakeoutScopes(nil)
+	assert.Error(t, err)
+}
+
+// takeoutInvoker accepts takeout session requests, and records requests invoked in takeout session
+type takeoutInvoker struct {
+	wrapped  []string
+	finished *tg.AccountFinishTakeoutSessionRequest
+}
+
+func (i *takeoutInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	switch req := input.(type) {
+	case *tg.AccountInitTakeoutSessionRequest:
+		*output.(*tg.AccountTakeout) = tg.AccountTakeout{ID: 7}
+		return nil
+	case *tg.InvokeWithTakeoutRequest:
+		if req.TakeoutID != 7 {
+			return tgerr.New(400, "TAKEOUT_INVALID")
+		}
+
+		// nopDecoder of takeout middleware embeds the original request
+		buf := &bin.Buffer{}
+		if err := req.Query.Encode(buf); err != nil {
+			return err
+		}
+		id, err := buf.PeekID()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case tg.AccountFinishTakeoutSessionRequestTypeID:
+			i.finished = &tg.AccountFinishTakeoutSessionRequest{}
+			if err = i.finished.Decode(buf); err != nil {
+				return err
+			}
+			i.wrapped = append(i.wrapped, "finish")
+			res := &bin.Buffer{}
+			res.PutID(tg.BoolTrueTypeID)
+			return output.Decode(res)
+		case tg.HelpGetConfigRequestTypeID:
+			i.wrapped = append(i.wrapped, "config")
+			return nil
+		}
+	}
+	return tgerr.New(400, "METHOD_INVALID")
+}
+
+func TestBeginTakeout(t *testing.T) {
+	ctx := context.Background()
+	inv := &takeoutInvoker{}
+
+	api, finish, err := beginTakeout(ctx, inv, takeout.Scopes{MessageChannels: true})
+	require.NoError(t, err)
+
+	require.NoError(t, api.Invoker().Invoke(ctx, &tg.HelpGetConfigRequest{}, &tg.Config{}))
+	require.NoError(t, finish(false))
+
+	assert.Equal(t, []string{"config", "finish"}, inv.wrapped)
+	require.NotNil(t, inv.finished)
+	assert.False(t, inv.finished.Success)
+}
@@ -0,0 +1,298 @@
+package dl
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+	"go.uber.org/multierr"
+
+	"github.com/iyear/tdl/core/util/fsutil"
+	"github.com/iyear/tdl/pkg/splitfile"
+)
+
+// Modes of handling duplicate media found by dedup store.
+const (
+	// DedupSkip skips duplicate media, so that they are not written again.
+	DedupSkip = "skip"
+	// DedupHardlink hard-links existing files to destinations, which costs no disk space.
+	DedupHardlink = "hardlink"
+	// DedupCopy copies existing files to destinations, which works across file systems.
+	DedupCopy = "copy"
+)
+
+// DedupModes are accepted values of Options.DedupMode.
+var DedupModes = []string{DedupSkip, DedupHardlink, DedupCopy}
+
+// dedupData is the persisted content of dedup store
+type dedupData struct {
+	Media map[string]string `json:"media"` // media key -> hex sha256 of content
+	Files map[string]string `json:"files"` // hex sha256 of content -> absolute path of the first downloaded file
+}
+
+// dedupSaveBatch is the number of records which are saved to dedup store together, so that
+// the whole store is not rewritten for each downloaded file
+const dedupSaveBatch = 100
+
+// dedupStore indexes downloaded files by content hash across runs. Media known by the store are not
+// downloaded again, and downloaded files whose content already exists are handled by mode.
+type dedupStore struct {
+	path string
+	mode string
+
+	mu      sync.Mutex
+	data    dedupData
+	unsaved int // number of records which are not saved yet
+}
+
+func loadDedup(path, mode string) (*dedupStore, error) {
+	switch mode {
+	case DedupSkip, DedupHardlink, DedupCopy:
+	default:
+		return nil, errors.Errorf("unknown dedup mode %q, must be one of %v", mode, DedupModes)
+	}
+
+	d := &dedupStore{path: path, mode: mode, data: dedupData{
+		Media: make(map[string]string),
+		Files: make(map[string]string),
+	}}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return d, nil
+		}
+		return nil, errors.Wrap(err, "read dedup store")
+	}
+	if err = json.Unmarshal(b, &d.data); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal dedup store %s", path)
+	}
+	// stores written by older versions may miss fields
+	if d.data.Media == nil {
+		d.data.Media = make(map[string]string)
+	}
+	if d.data.Files == nil {
+		d.data.Files = make(map[string]string)
+	}
+
+	return d, nil
+}
+
+// lookup returns existing file of media key with size, and stale entries of which files are removed
+// or changed on disk are ignored.
+func (d *dedupStore) lookup(key string, size int64) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	d.mu.Lock()
+	path, ok := d.data.Files[d.data.Media[key]]
+	d.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	if stat, err := os.Stat(path); err != nil || !stat.Mode().IsRegular() || stat.Size() != size {
+		return "", false
+	}
+	return path, true
+}
+
+// modeOf returns mode of handling duplicates of file name. Parts and indexes of split files are never
+// skipped, as they are reassembled and removed in place.
+func (d *dedupStore) modeOf(name string) string {
+	if d.mode == DedupSkip && (splitfile.IsPart(name) || splitfile.IsIndex(name)) {
+		return DedupCopy
+	}
+	return d.mode
+}
+
+// reuse handles known media of file name of existing file for dst by mode, and reports whether dst is kept,
+// i.e. it's not skipped. dst is written to a temp file and renamed like downloads, so that existing dst is overwritten.
+func (d *dedupStore) reuse(existing, dst, name string) (bool, error) {
+	mode := d.modeOf(name)
+	if mode == DedupSkip {
+		return false, nil
+	}
+	if sameFile(existing, dst) {
+		return true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return false, errors.Wrap(err, "create dir")
+	}
+	tmp := dst + tempExt
+	// leftover may be a link of existing file, which must not be truncated by copying
+	_ = os.Remove(tmp)
+
+	switch mode {
+	case DedupHardlink:
+		if err := linkOrCopy(existing, tmp); err != nil {
+			return false, errors.Wrapf(err, "link or copy %s", existing)
+		}
+	case DedupCopy:
+		if err := copyFile(existing, tmp); err != nil {
+			_ = os.Remove(tmp)
+			return false, errors.Wrapf(err, "copy %s", existing)
+		}
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		return false, errors.Wrap(err, "rename file")
+	}
+	return true, nil
+}
+
+// record indexes downloaded file name of media key at path by its content. If the same content is already
+// indexed by another existing file, it's returned, and path is handled by mode, e.g. reposted media
+// which are uploaded again with other keys.
+func (d *dedupStore) record(key, path, name string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	hash, err := fsutil.HashFile(abs)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	existing, ok := d.data.Files[hash]
+	if ok && existing != abs {
+		if _, serr := os.Stat(existing); serr != nil {
+			ok = false // stale entry is replaced
+		}
+	}
+	if !ok {
+		d.data.Files[hash] = abs
+	}
+	if key != "" {
+		d.data.Media[key] = hash
+	}
+	if d.unsaved++; d.unsaved >= dedupSaveBatch {
+		err = d.save()
+	}
+	d.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	if !ok || existing == abs {
+		return "", nil
+	}
+	return existing, d.replace(existing, abs, name)
+}
+
+// replace handles downloaded duplicate of existing file at path by mode
+func (d *dedupStore) replace(existing, path, name string) error {
+	switch d.modeOf(name) {
+	case DedupSkip:
+		return os.Remove(path)
+	case DedupHardlink:
+		// link to a temp name first, so that path is kept if linking fails, which is the same as a copy
+		tmp := path + tempExt
+		_ = os.Remove(tmp) // leftover of interrupted runs
+		if err := os.Link(existing, tmp); err != nil {
+			return nil
+		}
+		return os.Rename(tmp, path)
+	default:
+		return nil
+	}
+}
+
+// flush saves records which are not saved yet, and it's called when download is done
+func (d *dedupStore) flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.unsaved == 0 {
+		return nil
+	}
+	return d.save()
+}
+
+// save writes store to a temp file and renames it to avoid corruption on interruption, mu must be held
+func (d *dedupStore) save() error {
+	b, err := json.Marshal(d.data)
+	if err != nil {
+		return errors.Wrap(err, "marshal dedup store")
+	}
+
+	tmp := d.path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0o644); err != nil {
+		return errors.Wrap(err, "write dedup store")
+	}
+	if err = os.Rename(tmp, d.path); err != nil {
+		return errors.Wrap(err, "rename dedup store")
+	}
+	d.unsaved = 0
+	return nil
+}
+
+// mediaKey identifies media by Telegram, which is the same for forwarded or reposted media,
+// and empty is returned for unknown media.
+func mediaKey(m tg.MessageMediaClass) string {
+	switch m := m.(type) {
+	case *tg.MessageMediaDocument:
+		if doc, ok := m.Document.(*tg.Document); ok {
+			return "document:" + strconv.FormatInt(doc.ID, 10)
+		}
+	case *tg.MessageMediaPhoto:
+		if photo, ok := m.Photo.(*tg.Photo); ok {
+			return "photo:" + strconv.FormatInt(photo.ID, 10)
+		}
+	case *tg.MessageMediaInvoice:
+		if em, ok := m.ExtendedMedia.(*tg.MessageExtendedMedia); ok {
+			return mediaKey(em.Media)
+		}
+	}
+	return ""
+}
+
+func sameFile(a, b string) bool {
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	sb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(sa, sb)
+}
+
+// linkOrCopy hard-links src to dst, and copies it if linking fails, e.g. across file systems
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func copyFile(src, dst string) (rerr error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(in))
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(out))
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,180 @@
+package dl
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaKey(t *testing.T) {
+	assert.Equal(t, "document:1", mediaKey(&tg.MessageMediaDocument{Document: &tg.Document{ID: 1}}))
+	assert.Equal(t, "photo:2", mediaKey(&tg.MessageMediaPhoto{Photo: &tg.Photo{ID: 2}}))
+	assert.Equal(t, "document:3", mediaKey(&tg.MessageMediaInvoice{
+		ExtendedMedia: &tg.MessageExtendedMedia{Media: &tg.MessageMediaDocument{Document: &tg.Document{ID: 3}}},
+	}))
+	assert.Empty(t, mediaKey(&tg.MessageMediaDocument{Document: &tg.DocumentEmpty{}}))
+	assert.Empty(t, mediaKey(nil))
+}
+
+func TestLoadDedup_Mode(t *testing.T) {
+	_, err := loadDedup(filepath.Join(t.TempDir(), "dedup.json"), "move")
+	assert.Error(t, err)
+}
+
+func TestDedupStore(t *testing.T) {
+	for _, mode := range DedupModes {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			store := filepath.Join(dir, "dedup.json")
+			first := filepath.Join(dir, "a", "first.jpg")
+			require.NoError(t, os.MkdirAll(filepath.Dir(first), 0o755))
+			require.NoError(t, os.WriteFile(first, []byte("image"), 0o644))
+
+			d, err := loadDedup(store, mode)
+			require.NoError(t, err)
+			_, ok := d.lookup("photo:1", 5)
+			assert.False(t, ok, "unknown media is downloaded")
+
+			existing, err := d.record("photo:1", first, "first.jpg")
+			require.NoError(t, err)
+			assert.Empty(t, existing)
+
+			// index is persisted across runs
+			require.NoError(t, d.flush())
+			d, err = loadDedup(store, mode)
+			require.NoError(t, err)
+
+			_, ok = d.lookup("photo:1", 6)
+			assert.False(t, ok, "changed file is not reused")
+			existing, ok = d.lookup("photo:1", 5)
+			require.True(t, ok)
+			abs, _ := filepath.Abs(first)
+			assert.Equal(t, abs, existing)
+
+			// known media of another message
+			dst := filepath.Join(dir, "b", "repost.jpg")
+			written, err := d.reuse(existing, dst, "repost.jpg")
+			require.NoError(t, err)
+			assert.Equal(t, mode != DedupSkip, written)
+			if written {
+				b, err := os.ReadFile(dst)
+				require.NoError(t, err)
+				assert.Equal(t, "image", string(b))
+				assert.Equal(t, mode == DedupHardlink, sameFile(first, dst))
+			} else {
+				assert.NoFileExists(t, dst)
+			}
+
+			written, err = d.reuse(existing, first, "first.jpg")
+			require.NoError(t, err)
+			assert.Equal(t, mode != DedupSkip, written, "existing file itself is kept")
+			assert.FileExists(t, first)
+
+			// same content downloaded by other media
+			dup := filepath.Join(dir, "c", "dup.jpg")
+			require.NoError(t, os.MkdirAll(filepath.Dir(dup), 0o755))
+			require.NoError(t, os.WriteFile(dup, []byte("image"), 0o644))
+			existing, err = d.record("document:2", dup, "dup.jpg")
+			require.NoError(t, err)
+			assert.Equal(t, abs, existing)
+			switch mode {
+			case DedupSkip:
+				assert.NoFileExists(t, dup)
+			case DedupHardlink:
+				assert.True(t, sameFile(first, dup))
+			case DedupCopy:
+				assert.FileExists(t, dup)
+				assert.False(t, sameFile(first, dup))
+			}
+			_, ok = d.lookup("document:2", 5)
+			assert.True(t, ok, "other media of the same content are known")
+
+			// stale entry is ignored and replaced
+			require.NoError(t, os.Remove(first))
+			_, ok = d.lookup("photo:1", 5)
+			assert.False(t, ok)
+
+			again := filepath.Join(dir, "again.jpg")
+			require.NoError(t, os.WriteFile(again, []byte("image"), 0o644))
+			existing, err = d.record("photo:1", again, "again.jpg")
+			require.NoError(t, err)
+			assert.Empty(t, existing)
+			_, ok = d.lookup("photo:1", 5)
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestDedupStore_SplitParts(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a", "big.bin.part001")
+	require.NoError(t, os.MkdirAll(filepath.Dir(first), 0o755))
+	require.NoError(t, os.WriteFile(first, []byte("part"), 0o644))
+
+	d, err := loadDedup(filepath.Join(dir, "dedup.json"), DedupSkip)
+	require.NoError(t, err)
+	_, err = d.record("document:1", first, "big.bin.part001")
+	require.NoError(t, err)
+
+	// parts are never skipped, so that they can be reassembled in place
+	dst := filepath.Join(dir, "b", "big.bin.part001")
+	written, err := d.reuse(first, dst, "big.bin.part001")
+	require.NoError(t, err)
+	assert.True(t, written)
+	assert.FileExists(t, dst)
+
+	dup := filepath.Join(dir, "c", "big.bin.index.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dup), 0o755))
+	require.NoError(t, os.WriteFile(dup, []byte("part"), 0o644))
+	_, err = d.record("document:2", dup, "big.bin.index.json")
+	require.NoError(t, err)
+	assert.FileExists(t, dup)
+}
+
+func TestDedupStore_LinkLeftover(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "first.jpg")
+	require.NoError(t, os.WriteFile(existing, []byte("image"), 0o644))
+
+	d, err := loadDedup(filepath.Join(dir, "dedup.json"), DedupHardlink)
+	require.NoError(t, err)
+
+	// leftover temp file of interrupted run doesn't fail linking
+	dst := filepath.Join(dir, "repost.jpg")
+	require.NoError(t, os.WriteFile(dst+tempExt, []byte("partial"), 0o644))
+	written, err := d.reuse(existing, dst, "repost.jpg")
+	require.NoError(t, err)
+	assert.True(t, written)
+	assert.True(t, sameFile(existing, dst))
+	assert.NoFileExists(t, dst+tempExt)
+}
+
+func TestDedupStore_SaveBatch(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "dedup.json")
+
+	d, err := loadDedup(store, DedupCopy)
+	require.NoError(t, err)
+
+	for i := 0; i < dedupSaveBatch+1; i++ {
+		path := filepath.Join(dir, strconv.Itoa(i))
+		require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(i)), 0o644))
+		_, err = d.record("document:"+strconv.Itoa(i), path, strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+
+	// only full batches are saved until flush
+	loaded, err := loadDedup(store, DedupCopy)
+	require.NoError(t, err)
+	assert.Len(t, loaded.data.Media, dedupSaveBatch)
+
+	require.NoError(t, d.flush())
+	loaded, err = loadDedup(store, DedupCopy)
+	require.NoError(t, err)
+	assert.Len(t, loaded.data.Media, dedupSaveBatch+1)
+}
@@ -0,0 +1,74 @@
+package dl
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/flytam/filenamify"
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/pkg/tplfunc"
+)
+
+// ValidateDirTemplate reports errors of DirTemplate of Options, so that they fail before connecting.
+func ValidateDirTemplate(text string) error {
+	_, err := newDirTemplate(text)
+	return err
+}
+
+// newDirTemplate parses template of output dirs, and nil is returned for empty text. It's executed with
+// zero fields, so that unknown fields are reported before downloading.
+func newDirTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	tpl, err := template.New("dir").
+		Funcs(tplfunc.FuncMap(tplfunc.All...)).
+		Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse dir template")
+	}
+	if err = tpl.Execute(&bytes.Buffer{}, &fileTemplate{Date: time.Unix(0, 0)}); err != nil {
+		return nil, errors.Wrap(err, "validate dir template")
+	}
+
+	return tpl, nil
+}
+
+// execDirTemplate returns the relative output dir of data, and empty tpl means no dir
+func execDirTemplate(tpl *template.Template, data *fileTemplate) (string, error) {
+	if tpl == nil {
+		return "", nil
+	}
+
+	buf := bytes.Buffer{}
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrap(err, "execute dir template")
+	}
+	return sanitizeDir(buf.String()), nil
+}
+
+// sanitizeDir makes each component of p a valid file name, and drops empty, "." and ".." components,
+// so that p is always relative and can't escape the download dir.
+func sanitizeDir(p string) string {
+	parts := strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' })
+
+	r := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		name, err := filenamify.FilenamifyV2(part)
+		if err != nil || name == "" || name == "." || name == ".." {
+			continue
+		}
+		r = append(r, name)
+	}
+
+	return filepath.Join(r...)
+}
@@ -0,0 +1,51 @@
+package dl
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeDir(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"chat/2024-01", filepath.Join("chat", "2024-01")},
+		{"/etc/passwd", filepath.Join("etc", "passwd")},
+		{"../../secret", "secret"},
+		{`a\..\b`, filepath.Join("a", "b")},
+		{" a /./ b ", filepath.Join("a", "b")},
+		{"c:/x", filepath.Join("c", "x")},
+		{"a:b*c", "a!b!c"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sanitizeDir(tt.in), tt.in)
+	}
+}
+
+func TestDirTemplate(t *testing.T) {
+	tpl, err := newDirTemplate("")
+	require.NoError(t, err)
+	assert.Nil(t, tpl)
+	dir, err := execDirTemplate(tpl, &fileTemplate{})
+	require.NoError(t, err)
+	assert.Empty(t, dir)
+
+	assert.Error(t, ValidateDirTemplate("{{ .ChatTitle "))
+	assert.Error(t, ValidateDirTemplate("{{ .Unknown }}"), "unknown fields are reported before executing per message")
+
+	tpl, err = newDirTemplate(`{{ .ChatTitle }}/{{ .Date.Format "2006/01" }}/{{ .SenderID }}`)
+	require.NoError(t, err)
+	dir, err = execDirTemplate(tpl, &fileTemplate{
+		ChatTitle: "../My: Chat",
+		Date:      time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local),
+		SenderID:  42,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("My! Chat", "2024", "03", "42"), dir)
+}
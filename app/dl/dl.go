@@ -19,6 +19,7 @@ import (
 	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/storage"
 	"github.com/iyear/tdl/core/tclient"
+	"github.com/iyear/tdl/core/util/bandwidth"
 	"github.com/iyear/tdl/pkg/consts"
 	"github.com/iyear/tdl/pkg/key"
 	"github.com/iyear/tdl/pkg/prog"
@@ -38,6 +39,26 @@ type Options struct {
 	Desc       bool
 	Takeout    bool
 	Group      bool // auto detect grouped message
+	Verify     bool
+	// DirTemplate is the text/template of output dirs relative to Dir per message, e.g.
+	// '{{ .ChatTitle }}/{{ .Date.Format "2006-01" }}'. Components are sanitized, and empty means Dir itself.
+	DirTemplate string
+	// PreserveTime sets modification time of downloaded files to the date of media or message
+	PreserveTime bool
+	// Dedup is the path of local store indexing downloaded files by content hash across runs, and media
+	// known by the store are not downloaded again but handled by DedupMode(one of DedupModes). Empty means disabled.
+	Dedup     string
+	DedupMode string
+	// Reassemble joins parts of split files uploaded by up with SplitSize after download, by their downloaded indexes
+	Reassemble bool
+
+	// media filters, zero sizes mean no limit
+	IncludeMedia, ExcludeMedia []string
+	MinSize, MaxSize           int64
+
+	// requests limit of each DC, zero means unlimited
+	DCConcurrency int
+	DCRate        float64
 
 	// resume opts
 	Continue, Restart bool
@@ -53,9 +74,24 @@ type parser struct {
 }
 
 func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Options) (rerr error) {
-	pool := dcpool.NewPool(c,
-		int64(viper.GetInt(consts.FlagPoolSize)),
-		tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout))...)
+	// fail fast before collecting messages
+	var dedup *dedupStore
+	if opts.Dedup != "" {
+		var err error
+		if dedup, err = loadDedup(opts.Dedup, opts.DedupMode); err != nil {
+			return err
+		}
+		defer multierr.AppendInvoke(&rerr, multierr.Invoke(dedup.flush))
+	}
+
+	pool, err := dcpool.NewPoolWithOptions(c, dcpool.Options{
+		PerDC:       int64(viper.GetInt(consts.FlagPoolSize)),
+		MaxConns:    int64(viper.GetInt(consts.FlagMaxConns)),
+		Middlewares: tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout)),
+	})
+	if err != nil {
+		return errors.Wrap(err, "create pool")
+	}
 	defer multierr.AppendInvoke(&rerr, multierr.Close(pool))
 
 	parsers := []parser{
@@ -75,7 +111,12 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 
 	manager := peers.Options{Storage: storage.NewPeers(kvd)}.Build(pool.Default(ctx))
 
-	it, err := newIter(pool, manager, dialogs, opts, viper.GetDuration(consts.FlagDelay))
+	var ra *reassembler
+	if opts.Reassemble {
+		ra = newReassembler()
+	}
+
+	it, err := newIter(pool, manager, dialogs, opts, dedup, ra, viper.GetDuration(consts.FlagDelay))
 	if err != nil {
 		return err
 	}
@@ -101,11 +142,20 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 	dlProgress.SetNumTrackersExpected(it.Total())
 	prog.EnablePS(ctx, dlProgress)
 
+	bw, err := utils.Byte.ParseBinaryBytes(viper.GetString(consts.FlagBandwidth))
+	if err != nil {
+		return errors.Wrap(err, "parse bandwidth")
+	}
+
 	options := downloader.Options{
 		Pool:     pool,
 		Threads:  viper.GetInt(consts.FlagThreads),
 		Iter:     it,
-		Progress: newProgress(dlProgress, it, opts),
+		Progress: newProgress(dlProgress, it, ra, dedup, opts),
+		Limiter:  bandwidth.New(bw),
+		Verify:   opts.Verify,
+
+		DCLimiter: downloader.NewDCLimiter(nil, downloader.DCLimit{Concurrency: opts.DCConcurrency, Rate: opts.DCRate}),
 	}
 	limit := viper.GetInt(consts.FlagLimit)
 
@@ -113,15 +163,23 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		zap.String("dir", opts.Dir),
 		zap.Bool("rewrite_ext", opts.RewriteExt),
 		zap.Bool("skip_same", opts.SkipSame),
+		zap.Bool("verify", opts.Verify),
+		zap.Bool("preserve_time", opts.PreserveTime),
+		zap.String("dedup", opts.Dedup),
 		zap.Int("threads", options.Threads),
 		zap.Int("limit", limit))
 
 	color.Green("All files will be downloaded to '%s' dir", opts.Dir)
 
 	go dlProgress.Render()
-	defer prog.Wait(ctx, dlProgress)
+	err = downloader.New(options).Download(ctx, limit)
+	prog.Wait(ctx, dlProgress)
 
-	return downloader.New(options).Download(ctx, limit)
+	// split files of which all parts are downloaded are still reassembled after failures of others
+	if ra != nil && !errors.Is(err, context.Canceled) {
+		multierr.AppendInto(&err, ra.reassemble())
+	}
+	return err
 }
 
 func collectDialogs(parsers []parser) ([][]*tmessage.Dialog, error) {
@@ -0,0 +1,125 @@
+package dl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/util/mediautil"
+)
+
+// media categories of messages
+const (
+	mediaPhoto    = "photo"
+	mediaVideo    = "video"
+	mediaAudio    = "audio"
+	mediaDocument = "document"
+)
+
+var mediaCategories = []string{mediaPhoto, mediaVideo, mediaAudio, mediaDocument}
+
+// mediaFilter filters messages by media category and file size, like include and exclude of file extensions
+type mediaFilter struct {
+	include map[string]struct{}
+	exclude map[string]struct{}
+	minSize int64 // zero means no limit
+	maxSize int64 // zero means no limit
+}
+
+// newMediaFilter returns nil if no filter is specified, and nil filter matches all messages
+func newMediaFilter(opts Options) (*mediaFilter, error) {
+	if len(opts.IncludeMedia) == 0 && len(opts.ExcludeMedia) == 0 && opts.MinSize <= 0 && opts.MaxSize <= 0 {
+		return nil, nil
+	}
+	if opts.MinSize > 0 && opts.MaxSize > 0 && opts.MinSize > opts.MaxSize {
+		return nil, fmt.Errorf("min size %d is larger than max size %d", opts.MinSize, opts.MaxSize)
+	}
+
+	toMap := func(categories []string) (map[string]struct{}, error) {
+		m := make(map[string]struct{}, len(categories))
+		for _, c := range categories {
+			c = strings.ToLower(strings.TrimSpace(c))
+			if !isMediaCategory(c) {
+				return nil, fmt.Errorf("invalid media category %q, available: %s", c, strings.Join(mediaCategories, ", "))
+			}
+			m[c] = struct{}{}
+		}
+		return m, nil
+	}
+
+	in, err := toMap(opts.IncludeMedia)
+	if err != nil {
+		return nil, err
+	}
+	ex, err := toMap(opts.ExcludeMedia)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mediaFilter{
+		include: in,
+		exclude: ex,
+		minSize: max(opts.MinSize, 0),
+		maxSize: max(opts.MaxSize, 0),
+	}, nil
+}
+
+// match reports whether media of size should be downloaded
+func (m *mediaFilter) match(media tg.MessageMediaClass, size int64) bool {
+	if m == nil {
+		return true
+	}
+
+	if m.minSize > 0 && size < m.minSize || m.maxSize > 0 && size > m.maxSize {
+		return false
+	}
+
+	c := mediaCategory(media)
+	if len(m.include) > 0 {
+		if _, ok := m.include[c]; !ok {
+			return false
+		}
+	}
+	if _, ok := m.exclude[c]; ok {
+		return false
+	}
+
+	return true
+}
+
+// mediaCategory returns category of media by its type and MIME, other documents
+// (e.g. archives, stickers, images sent as files) are mediaDocument
+func mediaCategory(media tg.MessageMediaClass) string {
+	switch m := media.(type) {
+	case *tg.MessageMediaPhoto:
+		return mediaPhoto
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return mediaDocument
+		}
+		switch {
+		case mediautil.IsVideo(doc.MimeType):
+			return mediaVideo
+		case mediautil.IsAudio(doc.MimeType):
+			return mediaAudio
+		default:
+			return mediaDocument
+		}
+	case *tg.MessageMediaInvoice:
+		if em, ok := m.ExtendedMedia.(*tg.MessageExtendedMedia); ok {
+			return mediaCategory(em.Media)
+		}
+	}
+	return mediaDocument
+}
+
+func isMediaCategory(c string) bool {
+	for _, category := range mediaCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package dl
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	photoMedia    = &tg.MessageMediaPhoto{Photo: &tg.Photo{}}
+	videoMedia    = &tg.MessageMediaDocument{Document: &tg.Document{MimeType: "video/mp4"}}
+	audioMedia    = &tg.MessageMediaDocument{Document: &tg.Document{MimeType: "audio/mpeg"}}
+	documentMedia = &tg.MessageMediaDocument{Document: &tg.Document{MimeType: "application/zip"}}
+	paidMedia     = &tg.MessageMediaInvoice{ExtendedMedia: &tg.MessageExtendedMedia{Media: videoMedia}}
+)
+
+func TestMediaCategory(t *testing.T) {
+	assert.Equal(t, mediaPhoto, mediaCategory(photoMedia))
+	assert.Equal(t, mediaVideo, mediaCategory(videoMedia))
+	assert.Equal(t, mediaAudio, mediaCategory(audioMedia))
+	assert.Equal(t, mediaDocument, mediaCategory(documentMedia))
+	assert.Equal(t, mediaDocument, mediaCategory(&tg.MessageMediaDocument{Document: &tg.DocumentEmpty{}}))
+	assert.Equal(t, mediaVideo, mediaCategory(paidMedia))
+}
+
+func TestMediaFilter_Media(t *testing.T) {
+	f, err := newMediaFilter(Options{IncludeMedia: []string{" Photo", "video"}})
+	require.NoError(t, err)
+	assert.True(t, f.match(photoMedia, 1))
+	assert.True(t, f.match(videoMedia, 1))
+	assert.True(t, f.match(paidMedia, 1))
+	assert.False(t, f.match(audioMedia, 1))
+	assert.False(t, f.match(documentMedia, 1))
+
+	f, err = newMediaFilter(Options{ExcludeMedia: []string{"document"}})
+	require.NoError(t, err)
+	assert.True(t, f.match(photoMedia, 1))
+	assert.False(t, f.match(documentMedia, 1))
+
+	_, err = newMediaFilter(Options{IncludeMedia: []string{"sticker"}})
+	assert.Error(t, err)
+}
+
+func TestMediaFilter_Size(t *testing.T) {
+	f, err := newMediaFilter(Options{IncludeMedia: []string{"document"}, MinSize: 10, MaxSize: 100})
+	require.NoError(t, err)
+	assert.False(t, f.match(documentMedia, 9))
+	assert.True(t, f.match(documentMedia, 10))
+	assert.True(t, f.match(documentMedia, 100))
+	assert.False(t, f.match(documentMedia, 101))
+	assert.False(t, f.match(videoMedia, 50), "both media and size filters apply")
+
+	f, err = newMediaFilter(Options{MinSize: 10})
+	require.NoError(t, err)
+	assert.True(t, f.match(videoMedia, 1<<40), "zero max size means no limit")
+
+	_, err = newMediaFilter(Options{MinSize: 100, MaxSize: 10})
+	assert.Error(t, err)
+}
+
+func TestMediaFilter_Nil(t *testing.T) {
+	f, err := newMediaFilter(Options{})
+	require.NoError(t, err)
+	assert.Nil(t, f)
+	assert.True(t, f.match(audioMedia, 0))
+}
@@ -32,8 +32,11 @@ const tempExt = ".tmp"
 
 type fileTemplate struct {
 	DialogID     int64
+	ChatTitle    string
 	MessageID    int
 	MessageDate  int64
+	Date         time.Time // message date
+	SenderID     int64     // sender of message, which is DialogID if sender is unknown, e.g. channel posts
 	FileName     string
 	FileCaption  string
 	FileSize     string
@@ -45,8 +48,12 @@ type iter struct {
 	manager *peers.Manager
 	dialogs []*tmessage.Dialog
 	tpl     *template.Template
+	dirTpl  *template.Template // nil if output dirs are not templated
 	include map[string]struct{}
 	exclude map[string]struct{}
+	media   *mediaFilter
+	dedup   *dedupStore  // nil if not enabled
+	ra      *reassembler // records reused duplicates, nil if not enabled
 	opts    Options
 	delay   time.Duration
 
@@ -61,7 +68,7 @@ type iter struct {
 }
 
 func newIter(pool dcpool.Pool, manager *peers.Manager, dialog [][]*tmessage.Dialog,
-	opts Options, delay time.Duration,
+	opts Options, dedup *dedupStore, ra *reassembler, delay time.Duration,
 ) (*iter, error) {
 	tpl, err := template.New("dl").
 		Funcs(tplfunc.FuncMap(tplfunc.All...)).
@@ -69,6 +76,10 @@ func newIter(pool dcpool.Pool, manager *peers.Manager, dialog [][]*tmessage.Dial
 	if err != nil {
 		return nil, errors.Wrap(err, "parse template")
 	}
+	dirTpl, err := newDirTemplate(opts.DirTemplate)
+	if err != nil {
+		return nil, err
+	}
 
 	dialogs := flatDialogs(dialog)
 	// if msgs is empty, return error to avoid range out of index
@@ -80,6 +91,11 @@ func newIter(pool dcpool.Pool, manager *peers.Manager, dialog [][]*tmessage.Dial
 	includeMap := filterMap(opts.Include, fsutil.AddPrefixDot)
 	excludeMap := filterMap(opts.Exclude, fsutil.AddPrefixDot)
 
+	media, err := newMediaFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	// to keep fingerprint stable
 	sortDialogs(dialogs, opts.Desc)
 
@@ -90,7 +106,11 @@ func newIter(pool dcpool.Pool, manager *peers.Manager, dialog [][]*tmessage.Dial
 		opts:    opts,
 		include: includeMap,
 		exclude: excludeMap,
+		media:   media,
+		dedup:   dedup,
+		ra:      ra,
 		tpl:     tpl,
+		dirTpl:  dirTpl,
 		delay:   delay,
 
 		mu:          &sync.Mutex{},
@@ -186,24 +206,41 @@ func (i *iter) processSingle(message *tg.Message, from peers.Peer) (bool, bool)
 	if _, ok = i.exclude[ext]; len(i.exclude) > 0 && ok {
 		return false, true
 	}
+	if !i.media.match(message.Media, item.Size) {
+		return false, true
+	}
 
-	toName := bytes.Buffer{}
-	err := i.tpl.Execute(&toName, &fileTemplate{
+	sender := tutil.GetPeerID(message.FromID)
+	if sender == 0 {
+		sender = from.ID()
+	}
+	data := &fileTemplate{
 		DialogID:     from.ID(),
+		ChatTitle:    from.VisibleName(),
 		MessageID:    message.ID,
 		MessageDate:  int64(message.Date),
+		Date:         time.Unix(int64(message.Date), 0),
+		SenderID:     sender,
 		FileName:     item.Name,
 		FileCaption:  message.Message,
 		FileSize:     utils.Byte.FormatBinaryBytes(item.Size),
 		DownloadDate: time.Now().Unix(),
-	})
+	}
+
+	toName := bytes.Buffer{}
+	err := i.tpl.Execute(&toName, data)
 	if err != nil {
 		i.err = errors.Wrap(err, "execute template")
 		return false, false
 	}
+	dir, err := execDirTemplate(i.dirTpl, data)
+	if err != nil {
+		i.err = err
+		return false, false
+	}
 
 	if i.opts.SkipSame {
-		if stat, err := os.Stat(filepath.Join(i.opts.Dir, toName.String())); err == nil {
+		if stat, err := os.Stat(filepath.Join(i.opts.Dir, dir, toName.String())); err == nil {
 			if fsutil.GetNameWithoutExt(toName.String()) == fsutil.GetNameWithoutExt(stat.Name()) &&
 				stat.Size() == item.Size {
 				return false, true
@@ -211,8 +248,24 @@ func (i *iter) processSingle(message *tg.Message, from peers.Peer) (bool, bool)
 		}
 	}
 
+	if i.dedup != nil {
+		if existing, ok := i.dedup.lookup(mediaKey(message.Media), item.Size); ok {
+			// known media are never downloaded again
+			dst := filepath.Join(i.opts.Dir, dir, toName.String())
+			kept, err := i.dedup.reuse(existing, dst, item.Name)
+			if err != nil {
+				i.err = errors.Wrapf(err, "reuse duplicate of %d/%d message", from.ID(), message.ID)
+				return false, false
+			}
+			if kept && i.ra != nil {
+				i.ra.add(item.Name, dst)
+			}
+			return false, true
+		}
+	}
+
 	filename := fmt.Sprintf("%s%s", toName.String(), tempExt)
-	path := filepath.Join(i.opts.Dir, filename)
+	path := filepath.Join(i.opts.Dir, dir, filename)
 
 	// #113. If path contains dirs, create it. So now we support nested dirs.
 	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
@@ -317,7 +370,10 @@ func flatDialogs(dialogs [][]*tmessage.Dialog) []*tmessage.Dialog {
 func filterMap(data []string, keyFn func(key string) string) map[string]struct{} {
 	m := make(map[string]struct{})
 	for _, v := range data {
-		m[keyFn(v)] = struct{}{}
+		// empty keys(e.g. from "--include ''") should not make filter effective
+		if k := keyFn(v); k != "" {
+			m[k] = struct{}{}
+		}
 	}
 	return m
 }
@@ -0,0 +1,37 @@
+package dl
+
+import (
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// fileTime returns the original time of media of msg, which is the date of document or photo if available,
+// otherwise the message date. False is returned if neither is available.
+func fileTime(msg *tg.Message) (time.Time, bool) {
+	if date := mediaDate(msg.Media); date > 0 {
+		return time.Unix(int64(date), 0), true
+	}
+	if msg.Date > 0 {
+		return time.Unix(int64(msg.Date), 0), true
+	}
+	return time.Time{}, false
+}
+
+func mediaDate(m tg.MessageMediaClass) int {
+	switch m := m.(type) {
+	case *tg.MessageMediaDocument:
+		if doc, ok := m.Document.(*tg.Document); ok {
+			return doc.Date
+		}
+	case *tg.MessageMediaPhoto:
+		if photo, ok := m.Photo.(*tg.Photo); ok {
+			return photo.Date
+		}
+	case *tg.MessageMediaInvoice:
+		if em, ok := m.ExtendedMedia.(*tg.MessageExtendedMedia); ok {
+			return mediaDate(em.Media)
+		}
+	}
+	return 0
+}
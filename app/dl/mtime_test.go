@@ -0,0 +1,37 @@
+package dl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTime(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *tg.Message
+		want int64
+		ok   bool
+	}{
+		{"document", &tg.Message{Date: 200, Media: &tg.MessageMediaDocument{Document: &tg.Document{Date: 100}}}, 100, true},
+		{"photo", &tg.Message{Date: 200, Media: &tg.MessageMediaPhoto{Photo: &tg.Photo{Date: 150}}}, 150, true},
+		{"paid", &tg.Message{Date: 200, Media: &tg.MessageMediaInvoice{
+			ExtendedMedia: &tg.MessageExtendedMedia{Media: &tg.MessageMediaDocument{Document: &tg.Document{Date: 120}}},
+		}}, 120, true},
+		{"empty document", &tg.Message{Date: 200, Media: &tg.MessageMediaDocument{Document: &tg.DocumentEmpty{}}}, 200, true},
+		{"no media date", &tg.Message{Date: 200, Media: photoMedia}, 200, true},
+		{"unavailable", &tg.Message{Media: photoMedia}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := fileTime(tt.msg)
+			assert.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, time.Unix(tt.want, 0), got)
+			}
+		})
+	}
+}
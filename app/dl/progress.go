@@ -24,15 +24,19 @@ type progress struct {
 	trackers *sync.Map // map[ID]*pw.Tracker
 	opts     Options
 
-	it *iter
+	it         *iter
+	reassemble *reassembler // nil if not enabled
+	dedup      *dedupStore  // nil if not enabled
 }
 
-func newProgress(p pw.Writer, it *iter, opts Options) *progress {
+func newProgress(p pw.Writer, it *iter, ra *reassembler, dedup *dedupStore, opts Options) *progress {
 	return &progress{
-		pw:       p,
-		trackers: &sync.Map{},
-		opts:     opts,
-		it:       it,
+		pw:         p,
+		trackers:   &sync.Map{},
+		opts:       opts,
+		it:         it,
+		reassemble: ra,
+		dedup:      dedup,
 	}
 }
 
@@ -96,10 +100,30 @@ func (p *progress) donePost(elem *iterElem) error {
 		}
 	}
 
-	if err := os.Rename(elem.to.Name(), filepath.Join(filepath.Dir(elem.to.Name()), newfile)); err != nil {
+	path := filepath.Join(filepath.Dir(elem.to.Name()), newfile)
+	if err := os.Rename(elem.to.Name(), path); err != nil {
 		return errors.Wrap(err, "rename file")
 	}
 
+	if p.opts.PreserveTime {
+		// keep download time if the original time is unknown
+		if t, ok := fileTime(elem.fromMsg); ok {
+			if err := os.Chtimes(path, t, t); err != nil {
+				return errors.Wrap(err, "set file time")
+			}
+		}
+	}
+
+	if p.dedup != nil {
+		if _, err := p.dedup.record(mediaKey(elem.fromMsg.Media), path, elem.file.Name); err != nil {
+			return errors.Wrap(err, "record dedup")
+		}
+	}
+
+	if p.reassemble != nil {
+		p.reassemble.add(elem.file.Name, path)
+	}
+
 	return nil
 }
 
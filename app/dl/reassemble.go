@@ -0,0 +1,94 @@
+package dl
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+
+	"github.com/iyear/tdl/pkg/splitfile"
+)
+
+// reassembler records downloaded files, and reassembles split files of downloaded indexes after download
+type reassembler struct {
+	mu      sync.Mutex
+	files   map[string]string // original file name -> local path
+	indexes []string          // local paths of downloaded indexes
+}
+
+func newReassembler() *reassembler {
+	return &reassembler{files: make(map[string]string)}
+}
+
+func (r *reassembler) add(name, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.files[name] = path
+	if splitfile.IsIndex(name) {
+		r.indexes = append(r.indexes, path)
+	}
+}
+
+// reassemble joins parts of each downloaded index into the original file in the dir of index, and removes
+// parts and index after success. Parts are looked up in downloaded files, then by their names in the dir of index,
+// so that parts downloaded by previous runs are also found. Indexes with missing parts are skipped with warnings.
+func (r *reassembler) reassemble() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var err error
+	for _, index := range r.indexes {
+		ok, rerr := r.reassembleIndex(index)
+		if rerr != nil {
+			multierr.AppendInto(&err, errors.Wrapf(rerr, "reassemble %s", index))
+			continue
+		}
+		if ok {
+			color.Green("Reassembled %s", index)
+		}
+	}
+	return err
+}
+
+func (r *reassembler) reassembleIndex(index string) (bool, error) {
+	idx, err := splitfile.ReadIndex(index)
+	if err != nil {
+		return false, err
+	}
+
+	dir := filepath.Dir(index)
+	paths := make(map[string]string, len(idx.Parts))
+	for _, p := range idx.Parts {
+		path, ok := r.files[p.Name]
+		if !ok {
+			path = filepath.Join(dir, p.Name)
+		}
+		if _, err = os.Stat(path); err != nil {
+			color.Yellow("WARN: skip reassembling %s, part %s is not downloaded", idx.Name, p.Name)
+			return false, nil
+		}
+		paths[p.Name] = path
+	}
+
+	dst := filepath.Join(dir, idx.Name)
+	if _, err = os.Stat(dst); err == nil {
+		return false, errors.Errorf("file %s already exists", dst)
+	}
+
+	if err = splitfile.Reassemble(idx, dst, func(p splitfile.Part) string { return paths[p.Name] }); err != nil {
+		return false, err
+	}
+
+	for _, path := range paths {
+		multierr.AppendInto(&err, os.Remove(path))
+	}
+	multierr.AppendInto(&err, os.Remove(index))
+	if err != nil {
+		return true, errors.Wrap(err, "remove parts")
+	}
+	return true, nil
+}
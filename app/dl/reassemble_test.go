@@ -0,0 +1,67 @@
+package dl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/pkg/splitfile"
+)
+
+func TestReassembler(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "video.mkv")
+	data := []byte("0123456789abcdefghij")
+	require.NoError(t, os.WriteFile(src, data, 0o644))
+
+	idx, err := splitfile.Split(src, 8)
+	require.NoError(t, err)
+	require.Len(t, idx.Parts, 3)
+
+	// parts are downloaded with names of template, and the last one is downloaded by a previous run
+	dir := t.TempDir()
+	ra := newReassembler()
+	for i, p := range idx.Parts {
+		path := filepath.Join(dir, p.Name)
+		if i < 2 {
+			path = filepath.Join(dir, "1_"+p.Name)
+			ra.add(p.Name, path)
+		}
+		require.NoError(t, os.WriteFile(path, data[p.Offset:p.Offset+p.Size], 0o644))
+	}
+
+	b, err := json.Marshal(idx)
+	require.NoError(t, err)
+	index := filepath.Join(dir, "1_"+splitfile.IndexName(idx.Name))
+	require.NoError(t, os.WriteFile(index, b, 0o644))
+	ra.add(splitfile.IndexName(idx.Name), index)
+	ra.add("other.txt", filepath.Join(dir, "other.txt"))
+
+	require.NoError(t, ra.reassemble())
+
+	got, err := os.ReadFile(filepath.Join(dir, "video.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "parts and index are removed")
+}
+
+func TestReassembler_MissingPart(t *testing.T) {
+	dir := t.TempDir()
+	idx := splitfile.Index{Name: "a.bin", Size: 1, Parts: []splitfile.Part{{Name: "a.bin.part001", Size: 1}}}
+	b, err := json.Marshal(idx)
+	require.NoError(t, err)
+	index := filepath.Join(dir, splitfile.IndexName(idx.Name))
+	require.NoError(t, os.WriteFile(index, b, 0o644))
+
+	ra := newReassembler()
+	ra.add(splitfile.IndexName(idx.Name), index)
+	require.NoError(t, ra.reassemble())
+	assert.FileExists(t, index, "index is kept for next run")
+	assert.NoFileExists(t, filepath.Join(dir, "a.bin"))
+}
@@ -0,0 +1,68 @@
+package extension
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/iyear/tdl/pkg/extensions"
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+// downloadInterval is the min interval of refreshing download progress
+const downloadInterval = 200 * time.Millisecond
+
+var stepMessages = map[extensions.EventType]string{
+	extensions.EventResolve: "resolving latest release...",
+	extensions.EventVerify:  "checking compatibility...",
+	extensions.EventExtract: "extracting executable from archive...",
+	extensions.EventInstall: "writing extension files...",
+}
+
+// eventPrinter prints installation steps, and refreshes download progress in place
+type eventPrinter struct {
+	downloading bool
+	last        time.Time
+}
+
+func (p *eventPrinter) handle(e extensions.Event) {
+	if e.Type != extensions.EventDownload {
+		p.endDownload()
+		if msg, ok := stepMessages[e.Type]; ok {
+			info(1, msg)
+		}
+		return
+	}
+
+	finished := e.Total >= 0 && e.Done >= e.Total
+	if p.downloading && !finished && time.Since(p.last) < downloadInterval {
+		return
+	}
+	p.downloading, p.last = true, time.Now()
+
+	total := "unknown"
+	if e.Total >= 0 {
+		total = utils.Byte.FormatBinaryBytes(e.Total)
+	}
+	color.New(color.FgBlue, color.Bold).Print("\r  • ")
+	fmt.Printf("downloading %s / %s", utils.Byte.FormatBinaryBytes(e.Done), total)
+}
+
+// endDownload ends the line of download progress
+func (p *eventPrinter) endDownload() {
+	if p.downloading {
+		fmt.Println()
+		p.downloading = false
+	}
+}
+
+// withEvents prints events of em during f
+func withEvents(em *extensions.Manager, f func()) {
+	p := &eventPrinter{}
+	em.SetEventHandler(p.handle)
+	defer em.SetEventHandler(nil)
+
+	f()
+	p.endDownload()
+}
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/go-faster/errors"
 	"github.com/jedib0t/go-pretty/v6/table"
 
 	"github.com/iyear/tdl/pkg/extensions"
+	"github.com/iyear/tdl/pkg/utils"
 )
 
 var (
@@ -25,80 +28,204 @@ var (
 	fail = colorPrint(color.FgRed, color.Bold)
 )
 
-func List(ctx context.Context, em *extensions.Manager) error {
-	exts, err := em.List(ctx, false)
+// DefaultTimeout is the deadline of installing or upgrading each extension if caller doesn't set one
+const DefaultTimeout = 5 * time.Minute
+
+// withTimeout returns ctx for operation of one extension. Zero timeout means DefaultTimeout,
+// but deadline of parent ctx is respected as is.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		if _, ok := ctx.Deadline(); ok {
+			return context.WithCancel(ctx)
+		}
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timedOut reports whether err is caused by deadline of operation instead of parent ctx
+func timedOut(parent context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil
+}
+
+// Table styles of List
+const (
+	StyleDark  = utils.TableStyleDark
+	StyleLight = utils.TableStyleLight
+	StylePlain = utils.TableStylePlain
+)
+
+// Styles are all available table styles of List.
+var Styles = utils.TableStyles
+
+// ListOptions narrows rendered extensions, and empty fields mean no filter.
+type ListOptions struct {
+	// Owner matches owner of extensions case-insensitively
+	Owner string
+	// Filter matches substring of extension names case-insensitively
+	Filter string
+	// Style is the table style, empty means StyleDark. StylePlain is always used if colors
+	// are disabled, e.g. NO_COLOR is set or output is not a terminal.
+	Style string
+	// Remote fetches latest versions from GitHub, otherwise only local manifests are read
+	// and latest versions are the ones cached by last install, upgrade or remote listing.
+	Remote bool
+}
+
+func List(ctx context.Context, em *extensions.Manager, opts ListOptions) error {
+	style, err := utils.Table.Style(opts.Style)
+	if err != nil {
+		return err
+	}
+
+	lctx, cancel := withTimeout(ctx, 0)
+	defer cancel()
+	exts, err := em.List(lctx, opts.Remote)
 	if err != nil {
 		return errors.New("list extensions failed")
 	}
 
-	tb := table.NewWriter()
+	aliases, err := em.Aliases(ctx)
+	if err != nil {
+		return errors.Wrap(err, "load aliases")
+	}
+
+	exts = filterExtensions(exts, opts)
+	sort.Slice(exts, func(i, j int) bool {
+		return normalizeExtName(exts[i].Name()) < normalizeExtName(exts[j].Name())
+	})
 
-	style := table.StyleColoredDark
+	tb := table.NewWriter()
 	tb.SetStyle(style)
 
-	tb.AppendHeader(table.Row{"NAME", "AUTHOR", "VERSION"})
+	tb.AppendHeader(table.Row{"NAME", "ALIASES", "AUTHOR", "VERSION", "LATEST"})
 	for _, e := range exts {
-		tb.AppendRow(table.Row{normalizeExtName(e.Name()), e.Owner(), e.CurrentVersion()})
+		latest := e.CachedLatestVersion()
+		if opts.Remote {
+			latest = e.LatestVersion(lctx)
+		}
+		tb.AppendRow(table.Row{normalizeExtName(e.Name()), strings.Join(aliases[e.Name()], ", "), e.Owner(), e.CurrentVersion(), latest})
 	}
 
 	fmt.Println(tb.Render())
 
+	for _, e := range exts {
+		if err = em.Compatible(e); err != nil {
+			color.Yellow("WARN: extension %s may not work: %s", normalizeExtName(e.Name()), err)
+		}
+	}
+
 	return nil
 }
 
-func Install(ctx context.Context, em *extensions.Manager, targets []string, force bool) error {
+func filterExtensions(exts []extensions.Extension, opts ListOptions) []extensions.Extension {
+	r := make([]extensions.Extension, 0, len(exts))
+	for _, e := range exts {
+		if opts.Owner != "" && !strings.EqualFold(e.Owner(), opts.Owner) {
+			continue
+		}
+		if opts.Filter != "" && !strings.Contains(strings.ToLower(normalizeExtName(e.Name())), strings.ToLower(opts.Filter)) {
+			continue
+		}
+		r = append(r, e)
+	}
+	return r
+}
+
+// Install installs targets one by one, and timeout applies to each target, zero means DefaultTimeout.
+func Install(ctx context.Context, em *extensions.Manager, targets []string, force bool, timeout time.Duration) error {
 	for _, target := range targets {
 		info(0, "installing extension %s...", normalizeExtName(target))
 
-		if err := em.Install(ctx, target, force); err != nil {
+		var err error
+		withEvents(em, func() {
+			tctx, cancel := withTimeout(ctx, timeout)
+			defer cancel()
+			err = em.Install(tctx, target, force)
+		})
+		if err != nil {
+			if timedOut(ctx, err) {
+				fail(1, "install extension %s timed out: %s", normalizeExtName(target), err)
+				continue
+			}
+			if errors.Is(err, extensions.ErrIncompatibleVersion) {
+				fail(1, "extension %s is incompatible with current tdl, please upgrade tdl first: %s", normalizeExtName(target), err)
+				continue
+			}
+			if errors.Is(err, extensions.ErrRateLimited) {
+				fail(1, "install extension %s failed: %s, please set GITHUB_TOKEN environment variable to raise the limit", normalizeExtName(target), err)
+				continue
+			}
 			fail(1, "install extension %s failed: %s", normalizeExtName(target), err)
 			continue
 		}
 
+		source := "GitHub"
+		if extensions.TargetType(target) == extensions.ExtensionTypeLocal {
+			source = "local file " + target
+		}
+
 		if em.DryRun() {
-			succ(1, "extension %s will be installed", normalizeExtName(target))
+			succ(1, "extension %s will be installed from %s", normalizeExtName(target), source)
 		} else {
-			succ(1, "extension %s installed", normalizeExtName(target))
+			succ(1, "extension %s installed from %s", normalizeExtName(target), source)
 		}
 	}
 
 	return nil
 }
 
-func Upgrade(ctx context.Context, em *extensions.Manager, targets []string) error {
-	upgradeAll := len(targets) == 0
-
-	exts, err := em.List(ctx, upgradeAll)
-	if err != nil {
-		return errors.Wrap(err, "list extensions with metadata")
-	}
-	if len(exts) == 0 {
-		return errors.New("no extensions installed")
-	}
-
-	extMap := make(map[string]extensions.Extension)
-	for _, e := range exts {
-		extMap[e.Name()] = e
-		if upgradeAll {
-			targets = append(targets, e.Name())
+// Upgrade upgrades targets one by one, or all extensions if targets is empty.
+// Timeout applies to each extension, so one stuck download doesn't block the rest. Zero means DefaultTimeout.
+func Upgrade(ctx context.Context, em *extensions.Manager, targets []string, timeout time.Duration) error {
+	var exts []extensions.Extension
+	if len(targets) == 0 {
+		lctx, cancel := withTimeout(ctx, timeout)
+		all, err := em.List(lctx, true)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "list extensions with metadata")
+		}
+		if len(all) == 0 {
+			return errors.New("no extensions installed")
+		}
+		exts = all
+	} else {
+		for _, target := range targets {
+			e, err := em.Get(ctx, target)
+			if err != nil {
+				if !errors.Is(err, extensions.ErrNotInstalled) {
+					return errors.Wrap(err, "get extension")
+				}
+				fail(0, "extension %s not found", normalizeExtName(target))
+				continue
+			}
+			exts = append(exts, e)
 		}
 	}
 
-	for _, target := range targets {
-		e, ok := extMap[strings.TrimPrefix(target, extensions.Prefix)]
-		if !ok {
-			fail(0, "extension %s not found", normalizeExtName(target))
-			continue
-		}
+	var err error
+	for _, e := range exts {
 
 		info(0, "upgrading %s...", normalizeExtName(e.Name()))
 
-		if err = em.Upgrade(ctx, e); err != nil {
+		withEvents(em, func() {
+			tctx, cancel := withTimeout(ctx, timeout)
+			defer cancel()
+			err = em.Upgrade(tctx, e)
+		})
+		if err != nil {
 			switch {
+			case timedOut(ctx, err):
+				fail(1, "upgrade extension %s timed out: %s", normalizeExtName(e.Name()), err)
 			case errors.Is(err, extensions.ErrAlreadyUpToDate):
 				succ(1, "extension %s already up-to-date", normalizeExtName(e.Name()))
 			case errors.Is(err, extensions.ErrOnlyGitHub):
 				fail(1, "extension %s can't be automatically upgraded by tdl", normalizeExtName(e.Name()))
+			case errors.Is(err, extensions.ErrIncompatibleVersion):
+				fail(1, "new version of extension %s is incompatible with current tdl, please upgrade tdl first: %s", normalizeExtName(e.Name()), err)
+			case errors.Is(err, extensions.ErrRateLimited):
+				fail(1, "upgrade extension %s failed: %s, please set GITHUB_TOKEN environment variable to raise the limit", normalizeExtName(e.Name()), err)
 			default:
 				fail(1, "upgrade extension %s failed: %s", normalizeExtName(e.Name()), err)
 			}
@@ -117,19 +244,12 @@ func Upgrade(ctx context.Context, em *extensions.Manager, targets []string) erro
 }
 
 func Remove(ctx context.Context, em *extensions.Manager, targets []string) error {
-	exts, err := em.List(ctx, false)
-	if err != nil {
-		return errors.Wrap(err, "list extensions")
-	}
-
-	extMap := make(map[string]extensions.Extension)
-	for _, e := range exts {
-		extMap[e.Name()] = e
-	}
-
 	for _, target := range targets {
-		e, ok := extMap[strings.TrimPrefix(target, extensions.Prefix)]
-		if !ok {
+		e, err := em.Get(ctx, target)
+		if err != nil {
+			if !errors.Is(err, extensions.ErrNotInstalled) {
+				return errors.Wrap(err, "get extension")
+			}
 			fail(0, "extension %s not found", normalizeExtName(target))
 			continue
 		}
@@ -149,6 +269,52 @@ func Remove(ctx context.Context, em *extensions.Manager, targets []string) error
 	return nil
 }
 
+// Alias adds alias of installed extension target, so that it can be invoked as `tdl <alias>`.
+func Alias(ctx context.Context, em *extensions.Manager, target, alias string) error {
+	e, err := em.Get(ctx, target)
+	if err != nil {
+		if !errors.Is(err, extensions.ErrNotInstalled) {
+			return errors.Wrap(err, "get extension")
+		}
+		fail(0, "extension %s not found", normalizeExtName(target))
+		return nil
+	}
+
+	if err = em.Alias(ctx, e, alias); err != nil {
+		fail(0, "alias extension %s as %s failed: %s", normalizeExtName(e.Name()), alias, err)
+		return nil
+	}
+
+	if em.DryRun() {
+		succ(0, "extension %s will be aliased as %s", normalizeExtName(e.Name()), alias)
+	} else {
+		succ(0, "extension %s aliased as %s", normalizeExtName(e.Name()), alias)
+	}
+	return nil
+}
+
+// Unalias removes aliases one by one.
+func Unalias(ctx context.Context, em *extensions.Manager, aliases []string) error {
+	for _, alias := range aliases {
+		if err := em.Unalias(ctx, alias); err != nil {
+			if errors.Is(err, extensions.ErrNotInstalled) {
+				fail(0, "alias %s not found", alias)
+				continue
+			}
+			fail(0, "remove alias %s failed: %s", alias, err)
+			continue
+		}
+
+		if em.DryRun() {
+			succ(0, "alias %s will be removed", alias)
+		} else {
+			succ(0, "alias %s removed", alias)
+		}
+	}
+
+	return nil
+}
+
 func normalizeExtName(n string) string {
 	if idx := strings.IndexRune(n, '/'); idx >= 0 {
 		n = n[idx+1:]
@@ -54,9 +54,14 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 
 	ctx = tctx.WithKV(ctx, kvd)
 
-	pool := dcpool.NewPool(c,
-		int64(viper.GetInt(consts.FlagPoolSize)),
-		tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout))...)
+	pool, err := dcpool.NewPoolWithOptions(c, dcpool.Options{
+		PerDC:       int64(viper.GetInt(consts.FlagPoolSize)),
+		MaxConns:    int64(viper.GetInt(consts.FlagMaxConns)),
+		Middlewares: tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout)),
+	})
+	if err != nil {
+		return errors.Wrap(err, "create pool")
+	}
 	defer multierr.AppendInvoke(&rerr, multierr.Close(pool))
 
 	ctx = tctx.WithPool(ctx, pool)
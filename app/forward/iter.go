@@ -179,7 +179,9 @@ func (i *iter) Next(ctx context.Context) bool {
 		// modify message
 		msg.Message, msg.Entities = eb.Raw()
 		// direct mode can't modify message content, so we force it to be clone mode
-		modeOverride = forwarder.ModeClone
+		if i.opts.mode == forwarder.ModeDirect {
+			modeOverride = forwarder.ModeClone
+		}
 	}
 
 	if err != nil {
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/jedib0t/go-pretty/v6/table"
+
+	"github.com/iyear/tdl/core/tclient"
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// List prints active sessions of the account as a table in style, see utils.Table.Style, and the current
+// session is marked instead of its hash, as it can't be reset.
+func List(ctx context.Context, c *telegram.Client, style string) error {
+	tableStyle, err := utils.Table.Style(style)
+	if err != nil {
+		return err
+	}
+
+	auths, err := tclient.ListAuthorizations(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	tb := table.NewWriter()
+	tb.SetStyle(tableStyle)
+
+	tb.AppendHeader(table.Row{"HASH", "DEVICE", "PLATFORM", "APP", "IP", "COUNTRY", "ACTIVE"})
+	for _, a := range auths {
+		hash := strconv.FormatInt(a.Hash, 10)
+		if a.Current {
+			hash = "current"
+		}
+		tb.AppendRow(table.Row{hash, a.Device, a.Platform, a.App, a.IP, a.Country, a.Active.Format(timeLayout)})
+	}
+
+	fmt.Println(tb.Render())
+	return nil
+}
+
+// Reset terminates sessions of hashes one by one, and stops at the first failure.
+func Reset(ctx context.Context, c *telegram.Client, hashes []int64) error {
+	for _, hash := range hashes {
+		if err := tclient.ResetAuthorization(ctx, c, hash); err != nil {
+			return errors.Wrapf(err, "reset session %d", hash)
+		}
+		color.Green("Session %d is terminated", hash)
+	}
+	return nil
+}
+
+// Health prints consolidated restrictions of the account, and returns tclient.ErrAccountLimited if any.
+func Health(ctx context.Context, c *telegram.Client) error {
+	h, err := tclient.CheckAccount(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	color.Blue("Account: %s(@%s), id: %d", h.User.FirstName, h.User.Username, h.User.ID)
+	color.Blue("Self-destructs if inactive for %d days", h.TTLDays)
+
+	if err = h.Err(); err != nil {
+		var limited *tclient.AccountLimitedError
+		if errors.As(err, &limited) {
+			for _, r := range limited.Reasons {
+				color.Red("  %s", r)
+			}
+		}
+		return err
+	}
+
+	color.Green("No restrictions detected. Spam limits are only revealed by failed operations, check with @SpamBot if sending fails")
+	return nil
+}
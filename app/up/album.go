@@ -0,0 +1,70 @@
+package up
+
+import (
+	"path/filepath"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/core/util/mediautil"
+)
+
+// albumElem sends files of the same directory in one grouped message
+type albumElem struct {
+	*iterElem // the first elem, which provides destination
+	elems     []uploader.Elem
+}
+
+func (a *albumElem) Album() []uploader.Elem {
+	return a.elems
+}
+
+// albumMedia reports whether f can be grouped in albums, as Telegram only groups photos with videos,
+// and forced documents are sent individually.
+// MIME type is detected and cached on f.
+func albumMedia(f *file) (bool, error) {
+	if f.reader != nil || f.document {
+		return false, nil
+	}
+
+	if f.mime == "" {
+		mime, err := mimetype.DetectFile(f.file)
+		if err != nil {
+			return false, errors.Wrapf(err, "detect mime of %s", f.file)
+		}
+		f.mime = mime.String()
+	}
+
+	// webp is uploaded as document
+	return mediautil.IsImage(f.mime) && f.mime != "image/webp" || mediautil.IsVideo(f.mime), nil
+}
+
+// groupAlbums buckets media files by parent directory in order of first appearance, and splits
+// directories with more than uploader.MaxAlbumSize media into several albums.
+// Streams and other files are kept in their own groups, which are sent individually.
+func groupAlbums(files []*file) ([][]*file, error) {
+	groups := make([][]*file, 0, len(files))
+	last := make(map[string]int) // dir -> index of the last album of dir in groups
+
+	for _, f := range files {
+		ok, err := albumMedia(f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			groups = append(groups, []*file{f})
+			continue
+		}
+
+		dir := filepath.Dir(f.file)
+		if i, ok := last[dir]; ok && len(groups[i]) < uploader.MaxAlbumSize {
+			groups[i] = append(groups[i], f)
+			continue
+		}
+		last[dir] = len(groups)
+		groups = append(groups, []*file{f})
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,57 @@
+package up
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupAlbums(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	files := make([]*file, 0)
+	add := func(path string, data []byte) {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		files = append(files, &file{file: path, root: dir})
+	}
+
+	for i := 0; i < 12; i++ {
+		add(filepath.Join("a", strconv.Itoa(i)+".png"), png)
+		if i == 1 {
+			// interleaved files of other directories
+			add(filepath.Join("b", "0.png"), png)
+			add(filepath.Join("a", "note.txt"), []byte("hello"))
+		}
+	}
+	add(filepath.Join("b", "1.png"), png)
+	files = append(files, &file{file: "stdin", reader: os.Stdin})
+
+	groups, err := groupAlbums(files)
+	require.NoError(t, err)
+
+	names := make([][]string, 0, len(groups))
+	for _, g := range groups {
+		n := make([]string, 0, len(g))
+		for _, f := range g {
+			rel, _ := filepath.Rel(dir, f.file)
+			n = append(n, filepath.ToSlash(rel))
+		}
+		names = append(names, n)
+	}
+	require.Len(t, names, 5)
+	assert.Equal(t, [][]string{
+		{"a/0.png", "a/1.png", "a/2.png", "a/3.png", "a/4.png", "a/5.png", "a/6.png", "a/7.png", "a/8.png", "a/9.png"},
+		{"b/0.png", "b/1.png"},
+		{"a/note.txt"},
+		{"a/10.png", "a/11.png"},
+	}, names[:4], "groups are ordered by their first files")
+	assert.Len(t, groups[4], 1)
+	assert.NotNil(t, groups[4][0].reader, "streams are sent individually")
+}
@@ -0,0 +1,157 @@
+package up
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+)
+
+// ArchiveExt is the extension of archive name, only uncompressed tar is supported,
+// because size of the stream must be known before uploading.
+const ArchiveExt = ".tar"
+
+// archiveEntry is a file in archive
+type archiveEntry struct {
+	path string
+	name string // slash-separated path in archive
+	info os.FileInfo
+}
+
+// newArchive returns a stream which tars files on the fly, so that a directory can be uploaded
+// as a single document without temp files. Files are named relative to the parent of their input paths.
+func newArchive(name string, files []*file) (*file, error) {
+	if !strings.EqualFold(filepath.Ext(name), ArchiveExt) {
+		return nil, errors.Errorf("archive name %q should end with %s", name, ArchiveExt)
+	}
+
+	entries := make([]archiveEntry, 0, len(files))
+	for _, f := range files {
+		if f.reader != nil {
+			return nil, errors.Errorf("stream %s can't be archived", f.file)
+		}
+
+		info, err := os.Stat(f.file)
+		if err != nil {
+			return nil, errors.Wrap(err, "stat file")
+		}
+
+		rel, err := filepath.Rel(filepath.Dir(filepath.Clean(f.root)), f.file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(f.file)
+		}
+		entries = append(entries, archiveEntry{path: f.file, name: filepath.ToSlash(rel), info: info})
+	}
+
+	// headers are deterministic, so size can be computed by writing placeholder content
+	cw := &countWriter{}
+	if err := writeTar(cw, entries, false); err != nil {
+		return nil, errors.Wrap(err, "compute archive size")
+	}
+
+	return &file{file: name, reader: &archiveReader{entries: entries}, size: cw.n}, nil
+}
+
+// archiveReader starts tar writer on first read, and Close stops it
+type archiveReader struct {
+	entries []archiveEntry
+
+	once sync.Once
+	pr   *io.PipeReader
+}
+
+func (a *archiveReader) start() {
+	a.once.Do(func() {
+		pr, pw := io.Pipe()
+		a.pr = pr
+
+		go func() {
+			_ = pw.CloseWithError(writeTar(pw, a.entries, true))
+		}()
+	})
+}
+
+func (a *archiveReader) Read(p []byte) (int, error) {
+	a.start()
+	return a.pr.Read(p)
+}
+
+func (a *archiveReader) Close() error {
+	a.start()
+	return a.pr.Close()
+}
+
+// writeTar writes entries as tar to w. If content is false, zeros are written instead of file content.
+func writeTar(w io.Writer, entries []archiveEntry, content bool) error {
+	tw := tar.NewWriter(w)
+
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.name,
+			Size:     e.info.Size(),
+			Mode:     int64(e.info.Mode().Perm()),
+			ModTime:  e.info.ModTime(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "write header of %s", e.path)
+		}
+
+		if !content {
+			if err := writeZeros(tw, hdr.Size); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := copyFile(tw, e.path, hdr.Size); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// copyFile copies exactly size bytes of path, which fails if file is changed after stat
+func copyFile(w io.Writer, path string, size int64) (rerr error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "open file")
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(f))
+
+	if _, err = io.CopyN(w, f, size); err != nil {
+		return errors.Wrapf(err, "copy %s, file may be changed during archiving", path)
+	}
+	return nil
+}
+
+var zeros = make([]byte, 32*1024)
+
+func writeZeros(w io.Writer, n int64) error {
+	for n > 0 {
+		b := zeros
+		if n < int64(len(b)) {
+			b = b[:n]
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		n -= int64(len(b))
+	}
+	return nil
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,91 @@
+package up
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "photos")
+	createFiles(t, root, "a.jpg", "sub/b.mp4", "sub/deep/"+string(bytes.Repeat([]byte("n"), 120))+".txt", ".DS_Store")
+
+	files, err := walk(context.Background(), Options{Paths: []string{root}, SkipJunk: true}, io.Discard, nil)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	_, err = newArchive("photos.zip", files)
+	assert.Error(t, err)
+
+	f, err := newArchive("photos.tar", files)
+	require.NoError(t, err)
+	assert.Equal(t, "photos.tar", f.file)
+
+	s, err := newStreamFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-tar", s.MIME())
+
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	assert.Equal(t, f.size, int64(len(b)), "size should be computed before archiving")
+
+	contents := make(map[string]string)
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		c, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		contents[hdr.Name] = string(c)
+	}
+
+	expected := make(map[string]string)
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f.file)
+		require.NoError(t, err)
+		expected[filepath.ToSlash(rel)] = string(mustRead(t, f.file))
+	}
+	assert.Equal(t, expected, contents)
+	assert.Contains(t, contents, "photos/a.jpg")
+}
+
+func TestArchive_Changed(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt")
+
+	files, err := walk(context.Background(), Options{Paths: []string{dir}}, io.Discard, nil)
+	require.NoError(t, err)
+
+	f, err := newArchive("a.tar", files)
+	require.NoError(t, err)
+
+	// truncated after size computed
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o644))
+
+	_, err = io.ReadAll(f.reader)
+	assert.ErrorContains(t, err, "may be changed")
+}
+
+func TestArchive_Stream(t *testing.T) {
+	_, err := newArchive("a.tar", []*file{{file: "stdin", reader: &bytes.Buffer{}}})
+	assert.Error(t, err)
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return b
+}
@@ -0,0 +1,62 @@
+package up
+
+import (
+	"bytes"
+	"path/filepath"
+	"text/template"
+
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/core/util/fsutil"
+	"github.com/iyear/tdl/pkg/tplfunc"
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+// captionTemplate is the data of Options.Caption
+type captionTemplate struct {
+	Name string // file name with extension
+	Stem string // file name without extension
+	Ext  string // extension with dot, e.g. .mp4
+	Dir  string // slash-separated directory relative to the input path, "." if file is directly in it
+	Path string // local path, empty for streams
+	Size string // human-readable size, empty if unknown
+}
+
+// newCaption parses caption template, and nil template means the default caption
+func newCaption(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tpl, err := template.New("caption").
+		Funcs(tplfunc.FuncMap(tplfunc.All...)).
+		Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse caption template")
+	}
+	return tpl, nil
+}
+
+func execCaption(tpl *template.Template, f *file, size int64) (string, error) {
+	data := &captionTemplate{
+		Name: filepath.Base(f.file),
+		Stem: fsutil.GetNameWithoutExt(f.file),
+		Ext:  filepath.Ext(f.file),
+		Dir:  ".",
+	}
+	if f.reader == nil {
+		data.Path = f.file
+		if rel, err := filepath.Rel(f.root, filepath.Dir(f.file)); err == nil && f.root != f.file {
+			data.Dir = filepath.ToSlash(rel)
+		}
+	}
+	if size >= 0 {
+		data.Size = utils.Byte.FormatBinaryBytes(size)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tpl.Execute(buf, data); err != nil {
+		return "", errors.Wrap(err, "execute caption template")
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,65 @@
+package up
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaption(t *testing.T) {
+	_, err := newCaption("{{ .Name")
+	assert.Error(t, err, "bad template should fail at parse time")
+
+	tpl, err := newCaption("")
+	require.NoError(t, err)
+	assert.Nil(t, tpl)
+
+	tpl, err = newCaption("{{ .Dir }}/{{ .Stem }}{{ .Ext }} {{ .Size }} {{ upper .Name }}")
+	require.NoError(t, err)
+
+	root := filepath.Join("photos", "2024")
+	got, err := execCaption(tpl, &file{file: filepath.Join(root, "trip", "a.jpg"), root: root}, 2048)
+	require.NoError(t, err)
+	assert.Equal(t, "trip/a.jpg 2.00 KB A.JPG", got)
+
+	// input path is the file itself
+	f := filepath.Join(root, "a.jpg")
+	got, err = execCaption(tpl, &file{file: f, root: f}, 2048)
+	require.NoError(t, err)
+	assert.Equal(t, "./a.jpg 2.00 KB A.JPG", got)
+
+	// streams have unknown size and no directory
+	got, err = execCaption(tpl, &file{file: "stdin.log", reader: strings.NewReader(""), size: -1}, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "./stdin.log  STDIN.LOG", got)
+
+	tpl, err = newCaption("{{ .Unknown }}")
+	require.NoError(t, err)
+	_, err = execCaption(tpl, &file{file: "a.jpg"}, 0)
+	assert.Error(t, err)
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestIter_OpenCaptionError(t *testing.T) {
+	tpl, err := newCaption("{{ .Unknown }}")
+	require.NoError(t, err)
+
+	r := &closeRecorder{Reader: strings.NewReader("content")}
+	it := newIter(nil, nil, 0, false, false, 0, tpl, nil)
+	_, err = it.open(&file{file: "stdin.log", reader: r, size: 7}, false)
+	assert.Error(t, err)
+	assert.True(t, r.closed, "opened stream is closed on failure")
+}
@@ -0,0 +1,118 @@
+package up
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// checkpointEntry is a line of checkpoint file
+type checkpointEntry struct {
+	Path    string    `json:"path"` // absolute path
+	Peer    int64     `json:"peer"`
+	Message int       `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+type checkpointKey struct {
+	path string
+	peer int64
+}
+
+// checkpoint appends completed files to a JSON lines file as soon as they are uploaded, so that interrupted
+// uploads of huge directories can skip them in next run. Unlike manifest, content of files is never hashed.
+type checkpoint struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[checkpointKey]struct{}
+}
+
+// openCheckpoint loads recorded files of path if resume is true, otherwise the previous checkpoint is discarded
+func openCheckpoint(path string, resume bool) (*checkpoint, error) {
+	c := &checkpoint{done: make(map[checkpointKey]struct{})}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	size := int64(0) // length of complete lines kept in file
+	if resume {
+		b, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrap(err, "read checkpoint")
+		}
+
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for sc.Scan() {
+			var e checkpointEntry
+			// the last line may be incomplete if the previous run is killed while writing
+			if err = json.Unmarshal(sc.Bytes(), &e); err != nil {
+				continue
+			}
+			c.done[checkpointKey{path: e.Path, peer: e.Peer}] = struct{}{}
+		}
+		if err = sc.Err(); err != nil {
+			return nil, errors.Wrapf(err, "scan checkpoint %s", path)
+		}
+		size = int64(bytes.LastIndexByte(b, '\n') + 1)
+	} else {
+		flag |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flag, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open checkpoint")
+	}
+	// drop the incomplete last line, otherwise the next record is appended to it and lost
+	if err = f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "truncate checkpoint")
+	}
+	c.f = f
+
+	return c, nil
+}
+
+// uploaded reports whether file is recorded as uploaded to peer
+func (c *checkpoint) uploaded(path string, peer int64) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.done[checkpointKey{path: abs, peer: peer}]
+	return ok, nil
+}
+
+// record appends uploaded file to checkpoint file, and flushes it to disk
+func (c *checkpoint) record(path string, peer int64, msgID int) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(checkpointEntry{Path: abs, Peer: peer, Message: msgID, Time: time.Now()})
+	if err != nil {
+		return errors.Wrap(err, "marshal checkpoint")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err = c.f.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "write checkpoint")
+	}
+	c.done[checkpointKey{path: abs, peer: peer}] = struct{}{}
+
+	return c.f.Sync()
+}
+
+func (c *checkpoint) Close() error {
+	return c.f.Close()
+}
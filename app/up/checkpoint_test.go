@@ -0,0 +1,74 @@
+package up
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "up.jsonl")
+
+	cp, err := openCheckpoint(path, true)
+	require.NoError(t, err, "missing checkpoint is empty")
+	require.NoError(t, cp.record("a.txt", 1, 100))
+	require.NoError(t, cp.record("b.txt", 1, 101))
+	require.NoError(t, cp.Close())
+
+	// simulate interruption while writing the last line
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"path":"c.t`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	cp, err = openCheckpoint(path, true)
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		path     string
+		peer     int64
+		uploaded bool
+	}{
+		{"a.txt", 1, true},
+		{"./b.txt", 1, true},
+		{"a.txt", 2, false},
+		{"c.txt", 1, false},
+	} {
+		ok, err := cp.uploaded(tt.path, tt.peer)
+		require.NoError(t, err)
+		assert.Equal(t, tt.uploaded, ok, tt.path)
+	}
+
+	files, err := filterFiles([]*file{{file: "a.txt"}, {file: "c.txt"}}, func(f *file) (bool, error) {
+		return cp.uploaded(f.file, 1)
+	})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "c.txt", files[0].file)
+	require.NoError(t, cp.record("d.txt", 1, 102))
+	require.NoError(t, cp.Close())
+
+	// the record after incomplete line is kept
+	cp, err = openCheckpoint(path, true)
+	require.NoError(t, err)
+	for _, path := range []string{"a.txt", "b.txt", "d.txt"} {
+		ok, err := cp.uploaded(path, 1)
+		require.NoError(t, err)
+		assert.True(t, ok, path)
+	}
+	require.NoError(t, cp.Close())
+
+	// overwritten without resume
+	cp, err = openCheckpoint(path, false)
+	require.NoError(t, err)
+	require.NoError(t, cp.Close())
+	cp, err = openCheckpoint(path, true)
+	require.NoError(t, err)
+	ok, err := cp.uploaded("a.txt", 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, cp.Close())
+}
@@ -0,0 +1,46 @@
+package up
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// documentMatcher reports whether files are sent as plain documents regardless of detected media,
+// so that Telegram doesn't recompress images or convert videos
+type documentMatcher struct {
+	all  bool
+	exts map[string]struct{} // lower-cased extensions with leading dot
+}
+
+func newDocumentMatcher(all bool, exts []string) *documentMatcher {
+	m := &documentMatcher{all: all, exts: make(map[string]struct{}, len(exts))}
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		m.exts[ext] = struct{}{}
+	}
+	return m
+}
+
+func (m *documentMatcher) match(name string) bool {
+	if m.all {
+		return true
+	}
+	_, ok := m.exts[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// markDocuments sets files matched by m as forced documents
+func markDocuments(files []*file, m *documentMatcher) {
+	if !m.all && len(m.exts) == 0 {
+		return
+	}
+	for _, f := range files {
+		f.document = m.match(f.file)
+	}
+}
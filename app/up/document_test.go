@@ -0,0 +1,42 @@
+package up
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentMatcher(t *testing.T) {
+	m := newDocumentMatcher(false, []string{"jpg", ".PNG", " "})
+	assert.True(t, m.match("a/IMG_1.JPG"))
+	assert.True(t, m.match("b.png"))
+	assert.False(t, m.match("c.mp4"))
+	assert.False(t, m.match("jpg"))
+
+	assert.True(t, newDocumentMatcher(true, nil).match("c.mp4"))
+}
+
+func TestMarkDocuments_Album(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	files := make([]*file, 0)
+	for _, name := range []string{"0.png", "1.jpg", "2.png"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, png, 0o644))
+		files = append(files, &file{file: path, root: dir})
+	}
+
+	markDocuments(files, newDocumentMatcher(false, []string{"jpg"}))
+	assert.Equal(t, []bool{false, true, false}, []bool{files[0].document, files[1].document, files[2].document})
+
+	// forced documents are not grouped with photos
+	groups, err := groupAlbums(files)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Len(t, groups[0], 2)
+	assert.Equal(t, []*file{files[1]}, groups[1])
+}
@@ -1,6 +1,7 @@
 package up
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 
@@ -10,13 +11,31 @@ import (
 	"github.com/iyear/tdl/core/uploader"
 )
 
+// elemFile is a local file or a stream to upload
+type elemFile interface {
+	uploader.MIMEFile
+	io.Closer
+	// Path returns local path of file, and empty for streams
+	Path() string
+}
+
 type iterElem struct {
-	file  *uploaderFile
+	file  elemFile
 	thumb *uploaderFile
 	to    peers.Peer
+	topic int // forum topic to reply to, zero means the General topic
+
+	asPhoto    bool
+	asDocument bool
+	remove     bool
+
+	sent uploader.SentMessage // sent message, zero if unknown
+
+	origin *splitOrigin // local file of split part or index, nil if not split
+
+	caption *string // custom caption, nil means the default caption
 
-	asPhoto bool
-	remove  bool
+	video *videoProber // nil means attributes are only parsed from MP4 header
 }
 
 func (e *iterElem) File() uploader.File {
@@ -34,13 +53,47 @@ func (e *iterElem) To() tg.InputPeerClass {
 	return e.to.InputPeer()
 }
 
+func (e *iterElem) Topic() int {
+	return e.topic
+}
+
 func (e *iterElem) AsPhoto() bool {
 	return e.asPhoto
 }
 
+func (e *iterElem) AsDocument() bool {
+	return e.asDocument
+}
+
+func (e *iterElem) Caption() (string, bool) {
+	if e.caption == nil {
+		return "", false
+	}
+	return *e.caption, true
+}
+
+func (e *iterElem) Video() (uploader.VideoInfo, bool) {
+	if e.video == nil {
+		return uploader.VideoInfo{}, false
+	}
+	return e.video.probe(e.file.Path())
+}
+
+// display returns local path of file or part, or name of stream
+func (e *iterElem) display() string {
+	if p := e.file.Path(); p != "" {
+		return p
+	}
+	if p, ok := e.file.(*partFile); ok {
+		return p.display()
+	}
+	return e.file.Name()
+}
+
 type uploaderFile struct {
 	*os.File
 	size int64
+	mime string
 }
 
 func (u *uploaderFile) Name() string {
@@ -50,3 +103,11 @@ func (u *uploaderFile) Name() string {
 func (u *uploaderFile) Size() int64 {
 	return u.size
 }
+
+func (u *uploaderFile) MIME() string {
+	return u.mime
+}
+
+func (u *uploaderFile) Path() string {
+	return u.File.Name()
+}
@@ -0,0 +1,53 @@
+package up
+
+import (
+	"context"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/tmedia"
+)
+
+// existingSearchLimit is the max number of messages searched for each file name, as search of Telegram is fuzzy
+const existingSearchLimit = 50
+
+// existingIndex finds documents of the same name and size in target chat by messages.search, which costs
+// a request per file. Files uploaded as photos lose their names, so they are never found.
+type existingIndex struct {
+	api  *tg.Client
+	peer tg.InputPeerClass
+}
+
+// exists reports whether a document of name and size exists in target chat
+func (x *existingIndex) exists(ctx context.Context, name string, size int64) (bool, error) {
+	r, err := x.api.MessagesSearch(ctx, &tg.MessagesSearchRequest{
+		Peer:   x.peer,
+		Q:      name,
+		Filter: &tg.InputMessagesFilterEmpty{},
+		Limit:  existingSearchLimit,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "search messages")
+	}
+	msgs, ok := r.AsModified()
+	if !ok {
+		return false, nil
+	}
+
+	for _, msg := range msgs.GetMessages() {
+		m, ok := msg.(*tg.Message)
+		if !ok {
+			continue
+		}
+		doc, ok := m.Media.(*tg.MessageMediaDocument)
+		if !ok {
+			continue
+		}
+		if media, ok := tmedia.GetDocumentInfo(doc); ok && media.Name == name && media.Size == size {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
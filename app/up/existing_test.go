@@ -0,0 +1,65 @@
+package up
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// searchInvoker returns msgs for any messages.search, and records queries
+type searchInvoker struct {
+	msgs    []tg.MessageClass
+	queries []string
+}
+
+func (i *searchInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	req, ok := input.(*tg.MessagesSearchRequest)
+	if !ok {
+		return errors.Errorf("unexpected request %T", input)
+	}
+	i.queries = append(i.queries, req.Q)
+
+	output.(*tg.MessagesMessagesBox).Messages = &tg.MessagesMessages{Messages: i.msgs}
+	return nil
+}
+
+func docMessage(id int, name string, size int64) *tg.Message {
+	return &tg.Message{ID: id, Media: &tg.MessageMediaDocument{Document: &tg.Document{
+		ID:         int64(id),
+		Size:       size,
+		Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: name}},
+	}}}
+}
+
+func TestExistingIndex(t *testing.T) {
+	ctx := context.Background()
+	inv := &searchInvoker{msgs: []tg.MessageClass{
+		docMessage(1, "a.mp4", 100),
+		docMessage(2, "a (1).mp4", 200),
+		&tg.Message{ID: 3, Message: "a.mp4", Media: &tg.MessageMediaPhoto{}},
+		&tg.MessageService{ID: 4},
+	}}
+	x := &existingIndex{api: tg.NewClient(inv), peer: &tg.InputPeerSelf{}}
+
+	for _, tt := range []struct {
+		name   string
+		size   int64
+		exists bool
+	}{
+		{name: "a.mp4", size: 100, exists: true},
+		{name: "a.mp4", size: 200},
+		{name: "a (1).mp4", size: 200, exists: true},
+		{name: "b.mp4", size: 100},
+	} {
+		exists, err := x.exists(ctx, tt.name, tt.size)
+		require.NoError(t, err)
+		assert.Equal(t, tt.exists, exists, "%s(%d)", tt.name, tt.size)
+	}
+
+	assert.Equal(t, []string{"a.mp4", "a.mp4", "a (1).mp4", "b.mp4"}, inv.queries)
+}
@@ -0,0 +1,107 @@
+package up
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/core/util/fsutil"
+)
+
+// patterns matches file names by extensions, e.g. "mp4" or ".mp4", and glob patterns, e.g. "IMG_*.jpg"
+type patterns struct {
+	exts  map[string]struct{}
+	globs []string
+}
+
+func newPatterns(ps []string) (*patterns, error) {
+	p := &patterns{exts: make(map[string]struct{})}
+
+	for _, s := range ps {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		if strings.ContainsAny(s, "*?[") {
+			if _, err := filepath.Match(s, ""); err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern %q", s)
+			}
+			p.globs = append(p.globs, s)
+			continue
+		}
+
+		p.exts[fsutil.AddPrefixDot(s)] = struct{}{}
+	}
+
+	return p, nil
+}
+
+func (p *patterns) empty() bool {
+	return len(p.exts) == 0 && len(p.globs) == 0
+}
+
+// hasExt reports whether ext is matched by extension patterns
+func (p *patterns) hasExt(ext string) bool {
+	_, ok := p.exts[ext]
+	return ok
+}
+
+func (p *patterns) match(name string) bool {
+	if p.hasExt(filepath.Ext(name)) {
+		return true
+	}
+
+	for _, g := range p.globs {
+		if ok, _ := filepath.Match(g, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readPatterns reads patterns from file, one per line. Empty lines and lines starting with '#' are ignored.
+func readPatterns(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := make([]string, 0)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r = append(r, line)
+	}
+
+	return r, sc.Err()
+}
+
+// withFilterFiles merges patterns of IncludeFrom and ExcludeFrom files into Includes and Excludes of opts
+func withFilterFiles(opts Options) (Options, error) {
+	if opts.IncludeFrom != "" {
+		ps, err := readPatterns(opts.IncludeFrom)
+		if err != nil {
+			return opts, errors.Wrap(err, "read include-from file")
+		}
+		opts.Includes = append(append([]string{}, opts.Includes...), ps...)
+	}
+
+	if opts.ExcludeFrom != "" {
+		ps, err := readPatterns(opts.ExcludeFrom)
+		if err != nil {
+			return opts, errors.Wrap(err, "read exclude-from file")
+		}
+		opts.Excludes = append(append([]string{}, opts.Excludes...), ps...)
+	}
+
+	return opts, nil
+}
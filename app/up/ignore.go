@@ -0,0 +1,185 @@
+package up
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// ignoreRule is a pattern line of gitignore-style ignore file, refer to https://git-scm.com/docs/gitignore
+type ignoreRule struct {
+	re      *regexp.Regexp // matches slash-separated path relative to directory of ignore file
+	negate  bool           // "!" prefix, re-includes matched paths
+	dirOnly bool           // "/" suffix, only matches directories
+}
+
+// ignoreRules are rules of an ignore file, and the last matched rule decides
+type ignoreRules []ignoreRule
+
+// match reports whether rel is ignored, and whether any rule matches it
+func (rs ignoreRules) match(rel string, isDir bool) (ignored, matched bool) {
+	for i := len(rs) - 1; i >= 0; i-- {
+		r := rs[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			return !r.negate, true
+		}
+	}
+	return false, false
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false, nil
+	}
+
+	r := ignoreRule{}
+	switch {
+	case strings.HasPrefix(line, "!"):
+		r.negate, line = true, line[1:]
+	case strings.HasPrefix(line, `\#`), strings.HasPrefix(line, `\!`):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false, nil
+	}
+
+	// patterns without slash match names at any level, otherwise they are relative to ignore file
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := &strings.Builder{}
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case strings.HasPrefix(line[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "/**") && i+3 == len(line):
+			expr.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(line):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(line[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return ignoreRule{}, false, errors.Wrapf(err, "invalid pattern %q", line)
+	}
+	r.re = re
+
+	return r, true, nil
+}
+
+func readIgnoreFile(path string) (ignoreRules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	rules := make(ignoreRules, 0)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		r, ok, err := parseIgnoreRule(sc.Text())
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s", path)
+		}
+		if ok {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, sc.Err()
+}
+
+// ignorer applies ignore files found during walk hierarchically like git,
+// so rules of deeper directories take precedence over rules of parent directories.
+type ignorer struct {
+	names []string               // names of ignore files, e.g. .tdlignore
+	rules map[string]ignoreRules // dir -> rules of ignore files in it
+}
+
+func newIgnorer(names []string) *ignorer {
+	return &ignorer{
+		names: names,
+		rules: make(map[string]ignoreRules),
+	}
+}
+
+// load reads ignore files in dir, which must be called before walking into dir
+func (ig *ignorer) load(dir string) error {
+	dir = filepath.Clean(dir)
+	for _, name := range ig.names {
+		rules, err := readIgnoreFile(filepath.Join(dir, name))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return errors.Wrap(err, "read ignore file")
+		}
+		ig.rules[dir] = append(ig.rules[dir], rules...)
+	}
+	return nil
+}
+
+// ignored reports whether path under root is ignored by ignore files in directories from root to its parent
+func (ig *ignorer) ignored(root, path string, isDir bool) bool {
+	if len(ig.names) == 0 {
+		return false
+	}
+	root, path = filepath.Clean(root), filepath.Clean(path)
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if rules, ok := ig.rules[dir]; ok {
+			rel, err := filepath.Rel(dir, path)
+			if err == nil {
+				if ignored, matched := rules.match(filepath.ToSlash(rel), isDir); matched {
+					return ignored
+				}
+			}
+		}
+
+		if dir == root || dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
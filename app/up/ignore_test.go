@@ -0,0 +1,89 @@
+package up
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matched bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "sub/a.log", false, true},
+		{"*.log", "a.log.txt", false, false},
+		{"/a.log", "sub/a.log", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "sub/build", true, true},
+		{"docs/*.md", "docs/a.md", false, true},
+		{"docs/*.md", "docs/sub/a.md", false, false},
+		{"docs/*.md", "x/docs/a.md", false, false},
+		{"**/cache", "a/b/cache", true, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"out/**", "out/a/b", false, true},
+		{"img?.[pj]ng", "img1.png", false, true},
+		{"img?.[!pj]ng", "img1.png", false, false},
+		{`\#literal`, "#literal", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"@"+tt.path, func(t *testing.T) {
+			r, ok, err := parseIgnoreRule(tt.pattern)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			_, matched := ignoreRules{r}.match(tt.path, tt.isDir)
+			assert.Equal(t, tt.matched, matched)
+		})
+	}
+
+	for _, line := range []string{"", "# comment", "   ", "/"} {
+		_, ok, err := parseIgnoreRule(line)
+		require.NoError(t, err)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestWalk_IgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir,
+		"a.txt", "a.log", "build/out.bin",
+		"sub/b.log", "sub/keep.log", "sub/c.tmp", "sub/deep/d.tmp",
+		"other/e.tmp",
+	)
+
+	writeIgnore := func(path, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0o644))
+	}
+	writeIgnore(".tdlignore", "*.log\nbuild/\n.tdlignore\n")
+	// nested rules take precedence, and are relative to the directory
+	writeIgnore("sub/.tdlignore", "!keep.log\n*.tmp\n.tdlignore\n")
+
+	files, err := walk(context.Background(), Options{Paths: []string{dir + string(filepath.Separator)}, IgnoreFiles: []string{".tdlignore"}}, io.Discard, nil)
+	require.NoError(t, err)
+
+	expected := []string{"a.txt", "sub/keep.log", "other/e.tmp"}
+	actual := make([]string, 0, len(files))
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f.file)
+		require.NoError(t, err)
+		actual = append(actual, filepath.ToSlash(rel))
+	}
+	assert.ElementsMatch(t, expected, actual)
+
+	// disabled by default
+	files, err = walk(context.Background(), Options{Paths: []string{dir}}, io.Discard, nil)
+	require.NoError(t, err)
+	assert.Len(t, files, 10)
+}
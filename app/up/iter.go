@@ -2,7 +2,9 @@ package up
 
 import (
 	"context"
+	"io"
 	"os"
+	"text/template"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
@@ -14,29 +16,47 @@ import (
 )
 
 type file struct {
-	file  string
+	file  string // local path, or name of stream if reader is not nil
+	root  string // input path which file is walked from
 	thumb string
+	mime  string // detected MIME type, empty if not detected yet
+	// document forces file to be sent as document, even if it's a photo, video or audio
+	document bool
+
+	reader io.Reader    // stream to upload instead of local file
+	part   *filePart    // range of local file to upload as a part of split file, nil if not split
+	origin *splitOrigin // local file of split part or index, nil if not split
+	size   int64        // size of stream or local file at walk, negative means unknown
 }
 
 type iter struct {
-	files  []*file
+	groups [][]*file // files of each group are sent as an album if there are more than one
 	to     peers.Peer
+	topic  int
 	photo  bool
 	remove bool
 	delay  time.Duration
+	// caption is the template of captions, nil means the default caption
+	caption *template.Template
+	video   *videoProber
 
 	cur  int
 	err  error
 	file uploader.Elem
 }
 
-func newIter(files []*file, to peers.Peer, photo, remove bool, delay time.Duration) *iter {
+func newIter(groups [][]*file, to peers.Peer, topic int, photo, remove bool, delay time.Duration,
+	caption *template.Template, video *videoProber,
+) *iter {
 	return &iter{
-		files:  files,
-		to:     to,
-		photo:  photo,
-		remove: remove,
-		delay:  delay,
+		groups:  groups,
+		to:      to,
+		topic:   topic,
+		photo:   photo,
+		remove:  remove,
+		delay:   delay,
+		caption: caption,
+		video:   video,
 
 		cur:  0,
 		err:  nil,
@@ -44,6 +64,15 @@ func newIter(files []*file, to peers.Peer, photo, remove bool, delay time.Durati
 	}
 }
 
+// singleGroups puts each file in its own group, so that no albums are sent
+func singleGroups(files []*file) [][]*file {
+	groups := make([][]*file, 0, len(files))
+	for _, f := range files {
+		groups = append(groups, []*file{f})
+	}
+	return groups
+}
+
 func (i *iter) Next(ctx context.Context) bool {
 	select {
 	case <-ctx.Done():
@@ -52,7 +81,7 @@ func (i *iter) Next(ctx context.Context) bool {
 	default:
 	}
 
-	if i.cur >= len(i.files) || i.err != nil {
+	if i.cur >= len(i.groups) || i.err != nil {
 		return false
 	}
 
@@ -61,48 +90,154 @@ func (i *iter) Next(ctx context.Context) bool {
 		time.Sleep(i.delay)
 	}
 
-	cur := i.files[i.cur]
+	group := i.groups[i.cur]
 	i.cur++
 
+	if len(group) == 1 {
+		elem, err := i.open(group[0], i.photo)
+		if err != nil {
+			i.err = err
+			return false
+		}
+		i.file = elem
+		return true
+	}
+
+	album := &albumElem{elems: make([]uploader.Elem, 0, len(group))}
+	for _, cur := range group {
+		// images are grouped with videos only as photos
+		elem, err := i.open(cur, true)
+		if err != nil {
+			for _, e := range album.elems {
+				e := e.(*iterElem)
+				_ = e.file.Close()
+				if e.thumb != nil {
+					_ = e.thumb.Close()
+				}
+			}
+			i.err = err
+			return false
+		}
+		album.elems = append(album.elems, elem)
+	}
+	album.iterElem = album.elems[0].(*iterElem)
+	i.file = album
+
+	return true
+}
+
+func (i *iter) open(cur *file, photo bool) (_ *iterElem, rerr error) {
+	// files opened before failure are closed, as they are never passed to progress
+	var opened []io.Closer
+	defer func() {
+		if rerr == nil {
+			return
+		}
+		for _, c := range opened {
+			_ = c.Close()
+		}
+	}()
+
+	if cur.reader != nil {
+		s, err := newStreamFile(cur)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open stream %s", cur.file)
+		}
+		opened = append(opened, s)
+
+		elem := &iterElem{
+			file:  s,
+			to:    i.to,
+			topic: i.topic,
+			video: i.video,
+
+			asPhoto:    photo,
+			asDocument: cur.document,
+			origin:     cur.origin,
+		}
+		if err = i.setCaption(elem, cur, cur.size); err != nil {
+			return nil, err
+		}
+		return elem, nil
+	}
+
+	if cur.part != nil {
+		p, err := openPart(cur)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open part %s", cur.file)
+		}
+		opened = append(opened, p)
+
+		elem := &iterElem{
+			file:  p,
+			to:    i.to,
+			topic: i.topic,
+
+			asDocument: true,
+			origin:     cur.origin,
+		}
+		if err = i.setCaption(elem, cur, cur.size); err != nil {
+			return nil, err
+		}
+		return elem, nil
+	}
+
 	f, err := os.Open(cur.file)
 	if err != nil {
-		i.err = errors.Wrap(err, "open file")
-		return false
+		return nil, errors.Wrap(err, "open file")
 	}
+	opened = append(opened, f)
 
 	var thumb *uploaderFile = nil
 	// has thumbnail
 	if cur.thumb != "" {
 		tMime, err := mimetype.DetectFile(cur.thumb)
 		if err != nil || !mediautil.IsImage(tMime.String()) { // TODO(iyear): jpg only
-			i.err = errors.Wrapf(err, "invalid thumbnail file: %v", cur.thumb)
-			return false
+			return nil, errors.Wrapf(err, "invalid thumbnail file: %v", cur.thumb)
 		}
 		thumbFile, err := os.Open(cur.thumb)
 		if err != nil {
-			i.err = errors.Wrap(err, "open thumbnail file")
-			return false
+			return nil, errors.Wrap(err, "open thumbnail file")
 		}
+		opened = append(opened, thumbFile)
 
 		thumb = &uploaderFile{File: thumbFile, size: 0}
 	}
 
 	stat, err := f.Stat()
 	if err != nil {
-		i.err = errors.Wrap(err, "stat file")
-		return false
+		return nil, errors.Wrap(err, "stat file")
 	}
 
-	i.file = &iterElem{
-		file:  &uploaderFile{File: f, size: stat.Size()},
+	elem := &iterElem{
+		file:  &uploaderFile{File: f, size: stat.Size(), mime: cur.mime},
 		thumb: thumb,
 		to:    i.to,
+		topic: i.topic,
+		video: i.video,
 
-		asPhoto: i.photo,
-		remove:  i.remove,
+		asPhoto:    photo,
+		asDocument: cur.document,
+		remove:     i.remove,
+	}
+	if err = i.setCaption(elem, cur, stat.Size()); err != nil {
+		return nil, err
 	}
 
-	return true
+	return elem, nil
+}
+
+func (i *iter) setCaption(elem *iterElem, cur *file, size int64) error {
+	if i.caption == nil {
+		return nil
+	}
+
+	caption, err := execCaption(i.caption, cur, size)
+	if err != nil {
+		return errors.Wrapf(err, "caption of %s", cur.file)
+	}
+	elem.caption = &caption
+	return nil
 }
 
 func (i *iter) Value() uploader.Elem {
@@ -0,0 +1,150 @@
+package up
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/core/util/fsutil"
+)
+
+// manifestEntry is the record of an uploaded file
+type manifestEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"` // hex sha256 of content
+	Peer    int64     `json:"peer"`
+	Message int       `json:"message"`
+}
+
+// manifestSaveBatch is the number of records which are saved to manifest together, so that
+// the whole manifest is not rewritten for each uploaded file
+const manifestSaveBatch = 100
+
+// manifest records uploaded files, so that files with unchanged content can be skipped in next run
+type manifest struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]manifestEntry // key: absolute path
+	unsaved int                      // number of records which are not saved yet
+}
+
+func loadManifest(path string) (*manifest, error) {
+	m := &manifest{path: path, entries: make(map[string]manifestEntry)}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return m, nil
+		}
+		return nil, errors.Wrap(err, "read manifest")
+	}
+
+	if err = json.Unmarshal(b, &m.entries); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal manifest %s", path)
+	}
+
+	return m, nil
+}
+
+// uploaded reports whether file has been uploaded to peer and its content is unchanged.
+// Content is hashed only if size is the same but modification time is changed.
+func (m *manifest) uploaded(path string, peer int64) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	entry, ok := m.entries[abs]
+	m.mu.Unlock()
+	if !ok || entry.Peer != peer {
+		return false, nil
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, errors.Wrap(err, "stat file")
+	}
+	if stat.Size() != entry.Size {
+		return false, nil
+	}
+	if stat.ModTime().Equal(entry.ModTime) {
+		return true, nil
+	}
+
+	hash, err := fsutil.HashFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	return hash == entry.Hash, nil
+}
+
+// record adds uploaded file to manifest, which is saved by batch
+func (m *manifest) record(path string, peer int64, msgID int) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "stat file")
+	}
+	hash, err := fsutil.HashFile(path)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[abs] = manifestEntry{
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+		Hash:    hash,
+		Peer:    peer,
+		Message: msgID,
+	}
+
+	if m.unsaved++; m.unsaved >= manifestSaveBatch {
+		return m.save()
+	}
+	return nil
+}
+
+// Close saves records which are not saved yet, and it's called when upload is done
+func (m *manifest) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.unsaved == 0 {
+		return nil
+	}
+	return m.save()
+}
+
+// save writes manifest to a temp file and renames it to avoid corruption on interruption, mu must be held
+func (m *manifest) save() error {
+	b, err := json.Marshal(m.entries)
+	if err != nil {
+		return errors.Wrap(err, "marshal manifest")
+	}
+
+	tmp := m.path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0o644); err != nil {
+		return errors.Wrap(err, "write manifest")
+	}
+
+	if err = os.Rename(tmp, m.path); err != nil {
+		return errors.Wrap(err, "rename manifest")
+	}
+	m.unsaved = 0
+	return nil
+}
@@ -0,0 +1,81 @@
+package up
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt")
+	path := filepath.Join(dir, "a.txt")
+	mfPath := filepath.Join(dir, "manifest.json")
+
+	mf, err := loadManifest(mfPath)
+	require.NoError(t, err)
+
+	uploaded, err := mf.uploaded(path, 1)
+	require.NoError(t, err)
+	assert.False(t, uploaded)
+
+	require.NoError(t, mf.record(path, 1, 100))
+	_, err = os.Stat(mfPath)
+	assert.ErrorIs(t, err, os.ErrNotExist, "saved by batch")
+	require.NoError(t, mf.Close())
+
+	// reload from disk
+	mf, err = loadManifest(mfPath)
+	require.NoError(t, err)
+	assert.Equal(t, 100, mf.entries[path].Message)
+
+	uploaded, err = mf.uploaded(path, 1)
+	require.NoError(t, err)
+	assert.True(t, uploaded)
+
+	// another peer
+	uploaded, err = mf.uploaded(path, 2)
+	require.NoError(t, err)
+	assert.False(t, uploaded)
+
+	// only modification time changed
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, later, later))
+	uploaded, err = mf.uploaded(path, 1)
+	require.NoError(t, err)
+	assert.True(t, uploaded)
+
+	// content changed with the same size
+	require.NoError(t, os.WriteFile(path, []byte("b.txt"), 0o644))
+	uploaded, err = mf.uploaded(path, 1)
+	require.NoError(t, err)
+	assert.False(t, uploaded)
+}
+
+func TestManifest_SaveBatch(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt")
+	path := filepath.Join(dir, "a.txt")
+	mfPath := filepath.Join(dir, "manifest.json")
+
+	mf, err := loadManifest(mfPath)
+	require.NoError(t, err)
+
+	for i := 0; i < manifestSaveBatch; i++ {
+		require.NoError(t, mf.record(path, 1, i))
+	}
+	saved, err := loadManifest(mfPath)
+	require.NoError(t, err)
+	assert.Equal(t, manifestSaveBatch-1, saved.entries[path].Message)
+
+	// nothing to flush
+	require.NoError(t, mf.Close())
+	require.NoError(t, os.Remove(mfPath))
+	require.NoError(t, mf.Close())
+	_, err = os.Stat(mfPath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
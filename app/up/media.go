@@ -0,0 +1,101 @@
+package up
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/core/util/mediautil"
+)
+
+const (
+	mediaImage    = "image"
+	mediaVideo    = "video"
+	mediaAudio    = "audio"
+	mediaDocument = "document"
+)
+
+var mediaCategories = []string{mediaImage, mediaVideo, mediaAudio, mediaDocument}
+
+// mediaFilter filters files by media category of detected MIME type, regardless of file extension
+type mediaFilter struct {
+	include map[string]struct{}
+	exclude map[string]struct{}
+}
+
+// newMediaFilter returns nil if no filter is specified, so that files won't be sniffed unnecessarily
+func newMediaFilter(include, exclude []string) (*mediaFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	toMap := func(categories []string) (map[string]struct{}, error) {
+		m := make(map[string]struct{}, len(categories))
+		for _, c := range categories {
+			c = strings.ToLower(strings.TrimSpace(c))
+			if !isMediaCategory(c) {
+				return nil, fmt.Errorf("invalid media category %q, available: %s", c, strings.Join(mediaCategories, ", "))
+			}
+			m[c] = struct{}{}
+		}
+		return m, nil
+	}
+
+	in, err := toMap(include)
+	if err != nil {
+		return nil, err
+	}
+	ex, err := toMap(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mediaFilter{include: in, exclude: ex}, nil
+}
+
+// match detects MIME type of f and caches it on f
+func (m *mediaFilter) match(f *file) (bool, error) {
+	if f.mime == "" {
+		mime, err := mimetype.DetectFile(f.file)
+		if err != nil {
+			return false, errors.Wrapf(err, "detect mime of %s", f.file)
+		}
+		f.mime = mime.String()
+	}
+
+	c := mediaCategory(f.mime)
+	if len(m.include) > 0 {
+		if _, ok := m.include[c]; !ok {
+			return false, nil
+		}
+	}
+	if _, ok := m.exclude[c]; ok {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func mediaCategory(mime string) string {
+	switch {
+	case mediautil.IsImage(mime):
+		return mediaImage
+	case mediautil.IsVideo(mime):
+		return mediaVideo
+	case mediautil.IsAudio(mime):
+		return mediaAudio
+	default:
+		return mediaDocument
+	}
+}
+
+func isMediaCategory(c string) bool {
+	for _, category := range mediaCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package up
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"sync"
 
@@ -16,7 +17,13 @@ import (
 
 type progress struct {
 	pw       pw.Writer
+	out      io.Writer // errors are also written to it with JSON results
 	trackers *sync.Map // map[tuple]*pw.Tracker
+	manifest *manifest // nil if not enabled
+	total    *totalProgress
+	cp       *checkpoint // nil if not enabled
+	results  *results    // nil if not enabled
+	verifier *verifier   // nil if not enabled
 }
 
 type tuple struct {
@@ -24,10 +31,16 @@ type tuple struct {
 	to   int64
 }
 
-func newProgress(p pw.Writer) *progress {
+func newProgress(p pw.Writer, out io.Writer, mf *manifest, cp *checkpoint, rs *results, vf *verifier, total *totalProgress) *progress {
 	return &progress{
 		pw:       p,
+		out:      out,
 		trackers: &sync.Map{},
+		manifest: mf,
+		cp:       cp,
+		results:  rs,
+		verifier: vf,
+		total:    total,
 	}
 }
 
@@ -45,6 +58,8 @@ func (p *progress) OnUpload(elem uploader.Elem, state uploader.ProgressState) {
 	t := tracker.(*pw.Tracker)
 	t.UpdateTotal(state.Total)
 	t.SetValue(state.Uploaded)
+
+	p.total.update(p.tuple(elem), elem.(*iterElem).display(), state.Uploaded)
 }
 
 func (p *progress) OnDone(elem uploader.Elem, err error) {
@@ -65,14 +80,63 @@ func (p *progress) OnDone(elem uploader.Elem, err error) {
 		return
 	}
 
+	if p.results != nil {
+		if err := p.results.record(e); err != nil {
+			p.fail(t, elem, err)
+			return
+		}
+	}
+
+	// split file is recorded by message of its last sent part or index, and it's never verified or removed
+	if e.origin != nil {
+		if e.origin.sent() {
+			if err := p.record(e.origin.path, e); err != nil {
+				p.fail(t, elem, err)
+			}
+		}
+		return
+	}
+
+	// streams are not recorded, verified or removed
+	if e.file.Path() == "" {
+		return
+	}
+
+	if err := p.record(e.file.Path(), e); err != nil {
+		p.fail(t, elem, err)
+		return
+	}
+	if p.verifier != nil {
+		p.verifier.add(e)
+	}
+
 	if e.remove {
-		if err := os.Remove(e.file.File.Name()); err != nil {
+		if err := os.Remove(e.file.Path()); err != nil {
 			p.fail(t, elem, errors.Wrap(err, "remove file"))
 			return
 		}
 	}
 }
 
+// record records local file of path uploaded by e in manifest and checkpoint
+func (p *progress) record(path string, e *iterElem) error {
+	if p.manifest != nil {
+		if err := p.manifest.record(path, e.to.ID(), e.sent.ID); err != nil {
+			return errors.Wrap(err, "record manifest")
+		}
+	}
+	if p.cp != nil {
+		if err := p.cp.record(path, e.to.ID(), e.sent.ID); err != nil {
+			return errors.Wrap(err, "record checkpoint")
+		}
+	}
+	return nil
+}
+
+func (p *progress) OnSent(elem uploader.Elem, msg uploader.SentMessage) {
+	elem.(*iterElem).sent = msg
+}
+
 func (p *progress) closeFile(e *iterElem) error {
 	if err := e.file.Close(); err != nil {
 		return errors.Wrap(err, "close file")
@@ -88,12 +152,17 @@ func (p *progress) closeFile(e *iterElem) error {
 }
 
 func (p *progress) fail(t *pw.Tracker, elem uploader.Elem, err error) {
-	p.pw.Log(color.RedString("%s error: %s", p.elemString(elem), err.Error()))
+	msg := color.RedString("%s error: %s", p.elemString(elem), err.Error())
+	// progress UI is not rendered with JSON results
+	if p.results != nil {
+		_, _ = fmt.Fprintln(p.out, msg)
+	}
+	p.pw.Log(msg)
 	t.MarkAsErrored()
 }
 
 func (p *progress) tuple(elem uploader.Elem) tuple {
-	return tuple{elem.(*iterElem).file.File.Name(), elem.(*iterElem).to.ID()}
+	return tuple{elem.(*iterElem).display(), elem.(*iterElem).to.ID()}
 }
 
 func (p *progress) processMessage(elem uploader.Elem) string {
@@ -102,5 +171,5 @@ func (p *progress) processMessage(elem uploader.Elem) string {
 
 func (p *progress) elemString(elem uploader.Elem) string {
 	e := elem.(*iterElem)
-	return fmt.Sprintf("%s -> %s(%d)", e.file.File.Name(), e.to.VisibleName(), e.to.ID())
+	return fmt.Sprintf("%s -> %s(%d)", e.display(), e.to.VisibleName(), e.to.ID())
 }
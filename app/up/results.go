@@ -0,0 +1,51 @@
+package up
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// resultEntry is a JSON line of an uploaded file
+type resultEntry struct {
+	Path    string    `json:"path"` // display name for streams, e.g. stdin
+	Size    int64     `json:"size"`
+	Chat    int64     `json:"chat"`
+	Message int       `json:"message"` // zero if unknown
+	Date    time.Time `json:"date"`    // date of the sent message, zero if unknown
+}
+
+// results writes each uploaded file as a JSON line as soon as it's done, so that
+// files uploaded before failures of others are still reported.
+type results struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newResults(w io.Writer) *results {
+	return &results{enc: json.NewEncoder(w)}
+}
+
+func (r *results) record(e *iterElem) error {
+	path := e.file.Path()
+	if path == "" {
+		path = e.display()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(resultEntry{
+		Path:    path,
+		Size:    e.file.Size(),
+		Chat:    e.to.ID(),
+		Message: e.sent.ID,
+		Date:    e.sent.Date,
+	}); err != nil {
+		return errors.Wrap(err, "write result")
+	}
+	return nil
+}
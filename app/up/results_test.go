@@ -0,0 +1,66 @@
+package up
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/peers"
+	pw "github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/core/uploader"
+)
+
+type fakePeer struct {
+	peers.Peer
+	id int64
+}
+
+func (p fakePeer) ID() int64           { return p.id }
+func (p fakePeer) VisibleName() string { return "peer" }
+
+func TestResults(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt")
+
+	buf := &bytes.Buffer{}
+	p := newProgress(pw.NewWriter(), io.Discard, nil, nil, newResults(buf), nil, newTotalProgress(nil, nil))
+
+	elems := make([]*iterElem, 0)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		require.NoError(t, err)
+		elems = append(elems, &iterElem{file: &uploaderFile{File: f, size: 5}, to: fakePeer{id: 1}})
+	}
+
+	// the first file is sent, and the second one fails
+	for _, e := range elems {
+		p.OnAdd(e)
+	}
+	p.OnSent(elems[0], uploader.SentMessage{ID: 100, Date: time.Unix(1700000000, 0)})
+	p.OnDone(elems[0], nil)
+	p.OnDone(elems[1], errors.New("upload failed"))
+
+	sc := bufio.NewScanner(buf)
+	lines := make([]resultEntry, 0)
+	for sc.Scan() {
+		var e resultEntry
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &e))
+		lines = append(lines, e)
+	}
+
+	require.Len(t, lines, 1, "only uploaded files are reported")
+	assert.Equal(t, filepath.Join(dir, "a.txt"), lines[0].Path)
+	assert.Equal(t, int64(5), lines[0].Size)
+	assert.Equal(t, int64(1), lines[0].Chat)
+	assert.Equal(t, 100, lines[0].Message)
+	assert.True(t, time.Unix(1700000000, 0).Equal(lines[0].Date), "date of the sent message")
+}
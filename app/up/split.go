@@ -0,0 +1,120 @@
+package up
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/pkg/splitfile"
+)
+
+// filePart is a range of local file which is uploaded as a part of split file
+type filePart struct {
+	path   string
+	offset int64
+}
+
+// splitOrigin is the local file of parts and index, which is recorded once all of them are sent
+type splitOrigin struct {
+	path string
+	left atomic.Int32 // number of parts and index which are not sent yet
+}
+
+// sent marks a part or index as sent, and reports whether all of them are sent
+func (o *splitOrigin) sent() bool {
+	return o.left.Add(-1) == 0
+}
+
+// splitFiles replaces local files larger than size with their parts and index, and streams are never split.
+// Parts and index are sent as documents, which can be reassembled by splitfile.Reassemble after download.
+func splitFiles(files []*file, size int64) ([]*file, int, error) {
+	r, split := make([]*file, 0, len(files)), 0
+	for _, f := range files {
+		if f.reader != nil || f.size <= size {
+			r = append(r, f)
+			continue
+		}
+
+		idx, err := splitfile.Split(f.file, size)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "split %s", f.file)
+		}
+		origin := &splitOrigin{path: f.file}
+		origin.left.Store(int32(len(idx.Parts) + 1))
+		for _, p := range idx.Parts {
+			r = append(r, &file{
+				file:     filepath.Join(filepath.Dir(f.file), p.Name),
+				root:     f.root,
+				document: true,
+				part:     &filePart{path: f.file, offset: p.Offset},
+				origin:   origin,
+				size:     p.Size,
+			})
+		}
+
+		b, err := json.MarshalIndent(idx, "", "  ")
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "marshal index")
+		}
+		r = append(r, &file{
+			file:     splitfile.IndexName(idx.Name),
+			root:     f.root,
+			document: true,
+			reader:   bytes.NewReader(b),
+			origin:   origin,
+			size:     int64(len(b)),
+		})
+		split++
+	}
+
+	return r, split, nil
+}
+
+// partFile is a part of local file, which is seekable like the whole file
+type partFile struct {
+	*io.SectionReader
+	f    *os.File
+	path string // path of part, which doesn't exist
+	mime string
+}
+
+func openPart(f *file) (*partFile, error) {
+	fd, err := os.Open(f.part.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file")
+	}
+
+	return &partFile{
+		SectionReader: io.NewSectionReader(fd, f.part.offset, f.size),
+		f:             fd,
+		path:          f.file,
+		mime:          "application/octet-stream",
+	}, nil
+}
+
+func (p *partFile) Name() string {
+	return filepath.Base(p.path)
+}
+
+func (p *partFile) MIME() string {
+	return p.mime
+}
+
+func (p *partFile) Close() error {
+	return p.f.Close()
+}
+
+// Path is empty, as parts are not local files to be recorded, verified or removed,
+// and the split file is recorded by splitOrigin instead
+func (p *partFile) Path() string {
+	return ""
+}
+
+func (p *partFile) display() string {
+	return p.path
+}
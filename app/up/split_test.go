@@ -0,0 +1,107 @@
+package up
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pw "github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/pkg/splitfile"
+)
+
+func TestSplitFiles(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 2500)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.bin"), data, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "small.txt"), []byte("small"), 0o644))
+
+	files, err := walk(context.Background(), Options{Paths: []string{dir}}, io.Discard, nil)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	files, split, err := splitFiles(files, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, 1, split)
+	require.Len(t, files, 5, "3 parts, index and the small file")
+
+	it := newIter(singleGroups(files), nil, 0, false, false, 0, nil, nil)
+	uploaded := make(map[string][]byte)
+	for it.Next(context.Background()) {
+		e := it.Value().(*iterElem)
+		b, err := io.ReadAll(e.file)
+		require.NoError(t, err)
+		require.NoError(t, e.file.Close())
+		assert.Equal(t, int64(len(b)), e.file.Size())
+
+		if _, ok := e.file.(*partFile); ok {
+			assert.True(t, e.AsDocument())
+			assert.Equal(t, filepath.Join(dir, e.file.Name()), e.display())
+		}
+		uploaded[e.file.Name()] = b
+	}
+	require.NoError(t, it.Err())
+
+	// downloaded parts are reassembled by index
+	require.Contains(t, uploaded, "big.bin.index.json")
+	out := t.TempDir()
+	for name, b := range uploaded {
+		require.NoError(t, os.WriteFile(filepath.Join(out, name), b, 0o644))
+	}
+	idx, err := splitfile.ReadIndex(filepath.Join(out, "big.bin.index.json"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"big.bin.part001", "big.bin.part002", "big.bin.part003"},
+		[]string{idx.Parts[0].Name, idx.Parts[1].Name, idx.Parts[2].Name})
+
+	dst := filepath.Join(out, "big.bin")
+	require.NoError(t, splitfile.Reassemble(idx, dst, func(p splitfile.Part) string { return filepath.Join(out, p.Name) }))
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	assert.Equal(t, []byte("small"), uploaded["small.txt"])
+}
+
+func TestSplitFiles_Record(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.bin")
+	require.NoError(t, os.WriteFile(path, make([]byte, 2500), 0o644))
+
+	files, err := walk(context.Background(), Options{Paths: []string{dir}}, io.Discard, nil)
+	require.NoError(t, err)
+	files, _, err = splitFiles(files, 1024)
+	require.NoError(t, err)
+	require.Len(t, files, 4, "3 parts and index")
+
+	cp, err := openCheckpoint(filepath.Join(dir, "checkpoint.jsonl"), false)
+	require.NoError(t, err)
+	defer func() { _ = cp.Close() }()
+	p := newProgress(pw.NewWriter(), io.Discard, nil, cp, nil, nil, newTotalProgress(nil, files))
+
+	it := newIter(singleGroups(files), fakePeer{id: 1}, 0, false, false, 0, nil, nil)
+	elems := make([]*iterElem, 0)
+	for it.Next(context.Background()) {
+		e := it.Value().(*iterElem)
+		p.OnAdd(e)
+		elems = append(elems, e)
+	}
+	require.NoError(t, it.Err())
+
+	// the split file is recorded only after all parts and index are sent
+	for i, e := range elems {
+		p.OnSent(e, uploader.SentMessage{ID: 100 + i})
+		p.OnDone(e, nil)
+
+		uploaded, err := cp.uploaded(path, 1)
+		require.NoError(t, err)
+		assert.Equal(t, i == len(elems)-1, uploaded, "after %d elems", i+1)
+	}
+}
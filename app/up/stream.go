@@ -0,0 +1,110 @@
+package up
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-faster/errors"
+)
+
+// StdinPath is the special input path to upload from stdin
+const StdinPath = "-"
+
+// maxStreamBuffer is the max size of streams with unknown length, which are fully buffered
+// in memory to get the size before uploading.
+const maxStreamBuffer = 256 * 1024 * 1024
+
+// mimeSniffSize is the number of bytes used to detect MIME type of streams
+const mimeSniffSize = 3072
+
+var errStreamSeek = errors.New("stream is not seekable")
+
+// streamFile is a non-seekable stream to upload, MIME type is detected by peeking the head
+type streamFile struct {
+	r      io.Reader
+	closer io.Closer
+	name   string
+	size   int64
+	mime   string
+	read   int64
+}
+
+// newStreamFile reads stream of f. If size is unknown(negative), the whole stream is
+// buffered in memory with the limit of maxStreamBuffer.
+func newStreamFile(f *file) (*streamFile, error) {
+	var closer io.Closer = io.NopCloser(nil)
+	if c, ok := f.reader.(io.Closer); ok {
+		closer = c
+	}
+
+	s := &streamFile{closer: closer, name: f.file, size: f.size}
+
+	if f.size < 0 {
+		buf, err := io.ReadAll(io.LimitReader(f.reader, maxStreamBuffer+1))
+		if err != nil {
+			return nil, errors.Wrap(err, "buffer stream")
+		}
+		if len(buf) > maxStreamBuffer {
+			return nil, errors.Errorf("stream with unknown size exceeds %d bytes, please specify the size", maxStreamBuffer)
+		}
+
+		s.r, s.size = bytes.NewReader(buf), int64(len(buf))
+		s.mime = mimetype.Detect(buf).String()
+		return s, nil
+	}
+
+	br := bufio.NewReaderSize(f.reader, mimeSniffSize)
+	head, err := br.Peek(mimeSniffSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrap(err, "peek stream")
+	}
+	s.r, s.mime = br, mimetype.Detect(head).String()
+
+	return s, nil
+}
+
+func (s *streamFile) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.read += int64(n)
+	return n, err
+}
+
+// Seek only supports querying current offset and rewinding before reading
+func (s *streamFile) Seek(offset int64, whence int) (int64, error) {
+	switch {
+	case offset == 0 && whence == io.SeekCurrent:
+		return s.read, nil
+	case offset == 0 && whence == io.SeekStart && s.read == 0:
+		return 0, nil
+	}
+
+	if rs, ok := s.r.(io.Seeker); ok { // buffered stream
+		n, err := rs.Seek(offset, whence)
+		s.read = n
+		return n, err
+	}
+
+	return 0, errStreamSeek
+}
+
+func (s *streamFile) Close() error {
+	return s.closer.Close()
+}
+
+func (s *streamFile) Name() string {
+	return s.name
+}
+
+func (s *streamFile) Size() int64 {
+	return s.size
+}
+
+func (s *streamFile) MIME() string {
+	return s.mime
+}
+
+func (s *streamFile) Path() string {
+	return ""
+}
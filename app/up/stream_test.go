@@ -0,0 +1,58 @@
+package up
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamFile(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 1, 1))))
+	data := buf.Bytes()
+
+	t.Run("known size", func(t *testing.T) {
+		s, err := newStreamFile(&file{file: "a.png", reader: io.MultiReader(bytes.NewReader(data)), size: int64(len(data))})
+		require.NoError(t, err)
+
+		assert.Equal(t, "a.png", s.Name())
+		assert.Equal(t, "", s.Path())
+		assert.Equal(t, "image/png", s.MIME())
+		assert.Equal(t, int64(len(data)), s.Size())
+
+		_, err = s.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+
+		b, err := io.ReadAll(s)
+		require.NoError(t, err)
+		assert.Equal(t, data, b)
+
+		// not seekable after reading
+		_, err = s.Seek(0, io.SeekStart)
+		assert.ErrorIs(t, err, errStreamSeek)
+	})
+
+	t.Run("unknown size", func(t *testing.T) {
+		s, err := newStreamFile(&file{file: "a.png", reader: io.MultiReader(bytes.NewReader(data)), size: -1})
+		require.NoError(t, err)
+
+		assert.Equal(t, "image/png", s.MIME())
+		assert.Equal(t, int64(len(data)), s.Size())
+
+		b, err := io.ReadAll(s)
+		require.NoError(t, err)
+		assert.Equal(t, data, b)
+
+		// buffered stream is seekable
+		_, err = s.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		b, err = io.ReadAll(s)
+		require.NoError(t, err)
+		assert.Equal(t, data, b)
+	})
+}
@@ -0,0 +1,59 @@
+package up
+
+import (
+	"context"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+)
+
+var (
+	// ErrNotForum is returned when topic is set but destination chat isn't a forum.
+	ErrNotForum = errors.New("chat is not a forum")
+	// ErrTopicNotFound is returned when topic doesn't exist or is deleted in destination forum.
+	ErrTopicNotFound = errors.New("topic not found")
+)
+
+// generalTopic is the ID of General topic, whose messages are sent without replying to it
+const generalTopic = 1
+
+// resolveTopic checks topic exists in forum to, and returns ID to reply to, where zero means the General topic
+func resolveTopic(ctx context.Context, api *tg.Client, to peers.Peer, topic int) (int, error) {
+	if topic == 0 {
+		return 0, nil
+	}
+
+	ch, ok := to.(peers.Channel)
+	if !ok {
+		return 0, errors.Wrapf(ErrNotForum, "%s", to.VisibleName())
+	}
+	return checkTopic(ctx, api, ch.Raw(), topic)
+}
+
+func checkTopic(ctx context.Context, api *tg.Client, ch *tg.Channel, topic int) (int, error) {
+	if !ch.Forum {
+		return 0, errors.Wrapf(ErrNotForum, "%s", ch.Title)
+	}
+	if topic < 0 {
+		return 0, errors.Wrapf(ErrTopicNotFound, "invalid topic id %d", topic)
+	}
+	if topic == generalTopic {
+		return 0, nil
+	}
+
+	topics, err := api.ChannelsGetForumTopicsByID(ctx, &tg.ChannelsGetForumTopicsByIDRequest{
+		Channel: ch.AsInput(),
+		Topics:  []int{topic},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "get forum topic")
+	}
+
+	for _, t := range topics.Topics {
+		if ft, ok := t.(*tg.ForumTopic); ok && ft.ID == topic {
+			return topic, nil
+		}
+	}
+	return 0, errors.Wrapf(ErrTopicNotFound, "topic %d of %s", topic, ch.Title)
+}
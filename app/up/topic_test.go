@@ -0,0 +1,68 @@
+package up
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// topicInvoker returns topics of ids for channels.getForumTopicsByID, and deleted ones for others
+type topicInvoker struct {
+	ids   map[int]struct{}
+	calls int
+}
+
+func (i *topicInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	req, ok := input.(*tg.ChannelsGetForumTopicsByIDRequest)
+	if !ok {
+		return errors.Errorf("unexpected request %T", input)
+	}
+	i.calls++
+
+	topics := make([]tg.ForumTopicClass, 0, len(req.Topics))
+	for _, id := range req.Topics {
+		if _, ok := i.ids[id]; ok {
+			topics = append(topics, &tg.ForumTopic{ID: id, Title: "topic"})
+			continue
+		}
+		topics = append(topics, &tg.ForumTopicDeleted{ID: id})
+	}
+	*output.(*tg.MessagesForumTopics) = tg.MessagesForumTopics{Topics: topics}
+	return nil
+}
+
+func TestCheckTopic(t *testing.T) {
+	ctx := context.Background()
+	inv := &topicInvoker{ids: map[int]struct{}{42: {}}}
+	api := tg.NewClient(inv)
+	forum := &tg.Channel{ID: 1, AccessHash: 2, Title: "forum", Forum: true, Megagroup: true}
+
+	topic, err := checkTopic(ctx, api, forum, 42)
+	require.NoError(t, err)
+	assert.Equal(t, 42, topic)
+
+	_, err = checkTopic(ctx, api, forum, 7)
+	assert.ErrorIs(t, err, ErrTopicNotFound, "deleted topic")
+	_, err = checkTopic(ctx, api, forum, -1)
+	assert.ErrorIs(t, err, ErrTopicNotFound)
+
+	// General topic is sent without replying
+	topic, err = checkTopic(ctx, api, forum, generalTopic)
+	require.NoError(t, err)
+	assert.Zero(t, topic)
+	assert.Equal(t, 2, inv.calls)
+
+	_, err = checkTopic(ctx, api, &tg.Channel{ID: 3, Title: "group", Megagroup: true}, 42)
+	assert.ErrorIs(t, err, ErrNotForum)
+	assert.Equal(t, 2, inv.calls)
+
+	// no topic is never validated
+	topic, err = resolveTopic(ctx, api, nil, 0)
+	require.NoError(t, err)
+	assert.Zero(t, topic)
+}
@@ -0,0 +1,141 @@
+package up
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+// ProgressTracker receives overall progress of all files in one upload run,
+// so that integrators embedding tdl(e.g. GUIs, bots) can render their own progress bars.
+// Track may be called concurrently.
+type ProgressTracker interface {
+	Track(s ProgressSnapshot)
+}
+
+// ProgressSnapshot is the overall progress at a point in time
+type ProgressSnapshot struct {
+	// Done is the uploaded bytes of all files
+	Done int64
+	// Total is the bytes of all files, which is computed before uploading.
+	// Streams of unknown size are not counted.
+	Total int64
+	// Current is the file which reports this progress
+	Current string
+	// ETA is the estimated remaining time by average speed, negative if unknown
+	ETA time.Duration
+}
+
+// NopTracker drops all progress, which is the default tracker
+type NopTracker struct{}
+
+func (NopTracker) Track(ProgressSnapshot) {}
+
+// TerminalTracker prints overall progress on a single line of w
+type TerminalTracker struct {
+	w        io.Writer
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewTerminalTracker creates a tracker which prints to w at most once per interval,
+// except that the final progress is always printed.
+func NewTerminalTracker(w io.Writer, interval time.Duration) *TerminalTracker {
+	return &TerminalTracker{w: w, interval: interval}
+}
+
+func (t *TerminalTracker) Track(s ProgressSnapshot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s.Done < s.Total && time.Since(t.last) < t.interval {
+		return
+	}
+	t.last = time.Now()
+
+	eta := "unknown"
+	if s.ETA >= 0 {
+		eta = s.ETA.Round(time.Second).String()
+	}
+
+	_, _ = fmt.Fprintf(t.w, "\r%s / %s, current: %s, ETA: %s",
+		utils.Byte.FormatBinaryBytes(s.Done), utils.Byte.FormatBinaryBytes(s.Total), s.Current, eta)
+}
+
+// totalProgress aggregates progress of each file and reports to tracker
+type totalProgress struct {
+	tracker ProgressTracker
+	total   int64
+	start   time.Time
+	now     func() time.Time
+
+	mu   sync.Mutex
+	done map[tuple]int64
+	sum  int64
+}
+
+func newTotalProgress(tracker ProgressTracker, files []*file) *totalProgress {
+	if tracker == nil {
+		tracker = NopTracker{}
+	}
+
+	return &totalProgress{
+		tracker: tracker,
+		total:   totalSize(files),
+		start:   time.Now(),
+		now:     time.Now,
+		done:    make(map[tuple]int64),
+	}
+}
+
+func (t *totalProgress) update(key tuple, current string, uploaded int64) {
+	t.mu.Lock()
+	t.sum += uploaded - t.done[key]
+	t.done[key] = uploaded
+	s := ProgressSnapshot{
+		Done:    t.sum,
+		Total:   t.total,
+		Current: current,
+		ETA:     t.eta(),
+	}
+	t.mu.Unlock()
+
+	t.tracker.Track(s)
+}
+
+func (t *totalProgress) eta() time.Duration {
+	if t.sum <= 0 || t.total <= 0 {
+		return -1
+	}
+	if t.sum >= t.total {
+		return 0
+	}
+
+	elapsed := t.now().Sub(t.start)
+	return time.Duration(float64(elapsed) * float64(t.total-t.sum) / float64(t.sum))
+}
+
+// totalSize sums sizes of files by stat, files which can't be stat are counted at upload
+func totalSize(files []*file) int64 {
+	var total int64
+	for _, f := range files {
+		if f.reader != nil {
+			if f.size > 0 {
+				total += f.size
+			}
+			continue
+		}
+
+		if stat, err := os.Stat(f.file); err == nil {
+			total += stat.Size()
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,92 @@
+package up
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordTracker struct {
+	mu        sync.Mutex
+	snapshots []ProgressSnapshot
+}
+
+func (r *recordTracker) Track(s ProgressSnapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshots = append(r.snapshots, s)
+}
+
+func (r *recordTracker) last() ProgressSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshots[len(r.snapshots)-1]
+}
+
+func TestTotalProgress(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	require.NoError(t, os.WriteFile(a, make([]byte, 100), 0o644))
+	require.NoError(t, os.WriteFile(b, make([]byte, 300), 0o644))
+
+	files := []*file{
+		{file: a},
+		{file: b},
+		{file: "stream", reader: &bytes.Buffer{}, size: 100},
+		{file: "unknown", reader: &bytes.Buffer{}, size: -1},
+	}
+
+	r := &recordTracker{}
+	tp := newTotalProgress(r, files)
+	start := time.Now()
+	tp.start, tp.now = start, func() time.Time { return start.Add(10 * time.Second) }
+
+	assert.Equal(t, int64(500), tp.total)
+
+	tp.update(tuple{name: a}, a, 50)
+	tp.update(tuple{name: b}, b, 50)
+	s := r.last()
+	assert.Equal(t, int64(100), s.Done)
+	assert.Equal(t, int64(500), s.Total)
+	assert.Equal(t, b, s.Current)
+	assert.Equal(t, 40*time.Second, s.ETA) // 100B per 10s, 400B left
+
+	// progress of the same file is not accumulated
+	tp.update(tuple{name: a}, a, 100)
+	assert.Equal(t, int64(150), r.last().Done)
+
+	tp.update(tuple{name: b}, b, 300)
+	tp.update(tuple{name: "stream"}, "stream", 100)
+	assert.Equal(t, time.Duration(0), r.last().ETA)
+}
+
+func TestTotalProgress_Unknown(t *testing.T) {
+	tp := newTotalProgress(nil, nil)
+	assert.Equal(t, time.Duration(-1), tp.eta())
+
+	// nil tracker falls back to NopTracker
+	tp.update(tuple{name: "a"}, "a", 10)
+}
+
+func TestTerminalTracker(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tr := NewTerminalTracker(buf, time.Hour)
+
+	tr.Track(ProgressSnapshot{Done: 1024, Total: 2048, Current: "a.txt", ETA: 3 * time.Second})
+	assert.Equal(t, "\r1.00 KB / 2.00 KB, current: a.txt, ETA: 3s", buf.String())
+
+	// throttled
+	tr.Track(ProgressSnapshot{Done: 1536, Total: 2048, Current: "a.txt", ETA: time.Second})
+	assert.NotContains(t, buf.String(), "1.50 KB")
+
+	// final progress is always printed
+	buf.Reset()
+	tr.Track(ProgressSnapshot{Done: 2048, Total: 2048, Current: "a.txt", ETA: -1})
+	assert.Equal(t, "\r2.00 KB / 2.00 KB, current: a.txt, ETA: unknown", buf.String())
+}
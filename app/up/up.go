@@ -2,12 +2,18 @@ package up
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
+	"github.com/mattn/go-colorable"
 	"github.com/spf13/viper"
 	"go.uber.org/multierr"
 
@@ -15,6 +21,7 @@ import (
 	"github.com/iyear/tdl/core/storage"
 	"github.com/iyear/tdl/core/tclient"
 	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/core/util/bandwidth"
 	"github.com/iyear/tdl/core/util/tutil"
 	"github.com/iyear/tdl/pkg/consts"
 	"github.com/iyear/tdl/pkg/prog"
@@ -27,19 +34,151 @@ type Options struct {
 	Excludes []string
 	Remove   bool
 	Photo    bool
+	// Includes only uploads files matched by extensions or glob patterns of file names, empty means all.
+	// Excludes also accepts glob patterns.
+	Includes []string
+	// IncludeFrom and ExcludeFrom are files of patterns merged into Includes and Excludes,
+	// one pattern per line, and lines starting with '#' are comments
+	IncludeFrom string
+	ExcludeFrom string
+	// SkipHidden skips files and directories whose names start with '.'
+	SkipHidden bool
+	// SkipJunk skips well-known OS and VCS generated files, like .DS_Store and .git
+	SkipJunk bool
+	// IgnoreFiles are names of gitignore-style files, e.g. .tdlignore, whose patterns are applied
+	// to the directory containing them and its subdirectories during walk. Empty means disabled.
+	IgnoreFiles []string
+	// ThumbExts are candidate extensions of thumbnail files in priority order, default is consts.UploadThumbExt
+	ThumbExts []string
+	// ThumbCheck only attaches thumbnails which are images within Telegram size limit
+	ThumbCheck bool
+	// IncludeMedia only uploads files of detected media categories(image, video, audio, document)
+	IncludeMedia []string
+	// ExcludeMedia skips files of detected media categories(image, video, audio, document)
+	ExcludeMedia []string
+	// Manifest is the path of local manifest which records uploaded files,
+	// and files with unchanged content are skipped. Empty means disabled.
+	Manifest string
+	// MinAge skips files modified within the duration, which may be still being written. Zero means disabled.
+	MinAge time.Duration
+	// StdinName is the file name of stream from stdin, which is uploaded if Paths contains StdinPath
+	StdinName string
+	// StdinSize is the size of stream from stdin. Negative means unknown, and the stream is
+	// buffered in memory, which is limited to 256MB.
+	StdinSize int64
+	// Archive uploads all matched files as a single tar archive with the name, which is built on the fly.
+	// Empty means uploading files separately.
+	Archive string
+	// Tracker receives overall progress of all files. Nil means NopTracker.
+	Tracker ProgressTracker
+	// Retries is the max number of retries of uploading a file after failure. Big files are resumed
+	// from the last acknowledged part, even after restart of tdl.
+	Retries int
+	// Caption is the text/template of captions evaluated per file, with fields of captionTemplate.
+	// Empty means the default caption(file name and MIME type).
+	Caption string
+	// Checkpoint is the path of JSON lines file, which appends path and message ID of each uploaded file
+	// as soon as it's done. Empty means disabled.
+	Checkpoint string
+	// Continue skips files recorded in Checkpoint by previous runs, otherwise Checkpoint is overwritten.
+	Continue bool
+	// Album sends photos and videos of the same directory as grouped albums of at most 10 media,
+	// and images are always sent as photos. Other files are sent individually.
+	Album bool
+	// JSON writes each uploaded file as a JSON line(path, size, chat, message, date) to stdout instead of
+	// rendering progress, and other messages are written to stderr, so that output can be piped.
+	JSON bool
+	// Verify compares each uploaded file with the local one by hashes provided by Telegram, or by the
+	// re-downloaded first part, after all uploads are done, which costs extra requests. Photos are skipped
+	// as they are re-encoded. Failures are aggregated into ErrVerifyFailed. It can't be used with Remove.
+	Verify bool
+	// SkipExisting skips files of which documents with the same name and size exist in target chat,
+	// even if they are not recorded by Manifest. It searches the chat for each file, which costs a request per file.
+	SkipExisting bool
+	// FFProbe is the name or path of ffprobe, which probes attributes(duration, dimensions) of videos,
+	// so that they are playable inline. Videos are uploaded as documents if ffprobe is unavailable and
+	// they are not H.264 MP4. Empty disables probing.
+	FFProbe string
+	// Video overrides probed attributes of all uploaded videos, and zero fields are probed.
+	Video uploader.VideoInfo
+	// Topic is the ID of forum topic in Chat to upload into, which is the ID of its first message.
+	// Zero means the General topic, and ErrNotForum or ErrTopicNotFound is returned for invalid topics.
+	Topic int
+	// ForceDocument sends all files as plain documents, so that images are not recompressed as photos and
+	// videos or audios are not shown as media. It takes precedence over Photo and Album.
+	ForceDocument bool
+	// ForceDocumentExts only sends files with the extensions as documents, e.g. jpg, .png, which are case-insensitive.
+	ForceDocumentExts []string
+	// SplitSize splits local files larger than the size into parts of at most the size, e.g. file.part001,
+	// and an index file(file.index.json) recording sizes and hashes of parts, which are sent as documents.
+	// Parts are reassembled by dl with Reassemble. Zero means disabled.
+	SplitSize int64
 }
 
 func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Options) (rerr error) {
-	files, err := walk(opts.Paths, opts.Excludes)
+	// other messages are written to stderr, as stdout is used by JSON results
+	var rs *results
+	out := color.Output
+	if opts.JSON {
+		rs = newResults(os.Stdout)
+		out = colorable.NewColorableStderr()
+	}
+
+	if opts.Verify && opts.Remove {
+		return errors.New("verifying is not supported when removing files after uploading")
+	}
+
+	opts, err := withFilterFiles(opts)
+	if err != nil {
+		return err
+	}
+
+	// fail fast before walking
+	caption, err := newCaption(opts.Caption)
+	if err != nil {
+		return err
+	}
+
+	// stdin is not walked
+	walkOpts, stdin := withoutStdin(opts)
+
+	if exts := overlappedThumbExts(opts); len(exts) > 0 {
+		_, _ = fmt.Fprintln(out, color.YellowString("WARN: thumbnail extensions %v are also uploaded, files which are thumbnails of others with the same name won't be uploaded", exts))
+	}
+
+	scanned := false
+	files, err := walk(ctx, walkOpts, out, func(n int) {
+		scanned = true
+		_, _ = color.New(color.FgBlue).Fprintf(out, "\rScanned %d files...", n)
+	})
+	if scanned {
+		_, _ = fmt.Fprintln(out)
+	}
 	if err != nil {
 		return err
 	}
+	stats := newWalkStats(files)
+	if stdin {
+		files = append(files, newStdinFile(opts))
+	}
 
-	color.Blue("Files count: %d", len(files))
+	_, _ = fmt.Fprintln(out, color.BlueString("Files count: %d, total size: %s", len(files), utils.Byte.FormatBinaryBytes(stats.Size)))
+	for _, ext := range stats.sortedExts() {
+		e, name := stats.Exts[ext], ext
+		if name == "" {
+			name = "(no extension)"
+		}
+		_, _ = fmt.Fprintln(out, color.BlueString("  %s: %d files, %s", name, e.Files, utils.Byte.FormatBinaryBytes(e.Size)))
+	}
 
-	pool := dcpool.NewPool(c,
-		int64(viper.GetInt(consts.FlagPoolSize)),
-		tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout))...)
+	pool, err := dcpool.NewPoolWithOptions(c, dcpool.Options{
+		PerDC:       int64(viper.GetInt(consts.FlagPoolSize)),
+		MaxConns:    int64(viper.GetInt(consts.FlagMaxConns)),
+		Middlewares: tclient.NewDefaultMiddlewares(ctx, viper.GetDuration(consts.FlagReconnectTimeout)),
+	})
+	if err != nil {
+		return errors.Wrap(err, "create pool")
+	}
 	defer multierr.AppendInvoke(&rerr, multierr.Close(pool))
 
 	manager := peers.Options{Storage: storage.NewPeers(kvd)}.Build(pool.Default(ctx))
@@ -49,23 +188,163 @@ func Run(ctx context.Context, c *telegram.Client, kvd storage.Storage, opts Opti
 		return errors.Wrap(err, "get target peer")
 	}
 
+	topic, err := resolveTopic(ctx, pool.Default(ctx), to, opts.Topic)
+	if err != nil {
+		return err
+	}
+
+	var mf *manifest
+	if opts.Manifest != "" {
+		if mf, err = loadManifest(opts.Manifest); err != nil {
+			return err
+		}
+		defer multierr.AppendInvoke(&rerr, multierr.Close(mf))
+
+		total := len(files)
+		if files, err = filterFiles(files, func(f *file) (bool, error) { return mf.uploaded(f.file, to.ID()) }); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out, color.BlueString("Skipped %d uploaded files, %d files left", total-len(files), len(files)))
+	}
+
+	var cp *checkpoint
+	if opts.Checkpoint != "" {
+		if cp, err = openCheckpoint(opts.Checkpoint, opts.Continue); err != nil {
+			return err
+		}
+		defer multierr.AppendInvoke(&rerr, multierr.Close(cp))
+
+		if opts.Continue {
+			total := len(files)
+			if files, err = filterFiles(files, func(f *file) (bool, error) { return cp.uploaded(f.file, to.ID()) }); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintln(out, color.BlueString("Skipped %d files recorded in checkpoint, %d files left", total-len(files), len(files)))
+		}
+	}
+
+	// remote search is the last, as it costs requests
+	if opts.SkipExisting {
+		x := &existingIndex{api: pool.Default(ctx), peer: to.InputPeer()}
+
+		total := len(files)
+		if files, err = filterFiles(files, func(f *file) (bool, error) {
+			return x.exists(ctx, filepath.Base(f.file), f.size)
+		}); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out, color.BlueString("Skipped %d files existing in target chat, %d files left", total-len(files), len(files)))
+	}
+
+	if opts.Archive != "" {
+		if opts.Remove {
+			return errors.New("removing files is not supported when uploading as archive")
+		}
+
+		archive, err := newArchive(opts.Archive, files)
+		if err != nil {
+			return errors.Wrap(err, "create archive")
+		}
+		_, _ = fmt.Fprintln(out, color.BlueString("Upload %d files as archive %s(%s)", len(files), opts.Archive, utils.Byte.FormatBinaryBytes(archive.size)))
+		files = []*file{archive}
+	}
+
+	if opts.SplitSize > 0 {
+		if opts.Remove {
+			return errors.New("removing files is not supported when splitting files")
+		}
+
+		var split int
+		if files, split, err = splitFiles(files, opts.SplitSize); err != nil {
+			return err
+		}
+		if split > 0 {
+			_, _ = fmt.Fprintln(out, color.BlueString("Split %d files larger than %s into parts", split, utils.Byte.FormatBinaryBytes(opts.SplitSize)))
+		}
+	}
+
 	upProgress := prog.New(utils.Byte.FormatBinaryBytes)
 	upProgress.SetNumTrackersExpected(len(files))
+	if opts.JSON {
+		upProgress.SetOutputWriter(io.Discard)
+	}
 	prog.EnablePS(ctx, upProgress)
 
+	bw, err := utils.Byte.ParseBinaryBytes(viper.GetString(consts.FlagBandwidth))
+	if err != nil {
+		return errors.Wrap(err, "parse bandwidth")
+	}
+
+	var vf *verifier
+	if opts.Verify {
+		vf = &verifier{out: out}
+	}
+
+	markDocuments(files, newDocumentMatcher(opts.ForceDocument, opts.ForceDocumentExts))
+
+	groups := singleGroups(files)
+	if opts.Album {
+		if groups, err = groupAlbums(files); err != nil {
+			return errors.Wrap(err, "group albums")
+		}
+	}
+
+	iter := newIter(groups, to, topic, opts.Photo, opts.Remove, viper.GetDuration(consts.FlagDelay), caption,
+		newVideoProber(opts.FFProbe, opts.Video, out))
+
 	options := uploader.Options{
 		Client:   pool.Default(ctx),
 		Threads:  viper.GetInt(consts.FlagThreads),
-		Iter:     newIter(files, to, opts.Photo, opts.Remove, viper.GetDuration(consts.FlagDelay)),
-		Progress: newProgress(upProgress),
+		Iter:     iter,
+		Progress: newProgress(upProgress, out, mf, cp, rs, vf, newTotalProgress(opts.Tracker, files)),
+		Limiter:  bandwidth.New(bw),
+		Resume:   kvd,
+		Retries:  opts.Retries,
 	}
 
 	up := uploader.New(options)
 
 	go upProgress.Render()
-	defer prog.Wait(ctx, upProgress)
+	// limited accounts fail with scattered RPC errors, which are reported as tclient.ErrAccountLimited
+	err = tclient.LimitedError(up.Upload(ctx, viper.GetInt(consts.FlagLimit)))
+	prog.Wait(ctx, upProgress)
+
+	// files uploaded before failures of others are still verified
+	if vf != nil && !errors.Is(err, context.Canceled) {
+		multierr.AppendInto(&err, vf.verify(ctx, pool))
+	}
+	return err
+}
+
+func newStdinFile(opts Options) *file {
+	name := opts.StdinName
+	if name == "" {
+		name = "stdin"
+	}
+
+	return &file{file: name, reader: os.Stdin, size: opts.StdinSize}
+}
+
+// filterFiles removes files which are reported as uploaded, e.g. recorded in manifest with unchanged content
+func filterFiles(files []*file, uploadedFn func(f *file) (bool, error)) ([]*file, error) {
+	r := make([]*file, 0, len(files))
+	for _, f := range files {
+		if f.reader != nil { // streams are always uploaded
+			r = append(r, f)
+			continue
+		}
+
+		uploaded, err := uploadedFn(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "check uploaded %s", f.file)
+		}
+		if uploaded {
+			continue
+		}
+		r = append(r, f)
+	}
 
-	return up.Upload(ctx, viper.GetInt(consts.FlagLimit))
+	return r, nil
 }
 
 func resolveDestPeer(ctx context.Context, manager *peers.Manager, chat string) (peers.Peer, error) {
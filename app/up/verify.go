@@ -0,0 +1,136 @@
+package up
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/dcpool"
+	"github.com/iyear/tdl/core/downloader"
+	"github.com/iyear/tdl/core/tmedia"
+	"github.com/iyear/tdl/core/util/tutil"
+)
+
+// ErrVerifyFailed is returned when some uploaded files don't match local ones on Telegram side.
+var ErrVerifyFailed = errors.New("verification failed")
+
+// verifySampleSize is the size of the first part re-downloaded if Telegram doesn't provide hashes of file
+const verifySampleSize = downloader.MaxPartSize
+
+type uploaded struct {
+	path  string
+	size  int64
+	to    peers.Peer
+	msgID int
+}
+
+// verifier collects uploaded local files, and verifies them after all uploads are done
+type verifier struct {
+	out io.Writer // results of verification
+
+	mu    sync.Mutex
+	files []uploaded
+}
+
+func (v *verifier) add(e *iterElem) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.files = append(v.files, uploaded{path: e.file.Path(), size: e.file.Size(), to: e.to, msgID: e.sent.ID})
+}
+
+// verify fetches sent messages of uploaded files and compares their content with local files,
+// and all failures are aggregated into ErrVerifyFailed.
+func (v *verifier) verify(ctx context.Context, pool dcpool.Pool) error {
+	v.mu.Lock()
+	files := v.files
+	v.mu.Unlock()
+
+	failed := 0
+	for _, f := range files {
+		if err := verifyUploaded(ctx, pool, f); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			failed++
+			_, _ = fmt.Fprintln(v.out, color.RedString("Verify %s failed: %s", f.path, err))
+		}
+	}
+
+	if failed > 0 {
+		return errors.Wrapf(ErrVerifyFailed, "%d of %d files", failed, len(files))
+	}
+	_, _ = fmt.Fprintln(v.out, color.GreenString("Verified %d uploaded files", len(files)))
+	return nil
+}
+
+func verifyUploaded(ctx context.Context, pool dcpool.Pool, f uploaded) error {
+	if f.msgID == 0 {
+		return errors.New("sent message is unknown")
+	}
+
+	msg, err := tutil.GetSingleMessage(ctx, pool.Default(ctx), f.to.InputPeer(), f.msgID)
+	if err != nil {
+		return errors.Wrap(err, "get sent message")
+	}
+	// photos are re-encoded by Telegram, so they never match local files
+	if _, ok := msg.Media.(*tg.MessageMediaPhoto); ok {
+		return nil
+	}
+	media, ok := tmedia.GetMedia(msg)
+	if !ok {
+		return errors.Errorf("no media in message %d", f.msgID)
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return errors.Wrap(err, "open local file")
+	}
+	defer func() { _ = file.Close() }()
+
+	return verifyMedia(ctx, pool.Client(ctx, media.DC), media, file, f.size)
+}
+
+// verifyMedia compares media against local r of size by hashes provided by Telegram,
+// or by the re-downloaded first part if hashes are not available.
+func verifyMedia(ctx context.Context, client *tg.Client, media *tmedia.Media, r io.ReaderAt, size int64) error {
+	if media.Size != size {
+		return errors.Wrapf(downloader.ErrIntegrityMismatch, "size: expected %d, got %d", size, media.Size)
+	}
+
+	ok, err := downloader.VerifyHashes(ctx, client, media.InputFileLoc, size, r)
+	if err != nil || ok {
+		return err
+	}
+
+	sample, err := client.UploadGetFile(ctx, &tg.UploadGetFileRequest{
+		Location: media.InputFileLoc,
+		Offset:   0,
+		Limit:    verifySampleSize,
+	})
+	if err != nil {
+		return errors.Wrap(err, "download sample")
+	}
+	remote, ok := sample.(*tg.UploadFile)
+	if !ok {
+		return errors.Errorf("unexpected sample type %T", sample)
+	}
+
+	local := make([]byte, min(size, verifySampleSize))
+	if _, err = r.ReadAt(local, 0); err != nil && !errors.Is(err, io.EOF) {
+		return errors.Wrap(err, "read local file")
+	}
+	if !bytes.Equal(local, remote.Bytes) {
+		return errors.Wrapf(downloader.ErrIntegrityMismatch, "sample of first %d bytes", len(local))
+	}
+
+	return nil
+}
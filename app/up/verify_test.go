@@ -0,0 +1,90 @@
+package up
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iyear/tdl/core/downloader"
+	"github.com/iyear/tdl/core/tmedia"
+)
+
+// remoteInvoker serves the uploaded file, and its hashes if enabled
+type remoteInvoker struct {
+	data   []byte
+	hashes bool
+}
+
+func (i *remoteInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	switch req := input.(type) {
+	case *tg.UploadGetFileHashesRequest:
+		if !i.hashes {
+			return tgerr.New(400, "LOCATION_INVALID")
+		}
+		if req.Offset >= int64(len(i.data)) {
+			return nil
+		}
+		sum := sha256.Sum256(i.data[req.Offset:])
+		output.(*tg.FileHashVector).Elems = []tg.FileHash{{
+			Offset: req.Offset,
+			Limit:  len(i.data) - int(req.Offset),
+			Hash:   sum[:],
+		}}
+		return nil
+	case *tg.UploadGetFileRequest:
+		end := min(req.Offset+int64(req.Limit), int64(len(i.data)))
+		output.(*tg.UploadFileBox).File = &tg.UploadFile{
+			Type:  &tg.StorageFileUnknown{},
+			Bytes: i.data[req.Offset:end],
+		}
+		return nil
+	default:
+		return errors.Errorf("unexpected request %T", input)
+	}
+}
+
+func TestVerifyMedia(t *testing.T) {
+	ctx := context.Background()
+
+	local := bytes.Repeat([]byte("tdl"), 1000)
+	corrupted := bytes.Clone(local)
+	corrupted[100]++
+
+	tests := []struct {
+		name     string
+		remote   []byte
+		hashes   bool
+		size     int64
+		mismatch bool
+	}{
+		{name: "hashes", remote: local, hashes: true},
+		{name: "hashes mismatch", remote: corrupted, hashes: true, mismatch: true},
+		{name: "sample", remote: local},
+		{name: "sample mismatch", remote: corrupted, mismatch: true},
+		{name: "size mismatch", remote: local, hashes: true, size: 1, mismatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			media := &tmedia.Media{
+				InputFileLoc: &tg.InputDocumentFileLocation{ID: 1},
+				Size:         int64(len(tt.remote)) + tt.size,
+			}
+			client := tg.NewClient(&remoteInvoker{data: tt.remote, hashes: tt.hashes})
+
+			err := verifyMedia(ctx, client, media, bytes.NewReader(local), int64(len(local)))
+			if tt.mismatch {
+				assert.ErrorIs(t, err, downloader.ErrIntegrityMismatch)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package up
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+
+	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/core/util/mediautil"
+)
+
+// ffprobeTimeout is the timeout of probing one file
+const ffprobeTimeout = 30 * time.Second
+
+// lookPath is the seam for tests
+var lookPath = exec.LookPath
+
+// videoProber provides attributes of videos by explicit values, and probes unknown ones by ffprobe if available
+type videoProber struct {
+	explicit uploader.VideoInfo
+	ffprobe  string    // path of ffprobe, empty if unavailable
+	out      io.Writer // warnings of probing
+
+	warn sync.Once
+}
+
+// newVideoProber looks up ffprobe by name or path, and empty ffprobe disables probing
+func newVideoProber(ffprobe string, explicit uploader.VideoInfo, out io.Writer) *videoProber {
+	p := &videoProber{explicit: explicit, out: out}
+	if ffprobe != "" {
+		// unavailable ffprobe is reported when the first video is probed
+		p.ffprobe, _ = lookPath(ffprobe)
+	}
+	return p
+}
+
+// probe returns attributes of video at path, and empty path means streams which can't be probed
+func (p *videoProber) probe(path string) (uploader.VideoInfo, bool) {
+	info := p.explicit
+	if info.Width > 0 && info.Height > 0 && info.Duration > 0 {
+		return info, true
+	}
+
+	if p.ffprobe == "" || path == "" {
+		// H.264 MP4 is parsed by uploader, so only videos which would be uploaded as documents are reported
+		if p.ffprobe == "" && path != "" && (info.Width == 0 || info.Height == 0) && !hasMP4Info(path) {
+			p.warn.Do(func() {
+				_, _ = fmt.Fprintln(p.out, color.YellowString("WARN: ffprobe is not found, videos other than H.264 MP4 without --video-width and --video-height are uploaded as documents"))
+			})
+		}
+		return info, info != uploader.VideoInfo{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ffprobeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, p.ffprobe,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height,duration:format=duration,format_name",
+		"-of", "json",
+		path).Output()
+	if err == nil {
+		var probed uploader.VideoInfo
+		if probed, err = parseFFProbe(out); err == nil {
+			return info.Merge(probed), true
+		}
+	}
+
+	_, _ = fmt.Fprintln(p.out, color.YellowString("WARN: probe video %s by ffprobe: %v", path, err))
+	return info, info != uploader.VideoInfo{}
+}
+
+// hasMP4Info reports whether dimensions of video at path can be parsed from MP4 header
+func hasMP4Info(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	_, w, h, err := mediautil.GetMP4Info(f)
+	return err == nil && w > 0 && h > 0
+}
+
+// ffprobeOutput is the JSON output of ffprobe -show_entries stream=width,height,duration:format=duration,format_name
+type ffprobeOutput struct {
+	Streams []struct {
+		Width    int    `json:"width"`
+		Height   int    `json:"height"`
+		Duration string `json:"duration"`
+	} `json:"streams"`
+	Format struct {
+		Duration   string `json:"duration"`
+		FormatName string `json:"format_name"`
+	} `json:"format"`
+}
+
+// streamingFormats are ffprobe format names which Telegram clients can play while downloading
+var streamingFormats = map[string]struct{}{
+	"mov,mp4,m4a,3gp,3g2,mj2": {},
+}
+
+func parseFFProbe(data []byte) (uploader.VideoInfo, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return uploader.VideoInfo{}, errors.Wrap(err, "unmarshal ffprobe output")
+	}
+	if len(out.Streams) == 0 {
+		return uploader.VideoInfo{}, errors.New("no video stream")
+	}
+
+	s := out.Streams[0]
+	info := uploader.VideoInfo{Width: s.Width, Height: s.Height}
+
+	// duration of stream is missing in some containers, e.g. mkv
+	duration := s.Duration
+	if duration == "" || duration == "N/A" {
+		duration = out.Format.Duration
+	}
+	if sec, err := strconv.ParseFloat(duration, 64); err == nil {
+		info.Duration = time.Duration(sec * float64(time.Second)).Round(time.Second)
+	}
+
+	_, info.SupportsStreaming = streamingFormats[out.Format.FormatName]
+	return info, nil
+}
@@ -0,0 +1,90 @@
+package up
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/core/uploader"
+)
+
+func TestParseFFProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected uploader.VideoInfo
+	}{
+		{
+			name: "mp4",
+			output: `{"programs":[],"streams":[{"width":1920,"height":1080,"duration":"90.480000"}],
+				"format":{"format_name":"mov,mp4,m4a,3gp,3g2,mj2","duration":"90.500000"}}`,
+			expected: uploader.VideoInfo{Duration: 90 * time.Second, Width: 1920, Height: 1080, SupportsStreaming: true},
+		},
+		{
+			name: "mkv without stream duration",
+			output: `{"streams":[{"width":1280,"height":720}],
+				"format":{"format_name":"matroska,webm","duration":"61.700000"}}`,
+			expected: uploader.VideoInfo{Duration: 62 * time.Second, Width: 1280, Height: 720},
+		},
+		{
+			name:     "unknown duration",
+			output:   `{"streams":[{"width":640,"height":480,"duration":"N/A"}],"format":{"format_name":"avi"}}`,
+			expected: uploader.VideoInfo{Width: 640, Height: 480},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseFFProbe([]byte(tt.output))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, info)
+		})
+	}
+
+	_, err := parseFFProbe([]byte(`{"streams":[],"format":{}}`))
+	assert.Error(t, err)
+	_, err = parseFFProbe([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestVideoProber_Unavailable(t *testing.T) {
+	prev := lookPath
+	lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	defer func() { lookPath = prev }()
+
+	dir := t.TempDir()
+	createFiles(t, dir, "video.mkv")
+	path := filepath.Join(dir, "video.mkv")
+
+	// falls back to MP4 header or document, which is warned once
+	warn := &bytes.Buffer{}
+	p := newVideoProber("ffprobe", uploader.VideoInfo{}, warn)
+	_, ok := p.probe(path)
+	assert.False(t, ok)
+	_, _ = p.probe(path)
+	assert.Equal(t, 1, strings.Count(warn.String(), "ffprobe is not found"))
+
+	// not warned if videos are not probed
+	warn.Reset()
+	_, _ = newVideoProber("ffprobe", uploader.VideoInfo{}, warn).probe("")
+	assert.Empty(t, warn.String(), "streams are not probed")
+
+	explicit := uploader.VideoInfo{Width: 640, Height: 480}
+	info, ok := newVideoProber("ffprobe", explicit, warn).probe(path)
+	assert.True(t, ok)
+	assert.Equal(t, explicit, info)
+	assert.Empty(t, warn.String(), "dimensions are explicit")
+
+	// complete explicit values never probe
+	explicit.Duration = time.Minute
+	info, ok = newVideoProber("", explicit, io.Discard).probe("")
+	assert.True(t, ok)
+	assert.Equal(t, explicit, info)
+}
@@ -1,49 +1,440 @@
 package up
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/fatih/color"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/util/fsutil"
+	"github.com/iyear/tdl/core/util/mediautil"
 	"github.com/iyear/tdl/pkg/consts"
 )
 
-func walk(paths, excludes []string) ([]*file, error) {
-	files := make([]*file, 0)
-	excludesMap := map[string]struct{}{
-		consts.UploadThumbExt: {}, // ignore thumbnail files
+// junkNames are well-known files and directories generated by OS or VCS, which are useless to upload
+var junkNames = map[string]struct{}{
+	".DS_Store":       {},
+	".AppleDouble":    {},
+	".Spotlight-V100": {},
+	".Trashes":        {},
+	"__MACOSX":        {},
+	"Thumbs.db":       {},
+	"desktop.ini":     {},
+	".git":            {},
+	".svn":            {},
+	".hg":             {},
+}
+
+// ErrNoFilesMatched is returned when no files are left after filtering, to distinguish from successful uploads
+var ErrNoFilesMatched = errors.New("no files matched")
+
+// maxThumbSize refer to https://core.telegram.org/api/files#uploading-files
+const maxThumbSize = 200 * 1024
+
+// scanInterval is the min interval between two scan progress callbacks
+const scanInterval = 200 * time.Millisecond
+
+// walkProgress is called with the number of scanned files during traversal
+type walkProgress func(scanned int)
+
+type scanner struct {
+	fn       walkProgress
+	scanned  int
+	reported int
+	last     time.Time
+}
+
+func (s *scanner) scan() {
+	s.scanned++
+
+	if s.fn == nil || time.Since(s.last) < scanInterval {
+		return
 	}
+	s.last = time.Now()
+	s.report()
+}
 
-	for _, exclude := range excludes {
-		excludesMap[exclude] = struct{}{}
+// done reports the final count which may be throttled by scan
+func (s *scanner) done() {
+	if s.fn == nil || s.reported == s.scanned {
+		return
 	}
+	s.report()
+}
+
+func (s *scanner) report() {
+	s.reported = s.scanned
+	s.fn(s.scanned)
+}
+
+// Walk returns paths of files which will be uploaded with opts in order, and thumbnails attached to them
+// as main file path -> thumbnail path, so that callers can preview or verify them before uploading.
+// Stdin is not included.
+func Walk(ctx context.Context, opts Options) ([]string, map[string]string, error) {
+	paths, thumbs, _, err := WalkWithStats(ctx, opts)
+	return paths, thumbs, err
+}
+
+// WalkStats is the summary of files to upload, and thumbnails are not counted.
+type WalkStats struct {
+	Files int
+	Size  int64
+	// Exts is the breakdown by lower-cased extension with dot, and files without extension are keyed by "".
+	Exts map[string]ExtStats
+}
+
+// ExtStats is the summary of files with the same extension.
+type ExtStats struct {
+	Files int
+	Size  int64
+}
+
+// WalkWithStats is like Walk, but also returns stats of the files, which are computed
+// from sizes stat-ed once during traversal.
+func WalkWithStats(ctx context.Context, opts Options) ([]string, map[string]string, *WalkStats, error) {
+	opts, _ = withoutStdin(opts)
+
+	opts, err := withFilterFiles(opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	files, err := walk(ctx, opts, color.Output, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	paths, thumbs := make([]string, 0, len(files)), make(map[string]string)
+	for _, f := range files {
+		paths = append(paths, f.file)
+		if f.thumb != "" {
+			thumbs[f.file] = f.thumb
+		}
+	}
+
+	return paths, thumbs, newWalkStats(files), nil
+}
+
+// newWalkStats summarizes files by sizes recorded during walk, and unknown sizes of streams are not added
+func newWalkStats(files []*file) *WalkStats {
+	s := &WalkStats{Exts: make(map[string]ExtStats)}
+	for _, f := range files {
+		size := max(f.size, 0)
+		ext := strings.ToLower(filepath.Ext(f.file))
+
+		e := s.Exts[ext]
+		e.Files++
+		e.Size += size
+		s.Exts[ext] = e
 
-	for _, path := range paths {
-		err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		s.Files++
+		s.Size += size
+	}
+	return s
+}
+
+// sortedExts returns extensions of stats by total size in descending order
+func (s *WalkStats) sortedExts() []string {
+	exts := make([]string, 0, len(s.Exts))
+	for ext := range s.Exts {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		a, b := s.Exts[exts[i]], s.Exts[exts[j]]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return exts[i] < exts[j]
+	})
+	return exts
+}
+
+// withoutStdin removes StdinPath from paths of opts, and reports whether it exists
+func withoutStdin(opts Options) (Options, bool) {
+	paths, stdin := make([]string, 0, len(opts.Paths)), false
+	for _, p := range opts.Paths {
+		if p == StdinPath {
+			stdin = true
+			continue
+		}
+		paths = append(paths, p)
+	}
+
+	opts.Paths = paths
+	return opts, stdin
+}
+
+func walk(ctx context.Context, opts Options, out io.Writer, progress walkProgress) ([]*file, error) {
+	mf, err := newMediaFilter(opts.IncludeMedia, opts.ExcludeMedia)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*file, 0)
+	sc := &scanner{fn: progress}
+
+	includes, err := newPatterns(opts.Includes)
+	if err != nil {
+		return nil, errors.Wrap(err, "includes")
+	}
+	// ignore thumbnail files
+	excludes, err := newPatterns(append([]string{consts.UploadThumbExt}, opts.Excludes...))
+	if err != nil {
+		return nil, errors.Wrap(err, "excludes")
+	}
+
+	// overlapped input paths may walk the same file more than once
+	visited := make(map[string]struct{})
+	ig := newIgnorer(opts.IgnoreFiles)
+
+	for _, root := range opts.Paths {
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
+			// respond to interruption during traversal of huge trees
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			// input paths are specified by user explicitly, so never skip them
+			if path != root && skipName(d.Name(), opts) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if path != root && ig.ignored(root, path, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 			if d.IsDir() {
+				return ig.load(path)
+			}
+			sc.scan()
+
+			if name := d.Name(); excludes.match(name) || !includes.empty() && !includes.match(name) {
 				return nil
 			}
-			if _, ok := excludesMap[filepath.Ext(path)]; ok {
+
+			// stat once for both age filter and stats
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if opts.MinAge > 0 {
+				if age := time.Since(info.ModTime()); age < opts.MinAge {
+					logctx.From(ctx).Debug("Skip recently modified file",
+						zap.String("path", path),
+						zap.Duration("age", age))
+					return nil
+				}
+			}
+
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if _, ok := visited[abs]; ok {
 				return nil
 			}
+			visited[abs] = struct{}{}
 
-			f := file{file: path}
-			t := strings.TrimRight(path, filepath.Ext(path)) + consts.UploadThumbExt
-			if fsutil.PathExists(t) {
-				f.thumb = t
+			f := &file{file: path, root: root, size: info.Size()}
+			if mf != nil {
+				ok, err := mf.match(f)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return nil
+				}
 			}
+			f.thumb = findThumb(path, opts)
 
-			files = append(files, &f)
+			files = append(files, f)
 			return nil
 		})
 		if err != nil {
 			return nil, err
 		}
 	}
+	sc.done()
+
+	files = excludeThumbs(files, out)
+	if len(files) == 0 && len(opts.Paths) > 0 {
+		return nil, errors.Wrapf(ErrNoFilesMatched, "scanned %d files, active filters: %s", sc.scanned, activeFilters(opts))
+	}
 
 	return files, nil
 }
+
+func activeFilters(opts Options) string {
+	filters := make([]string, 0)
+	add := func(active bool, format string, args ...any) {
+		if active {
+			filters = append(filters, fmt.Sprintf(format, args...))
+		}
+	}
+
+	add(len(opts.Includes) > 0, "includes=%v", opts.Includes)
+	add(len(opts.Excludes) > 0, "excludes=%v", opts.Excludes)
+	add(len(opts.IncludeMedia) > 0, "include-media=%v", opts.IncludeMedia)
+	add(len(opts.ExcludeMedia) > 0, "exclude-media=%v", opts.ExcludeMedia)
+	add(opts.SkipHidden, "skip-hidden")
+	add(opts.SkipJunk, "skip-junk")
+	add(len(opts.IgnoreFiles) > 0, "ignore-files=%v", opts.IgnoreFiles)
+	add(opts.MinAge > 0, "min-age=%s", opts.MinAge)
+
+	if len(filters) == 0 {
+		return "none"
+	}
+	return strings.Join(filters, ", ")
+}
+
+// findThumb returns the first valid thumbnail candidate of path in priority order, or empty if not found
+func findThumb(path string, opts Options) string {
+	exts := opts.ThumbExts
+	if len(exts) == 0 {
+		exts = []string{consts.UploadThumbExt}
+	}
+
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range exts {
+		t := base + fsutil.AddPrefixDot(ext)
+		if t == path || !fsutil.PathExists(t) {
+			continue
+		}
+		if opts.ThumbCheck && !validThumb(t) {
+			continue
+		}
+
+		return t
+	}
+
+	return ""
+}
+
+// validThumb reports whether file is an image within Telegram thumbnail size limit
+func validThumb(path string) bool {
+	stat, err := os.Stat(path)
+	if err != nil || stat.Size() > maxThumbSize {
+		return false
+	}
+
+	mime, err := mimetype.DetectFile(path)
+	if err != nil {
+		return false
+	}
+
+	return mediautil.IsImage(mime.String())
+}
+
+// overlappedThumbExts returns thumbnail extensions which are also uploaded as files, which means
+// files of these extensions are skipped if they are thumbnails of others.
+func overlappedThumbExts(opts Options) []string {
+	// invalid patterns are reported by walk
+	includes, _ := newPatterns(opts.Includes)
+	excludes, _ := newPatterns(append([]string{consts.UploadThumbExt}, opts.Excludes...))
+	if includes == nil || excludes == nil {
+		return nil
+	}
+
+	// thumbnails are images
+	if len(opts.IncludeMedia) > 0 && !containsFold(opts.IncludeMedia, mediaImage) ||
+		containsFold(opts.ExcludeMedia, mediaImage) {
+		return nil
+	}
+
+	r := make([]string, 0)
+	for _, ext := range opts.ThumbExts {
+		ext = fsutil.AddPrefixDot(ext)
+		if ext == "" || excludes.hasExt(ext) || len(includes.exts) > 0 && !includes.hasExt(ext) {
+			continue
+		}
+		r = append(r, ext)
+	}
+
+	return r
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, v := range ss {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludeThumbs removes files which are attached as thumbnails of other files, so they won't be uploaded twice,
+// and warnings of mutual thumbnails are written to out
+func excludeThumbs(files []*file, out io.Writer) []*file {
+	thumbs := make(map[string]string) // abs path of thumbnail -> abs path of main file
+	for _, f := range files {
+		if f.thumb == "" {
+			continue
+		}
+		thumb, err1 := filepath.Abs(f.thumb)
+		main, err2 := filepath.Abs(f.file)
+		if err1 == nil && err2 == nil {
+			thumbs[thumb] = main
+		}
+	}
+	if len(thumbs) == 0 {
+		return files
+	}
+
+	r := make([]*file, 0, len(files))
+	for _, f := range files {
+		abs, err := filepath.Abs(f.file)
+		if err != nil {
+			r = append(r, f)
+			continue
+		}
+
+		main, ok := thumbs[abs]
+		if !ok {
+			r = append(r, f)
+			continue
+		}
+
+		// e.g. a.jpg and a.png with thumbnail extensions [.png, .jpg], and neither of them is uploaded
+		if thumbs[main] == abs && abs < main {
+			_, _ = fmt.Fprintln(out, color.YellowString("WARN: %s and %s are thumbnails of each other, neither of them will be uploaded, "+
+				"please change thumbnail extensions or exclude one of them", f.file, f.thumb))
+		}
+	}
+
+	return r
+}
+
+func skipName(name string, opts Options) bool {
+	if opts.SkipHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	if opts.SkipJunk {
+		if _, ok := junkNames[name]; ok {
+			return true
+		}
+		// AppleDouble resource fork files
+		if strings.HasPrefix(name, "._") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,367 @@
+package up
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/pkg/consts"
+)
+
+func createFiles(t *testing.T, dir string, files ...string) {
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(f), 0o644))
+	}
+}
+
+func walkedFiles(files []*file) []string {
+	r := make([]string, 0, len(files))
+	for _, f := range files {
+		r = append(r, f.file)
+	}
+	return r
+}
+
+func TestWalk_Overlap(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "sub/b.mp4", "sub/b.thumb")
+
+	files, err := walk(context.Background(), Options{Paths: []string{
+		dir,
+		filepath.Join(dir, "sub"),
+		filepath.Join(dir, "sub", "b.mp4"),
+		filepath.Join(dir, "sub", ".", "b.mp4"),
+	}}, io.Discard, nil)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "sub", "b.mp4"),
+	}, walkedFiles(files))
+
+	for _, f := range files {
+		if filepath.Base(f.file) == "b.mp4" {
+			assert.Equal(t, filepath.Join(dir, "sub", "b.thumb"), f.thumb)
+		}
+	}
+}
+
+func TestWalk_Skip(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", ".hidden", ".git/config", ".DS_Store", "Thumbs.db", "sub/._b.txt", "sub/b.txt")
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{
+			name:     "default",
+			opts:     Options{},
+			expected: []string{"a.txt", ".hidden", ".git/config", ".DS_Store", "Thumbs.db", "sub/._b.txt", "sub/b.txt"},
+		},
+		{
+			name:     "skip hidden",
+			opts:     Options{SkipHidden: true},
+			expected: []string{"a.txt", "Thumbs.db", "sub/b.txt"},
+		},
+		{
+			name:     "skip junk",
+			opts:     Options{SkipJunk: true},
+			expected: []string{"a.txt", ".hidden", "sub/b.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Paths = []string{dir}
+			files, err := walk(context.Background(), tt.opts, io.Discard, nil)
+			require.NoError(t, err)
+
+			expected := make([]string, 0, len(tt.expected))
+			for _, e := range tt.expected {
+				expected = append(expected, filepath.Join(dir, e))
+			}
+			assert.ElementsMatch(t, expected, walkedFiles(files))
+		})
+	}
+}
+
+func TestWalk_Progress(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt", "sub/c.txt")
+
+	calls := make([]int, 0)
+	_, err := walk(context.Background(), Options{Paths: []string{dir}}, io.Discard, func(scanned int) {
+		calls = append(calls, scanned)
+	})
+	require.NoError(t, err)
+
+	// rate limited, so only the first file and the final count are reported in such a short time
+	assert.Equal(t, []int{1, 3}, calls)
+}
+
+func TestWalk_ThumbCandidates(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.mp4", "a.jpg", "a.png", "b.mp4", "b.png", "c.mp4", "c.thumb", "d.jpg")
+
+	// real png image
+	img, err := os.Create(filepath.Join(dir, "e.png"))
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 1, 1))))
+	require.NoError(t, img.Close())
+	createFiles(t, dir, "e.mp4", "e.jpg")
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected map[string]string // file -> thumb
+	}{
+		{
+			name: "default",
+			opts: Options{},
+			expected: map[string]string{
+				"a.mp4": "", "a.jpg": "", "a.png": "", "b.mp4": "", "b.png": "",
+				"c.mp4": "c.thumb", "d.jpg": "", "e.mp4": "", "e.jpg": "", "e.png": "",
+			},
+		},
+		{
+			name: "priority",
+			opts: Options{ThumbExts: []string{"jpg", ".png"}},
+			expected: map[string]string{
+				"a.mp4": "a.jpg", "b.mp4": "b.png", "c.mp4": "", "d.jpg": "", "e.mp4": "e.jpg",
+			},
+		},
+		{
+			name: "check",
+			opts: Options{ThumbExts: []string{".jpg", ".png"}, ThumbCheck: true},
+			expected: map[string]string{
+				"a.mp4": "", "a.jpg": "", "a.png": "", "b.mp4": "", "b.png": "",
+				"c.mp4": "", "d.jpg": "", "e.mp4": "e.png", "e.jpg": "e.png",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Paths = []string{dir}
+			files, err := walk(context.Background(), tt.opts, io.Discard, nil)
+			require.NoError(t, err)
+
+			actual := make(map[string]string)
+			for _, f := range files {
+				thumb := ""
+				if f.thumb != "" {
+					thumb = filepath.Base(f.thumb)
+				}
+				actual[filepath.Base(f.file)] = thumb
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestWalk_Media(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "fake.png", "data.bin")
+
+	// real png image with misleading extension
+	img, err := os.Create(filepath.Join(dir, "pic.bin"))
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 1, 1))))
+	require.NoError(t, img.Close())
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{name: "none", opts: Options{}, expected: []string{"data.bin", "fake.png", "pic.bin"}},
+		{name: "include", opts: Options{IncludeMedia: []string{"image", "video"}}, expected: []string{"pic.bin"}},
+		{name: "exclude", opts: Options{ExcludeMedia: []string{"document"}}, expected: []string{"pic.bin"}},
+		{name: "with extension", opts: Options{Excludes: []string{".bin"}, IncludeMedia: []string{"document"}}, expected: []string{"fake.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Paths = []string{dir}
+			files, err := walk(context.Background(), tt.opts, io.Discard, nil)
+			require.NoError(t, err)
+
+			actual := make([]string, 0, len(files))
+			for _, f := range files {
+				actual = append(actual, filepath.Base(f.file))
+				if filepath.Base(f.file) == "pic.bin" && len(tt.opts.IncludeMedia)+len(tt.opts.ExcludeMedia) > 0 {
+					assert.Equal(t, "image/png", f.mime)
+				}
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+
+	_, err = walk(context.Background(), Options{Paths: []string{dir}, IncludeMedia: []string{"image"}, ExcludeMedia: []string{"image"}}, io.Discard, nil)
+	assert.ErrorIs(t, err, ErrNoFilesMatched)
+
+	_, err = walk(context.Background(), Options{Paths: []string{dir}, IncludeMedia: []string{"picture"}}, io.Discard, nil)
+	assert.Error(t, err)
+}
+
+func TestWalk_NoFilesMatched(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.so", ".b")
+
+	_, err := walk(context.Background(), Options{Paths: []string{dir}, Excludes: []string{"so"}, SkipHidden: true}, io.Discard, nil)
+	require.ErrorIs(t, err, ErrNoFilesMatched)
+	assert.Contains(t, err.Error(), "excludes=[so], skip-hidden")
+
+	// nothing to walk, e.g. only uploading from stdin
+	files, err := walk(context.Background(), Options{}, io.Discard, nil)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestWalk_Excludes(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.mp4", "b.so", "c.tmp", "d.txt")
+
+	files, err := walk(context.Background(), Options{
+		Paths:    []string{dir},
+		Excludes: []string{".so", "tmp", ""},
+	}, io.Discard, nil)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "a.mp4"),
+		filepath.Join(dir, "d.txt"),
+	}, walkedFiles(files))
+}
+
+func TestWalk_MinAge(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "old.txt", "new.txt")
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "old.txt"), old, old))
+
+	files, err := walk(context.Background(), Options{Paths: []string{dir}, MinAge: 30 * time.Second}, io.Discard, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "old.txt")}, walkedFiles(files))
+
+	files, err = walk(context.Background(), Options{Paths: []string{dir}}, io.Discard, nil)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestWalk_Cancel(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 100; i++ {
+		createFiles(t, dir, filepath.Join(strconv.Itoa(i), "a.txt"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	scanned := 0
+	start := time.Now()
+	_, err := walk(ctx, Options{Paths: []string{dir}}, io.Discard, func(n int) {
+		scanned = n
+		cancel()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, scanned) // stopped right after cancellation
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestOverlappedThumbExts(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{name: "default", opts: Options{ThumbExts: []string{consts.UploadThumbExt}}, expected: []string{}},
+		{name: "overlap", opts: Options{ThumbExts: []string{"jpg", ".png", ".thumb"}}, expected: []string{".jpg", ".png"}},
+		{name: "excluded", opts: Options{ThumbExts: []string{"jpg", ".png"}, Excludes: []string{"png"}}, expected: []string{".jpg"}},
+		{name: "include video", opts: Options{ThumbExts: []string{"jpg"}, IncludeMedia: []string{"video"}}, expected: nil},
+		{name: "include image", opts: Options{ThumbExts: []string{"jpg"}, IncludeMedia: []string{"Image"}}, expected: []string{".jpg"}},
+		{name: "exclude image", opts: Options{ThumbExts: []string{"jpg"}, ExcludeMedia: []string{"image"}}, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, overlappedThumbExts(tt.opts))
+		})
+	}
+}
+
+func TestWalk_Exported(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.mp4", "a.thumb", "b.txt")
+
+	files, thumbs, err := Walk(context.Background(), Options{Paths: []string{dir, StdinPath}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{filepath.Join(dir, "a.mp4"), filepath.Join(dir, "b.txt")}, files)
+	assert.Equal(t, map[string]string{
+		filepath.Join(dir, "a.mp4"): filepath.Join(dir, "a.thumb"),
+	}, thumbs)
+}
+
+func TestWalk_FilterFiles(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.mp4", "b.jpg", "IMG_1.jpg", "c.tmp", "d.txt")
+
+	includeFrom := filepath.Join(t.TempDir(), "include.txt")
+	require.NoError(t, os.WriteFile(includeFrom, []byte("# media\nmp4\n\n  .jpg  \n"), 0o644))
+	excludeFrom := filepath.Join(t.TempDir(), "exclude.txt")
+	require.NoError(t, os.WriteFile(excludeFrom, []byte("IMG_*.jpg\n"), 0o644))
+
+	files, _, err := Walk(context.Background(), Options{
+		Paths:       []string{dir},
+		Includes:    []string{"txt"},
+		IncludeFrom: includeFrom,
+		ExcludeFrom: excludeFrom,
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "a.mp4"),
+		filepath.Join(dir, "b.jpg"),
+		filepath.Join(dir, "d.txt"),
+	}, files)
+
+	_, _, err = Walk(context.Background(), Options{Paths: []string{dir}, ExcludeFrom: filepath.Join(dir, "missing.txt")})
+	assert.ErrorContains(t, err, "read exclude-from file")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, _, err = Walk(context.Background(), Options{Paths: []string{dir}, Excludes: []string{"[a"}})
+	assert.ErrorContains(t, err, `invalid pattern "[a"`)
+}
+
+func TestWalkWithStats(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.mp4", "a.thumb", "b.MP4", "sub/c.jpg", "README")
+
+	_, _, stats, err := WalkWithStats(context.Background(), Options{Paths: []string{dir}})
+	require.NoError(t, err)
+
+	// content of each file is its name, and thumbnails are not counted
+	assert.Equal(t, &WalkStats{
+		Files: 4,
+		Size:  int64(len("a.mp4") + len("b.MP4") + len("sub/c.jpg") + len("README")),
+		Exts: map[string]ExtStats{
+			".mp4": {Files: 2, Size: int64(len("a.mp4") + len("b.MP4"))},
+			".jpg": {Files: 1, Size: int64(len("sub/c.jpg"))},
+			"":     {Files: 1, Size: int64(len("README"))},
+		},
+	}, stats)
+	assert.Equal(t, []string{".mp4", ".jpg", ""}, stats.sortedExts())
+}
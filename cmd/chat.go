@@ -32,13 +32,16 @@ func NewChat() *cobra.Command {
 }
 
 func NewChatList() *cobra.Command {
-	var opts chat.ListOptions
+	var (
+		opts        chat.ListOptions
+		allAccounts bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "ls",
 		Short: "List your chats",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return tRun(cmd.Context(), func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
+			return tRunAccounts(cmd.Context(), allAccounts, func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
 				return chat.List(logctx.Named(ctx, "ls"), c, kvd, opts)
 			}, limiter)
 		},
@@ -46,6 +49,7 @@ func NewChatList() *cobra.Command {
 
 	cmd.Flags().VarP(&opts.Output, "output", "o", fmt.Sprintf("output format: [%s]", strings.Join(chat.ListOutputNames(), ", ")))
 	cmd.Flags().StringVarP(&opts.Filter, "filter", "f", "true", "filter chats by expression")
+	allAccountsFlag(cmd, &allAccounts)
 
 	return cmd
 }
@@ -108,6 +112,10 @@ func NewChatExport() *cobra.Command {
 	cmd.Flags().BoolVar(&opts.WithContent, "with-content", false, "export with message content")
 	cmd.Flags().BoolVar(&opts.Raw, "raw", false, "export raw message struct of Telegram MTProto API, useful for debugging")
 	cmd.Flags().BoolVar(&opts.All, "all", false, "export all messages including non-media messages, but still affected by filter and type flag")
+	cmd.Flags().BoolVar(&opts.Takeout, "takeout", false, "fetch messages in a takeout session, which has lower flood wait limits")
+	cmd.Flags().StringSliceVar(&opts.TakeoutScopes, "takeout-scope", chat.DefaultTakeoutScopes, fmt.Sprintf("scopes of takeout session: [%s]", strings.Join(chat.TakeoutScopes, ", ")))
+	cmd.Flags().StringVar(&opts.Checkpoint, "checkpoint", "", "path of JSON file to record exported message ranges, e.g. export.checkpoint.json")
+	cmd.Flags().BoolVar(&opts.Continue, "continue", false, "resume interrupted export recorded in checkpoint and only fetch new messages, and messages in output are kept, otherwise checkpoint is overwritten")
 
 	// completion and validation
 	_ = cmd.RegisterFlagCompletionFunc(input, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -3,7 +3,9 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -12,10 +14,14 @@ import (
 	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/storage"
 	"github.com/iyear/tdl/pkg/consts"
+	"github.com/iyear/tdl/pkg/utils"
 )
 
 func NewDownload() *cobra.Command {
-	var opts dl.Options
+	var (
+		opts             dl.Options
+		minSize, maxSize string
+	)
 
 	cmd := &cobra.Command{
 		Use:     "download",
@@ -28,6 +34,18 @@ func NewDownload() *cobra.Command {
 			}
 
 			opts.Template = viper.GetString(consts.FlagDlTemplate)
+			opts.DirTemplate = viper.GetString(consts.FlagDlDirTemplate)
+
+			var err error
+			if err = dl.ValidateDirTemplate(opts.DirTemplate); err != nil {
+				return err
+			}
+			if opts.MinSize, err = utils.Byte.ParseBinaryBytes(minSize); err != nil {
+				return errors.Wrap(err, "parse min size")
+			}
+			if opts.MaxSize, err = utils.Byte.ParseBinaryBytes(maxSize); err != nil {
+				return errors.Wrap(err, "parse max size")
+			}
 
 			return tRun(cmd.Context(), func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
 				return dl.Run(logctx.Named(ctx, "dl"), c, kvd, opts)
@@ -48,14 +66,27 @@ func NewDownload() *cobra.Command {
 	cmd.Flags().StringSliceVarP(&opts.Files, file, "f", []string{}, "official client exported files")
 
 	cmd.Flags().String(consts.FlagDlTemplate, `{{ .DialogID }}_{{ .MessageID }}_{{ filenamify .FileName }}`, "download file name template")
+	cmd.Flags().String(consts.FlagDlDirTemplate, "", `template of output dirs relative to download dir per message, e.g. '{{ .ChatTitle }}/{{ .Date.Format "2006-01" }}'`)
 
 	cmd.Flags().StringSliceVarP(&opts.Include, include, "i", []string{}, "include the specified file extensions, and only judge by file name, not file MIME. Example: -i mp4,mp3")
 	cmd.Flags().StringSliceVarP(&opts.Exclude, exclude, "e", []string{}, "exclude the specified file extensions, and only judge by file name, not file MIME. Example: -e png,jpg")
 
+	cmd.Flags().StringSliceVar(&opts.IncludeMedia, "include-media", []string{}, "only download media of the specified types: photo, video, audio, document")
+	cmd.Flags().StringSliceVar(&opts.ExcludeMedia, "exclude-media", []string{}, "skip media of the specified types: photo, video, audio, document")
+	cmd.Flags().StringVar(&minSize, "min-size", "", "only download files not smaller than the size, e.g. 10MB")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "only download files not larger than the size, e.g. 2GB")
+
 	cmd.Flags().StringVarP(&opts.Dir, dir, "d", "downloads", "specify the download directory. If the directory does not exist, it will be created automatically")
 	cmd.Flags().BoolVar(&opts.RewriteExt, "rewrite-ext", false, "rewrite file extension according to file header MIME")
 	// do not match extension, because some files' extension is corrected by --rewrite-ext flag
 	cmd.Flags().BoolVar(&opts.SkipSame, "skip-same", false, "skip files with the same name(without extension) and size")
+	cmd.Flags().IntVar(&opts.DCConcurrency, "dc-concurrency", 0, "max in-flight download requests to each DC of all workers, 0 means unlimited")
+	cmd.Flags().Float64Var(&opts.DCRate, "dc-rate", 0, "max download requests per second to each DC of all workers, 0 means unlimited")
+	cmd.Flags().BoolVar(&opts.PreserveTime, "preserve-time", false, "set modification time of downloaded files to the original date of media, or message date if unavailable")
+	cmd.Flags().StringVar(&opts.Dedup, "dedup", "", "path of local store indexing downloaded files by content hash, so that duplicate media are not downloaded again across runs")
+	cmd.Flags().StringVar(&opts.DedupMode, "dedup-mode", dl.DedupSkip, fmt.Sprintf("how duplicate media found by dedup store are handled: [%s]", strings.Join(dl.DedupModes, ", ")))
+	cmd.Flags().BoolVar(&opts.Reassemble, "reassemble", false, "reassemble split files uploaded by 'tdl up --split' after downloading their parts and index files")
+	cmd.Flags().BoolVar(&opts.Verify, "verify", false, "verify size and hashes of downloaded files provided by Telegram, which costs extra requests")
 
 	cmd.Flags().BoolVar(&opts.Desc, "desc", false, "download files from the newest to the oldest ones (may affect resume download)")
 	cmd.Flags().BoolVar(&opts.Takeout, "takeout", false, "takeout sessions let you export data from your account with lower flood wait limits.")
@@ -70,6 +101,7 @@ func NewDownload() *cobra.Command {
 	cmd.Flags().IntVar(&opts.Port, "port", 8080, "http server port")
 
 	_ = viper.BindPFlag(consts.FlagDlTemplate, cmd.Flags().Lookup(consts.FlagDlTemplate))
+	_ = viper.BindPFlag(consts.FlagDlDirTemplate, cmd.Flags().Lookup(consts.FlagDlDirTemplate))
 
 	// completion and validation
 	_ = cmd.RegisterFlagCompletionFunc(file, completeExtFiles("json"))
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/go-faster/errors"
 	"github.com/spf13/cobra"
@@ -17,6 +18,7 @@ import (
 	"github.com/iyear/tdl/pkg/consts"
 	"github.com/iyear/tdl/pkg/extensions"
 	"github.com/iyear/tdl/pkg/tclient"
+	"github.com/iyear/tdl/pkg/utils"
 )
 
 func NewExtension(em *extensions.Manager) *cobra.Command {
@@ -32,7 +34,8 @@ func NewExtension(em *extensions.Manager) *cobra.Command {
 		},
 	}
 
-	cmd.AddCommand(NewExtensionList(em), NewExtensionInstall(em), NewExtensionRemove(em), NewExtensionUpgrade(em))
+	cmd.AddCommand(NewExtensionList(em), NewExtensionInstall(em), NewExtensionRemove(em), NewExtensionUpgrade(em),
+		NewExtensionAlias(em), NewExtensionUnalias(em))
 
 	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "only print what would be done without actually doing it")
 
@@ -40,48 +43,94 @@ func NewExtension(em *extensions.Manager) *cobra.Command {
 }
 
 func NewExtensionList(em *extensions.Manager) *cobra.Command {
+	var opts extension.ListOptions
+
 	cmd := &cobra.Command{
 		Use:     "list",
 		Short:   "List installed extension commands",
 		Aliases: []string{"ls"},
 		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return extension.List(cmd.Context(), em)
+			return extension.List(cmd.Context(), em, opts)
 		},
 	}
 
+	cmd.Flags().StringVar(&opts.Owner, "owner", "", "only list extensions of the owner")
+	cmd.Flags().StringVar(&opts.Filter, "filter", "", "only list extensions whose names contain the string")
+	cmd.Flags().BoolVar(&opts.Remote, "remote", false, "fetch latest versions from GitHub instead of cached ones")
+	tableStyleFlag(cmd, &opts.Style)
+
 	return cmd
 }
 
 func NewExtensionInstall(em *extensions.Manager) *cobra.Command {
-	var force bool
+	var (
+		force        bool
+		goos, goarch string
+		asset        string
+		timeout      time.Duration
+	)
 
 	cmd := &cobra.Command{
 		Use:   "install",
 		Short: "Install a tdl extension",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return extension.Install(cmd.Context(), em, args, force)
+			em.SetPlatform(goos, goarch)
+			setAssetPicker(em, asset)
+			return extension.Install(cmd.Context(), em, args, force, timeout)
 		},
 	}
 
 	cmd.Flags().BoolVar(&force, "force", false, "force install even if extension already exists")
+	platformFlags(cmd, &goos, &goarch, &asset)
+	timeoutFlag(cmd, &timeout)
 
 	return cmd
 }
 
 func NewExtensionUpgrade(em *extensions.Manager) *cobra.Command {
+	var (
+		goos, goarch string
+		asset        string
+		timeout      time.Duration
+	)
+
 	cmd := &cobra.Command{
 		Use:   "upgrade",
 		Short: "Upgrade a tdl extension",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return extension.Upgrade(cmd.Context(), em, args)
+			em.SetPlatform(goos, goarch)
+			setAssetPicker(em, asset)
+			return extension.Upgrade(cmd.Context(), em, args, timeout)
 		},
 	}
 
+	platformFlags(cmd, &goos, &goarch, &asset)
+	timeoutFlag(cmd, &timeout)
+
 	return cmd
 }
 
+func platformFlags(cmd *cobra.Command, goos, goarch, asset *string) {
+	cmd.Flags().StringVar(goos, "os", "", "override target OS of GitHub release assets, e.g. linux, darwin, windows. Empty means current OS")
+	cmd.Flags().StringVar(goarch, "arch", "", "override target arch of GitHub release assets, e.g. amd64, arm64, armv7. Empty means current arch")
+	cmd.Flags().StringVar(asset, "asset", "", "glob pattern of GitHub release asset names for non-standard names, e.g. '*_linux_x86_64.tar.gz'. Empty means matching by OS and arch")
+}
+
+// setAssetPicker picks release assets by glob pattern, or by OS and arch aliases if pattern is empty
+func setAssetPicker(em *extensions.Manager, pattern string) {
+	if pattern == "" {
+		em.SetAssetPicker(nil)
+		return
+	}
+	em.SetAssetPicker(extensions.GlobAssetPicker(pattern))
+}
+
+func timeoutFlag(cmd *cobra.Command, timeout *time.Duration) {
+	cmd.Flags().DurationVar(timeout, "timeout", extension.DefaultTimeout, "timeout of installing each extension")
+}
+
 func NewExtensionRemove(em *extensions.Manager) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "remove",
@@ -95,10 +144,38 @@ func NewExtensionRemove(em *extensions.Manager) *cobra.Command {
 	return cmd
 }
 
-func NewExtensionCmd(em *extensions.Manager, ext extensions.Extension, stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
+func NewExtensionAlias(em *extensions.Manager) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "alias <extension> <alias>",
+		Short: "Add a custom command name of an installed extension",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return extension.Alias(cmd.Context(), em, args[0], args[1])
+		},
+	}
+
+	return cmd
+}
+
+func NewExtensionUnalias(em *extensions.Manager) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unalias <alias>...",
+		Short: "Remove custom command names of extensions",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return extension.Unalias(cmd.Context(), em, args)
+		},
+	}
+
+	return cmd
+}
+
+// NewExtensionCmd returns command of ext, which can also be invoked by aliases.
+func NewExtensionCmd(em *extensions.Manager, ext extensions.Extension, aliases []string, stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
 	return &cobra.Command{
-		Use:   ext.Name(),
-		Short: fmt.Sprintf("Extension %s", ext.Name()),
+		Use:     ext.Name(),
+		Aliases: aliases,
+		Short:   fmt.Sprintf("Extension %s", ext.Name()),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -132,7 +209,21 @@ func NewExtensionCmd(em *extensions.Manager, ext extensions.Extension, stdin io.
 				Proxy:     opts.Proxy,
 				Pool:      viper.GetInt64(consts.FlagPoolSize),
 				Debug:     viper.GetBool(consts.FlagDebug),
+				LogFormat: viper.GetString(consts.FlagLogFormat),
+				LogLevel:  viper.GetString(consts.FlagLogLevel),
+
+				AllowMethods: viper.GetStringSlice(consts.FlagExtAllowMethods),
+				DenyMethods:  viper.GetStringSlice(consts.FlagExtDenyMethods),
+			}
+
+			mem, err := utils.Byte.ParseBinaryBytes(viper.GetString(consts.FlagExtMemory))
+			if err != nil {
+				return errors.Wrap(err, "parse extension memory limit")
 			}
+			em.SetLimits(extensions.Limits{
+				Memory:  uint64(mem),
+				Timeout: viper.GetDuration(consts.FlagExtTimeout),
+			})
 
 			if err = em.Dispatch(ext, args, env, stdin, stdout, stderr); err != nil {
 				var execError *exec.ExitError
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/spf13/cobra"
+
+	"github.com/iyear/tdl/app/session"
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/utils"
+)
+
+func NewSession() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "session",
+		Short:   "Manage active sessions of your account",
+		GroupID: groupAccount.ID,
+	}
+
+	cmd.AddCommand(NewSessionList(), NewSessionReset(), NewSessionHealth())
+
+	return cmd
+}
+
+func NewSessionList() *cobra.Command {
+	var (
+		allAccounts bool
+		style       string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List active sessions of your account",
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tRunAccounts(cmd.Context(), allAccounts, func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
+				return session.List(logctx.Named(ctx, "session"), c, style)
+			})
+		},
+	}
+
+	allAccountsFlag(cmd, &allAccounts)
+	tableStyleFlag(cmd, &style)
+
+	return cmd
+}
+
+func NewSessionHealth() *cobra.Command {
+	var allAccounts bool
+
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Check whether your account is frozen or restricted by Telegram",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tRunAccounts(cmd.Context(), allAccounts, func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
+				return session.Health(logctx.Named(ctx, "session"), c)
+			})
+		},
+	}
+
+	allAccountsFlag(cmd, &allAccounts)
+
+	return cmd
+}
+
+func allAccountsFlag(cmd *cobra.Command, all *bool) {
+	cmd.Flags().BoolVar(all, "all-accounts", false, "run against logged-in accounts of all namespaces instead of --namespace, one by one")
+}
+
+// tableStyleFlag is the --style flag shared by commands printing tables
+func tableStyleFlag(cmd *cobra.Command, style *string) {
+	cmd.Flags().StringVar(style, "style", utils.TableStyleDark, fmt.Sprintf("table style, available: %s, and NO_COLOR env falls back to %s",
+		strings.Join(utils.TableStyles, ", "), utils.TableStylePlain))
+}
+
+func NewSessionReset() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reset <hash>...",
+		Short: "Terminate other sessions by hashes listed by `session ls`",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hashes := make([]int64, 0, len(args))
+			for _, arg := range args {
+				hash, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil {
+					return errors.Wrapf(err, "invalid session hash %q", arg)
+				}
+				hashes = append(hashes, hash)
+			}
+
+			return tRun(cmd.Context(), func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
+				return session.Reset(logctx.Named(ctx, "session"), c, hashes)
+			})
+		},
+	}
+
+	return cmd
+}
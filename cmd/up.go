@@ -3,16 +3,24 @@ package cmd
 import (
 	"context"
 
+	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram"
 	"github.com/spf13/cobra"
 
 	"github.com/iyear/tdl/app/up"
 	"github.com/iyear/tdl/core/logctx"
 	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/uploader"
+	"github.com/iyear/tdl/pkg/consts"
+	"github.com/iyear/tdl/pkg/utils"
 )
 
 func NewUpload() *cobra.Command {
-	var opts up.Options
+	var (
+		opts      up.Options
+		split     bool
+		splitSize string
+	)
 
 	cmd := &cobra.Command{
 		Use:     "upload",
@@ -20,6 +28,21 @@ func NewUpload() *cobra.Command {
 		Short:   "Upload anything to Telegram",
 		GroupID: groupTools.ID,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if split {
+				size, err := utils.Byte.ParseBinaryBytes(splitSize)
+				if err != nil {
+					return errors.Wrap(err, "parse split size")
+				}
+				if size <= 0 {
+					return errors.New("split size must be positive")
+				}
+				if size > uploader.MaxFileSize {
+					return errors.Errorf("split size must not exceed Telegram file size limit %s",
+						utils.Byte.FormatBinaryBytes(uploader.MaxFileSize))
+				}
+				opts.SplitSize = size
+			}
+
 			return tRun(cmd.Context(), func(ctx context.Context, c *telegram.Client, kvd storage.Storage) error {
 				return up.Run(logctx.Named(ctx, "up"), c, kvd, opts)
 			})
@@ -31,10 +54,42 @@ func NewUpload() *cobra.Command {
 		path  = "path"
 	)
 	cmd.Flags().StringVarP(&opts.Chat, _chat, "c", "", "chat id or domain, and empty means 'Saved Messages'")
-	cmd.Flags().StringSliceVarP(&opts.Paths, path, "p", []string{}, "dirs or files")
-	cmd.Flags().StringSliceVarP(&opts.Excludes, "excludes", "e", []string{}, "exclude the specified file extensions")
+	cmd.Flags().IntVar(&opts.Topic, "topic", 0, "id of forum topic in the chat to upload into, and zero means the General topic")
+	cmd.Flags().StringSliceVarP(&opts.Paths, path, "p", []string{}, "dirs or files, and '-' means reading from stdin")
+	cmd.Flags().StringSliceVarP(&opts.Includes, "includes", "i", []string{}, "only upload files of the specified file extensions or glob patterns of file names, e.g. mp4,IMG_*.jpg")
+	cmd.Flags().StringSliceVarP(&opts.Excludes, "excludes", "e", []string{}, "exclude the specified file extensions or glob patterns of file names")
+	cmd.Flags().StringVar(&opts.IncludeFrom, "include-from", "", "read include patterns from the file, one per line, and lines starting with '#' are comments")
+	cmd.Flags().StringVar(&opts.ExcludeFrom, "exclude-from", "", "read exclude patterns from the file, one per line, and lines starting with '#' are comments")
 	cmd.Flags().BoolVar(&opts.Remove, "rm", false, "remove the uploaded files after uploading")
 	cmd.Flags().BoolVar(&opts.Photo, "photo", false, "upload the image as a photo instead of a file")
+	cmd.Flags().BoolVar(&opts.ForceDocument, "force-document", false, "upload all files as documents without recompression, even if they are images or videos")
+	cmd.Flags().StringSliceVar(&opts.ForceDocumentExts, "force-document-ext", []string{}, "only upload files of the specified extensions as documents without recompression, e.g. jpg,png")
+	cmd.Flags().BoolVar(&opts.SkipHidden, "skip-hidden", false, "skip hidden files and directories whose names start with '.'")
+	cmd.Flags().StringSliceVar(&opts.ThumbExts, "thumb-ext", []string{consts.UploadThumbExt}, "candidate extensions of thumbnail files with the same name as the uploaded file, in priority order")
+	cmd.Flags().BoolVar(&opts.ThumbCheck, "thumb-check", false, "only attach thumbnails which are images smaller than 200KB")
+	cmd.Flags().StringSliceVar(&opts.IncludeMedia, "include-media", []string{}, "only upload files of the specified media types detected by content: image, video, audio, document")
+	cmd.Flags().StringSliceVar(&opts.ExcludeMedia, "exclude-media", []string{}, "skip files of the specified media types detected by content: image, video, audio, document")
+	cmd.Flags().StringVar(&opts.Manifest, "manifest", "", "path of local manifest to record uploaded files, and skip files with unchanged content in next run")
+	cmd.Flags().StringVar(&opts.Checkpoint, "checkpoint", "", "path of JSON lines file to record each uploaded file as soon as it's done, e.g. up.jsonl")
+	cmd.Flags().BoolVar(&opts.Continue, "continue", false, "skip files recorded in checkpoint by previous runs, otherwise checkpoint is overwritten")
+	cmd.Flags().StringVar(&opts.StdinName, "stdin-name", "stdin", "file name of the content read from stdin")
+	cmd.Flags().Int64Var(&opts.StdinSize, "stdin-size", -1, "size of the content read from stdin, unknown size is buffered in memory up to 256MB")
+	cmd.Flags().BoolVar(&split, "split", false, "split files larger than split size into parts with an index file, which can be reassembled by 'tdl dl --reassemble'")
+	cmd.Flags().StringVar(&splitSize, "split-size", "2000MB", "max size of each part of split files, e.g. 4000MB for premium accounts")
+	cmd.Flags().StringVar(&opts.Archive, "archive", "", "upload all matched files as a single tar archive with the name, e.g. photos.tar")
+	cmd.Flags().DurationVar(&opts.MinAge, "min-age", 0, "skip files modified within the duration, which may be still being written, e.g. 30s")
+	cmd.Flags().BoolVar(&opts.SkipJunk, "skip-junk", false, "skip well-known junk files and directories, like .DS_Store, Thumbs.db and .git")
+	cmd.Flags().StringSliceVar(&opts.IgnoreFiles, "ignore-file", []string{}, "names of gitignore-style files applied hierarchically during walk, e.g. .tdlignore,.gitignore")
+	cmd.Flags().BoolVar(&opts.Album, "album", false, "send photos and videos of the same directory as grouped albums of at most 10 media")
+	cmd.Flags().StringVar(&opts.Caption, "caption", "", "caption template of each file, e.g. '{{ .Dir }}/{{ .Stem }}', and empty means file name and MIME type")
+	cmd.Flags().BoolVar(&opts.SkipExisting, "skip-existing", false, "skip files of which documents with the same name and size exist in target chat, which costs a search request per file")
+	cmd.Flags().BoolVar(&opts.Verify, "verify", false, "verify uploaded files against local ones by hashes provided by Telegram after uploading, which costs extra requests")
+	cmd.Flags().BoolVar(&opts.JSON, "json", false, "print each uploaded file as a JSON line to stdout instead of progress, e.g. for recording into database")
+	cmd.Flags().StringVar(&opts.FFProbe, "ffprobe", "ffprobe", "name or path of ffprobe to probe duration and dimensions of videos, and empty disables probing")
+	cmd.Flags().DurationVar(&opts.Video.Duration, "video-duration", 0, "duration of uploaded videos, which overrides the probed one, e.g. 1m30s")
+	cmd.Flags().IntVar(&opts.Video.Width, "video-width", 0, "width of uploaded videos, which overrides the probed one")
+	cmd.Flags().IntVar(&opts.Video.Height, "video-height", 0, "height of uploaded videos, which overrides the probed one")
+	cmd.Flags().IntVar(&opts.Retries, "retry", 2, "max retries of uploading a file after failure, and big files are resumed from the last uploaded part")
 
 	// completion and validation
 	_ = cmd.MarkFlagRequired(path)
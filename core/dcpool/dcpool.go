@@ -4,12 +4,14 @@ import (
 	"context"
 	"sync"
 
+	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 
 	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/middlewares/migrate"
 	"github.com/iyear/tdl/core/middlewares/takeout"
 )
 
@@ -27,11 +29,45 @@ type Pool interface {
 	Close() error
 }
 
+// MaxPerDC is the max recommended Options.PerDC, as more connections of one account to the same DC
+// are likely to be flood limited by Telegram rather than being faster. Larger values are still accepted.
+const MaxPerDC = 64
+
+// ErrInvalidLimit is returned when limits of Options are out of range.
+var ErrInvalidLimit = errors.New("invalid pool limit")
+
+// Options of pool created by NewPoolWithOptions.
+type Options struct {
+	// PerDC is the max number of connections to each DC, e.g. 8 of --pool flag, and zero means unlimited.
+	// Connections are created lazily when there are concurrent requests, so it's not the number of idle connections.
+	PerDC int64
+	// MaxConns is the max number of in-flight requests across all DCs, which caps total busy
+	// connections when downloading from multiple DCs in parallel. Zero means unlimited.
+	MaxConns int64
+	// Middlewares are applied to all invokers of pool.
+	Middlewares []telegram.Middleware
+}
+
+// Validate reports ErrInvalidLimit if limits of o are out of range.
+func (o Options) Validate() error {
+	if o.PerDC < 0 {
+		return errors.Wrapf(ErrInvalidLimit, "connections per DC %d, must be non-negative", o.PerDC)
+	}
+	if o.MaxConns < 0 {
+		return errors.Wrapf(ErrInvalidLimit, "max connections %d, must be non-negative", o.MaxConns)
+	}
+	return nil
+}
+
 type pool struct {
 	api         *telegram.Client
 	size        int64
 	mu          *sync.Mutex
 	middlewares []telegram.Middleware
+	// conns are semaphores of Options.MaxConns shared by all invokers, nil means unlimited
+	conns chan struct{}
+	// newInvoker creates pooled invoker to dc, and it's the seam for tests
+	newInvoker func(ctx context.Context, dc int, size int64) (telegram.CloseInvoker, error)
 
 	invokers map[int]tg.Invoker
 	closes   map[int]func() error
@@ -39,7 +75,7 @@ type pool struct {
 }
 
 func NewPool(c *telegram.Client, size int64, middlewares ...telegram.Middleware) Pool {
-	return &pool{
+	p := &pool{
 		api:         c,
 		size:        size,
 		mu:          &sync.Mutex{},
@@ -48,6 +84,21 @@ func NewPool(c *telegram.Client, size int64, middlewares ...telegram.Middleware)
 		closes:      make(map[int]func() error),
 		takeout:     0,
 	}
+	p.newInvoker = p.dial
+	return p
+}
+
+// NewPoolWithOptions is like NewPool, but also caps total connections by Options.MaxConns.
+func NewPoolWithOptions(c *telegram.Client, o Options) (Pool, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := NewPool(c, o.PerDC, o.Middlewares...).(*pool)
+	if o.MaxConns > 0 {
+		p.conns = make(chan struct{}, o.MaxConns)
+	}
+	return p, nil
 }
 
 func (p *pool) current() int {
@@ -73,27 +124,30 @@ func (p *pool) invoker(ctx context.Context, dc int) tg.Invoker {
 	}
 
 	// lazy init
-	var (
-		invoker telegram.CloseInvoker
-		err     error
-	)
-	if dc == p.current() { // can't transfer dc to current dc
-		invoker, err = p.api.Pool(p.size)
-	} else {
-		invoker, err = p.api.DC(ctx, dc, p.size)
-	}
-
+	invoker, err := p.newInvoker(ctx, dc, p.size)
 	if err != nil {
 		logctx.From(ctx).Error("create invoker", zap.Error(err))
 		return p.api // degraded
 	}
 
+	middlewares := append(p.middlewares[:len(p.middlewares):len(p.middlewares)],
+		migrate.New(func(ctx context.Context, dc int) (tg.Invoker, error) {
+			return p.Client(ctx, dc).Invoker(), nil
+		}))
+
 	p.closes[dc] = invoker.Close
-	p.invokers[dc] = chainMiddlewares(invoker, p.middlewares...)
+	p.invokers[dc] = chainMiddlewares(limitInvoker(invoker, p.conns), middlewares...)
 
 	return p.invokers[dc]
 }
 
+func (p *pool) dial(ctx context.Context, dc int, size int64) (telegram.CloseInvoker, error) {
+	if dc == p.current() { // can't transfer dc to current dc
+		return p.api.Pool(size)
+	}
+	return p.api.DC(ctx, dc, size)
+}
+
 func (p *pool) Default(ctx context.Context) *tg.Client {
 	return p.Client(ctx, p.current())
 }
@@ -0,0 +1,120 @@
+package dcpool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// fakeConns simulates pooled connections of one DC, each of which serves one request at a time with latency
+type fakeConns struct {
+	conns   chan struct{} // nil means unlimited
+	latency time.Duration
+
+	cur, max *atomic.Int64 // in-flight requests across all DCs
+}
+
+func (f *fakeConns) Invoke(ctx context.Context, _ bin.Encoder, _ bin.Decoder) error {
+	if f.conns != nil {
+		f.conns <- struct{}{}
+		defer func() { <-f.conns }()
+	}
+
+	cur := f.cur.Inc()
+	defer f.cur.Dec()
+	for {
+		prev := f.max.Load()
+		if cur <= prev || f.max.CompareAndSwap(prev, cur) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(f.latency):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *fakeConns) Close() error { return nil }
+
+func newFakePool(t testing.TB, o Options, latency time.Duration) (Pool, *atomic.Int64) {
+	p, err := NewPoolWithOptions(telegram.NewClient(1, "hash", telegram.Options{}), o)
+	require.NoError(t, err)
+
+	cur, max := atomic.NewInt64(0), atomic.NewInt64(0)
+	p.(*pool).newInvoker = func(_ context.Context, _ int, size int64) (telegram.CloseInvoker, error) {
+		f := &fakeConns{latency: latency, cur: cur, max: max}
+		if size > 0 {
+			f.conns = make(chan struct{}, size)
+		}
+		return f, nil
+	}
+	return p, max
+}
+
+// request sends n concurrent requests to each of dcs
+func request(ctx context.Context, p Pool, dcs []int, n int) {
+	wg := sync.WaitGroup{}
+	for _, dc := range dcs {
+		api := p.Client(ctx, dc)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _ = api.HelpGetConfig(ctx)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func TestOptions_Validate(t *testing.T) {
+	for _, o := range []Options{{}, {PerDC: 8}, {PerDC: MaxPerDC, MaxConns: 16}, {PerDC: MaxPerDC + 1}} {
+		assert.NoError(t, o.Validate(), o)
+	}
+	for _, o := range []Options{{PerDC: -1}, {MaxConns: -1}} {
+		assert.ErrorIs(t, o.Validate(), ErrInvalidLimit, o)
+	}
+}
+
+func TestPool_MaxConns(t *testing.T) {
+	ctx := context.Background()
+
+	p, max := newFakePool(t, Options{PerDC: 4, MaxConns: 6}, 10*time.Millisecond)
+	request(ctx, p, []int{1, 2, 3}, 8)
+	assert.Equal(t, int64(6), max.Load())
+
+	// PerDC of each DC when MaxConns is unlimited
+	p, max = newFakePool(t, Options{PerDC: 4}, 10*time.Millisecond)
+	request(ctx, p, []int{1, 2, 3}, 8)
+	assert.Equal(t, int64(12), max.Load())
+}
+
+// BenchmarkPool_PerDC shows throughput of parallel parts from the same media DC, which scales
+// with connections per DC as each connection serves one request at a time.
+func BenchmarkPool_PerDC(b *testing.B) {
+	const parts = 32 // e.g. --threads 8 with --limit 4
+
+	for _, perDC := range []int64{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("PerDC=%d", perDC), func(b *testing.B) {
+			p, _ := newFakePool(b, Options{PerDC: perDC}, time.Millisecond)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				request(ctx, p, []int{4}, parts)
+			}
+			b.ReportMetric(float64(parts*b.N)/b.Elapsed().Seconds(), "parts/s")
+		})
+	}
+}
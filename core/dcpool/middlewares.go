@@ -1,6 +1,9 @@
 package dcpool
 
 import (
+	"context"
+
+	"github.com/gotd/td/bin"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
 )
@@ -15,3 +18,23 @@ func chainMiddlewares(invoker tg.Invoker, chain ...telegram.Middleware) tg.Invok
 
 	return invoker
 }
+
+// limitInvoker holds one of conns during each request, so that in-flight requests are capped.
+// Nil conns means unlimited. It's the innermost invoker, so that waiting in middlewares(e.g. flood wait,
+// recovery) doesn't occupy conns.
+func limitInvoker(invoker tg.Invoker, conns chan struct{}) tg.Invoker {
+	if conns == nil {
+		return invoker
+	}
+
+	return telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		select {
+		case conns <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-conns }()
+
+		return invoker.Invoke(ctx, input, output)
+	})
+}
@@ -0,0 +1,145 @@
+package downloader
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/iyear/tdl/core/logctx"
+)
+
+// DCLimit caps requests of downloads to a DC, and zero fields mean unlimited.
+type DCLimit struct {
+	// Concurrency is the max number of in-flight requests
+	Concurrency int
+	// Rate is the max number of requests per second
+	Rate float64
+}
+
+func (l DCLimit) zero() bool {
+	return l.Concurrency <= 0 && l.Rate <= 0
+}
+
+// DCLimiter enforces DCLimit of each DC for all workers sharing it, so that batch downloads don't
+// hit FLOOD_WAIT by themselves. It can be shared by Downloaders, and nil DCLimiter means unlimited.
+type DCLimiter struct {
+	limits map[int]DCLimit
+	def    DCLimit
+
+	mu  sync.Mutex
+	dcs map[int]*dcLimiter
+}
+
+// NewDCLimiter returns DCLimiter with limits by DC id, and def applies to other DCs.
+// It returns nil if all limits are zero.
+func NewDCLimiter(limits map[int]DCLimit, def DCLimit) *DCLimiter {
+	l := &DCLimiter{limits: make(map[int]DCLimit), def: def, dcs: make(map[int]*dcLimiter)}
+	for dc, limit := range limits {
+		if !limit.zero() {
+			l.limits[dc] = limit
+		}
+	}
+
+	if len(l.limits) == 0 && def.zero() {
+		return nil
+	}
+	return l
+}
+
+type dcLimiter struct {
+	dc        int
+	sem       chan struct{} // nil if concurrency is unlimited
+	rate      *rate.Limiter // nil if rate is unlimited
+	throttled bool          // to log only when throttling kicks in
+	mu        sync.Mutex
+}
+
+func (l *DCLimiter) get(dc int) *dcLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if d, ok := l.dcs[dc]; ok {
+		return d
+	}
+
+	limit, ok := l.limits[dc]
+	if !ok {
+		limit = l.def
+	}
+
+	d := &dcLimiter{dc: dc}
+	if limit.Concurrency > 0 {
+		d.sem = make(chan struct{}, limit.Concurrency)
+	}
+	if limit.Rate > 0 {
+		d.rate = rate.NewLimiter(rate.Limit(limit.Rate), max(int(limit.Rate), 1))
+	}
+	l.dcs[dc] = d
+	return d
+}
+
+// acquire blocks until a request to DC is allowed, and returns the release function
+func (d *dcLimiter) acquire(ctx context.Context) (func(), error) {
+	throttled := false
+
+	release := func() {}
+	if d.sem != nil {
+		select {
+		case d.sem <- struct{}{}:
+		default:
+			throttled = true
+			select {
+			case d.sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		release = func() { <-d.sem }
+	}
+
+	if d.rate != nil {
+		if !d.rate.Allow() {
+			throttled = true
+			if err := d.rate.Wait(ctx); err != nil {
+				release()
+				return nil, err
+			}
+		}
+	}
+
+	d.mu.Lock()
+	if throttled && !d.throttled {
+		logctx.From(ctx).Info("Throttle download requests by DC limit", zap.Int("dc", d.dc))
+	}
+	d.throttled = throttled
+	d.mu.Unlock()
+
+	return release, nil
+}
+
+// client wraps client of dc, so that its requests are limited. It returns client as is if l is nil.
+func (l *DCLimiter) client(dc int, client *tg.Client) *tg.Client {
+	if l == nil {
+		return client
+	}
+	return tg.NewClient(&limitedInvoker{next: client.Invoker(), l: l.get(dc)})
+}
+
+type limitedInvoker struct {
+	next tg.Invoker
+	l    *dcLimiter
+}
+
+func (i *limitedInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	release, err := i.l.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return i.next.Invoke(ctx, input, output)
+}
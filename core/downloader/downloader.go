@@ -2,6 +2,8 @@ package downloader
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/telegram/downloader"
@@ -10,12 +12,16 @@ import (
 
 	"github.com/iyear/tdl/core/dcpool"
 	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/util/bandwidth"
 	"github.com/iyear/tdl/core/util/tutil"
 )
 
 // MaxPartSize refer to https://core.telegram.org/api/files#downloading-files
 const MaxPartSize = 1024 * 1024
 
+// ErrInvalidPartSize is returned when Options.PartSize is not accepted by Telegram.
+var ErrInvalidPartSize = errors.New("invalid part size")
+
 type Downloader struct {
 	opts Options
 }
@@ -25,6 +31,16 @@ type Options struct {
 	Threads  int
 	Iter     Iter
 	Progress Progress
+	// Limiter caps total download bandwidth, nil means unlimited. It can be shared with uploader.
+	Limiter *bandwidth.Limiter
+	// Verify checks size of downloaded files, and content against hashes provided by Telegram
+	// if destination is io.ReaderAt, which costs extra requests. Mismatch fails with ErrIntegrityMismatch.
+	Verify bool
+	// PartSize is the size of each requested part, which must be divisible by 4KB and divide MaxPartSize(1MB).
+	// Zero means MaxPartSize, which needs the fewest requests.
+	PartSize int
+	// DCLimiter caps requests to each DC of all workers, nil means unlimited. It can be shared with other Downloaders.
+	DCLimiter *DCLimiter
 }
 
 func New(opts Options) *Downloader {
@@ -33,24 +49,89 @@ func New(opts Options) *Downloader {
 	}
 }
 
+// ValidatePartSize reports ErrInvalidPartSize if size is not accepted by Telegram, and zero is valid as MaxPartSize.
+func ValidatePartSize(size int) error {
+	if size == 0 {
+		return nil
+	}
+	if size < 0 || size%4096 != 0 || MaxPartSize%size != 0 {
+		return errors.Wrapf(ErrInvalidPartSize, "%d bytes, must be divisible by 4KB and divide 1MB", size)
+	}
+	return nil
+}
+
+func (d *Downloader) partSize() int {
+	if d.opts.PartSize == 0 {
+		return MaxPartSize
+	}
+	return d.opts.PartSize
+}
+
+// ElemError is the error of a failed elem, which doesn't abort downloads of other elems.
+type ElemError struct {
+	Elem Elem
+	Err  error
+}
+
+func (e *ElemError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ElemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError aggregates errors of failed elems in a Download.
+type BatchError struct {
+	Errors []*ElemError
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d files failed to download, first error: %v", len(e.Errors), e.Errors[0])
+}
+
+// Unwrap returns errors of failed elems, so that errors.Is and errors.As match any of them.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Download downloads elems of Iter by at most limit workers simultaneously, which share connections of Pool.
+// Failed elems are reported to Progress and don't abort others, and *BatchError is returned if any fails.
 func (d *Downloader) Download(ctx context.Context, limit int) error {
+	if err := ValidatePartSize(d.opts.PartSize); err != nil {
+		return err
+	}
+
 	wg, wgctx := errgroup.WithContext(ctx)
 	wg.SetLimit(limit)
 
+	var (
+		mu     sync.Mutex
+		failed []*ElemError
+	)
+
 	for d.opts.Iter.Next(wgctx) {
 		elem := d.opts.Iter.Value()
 
-		wg.Go(func() (rerr error) {
+		wg.Go(func() error {
 			d.opts.Progress.OnAdd(elem)
-			defer func() { d.opts.Progress.OnDone(elem, rerr) }()
 
-			if err := d.download(wgctx, elem); err != nil {
+			err := d.download(wgctx, elem)
+			d.opts.Progress.OnDone(elem, err)
+
+			if err != nil {
 				// canceled by user, so we directly return error to stop all
 				if errors.Is(err, context.Canceled) {
 					return errors.Wrap(err, "download")
 				}
 
-				// don't return error, just log it
+				mu.Lock()
+				failed = append(failed, &ElemError{Elem: elem, Err: err})
+				mu.Unlock()
 			}
 
 			return nil
@@ -61,7 +142,13 @@ func (d *Downloader) Download(ctx context.Context, limit int) error {
 		return errors.Wrap(err, "iter")
 	}
 
-	return wg.Wait()
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return &BatchError{Errors: failed}
+	}
+	return nil
 }
 
 func (d *Downloader) download(ctx context.Context, elem Elem) error {
@@ -78,14 +165,22 @@ func (d *Downloader) download(ctx context.Context, elem Elem) error {
 	if elem.AsTakeout() {
 		client = d.opts.Pool.Takeout(ctx, elem.File().DC())
 	}
+	client = d.opts.DCLimiter.client(elem.File().DC(), client)
 
-	_, err := downloader.NewDownloader().WithPartSize(MaxPartSize).
+	w := newWriteAt(ctx, elem, d.opts.Progress, d.partSize(), d.opts.Limiter)
+	_, err := downloader.NewDownloader().WithPartSize(d.partSize()).
 		Download(client, elem.File().Location()).
 		WithThreads(tutil.BestThreads(elem.File().Size(), d.opts.Threads)).
-		Parallel(ctx, newWriteAt(elem, d.opts.Progress, MaxPartSize))
+		Parallel(ctx, w)
 	if err != nil {
 		return errors.Wrap(err, "download")
 	}
 
+	if d.opts.Verify {
+		if err = verify(ctx, client, elem, w.downloaded.Load()); err != nil {
+			return errors.Wrap(err, "verify")
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,421 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileInvoker serves upload.getFile of files by volume ID, and fails missing files.
+// upload.getFileHashes is served by hashes of files, which are hashed by hashLimit bytes.
+type fileInvoker struct {
+	files     map[int64][]byte
+	hashes    map[int64][]byte
+	hashLimit int
+	running   atomic.Int32
+	peak      atomic.Int32
+}
+
+func (f *fileInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	if req, ok := input.(*tg.UploadGetFileHashesRequest); ok {
+		return f.fileHashes(req, output.(*tg.FileHashVector))
+	}
+
+	req, ok := input.(*tg.UploadGetFileRequest)
+	if !ok {
+		return errors.Errorf("unexpected request %T", input)
+	}
+
+	n := f.running.Add(1)
+	defer f.running.Add(-1)
+	for {
+		peak := f.peak.Load()
+		if n <= peak || f.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	// simulate network latency, so that downloads overlap
+	select {
+	case <-time.After(20 * time.Millisecond):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	id := req.Location.(*tg.InputFileLocation).VolumeID
+	data, ok := f.files[id]
+	if !ok {
+		return errors.New("FILE_REFERENCE_EXPIRED")
+	}
+
+	end := min(req.Offset+int64(req.Limit), int64(len(data)))
+	output.(*tg.UploadFileBox).File = &tg.UploadFile{
+		Type:  &tg.StorageFileUnknown{},
+		Bytes: data[min(req.Offset, end):end],
+	}
+	return nil
+}
+
+func (f *fileInvoker) fileHashes(req *tg.UploadGetFileHashesRequest, output *tg.FileHashVector) error {
+	data, ok := f.hashes[req.Location.(*tg.InputFileLocation).VolumeID]
+	if !ok {
+		return tgerr.New(400, "LOCATION_INVALID")
+	}
+
+	// return 2 hashes per request like Telegram returns several ones
+	for off := req.Offset; off < int64(len(data)) && len(output.Elems) < 2; off += int64(f.hashLimit) {
+		end := min(off+int64(f.hashLimit), int64(len(data)))
+		sum := sha256.Sum256(data[off:end])
+		output.Elems = append(output.Elems, tg.FileHash{Offset: off, Limit: f.hashLimit, Hash: sum[:]})
+	}
+	return nil
+}
+
+// fakePool returns clients by DC, and client for other DCs
+type fakePool struct {
+	client  *tg.Client
+	clients map[int]*tg.Client
+}
+
+func (p *fakePool) Client(_ context.Context, dc int) *tg.Client {
+	if c, ok := p.clients[dc]; ok {
+		return c
+	}
+	return p.client
+}
+
+func (p *fakePool) Takeout(ctx context.Context, dc int) *tg.Client { return p.Client(ctx, dc) }
+func (p *fakePool) Default(context.Context) *tg.Client             { return p.client }
+func (p *fakePool) Close() error                                   { return nil }
+
+type buffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *buffer) ReadAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if off >= int64(len(b.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b *buffer) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if end := int(off) + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+	return copy(b.buf[off:], p), nil
+}
+
+type fakeElem struct {
+	id   int64
+	size int64
+	to   *buffer
+	dc   int // zero means 2
+}
+
+func (e *fakeElem) File() File      { return e }
+func (e *fakeElem) To() io.WriterAt { return e.to }
+func (e *fakeElem) AsTakeout() bool { return false }
+func (e *fakeElem) Size() int64     { return e.size }
+func (e *fakeElem) DC() int         { return max(e.dc, 2) }
+func (e *fakeElem) Location() tg.InputFileLocationClass {
+	return &tg.InputFileLocation{VolumeID: e.id}
+}
+
+type sliceIter struct {
+	elems []Elem
+	cur   Elem
+}
+
+func (i *sliceIter) Next(ctx context.Context) bool {
+	if len(i.elems) == 0 || ctx.Err() != nil {
+		return false
+	}
+	i.cur, i.elems = i.elems[0], i.elems[1:]
+	return true
+}
+
+func (i *sliceIter) Value() Elem { return i.cur }
+func (i *sliceIter) Err() error  { return nil }
+
+type doneProgress struct {
+	mu   sync.Mutex
+	errs map[int64]error
+}
+
+func (p *doneProgress) OnAdd(Elem)                     {}
+func (p *doneProgress) OnDownload(Elem, ProgressState) {}
+func (p *doneProgress) OnDone(elem Elem, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errs[elem.(*fakeElem).id] = err
+}
+
+func TestDownloader_Download(t *testing.T) {
+	inv := &fileInvoker{files: map[int64][]byte{}}
+	elems := make([]Elem, 0)
+	for id := int64(1); id <= 8; id++ {
+		data := bytes.Repeat([]byte{byte(id)}, int(id)*1000)
+		if id%4 != 0 { // 4 and 8 fail
+			inv.files[id] = data
+		}
+		elems = append(elems, &fakeElem{id: id, size: int64(len(data)), to: &buffer{}})
+	}
+
+	progress := &doneProgress{errs: map[int64]error{}}
+	d := New(Options{
+		Pool:     &fakePool{client: tg.NewClient(inv)},
+		Threads:  1,
+		Iter:     &sliceIter{elems: elems},
+		Progress: progress,
+	})
+
+	err := d.Download(context.Background(), 3)
+
+	var batch *BatchError
+	require.ErrorAs(t, err, &batch)
+	failed := make([]int64, 0)
+	for _, e := range batch.Errors {
+		failed = append(failed, e.Elem.(*fakeElem).id)
+	}
+	assert.ElementsMatch(t, []int64{4, 8}, failed)
+
+	// errors of failed elems are unwrapped
+	var elemErr *ElemError
+	require.ErrorAs(t, err, &elemErr)
+	assert.Equal(t, int64(0), elemErr.Elem.(*fakeElem).id%4)
+	assert.ErrorIs(t, err, batch.Errors[0].Err)
+
+	// failed files don't abort others
+	for _, e := range elems {
+		fe := e.(*fakeElem)
+		if fe.id%4 == 0 {
+			assert.Error(t, progress.errs[fe.id], "failure should be reported to progress")
+			continue
+		}
+		assert.NoError(t, progress.errs[fe.id])
+		assert.Equal(t, inv.files[fe.id], fe.to.buf)
+	}
+
+	assert.Greater(t, inv.peak.Load(), int32(1), "files should be downloaded simultaneously")
+	assert.LessOrEqual(t, inv.peak.Load(), int32(3), "workers should be bounded by limit")
+}
+
+func TestDownloader_Verify(t *testing.T) {
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	corrupted := bytes.Clone(data)
+	corrupted[2500]++
+
+	inv := &fileInvoker{
+		files: map[int64][]byte{
+			1: data,      // ok
+			2: corrupted, // hash mismatch
+			3: data,      // size mismatch
+			4: data,      // hashes unavailable
+		},
+		hashes:    map[int64][]byte{1: data, 2: data, 3: data},
+		hashLimit: 500,
+	}
+	elems := []Elem{
+		&fakeElem{id: 1, size: 3000, to: &buffer{}},
+		&fakeElem{id: 2, size: 3000, to: &buffer{}},
+		&fakeElem{id: 3, size: 4000, to: &buffer{}},
+		&fakeElem{id: 4, size: 3000, to: &buffer{}},
+	}
+
+	progress := &doneProgress{errs: map[int64]error{}}
+	d := New(Options{
+		Pool:     &fakePool{client: tg.NewClient(inv)},
+		Threads:  1,
+		Iter:     &sliceIter{elems: elems},
+		Progress: progress,
+		Verify:   true,
+	})
+
+	require.Error(t, d.Download(context.Background(), 2))
+
+	assert.NoError(t, progress.errs[1])
+	assert.ErrorIs(t, progress.errs[2], ErrIntegrityMismatch)
+	assert.ErrorIs(t, progress.errs[3], ErrIntegrityMismatch)
+	assert.NoError(t, progress.errs[4])
+}
+
+func TestDownload_InvalidPartSize(t *testing.T) {
+	for _, size := range []int{0, 4096, 512 * 1024, MaxPartSize} {
+		assert.NoError(t, ValidatePartSize(size), size)
+	}
+
+	for _, size := range []int{-4096, 1024, 3 * 4096, 2 * MaxPartSize} {
+		assert.ErrorIs(t, ValidatePartSize(size), ErrInvalidPartSize, size)
+
+		// nil pool and iter are never used
+		err := New(Options{PartSize: size}).Download(context.Background(), 1)
+		assert.ErrorIs(t, err, ErrInvalidPartSize, size)
+	}
+}
+
+func TestDownloader_DCLimiter(t *testing.T) {
+	assert.Nil(t, NewDCLimiter(map[int]DCLimit{4: {}}, DCLimit{}), "zero limits mean unlimited")
+
+	dc2, dc4 := &fileInvoker{files: map[int64][]byte{}}, &fileInvoker{files: map[int64][]byte{}}
+	elems := make([]Elem, 0)
+	for id := int64(1); id <= 12; id++ {
+		data := bytes.Repeat([]byte{byte(id)}, 1000)
+		dc, inv := 2, dc2
+		if id%2 == 0 {
+			dc, inv = 4, dc4
+		}
+		inv.files[id] = data
+		elems = append(elems, &fakeElem{id: id, size: int64(len(data)), to: &buffer{}, dc: dc})
+	}
+
+	progress := &doneProgress{errs: map[int64]error{}}
+	d := New(Options{
+		Pool: &fakePool{clients: map[int]*tg.Client{
+			2: tg.NewClient(dc2),
+			4: tg.NewClient(dc4),
+		}},
+		Threads:   1,
+		Iter:      &sliceIter{elems: elems},
+		Progress:  progress,
+		DCLimiter: NewDCLimiter(map[int]DCLimit{4: {Concurrency: 3}}, DCLimit{Concurrency: 1}),
+	})
+
+	require.NoError(t, d.Download(context.Background(), 6))
+	for _, e := range elems {
+		assert.NoError(t, progress.errs[e.(*fakeElem).id])
+	}
+
+	assert.Equal(t, int32(1), dc2.peak.Load(), "default limit applies to DC 2")
+	assert.Greater(t, dc4.peak.Load(), int32(1))
+	assert.LessOrEqual(t, dc4.peak.Load(), int32(3), "DC 4 should be capped by its own limit")
+}
+
+func TestDCLimiter_Rate(t *testing.T) {
+	l := NewDCLimiter(nil, DCLimit{Rate: 20}).get(2)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		release, err := l.acquire(ctx)
+		require.NoError(t, err)
+		release()
+	}
+	// burst of 20 requests, then 10 requests at 20/s
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	assert.True(t, l.throttled)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := l.acquire(canceled)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// hashesInvoker serves upload.getFileHashes by fn
+type hashesInvoker func(offset int64) ([]tg.FileHash, error)
+
+func (f hashesInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	req, ok := input.(*tg.UploadGetFileHashesRequest)
+	if !ok {
+		return errors.Errorf("unexpected request %T", input)
+	}
+
+	hashes, err := f(req.Offset)
+	if err != nil {
+		return err
+	}
+	output.(*tg.FileHashVector).Elems = hashes
+	return nil
+}
+
+func TestVerifyHashes(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte{1}, 1000)
+	r := &buffer{buf: data}
+	sum := sha256.Sum256(data[:500])
+
+	tests := []struct {
+		name      string
+		fn        hashesInvoker
+		available bool
+		wantErr   bool
+	}{
+		{
+			name: "unavailable",
+			fn: func(int64) ([]tg.FileHash, error) {
+				return nil, tgerr.New(400, tg.ErrLocationInvalid)
+			},
+			available: false,
+		},
+		{
+			name: "expired reference",
+			fn: func(int64) ([]tg.FileHash, error) {
+				return nil, tgerr.New(400, tg.ErrFileReferenceExpired)
+			},
+			wantErr: true,
+		},
+		{
+			name: "no progress",
+			fn: func(int64) ([]tg.FileHash, error) {
+				return []tg.FileHash{{Offset: 0, Limit: 0, Hash: sum[:]}}, nil
+			},
+			available: true,
+			wantErr:   true,
+		},
+		{
+			name: "ok",
+			fn: func(offset int64) ([]tg.FileHash, error) {
+				return []tg.FileHash{{Offset: offset, Limit: 500, Hash: sum[:]}}, nil
+			},
+			available: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+
+				available, err := VerifyHashes(ctx, tg.NewClient(tt.fn), &tg.InputFileLocation{}, int64(len(data)), r)
+				assert.Equal(t, tt.available, available)
+				if tt.wantErr {
+					assert.Error(t, err)
+					return
+				}
+				assert.NoError(t, err)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("verify doesn't return")
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package downloader
 
 import (
+	"context"
 	"time"
 
 	"go.uber.org/atomic"
+
+	"github.com/iyear/tdl/core/util/bandwidth"
 )
 
 type Progress interface {
@@ -22,23 +25,31 @@ type ProgressState struct {
 //
 // do not need mutex because gotd has use syncio.WriteAt
 type writeAt struct {
+	ctx      context.Context
 	elem     Elem
 	progress Progress
 	partSize int
+	limiter  *bandwidth.Limiter
 
 	downloaded *atomic.Int64
 }
 
-func newWriteAt(elem Elem, progress Progress, partSize int) *writeAt {
+func newWriteAt(ctx context.Context, elem Elem, progress Progress, partSize int, limiter *bandwidth.Limiter) *writeAt {
 	return &writeAt{
+		ctx:        ctx,
 		elem:       elem,
 		progress:   progress,
 		partSize:   partSize,
+		limiter:    limiter,
 		downloaded: atomic.NewInt64(0),
 	}
 }
 
 func (w *writeAt) WriteAt(p []byte, off int64) (int, error) {
+	if err := w.limiter.WaitN(w.ctx, len(p)); err != nil {
+		return 0, err
+	}
+
 	at, err := w.elem.To().WriteAt(p, off)
 	if err != nil {
 		return 0, err
@@ -0,0 +1,85 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// ErrIntegrityMismatch is returned by Options.Verify when downloaded file doesn't match expected size or hashes.
+var ErrIntegrityMismatch = errors.New("integrity mismatch")
+
+// verify checks written bytes against file size, and content against hashes of upload.getFileHashes
+// if the destination is readable and Telegram provides hashes of the file.
+func verify(ctx context.Context, client *tg.Client, elem Elem, written int64) error {
+	if size := elem.File().Size(); size > 0 && written != size {
+		return errors.Wrapf(ErrIntegrityMismatch, "size: expected %d, got %d", size, written)
+	}
+
+	r, ok := elem.To().(io.ReaderAt)
+	if !ok {
+		return nil
+	}
+
+	_, err := VerifyHashes(ctx, client, elem.File().Location(), written, r)
+	return err
+}
+
+// VerifyHashes checks the first size bytes of r against hashes of file at loc provided by upload.getFileHashes,
+// and reports whether hashes are available, e.g. they are not provided for photos. client must be of the DC of file.
+// Mismatch fails with ErrIntegrityMismatch.
+func VerifyHashes(ctx context.Context, client *tg.Client, loc tg.InputFileLocationClass, size int64, r io.ReaderAt) (bool, error) {
+	var (
+		offset int64
+		buf    []byte
+	)
+	for offset < size {
+		hashes, err := client.UploadGetFileHashes(ctx, &tg.UploadGetFileHashesRequest{
+			Location: loc,
+			Offset:   offset,
+		})
+		if err != nil {
+			// hashes are not available for all locations, e.g. photos
+			if tgerr.Is(err, tg.ErrLocationInvalid) {
+				return offset > 0, nil
+			}
+			return false, errors.Wrap(err, "get file hashes")
+		}
+		if len(hashes) == 0 {
+			return offset > 0, nil
+		}
+
+		next := offset
+		for _, h := range hashes {
+			if h.Offset >= size {
+				return true, nil
+			}
+
+			if cap(buf) < h.Limit {
+				buf = make([]byte, h.Limit)
+			}
+			n, err := r.ReadAt(buf[:h.Limit], h.Offset)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return false, errors.Wrap(err, "read file")
+			}
+
+			sum := sha256.Sum256(buf[:n])
+			if !bytes.Equal(sum[:], h.Hash) {
+				return true, errors.Wrapf(ErrIntegrityMismatch, "hash of range [%d, %d)", h.Offset, h.Offset+int64(n))
+			}
+			next = h.Offset + int64(h.Limit)
+		}
+		// malformed hashes shouldn't make it loop forever
+		if next <= offset {
+			return true, errors.Errorf("hashes of offset %d don't make progress", offset)
+		}
+		offset = next
+	}
+
+	return true, nil
+}
@@ -19,8 +19,11 @@ import (
 )
 
 type cloneOptions struct {
-	elem     Elem
-	media    *tmedia.Media
+	elem  Elem
+	media *tmedia.Media
+	// stream pipes downloaded data to uploader directly instead of a temp file,
+	// which is sequential download in one thread but doesn't touch disk.
+	stream   bool
 	progress progressAdd
 }
 
@@ -37,6 +40,10 @@ func (f *Forwarder) cloneMedia(ctx context.Context, opts cloneOptions, dryRun bo
 		return &tg.InputFile{}, nil
 	}
 
+	if opts.stream {
+		return f.streamMedia(ctx, opts)
+	}
+
 	temp, err := os.CreateTemp("", "tdl_*")
 	if err != nil {
 		return nil, errors.Wrap(err, "create temp file")
@@ -60,14 +67,41 @@ func (f *Forwarder) cloneMedia(ctx context.Context, opts cloneOptions, dryRun bo
 		return nil, errors.Wrap(err, "download")
 	}
 
-	var file tg.InputFileClass
-
 	if _, err = temp.Seek(0, io.SeekStart); err != nil {
 		return nil, errors.Wrap(err, "seek")
 	}
 
-	upload := uploader.NewUpload(opts.media.Name, temp, opts.media.Size)
-	file, err = uploader.NewUploader(f.opts.Pool.Default(ctx)).
+	return f.uploadMedia(ctx, opts, temp, threads)
+}
+
+// streamMedia downloads media into a pipe, which is read by uploader at the same time
+func (f *Forwarder) streamMedia(ctx context.Context, opts cloneOptions) (tg.InputFileClass, error) {
+	r, w := io.Pipe()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		_, err := downloader.NewDownloader().
+			WithPartSize(tdownloader.MaxPartSize).
+			Download(f.opts.Pool.Client(ctx, opts.media.DC), opts.media.InputFileLoc).
+			Stream(ctx, progressWriter{w: w, opts: opts})
+		if err != nil {
+			// uploader gets download error instead of EOF
+			_ = w.CloseWithError(errors.Wrap(err, "download"))
+			return
+		}
+		_ = w.Close()
+	}()
+
+	file, err := f.uploadMedia(ctx, opts, r, tutil.BestThreads(opts.media.Size, f.opts.Threads))
+	// stop download if upload fails early
+	_ = r.CloseWithError(err)
+	return file, err
+}
+
+func (f *Forwarder) uploadMedia(ctx context.Context, opts cloneOptions, r io.Reader, threads int) (tg.InputFileClass, error) {
+	upload := uploader.NewUpload(opts.media.Name, r, opts.media.Size)
+	file, err := uploader.NewUploader(f.opts.Pool.Default(ctx)).
 		WithPartSize(tuploader.MaxPartSize).
 		WithThreads(threads).
 		WithProgress(uploaded{
@@ -82,6 +116,17 @@ func (f *Forwarder) cloneMedia(ctx context.Context, opts cloneOptions, dryRun bo
 	return file, nil
 }
 
+type progressWriter struct {
+	w    io.Writer
+	opts cloneOptions
+}
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.opts.progress.add(int64(n))
+	return n, err
+}
+
 type writeAt struct {
 	f    io.WriterAt
 	opts cloneOptions
@@ -9,6 +9,7 @@ import (
 	"github.com/gotd/td/bin"
 	"github.com/gotd/td/telegram/peers"
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 
@@ -21,7 +22,7 @@ import (
 //go:generate go-enum --values --names --flag --nocase
 
 // Mode
-// ENUM(direct, clone)
+// ENUM(direct, clone, reupload)
 type Mode int
 
 type Options struct {
@@ -147,7 +148,9 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 
 		// we should clone photo and document via re-upload, it will be banned if we forward it directly.
 		// but other media can be forwarded directly via copy
-		if (!protectedDialog(elem.From()) && !protectedMessage(msg)) || !photoOrDocument(msg.Media) {
+		// reupload mode always clones photo and document, so that no server-side reference is kept.
+		reupload := elem.Mode() == ModeReupload
+		if (!reupload && !protectedDialog(elem.From()) && !protectedMessage(msg)) || !photoOrDocument(msg.Media) {
 			media, ok := tmedia.ConvInputMedia(msg.Media)
 			if !ok {
 				return nil, errors.Errorf("can't convert message %d to input class directly", msg.ID)
@@ -166,8 +169,9 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 		}
 
 		mediaFile, err := f.cloneMedia(ctx, cloneOptions{
-			elem:  elem,
-			media: media,
+			elem:   elem,
+			media:  media,
+			stream: reupload,
 			progress: &wrapProgress{
 				elem:     elem,
 				progress: f.opts.Progress,
@@ -212,6 +216,7 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 				thumbFile, err := f.cloneMedia(ctx, cloneOptions{
 					elem:     elem,
 					media:    thumb,
+					stream:   reupload,
 					progress: nopProgress{},
 				}, elem.AsDryRun())
 				if err != nil {
@@ -246,6 +251,22 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 		return inputMedia, nil
 	}
 
+	// file references of messages fetched long ago may expire, e.g. reupload of large media takes long,
+	// so media is converted again from the refetched message
+	convFreshMedia := func(msg *tg.Message) (tg.InputMediaClass, error) {
+		media, err := convForwardedMedia(msg)
+		if err == nil || !tgerr.Is(err, tg.ErrFileReferenceExpired) {
+			return media, err
+		}
+
+		log.Info("File reference expired, refetch message", zap.Int("message", msg.ID))
+		fresh, err := tutil.GetSingleMessage(ctx, f.opts.Pool.Default(ctx), elem.From().InputPeer(), msg.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, "refetch message")
+		}
+		return convForwardedMedia(fresh)
+	}
+
 	switch elem.Mode() {
 	case ModeDirect:
 		// it can be forwarded via API
@@ -298,11 +319,11 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 		}
 	fallback:
 		fallthrough
-	case ModeClone:
+	case ModeClone, ModeReupload:
 		if len(grouped) > 0 {
 			media := make([]tg.InputSingleMedia, 0, len(grouped))
 			for _, gm := range grouped {
-				m, err := convForwardedMedia(gm)
+				m, err := convFreshMedia(gm)
 				if err != nil {
 					log.Debug("Can't convert forwarded media", zap.Error(err))
 					continue
@@ -342,7 +363,7 @@ func (f *Forwarder) forwardMessage(ctx context.Context, elem Elem, grouped ...*t
 			return forwardTextOnly(elem.Msg())
 		}
 
-		media, err := convForwardedMedia(elem.Msg())
+		media, err := convFreshMedia(elem.Msg())
 		if err != nil {
 			log.Debug("Can't convert forwarded media", zap.Error(err))
 			return forwardTextOnly(elem.Msg())
@@ -16,15 +16,18 @@ const (
 	ModeDirect Mode = iota
 	// ModeClone is a Mode of type Clone.
 	ModeClone
+	// ModeReupload is a Mode of type Reupload.
+	ModeReupload
 )
 
 var ErrInvalidMode = fmt.Errorf("not a valid Mode, try [%s]", strings.Join(_ModeNames, ", "))
 
-const _ModeName = "directclone"
+const _ModeName = "directclonereupload"
 
 var _ModeNames = []string{
 	_ModeName[0:6],
 	_ModeName[6:11],
+	_ModeName[11:19],
 }
 
 // ModeNames returns a list of possible string values of Mode.
@@ -39,12 +42,14 @@ func ModeValues() []Mode {
 	return []Mode{
 		ModeDirect,
 		ModeClone,
+		ModeReupload,
 	}
 }
 
 var _ModeMap = map[Mode]string{
-	ModeDirect: _ModeName[0:6],
-	ModeClone:  _ModeName[6:11],
+	ModeDirect:   _ModeName[0:6],
+	ModeClone:    _ModeName[6:11],
+	ModeReupload: _ModeName[11:19],
 }
 
 // String implements the Stringer interface.
@@ -63,10 +68,12 @@ func (x Mode) IsValid() bool {
 }
 
 var _ModeValue = map[string]Mode{
-	_ModeName[0:6]:                   ModeDirect,
-	strings.ToLower(_ModeName[0:6]):  ModeDirect,
-	_ModeName[6:11]:                  ModeClone,
-	strings.ToLower(_ModeName[6:11]): ModeClone,
+	_ModeName[0:6]:                    ModeDirect,
+	strings.ToLower(_ModeName[0:6]):   ModeDirect,
+	_ModeName[6:11]:                   ModeClone,
+	strings.ToLower(_ModeName[6:11]):  ModeClone,
+	_ModeName[11:19]:                  ModeReupload,
+	strings.ToLower(_ModeName[11:19]): ModeReupload,
 }
 
 // ParseMode attempts to convert a string to a Mode.
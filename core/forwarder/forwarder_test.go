@@ -0,0 +1,166 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePeer struct {
+	peers.Peer
+	id int64
+}
+
+func (p fakePeer) ID() int64                    { return p.id }
+func (p fakePeer) InputPeer() tg.InputPeerClass { return &tg.InputPeerChat{ChatID: p.id} }
+
+type fakeElem struct {
+	msg *tg.Message
+}
+
+func (e *fakeElem) Mode() Mode       { return ModeReupload }
+func (e *fakeElem) From() peers.Peer { return fakePeer{id: 1} }
+func (e *fakeElem) Msg() *tg.Message { return e.msg }
+func (e *fakeElem) To() peers.Peer   { return fakePeer{id: 2} }
+func (e *fakeElem) Thread() int      { return 0 }
+func (e *fakeElem) AsSilent() bool   { return false }
+func (e *fakeElem) AsDryRun() bool   { return false }
+func (e *fakeElem) AsGrouped() bool  { return false }
+
+type fakePool struct{ client *tg.Client }
+
+func (p *fakePool) Client(context.Context, int) *tg.Client  { return p.client }
+func (p *fakePool) Takeout(context.Context, int) *tg.Client { return p.client }
+func (p *fakePool) Default(context.Context) *tg.Client      { return p.client }
+func (p *fakePool) Close() error                            { return nil }
+
+type fakeProgress struct {
+	mu   sync.Mutex
+	last ProgressState
+	err  error
+}
+
+func (p *fakeProgress) OnAdd(Elem) {}
+
+func (p *fakeProgress) OnClone(_ Elem, state ProgressState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last = state
+}
+
+func (p *fakeProgress) OnDone(_ Elem, err error) { p.err = err }
+
+// mediaInvoker serves document of source chat, which is only downloadable by fresh reference,
+// and records the re-uploaded file and sent message.
+type mediaInvoker struct {
+	data  []byte
+	fresh *tg.Message // returned by refetching
+
+	mu        sync.Mutex
+	refetched int
+	uploaded  bytes.Buffer
+	sent      *tg.MessagesSendMediaRequest
+}
+
+func (i *mediaInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	switch req := input.(type) {
+	case *tg.UploadGetFileRequest:
+		if string(req.Location.(*tg.InputDocumentFileLocation).FileReference) != "fresh" {
+			return tgerr.New(400, tg.ErrFileReferenceExpired)
+		}
+		end := min(req.Offset+int64(req.Limit), int64(len(i.data)))
+		output.(*tg.UploadFileBox).File = &tg.UploadFile{
+			Type:  &tg.StorageFileUnknown{},
+			Bytes: i.data[min(req.Offset, end):end],
+		}
+	case *tg.UploadSaveFilePartRequest:
+		i.uploaded.Write(req.Bytes)
+		output.(*tg.BoolBox).Bool = &tg.BoolTrue{}
+	case *tg.MessagesGetHistoryRequest:
+		i.refetched++
+		output.(*tg.MessagesMessagesBox).Messages = &tg.MessagesMessages{Messages: []tg.MessageClass{i.fresh}}
+	case *tg.MessagesUploadMediaRequest:
+		output.(*tg.MessageMediaBox).MessageMedia = &tg.MessageMediaDocument{
+			Document: &tg.Document{ID: 100, AccessHash: 1, FileReference: []byte("uploaded")},
+		}
+	case *tg.MessagesSendMediaRequest:
+		i.sent = req
+		output.(*tg.UpdatesBox).Updates = &tg.Updates{}
+	default:
+		return errors.Errorf("unexpected request %T", input)
+	}
+	return nil
+}
+
+func newDocumentMessage(id int, ref string, size int) *tg.Message {
+	msg := &tg.Message{
+		ID:      id,
+		Message: "caption",
+		Media: &tg.MessageMediaDocument{Document: &tg.Document{
+			ID:            10,
+			AccessHash:    1,
+			FileReference: []byte(ref),
+			DCID:          2,
+			Size:          int64(size),
+			MimeType:      "application/octet-stream",
+			Attributes:    []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: "file.bin"}},
+		}},
+	}
+	msg.SetFlags()
+	return msg
+}
+
+func TestForwarder_Reupload(t *testing.T) {
+	data := make([]byte, 3000)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		ref       string
+		refetched int
+	}{
+		{name: "stream", ref: "fresh", refetched: 0},
+		{name: "expired reference", ref: "expired", refetched: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &mediaInvoker{data: data, fresh: newDocumentMessage(5, "fresh", len(data))}
+			progress := &fakeProgress{}
+			f := New(Options{
+				Pool:     &fakePool{client: tg.NewClient(inv)},
+				Threads:  4,
+				Progress: progress,
+			})
+
+			elem := &fakeElem{msg: newDocumentMessage(5, tt.ref, len(data))}
+			require.NoError(t, f.forwardMessage(context.Background(), elem))
+			require.NoError(t, progress.err)
+
+			assert.Equal(t, tt.refetched, inv.refetched)
+			assert.Equal(t, data, inv.uploaded.Bytes(), "media is downloaded and uploaded by stream")
+			assert.Equal(t, ProgressState{Done: int64(len(data)) * 2, Total: int64(len(data)) * 2}, progress.last)
+
+			// sent as a new message with caption instead of forwarding
+			require.NotNil(t, inv.sent)
+			assert.Equal(t, "caption", inv.sent.Message)
+			doc, ok := inv.sent.Media.(*tg.InputMediaDocument)
+			require.True(t, ok)
+			assert.Equal(t, int64(100), doc.ID.(*tg.InputDocument).ID)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package breaker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// ErrOpen is returned by all requests after the circuit is opened.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// DefaultErrors are auth-level errors which can't be recovered by retrying or reconnecting,
+// e.g. the session is revoked or the account is banned.
+var DefaultErrors = []string{
+	"AUTH_KEY_UNREGISTERED",
+	"USER_DEACTIVATED",
+	"USER_DEACTIVATED_BAN",
+	"SESSION_REVOKED",
+}
+
+// Breaker counts auth-level failures in a sliding window, and opens the circuit after threshold
+// failures, so that callers get a terminal error instead of reconnecting forever with a dead account.
+// The circuit never closes once opened, because such accounts don't recover by themselves.
+type Breaker struct {
+	threshold int
+	window    time.Duration
+	types     []string
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures []time.Time
+	last     error // the failure which opens the circuit, nil if closed
+}
+
+// New returns Breaker which opens after threshold failures of given error types in window.
+// DefaultErrors are used if types is empty.
+func New(threshold int, window time.Duration, types ...string) *Breaker {
+	if len(types) == 0 {
+		types = DefaultErrors
+	}
+
+	return &Breaker{
+		threshold: max(threshold, 1),
+		window:    window,
+		types:     types,
+		now:       time.Now,
+	}
+}
+
+// Handle implements telegram.Middleware.
+func (b *Breaker) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if err := b.Err(); err != nil {
+			return err
+		}
+
+		err := next.Invoke(ctx, input, output)
+		if err != nil && tgerr.Is(err, b.types...) {
+			b.fail(err)
+		}
+
+		return err
+	}
+}
+
+// Err returns error wrapping ErrOpen and the last failure if the circuit is open, otherwise nil.
+func (b *Breaker) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.last == nil {
+		return nil
+	}
+	return errors.Wrapf(ErrOpen, "%d failures in %s, last: %v", b.threshold, b.window, b.last)
+}
+
+func (b *Breaker) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.failures = append(b.failures, now)
+
+	// failures are in time order
+	since := now.Add(-b.window)
+	i := 0
+	for i < len(b.failures) && !b.failures[i].After(since) {
+		i++
+	}
+	b.failures = b.failures[i:]
+
+	if len(b.failures) >= b.threshold {
+		b.last = err
+	}
+}
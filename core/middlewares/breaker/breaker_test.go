@@ -0,0 +1,69 @@
+package breaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type invoker func() error
+
+func (i invoker) Invoke(context.Context, bin.Encoder, bin.Decoder) error {
+	return i()
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := New(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	calls := 0
+	var next error
+	invoke := b.Handle(invoker(func() error { calls++; return next }))
+	call := func(err error) error {
+		next = err
+		return invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+	}
+
+	// other errors are not counted
+	require.NoError(t, call(nil))
+	banned := tgerr.New(401, "USER_DEACTIVATED_BAN")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, tgerr.New(400, "CHAT_ID_INVALID"), call(tgerr.New(400, "CHAT_ID_INVALID")))
+	}
+	require.NoError(t, b.Err())
+
+	// failures out of window are expired
+	assert.Equal(t, banned, call(banned))
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, banned, call(banned))
+	require.NoError(t, b.Err())
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, banned, call(banned))
+	assert.ErrorIs(t, b.Err(), ErrOpen)
+
+	// requests are rejected without invoking next
+	calls = 0
+	err := call(nil)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.ErrorContains(t, err, "USER_DEACTIVATED_BAN")
+	assert.Zero(t, calls)
+}
+
+func TestNew_Types(t *testing.T) {
+	b := New(1, time.Minute, "SESSION_EXPIRED")
+	invoke := b.Handle(invoker(func() error { return tgerr.New(401, "AUTH_KEY_UNREGISTERED") }))
+	_ = invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+	assert.NoError(t, b.Err(), "types replace DefaultErrors")
+
+	invoke = b.Handle(invoker(func() error { return tgerr.New(401, "SESSION_EXPIRED") }))
+	_ = invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+	assert.ErrorIs(t, b.Err(), ErrOpen)
+}
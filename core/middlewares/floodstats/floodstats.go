@@ -0,0 +1,85 @@
+package floodstats
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// Stats is the summary of FLOOD_WAIT errors in recent window.
+type Stats struct {
+	// Count is the number of FLOOD_WAIT errors.
+	Count int
+	// Total is the sum of required wait durations.
+	Total time.Duration
+}
+
+type record struct {
+	at   time.Time
+	wait time.Duration
+}
+
+// Recorder records FLOOD_WAIT errors in a sliding window, so that callers can pace themselves.
+type Recorder struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	records []record
+}
+
+// New returns Recorder with given sliding window.
+func New(window time.Duration) *Recorder {
+	return &Recorder{window: window, now: time.Now}
+}
+
+// Handle implements telegram.Middleware. It should be placed after flood wait middleware
+// to observe raw FLOOD_WAIT errors, and it never changes the result of requests.
+func (r *Recorder) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		err := next.Invoke(ctx, input, output)
+		if d, ok := tgerr.AsFloodWait(err); ok {
+			r.record(d)
+		}
+
+		return err
+	}
+}
+
+func (r *Recorder) record(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = append(r.records, record{at: r.now(), wait: d})
+	r.expire()
+}
+
+// Stats returns FLOOD_WAIT stats in the window.
+func (r *Recorder) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire()
+
+	s := Stats{Count: len(r.records)}
+	for _, rec := range r.records {
+		s.Total += rec.wait
+	}
+	return s
+}
+
+// expire drops records out of window, records are in time order
+func (r *Recorder) expire() {
+	since := r.now().Add(-r.window)
+
+	i := 0
+	for i < len(r.records) && !r.records[i].at.After(since) {
+		i++
+	}
+	r.records = r.records[i:]
+}
@@ -0,0 +1,48 @@
+package floodstats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type invoker func() error
+
+func (i invoker) Invoke(context.Context, bin.Encoder, bin.Decoder) error {
+	return i()
+}
+
+func TestRecorder(t *testing.T) {
+	now := time.Now()
+	r := New(time.Minute)
+	r.now = func() time.Time { return now }
+
+	var next error
+	invoke := r.Handle(invoker(func() error { return next }))
+	call := func(err error) {
+		next = err
+		assert.Equal(t, err, invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil))
+	}
+
+	call(nil)
+	call(tgerr.New(400, "CHAT_ID_INVALID"))
+	require.Equal(t, Stats{}, r.Stats())
+
+	call(tgerr.New(420, "FLOOD_WAIT_3"))
+	now = now.Add(30 * time.Second)
+	call(tgerr.New(420, "FLOOD_WAIT_5"))
+	assert.Equal(t, Stats{Count: 2, Total: 8 * time.Second}, r.Stats())
+
+	// first one slides out of window
+	now = now.Add(40 * time.Second)
+	assert.Equal(t, Stats{Count: 1, Total: 5 * time.Second}, r.Stats())
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, Stats{}, r.Stats())
+}
@@ -0,0 +1,87 @@
+// Package methodfilter provides a middleware which restricts MTProto methods the client can invoke.
+package methodfilter
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// ErrNotAllowed is returned when invoked method is rejected by the filter.
+var ErrNotAllowed = errors.New("method is not allowed")
+
+// Wildcard matches all methods of a namespace when used as suffix, e.g. "messages.*".
+const Wildcard = "*"
+
+type filter struct {
+	allow []string
+	deny  []string
+}
+
+// New returns a middleware which only allows methods matched by allow and not matched by deny.
+// Empty allow means all methods are allowed, and deny takes precedence over allow.
+//
+// Methods are TL names, e.g. "messages.deleteHistory", or namespace with Wildcard, e.g. "account.*".
+// Queries wrapped by invokeWithLayer, invokeWithTakeout, etc. are checked by the inner method.
+func New(allow, deny []string) telegram.Middleware {
+	return &filter{
+		allow: allow,
+		deny:  deny,
+	}
+}
+
+func (f *filter) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if err := f.check(input); err != nil {
+			return err
+		}
+
+		return next.Invoke(ctx, input, output)
+	}
+}
+
+func (f *filter) check(input bin.Encoder) error {
+	for {
+		name := ""
+		if m, ok := input.(interface{ TypeName() string }); ok {
+			name = m.TypeName()
+		}
+
+		// wrappers are only checked by deny, and the wrapped query is checked recursively,
+		// e.g. invokeWithTakeout{query: messages.deleteHistory}
+		w, ok := input.(interface{ GetQuery() bin.Object })
+		if !ok {
+			if !f.allowed(name) {
+				return errors.Wrapf(ErrNotAllowed, "%s", name)
+			}
+			return nil
+		}
+		if match(f.deny, name) {
+			return errors.Wrapf(ErrNotAllowed, "%s", name)
+		}
+		input = w.GetQuery()
+	}
+}
+
+func (f *filter) allowed(name string) bool {
+	if match(f.deny, name) {
+		return false
+	}
+	return len(f.allow) == 0 || match(f.allow, name)
+}
+
+func match(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if p == name {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, Wildcard); ok && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package methodfilter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	deleteHistory := &tg.MessagesDeleteHistoryRequest{}
+	getHistory := &tg.MessagesGetHistoryRequest{}
+	getPassword := &tg.AccountGetPasswordRequest{}
+	takeout := &tg.InvokeWithTakeoutRequest{Query: deleteHistory}
+
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		allowed []bin.Encoder
+		denied  []bin.Encoder
+	}{
+		{
+			name:    "empty",
+			allowed: []bin.Encoder{deleteHistory, getHistory, getPassword, takeout},
+		},
+		{
+			name:    "deny",
+			deny:    []string{"messages.deleteHistory"},
+			allowed: []bin.Encoder{getHistory, getPassword},
+			denied:  []bin.Encoder{deleteHistory, takeout},
+		},
+		{
+			name:    "allow wildcard",
+			allow:   []string{"messages.*"},
+			allowed: []bin.Encoder{deleteHistory, getHistory, takeout},
+			denied:  []bin.Encoder{getPassword},
+		},
+		{
+			name:    "deny precedence",
+			allow:   []string{"messages.*"},
+			deny:    []string{"messages.deleteHistory"},
+			allowed: []bin.Encoder{getHistory},
+			denied:  []bin.Encoder{deleteHistory, getPassword, takeout},
+		},
+		{
+			name:    "deny wrapper",
+			deny:    []string{"invokeWithTakeout"},
+			allowed: []bin.Encoder{deleteHistory},
+			denied:  []bin.Encoder{takeout},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			inv := New(tt.allow, tt.deny).Handle(telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+				calls++
+				return nil
+			}))
+
+			for _, input := range tt.allowed {
+				assert.NoError(t, inv.Invoke(context.Background(), input, nil))
+			}
+			for _, input := range tt.denied {
+				assert.ErrorIs(t, inv.Invoke(context.Background(), input, nil), ErrNotAllowed)
+			}
+			assert.Equal(t, len(tt.allowed), calls)
+		})
+	}
+}
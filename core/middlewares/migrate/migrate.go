@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+)
+
+// Resolver returns invoker of given DC.
+type Resolver func(ctx context.Context, dc int) (tg.Invoker, error)
+
+type migratedKey struct{}
+
+type migrate struct {
+	resolve Resolver
+}
+
+// New returns middleware which retries requests on target DC when they fail with *_MIGRATE_X errors.
+// Primary connection of telegram.Client already handles migration, but connections to other DCs
+// (e.g. telegram.Client.DC) surface these errors directly.
+// Each request is migrated at most once to avoid redirect loops.
+// tclient.New includes it with connections of the client to other DCs, unless tclient.Options.DisableMigrate is set,
+// and dcpool applies it to all pooled connections.
+func New(resolve Resolver) telegram.Middleware {
+	return migrate{resolve: resolve}
+}
+
+func (m migrate) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		err := next.Invoke(ctx, input, output)
+		if err == nil {
+			return nil
+		}
+
+		rpcErr, ok := tgerr.As(err)
+		if !ok || !strings.HasSuffix(rpcErr.Type, "_MIGRATE") || rpcErr.Argument <= 0 {
+			return err
+		}
+		if ctx.Value(migratedKey{}) != nil {
+			return err
+		}
+
+		logctx.From(ctx).Info("Migrating request to target DC",
+			zap.String("error_type", rpcErr.Type),
+			zap.Int("target_dc", rpcErr.Argument))
+
+		invoker, rerr := m.resolve(ctx, rpcErr.Argument)
+		if rerr != nil {
+			return errors.Wrapf(rerr, "resolve DC %d", rpcErr.Argument)
+		}
+
+		return invoker.Invoke(context.WithValue(ctx, migratedKey{}, struct{}{}), input, output)
+	}
+}
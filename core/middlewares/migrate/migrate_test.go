@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type invoker func(ctx context.Context) error
+
+func (i invoker) Invoke(ctx context.Context, _ bin.Encoder, _ bin.Decoder) error {
+	return i(ctx)
+}
+
+func TestMigrate(t *testing.T) {
+	var calls []int
+
+	// every DC except 4 redirects to DC 4
+	var resolve Resolver
+	dcInvoker := func(dc int) tg.Invoker {
+		return New(func(ctx context.Context, dc int) (tg.Invoker, error) {
+			return resolve(ctx, dc)
+		}).Handle(invoker(func(ctx context.Context) error {
+			calls = append(calls, dc)
+			if dc != 4 {
+				return tgerr.New(303, "FILE_MIGRATE_4")
+			}
+			return nil
+		}))
+	}
+	resolve = func(_ context.Context, dc int) (tg.Invoker, error) {
+		return dcInvoker(dc), nil
+	}
+
+	require.NoError(t, dcInvoker(2).Invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil))
+	assert.Equal(t, []int{2, 4}, calls)
+
+	t.Run("other errors", func(t *testing.T) {
+		inv := New(func(ctx context.Context, dc int) (tg.Invoker, error) {
+			t.Fatal("should not be migrated")
+			return nil, nil
+		}).Handle(invoker(func(ctx context.Context) error {
+			return tgerr.New(400, "CHANNEL_INVALID")
+		}))
+
+		assert.True(t, tgerr.Is(inv.Invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil), "CHANNEL_INVALID"))
+	})
+
+	t.Run("migrate once", func(t *testing.T) {
+		calls = nil
+		resolve = func(_ context.Context, dc int) (tg.Invoker, error) {
+			return dcInvoker(3), nil // still redirects
+		}
+
+		err := dcInvoker(2).Invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+		assert.True(t, tgerr.Is(err, "FILE_MIGRATE"))
+		assert.Equal(t, []int{2, 3}, calls)
+	})
+}
@@ -55,8 +55,12 @@ func (r *recovery) shouldRecover(err error) bool {
 	default:
 	}
 
-	// we try recover when encountered any error that is not telegram business error
-	_, ok := tgerr.As(err)
+	return Recoverable(err)
+}
 
+// Recoverable reports whether err may be recovered after reconnection, which is any error
+// that is not telegram business error, e.g. transient disconnects.
+func Recoverable(err error) bool {
+	_, ok := tgerr.As(err)
 	return !ok
 }
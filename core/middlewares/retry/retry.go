@@ -3,6 +3,7 @@ package retry
 import (
 	"context"
 	"fmt"
+	"net"
 
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/bin"
@@ -23,9 +24,48 @@ var internalErrors = []string{
 	"memory limit exit",          // #504
 }
 
+// Classifier reports whether err is transient and the request is worth retrying.
+type Classifier func(err error) bool
+
+// Errors returns a Classifier which retries RPC errors of given types.
+func Errors(types ...string) Classifier {
+	return func(err error) bool {
+		return len(types) > 0 && tgerr.Is(err, types...)
+	}
+}
+
+// Any returns a Classifier which retries err if any of classifiers does,
+// which is useful to extend DefaultClassifier.
+func Any(classifiers ...Classifier) Classifier {
+	return func(err error) bool {
+		for _, c := range classifiers {
+			if c(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DefaultClassifier retries Telegram internal errors(code 500, negative codes like -500 and
+// well-known internal types) and network timeouts. Other RPC errors(e.g. 400 PHONE_NUMBER_INVALID,
+// 403 CHAT_WRITE_FORBIDDEN) are permanent, and retrying them only delays the failure.
+func DefaultClassifier(err error) bool {
+	if tgerr.Is(err, internalErrors...) {
+		return true
+	}
+
+	if rpcErr, ok := tgerr.As(err); ok {
+		return rpcErr.Code == 500 || rpcErr.Code < 0
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
 type retry struct {
-	max    int
-	errors []string
+	max      int
+	classify Classifier
 }
 
 func (r retry) Handle(next tg.Invoker) telegram.InvokeFunc {
@@ -34,7 +74,8 @@ func (r retry) Handle(next tg.Invoker) telegram.InvokeFunc {
 
 		for retries < r.max {
 			if err := next.Invoke(ctx, input, output); err != nil {
-				if tgerr.Is(err, r.errors...) {
+				// timeouts of caller context are not transient
+				if ctx.Err() == nil && r.classify(err) {
 					logctx.From(ctx).Debug("retry middleware", zap.Int("retries", retries), zap.Error(err))
 					retries++
 					continue
@@ -49,10 +90,17 @@ func (r retry) Handle(next tg.Invoker) telegram.InvokeFunc {
 	}
 }
 
-// New returns middleware that retries request if it fails with one of provided errors.
+// New returns middleware that retries request if it fails with one of provided errors
+// or DefaultClassifier reports it as transient.
 func New(max int, errors ...string) telegram.Middleware {
+	return NewWithClassifier(max, Any(Errors(errors...), DefaultClassifier)) // #373
+}
+
+// NewWithClassifier returns middleware that retries request at most max times
+// if classify reports the error as transient.
+func NewWithClassifier(max int, classify Classifier) telegram.Middleware {
 	return retry{
-		max:    max,
-		errors: append(errors, internalErrors...), // #373
+		max:      max,
+		classify: classify,
 	}
 }
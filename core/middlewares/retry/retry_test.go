@@ -0,0 +1,94 @@
+package retry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type invoker func(ctx context.Context) error
+
+func (i invoker) Invoke(ctx context.Context, _ bin.Encoder, _ bin.Decoder) error {
+	return i(ctx)
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{name: "forbidden", err: tgerr.New(403, "CHAT_WRITE_FORBIDDEN"), calls: 1},
+		{name: "invalid", err: tgerr.New(400, "PHONE_NUMBER_INVALID"), calls: 1},
+		{name: "internal", err: tgerr.New(500, "INTERNAL"), calls: 3},
+		{name: "negative", err: tgerr.New(-500, "No workers running"), calls: 3},
+		{name: "known internal", err: tgerr.New(400, "RPC_CALL_FAIL"), calls: 3},
+		{name: "timeout", err: errors.Wrap(timeoutErr{}, "read"), calls: 3},
+		{name: "other", err: errors.New("other"), calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := New(3).Handle(invoker(func(ctx context.Context) error {
+				calls++
+				return tt.err
+			})).Invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+
+			require.Error(t, err)
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+}
+
+func TestRetry_Success(t *testing.T) {
+	calls := 0
+	err := New(3).Handle(invoker(func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return tgerr.New(500, "INTERNAL")
+		}
+		return nil
+	})).Invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRetry_Classifier(t *testing.T) {
+	calls := 0
+	classify := Any(Errors("FLOOD_PREMIUM_WAIT"), DefaultClassifier)
+	err := NewWithClassifier(2, classify).Handle(invoker(func(ctx context.Context) error {
+		calls++
+		return tgerr.New(420, "FLOOD_PREMIUM_WAIT")
+	})).Invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+
+	require.Error(t, err)
+	assert.Equal(t, 2, calls)
+	assert.False(t, Errors()(tgerr.New(500, "INTERNAL")))
+}
+
+func TestRetry_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := New(3).Handle(invoker(func(ctx context.Context) error {
+		calls++
+		cancel()
+		return tgerr.New(500, "INTERNAL")
+	})).Invoke(ctx, &tg.HelpGetConfigRequest{}, nil)
+
+	require.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
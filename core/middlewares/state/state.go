@@ -0,0 +1,91 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// Event is the connection state change event of client.
+type Event interface {
+	event()
+}
+
+// Connected is emitted when requests succeed again after client is disconnected, or the first request succeeds.
+type Connected struct{}
+
+// Disconnected is emitted when requests fail with network errors, and client is reconnecting.
+type Disconnected struct {
+	Err error
+}
+
+// FloodWait is emitted when requests are rate limited by Telegram server.
+type FloodWait struct {
+	Duration time.Duration
+}
+
+func (Connected) event()    {}
+func (Disconnected) event() {}
+func (FloodWait) event()    {}
+
+// Handler is called on every state change event, and it should not block.
+type Handler func(e Event)
+
+type state struct {
+	handler Handler
+
+	mu        sync.Mutex
+	connected *bool // nil means unknown
+}
+
+// New returns middleware that notifies connection state changes by handler.
+// It should be placed after flood wait middleware to observe raw FLOOD_WAIT errors.
+func New(handler Handler) telegram.Middleware {
+	return &state{handler: handler}
+}
+
+func (s *state) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		err := next.Invoke(ctx, input, output)
+		switch {
+		case err == nil:
+			s.transit(true, nil)
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		default:
+			if d, ok := tgerr.AsFloodWait(err); ok {
+				s.handler(FloodWait{Duration: d})
+				break
+			}
+			// telegram business errors mean connection is alive
+			if _, ok := tgerr.As(err); ok {
+				s.transit(true, nil)
+				break
+			}
+			s.transit(false, err)
+		}
+
+		return err
+	}
+}
+
+func (s *state) transit(connected bool, err error) {
+	s.mu.Lock()
+	if s.connected != nil && *s.connected == connected {
+		s.mu.Unlock()
+		return
+	}
+	s.connected = &connected
+	s.mu.Unlock()
+
+	if connected {
+		s.handler(Connected{})
+	} else {
+		s.handler(Disconnected{Err: err})
+	}
+}
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+)
+
+type invoker func() error
+
+func (i invoker) Invoke(context.Context, bin.Encoder, bin.Decoder) error {
+	return i()
+}
+
+func TestState(t *testing.T) {
+	var events []Event
+	var next error
+	invoke := New(func(e Event) { events = append(events, e) }).
+		Handle(invoker(func() error { return next }))
+	call := func(err error) error {
+		next = err
+		return invoke(context.Background(), &tg.HelpGetConfigRequest{}, nil)
+	}
+
+	// the first request succeeds
+	assert.NoError(t, call(nil))
+	assert.Equal(t, []Event{Connected{}}, events)
+
+	// unchanged states are not emitted again
+	assert.NoError(t, call(nil))
+	assert.Equal(t, tgerr.New(400, "CHAT_ID_INVALID"), call(tgerr.New(400, "CHAT_ID_INVALID")))
+	assert.Len(t, events, 1, "business errors mean connection is alive")
+
+	// network errors
+	assert.Equal(t, io.EOF, call(io.EOF))
+	assert.Equal(t, io.EOF, call(io.EOF))
+	assert.Equal(t, []Event{Connected{}, Disconnected{Err: io.EOF}}, events)
+
+	// canceled requests don't change state
+	assert.Equal(t, context.Canceled, call(context.Canceled))
+	assert.Len(t, events, 2)
+
+	// reconnected
+	assert.NoError(t, call(nil))
+	assert.Equal(t, Connected{}, events[2])
+
+	// every flood wait is emitted
+	flood := tgerr.New(420, "FLOOD_WAIT_5")
+	assert.Equal(t, flood, call(flood))
+	assert.Equal(t, flood, call(flood))
+	assert.Equal(t, []Event{FloodWait{Duration: 5 * time.Second}, FloodWait{Duration: 5 * time.Second}}, events[3:])
+}
@@ -2,19 +2,51 @@ package takeout
 
 import (
 	"context"
+	"time"
 
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 )
 
+// Scopes are kinds of data exported by takeout session, and requests out of scopes fail with TAKEOUT_REQUIRED.
+type Scopes struct {
+	Contacts          bool
+	MessageUsers      bool
+	MessageChats      bool
+	MessageMegagroups bool
+	MessageChannels   bool
+	Files             bool
+	// FileMaxSize is the max size of downloaded files if Files is set
+	FileMaxSize int64
+}
+
+// DefaultScopes are all scopes of takeout session, which are used by Takeout.
+var DefaultScopes = Scopes{
+	Contacts:          true,
+	MessageUsers:      true,
+	MessageChats:      true,
+	MessageMegagroups: true,
+	MessageChannels:   true,
+	Files:             true,
+	FileMaxSize:       4000 * 1024 * 1024,
+}
+
 func Takeout(ctx context.Context, invoker tg.Invoker) (int64, error) {
+	return Init(ctx, invoker, DefaultScopes)
+}
+
+// Init initializes takeout session of scopes and returns its id, which is used by Middleware.
+func Init(ctx context.Context, invoker tg.Invoker, scopes Scopes) (int64, error) {
 	req := &tg.AccountInitTakeoutSessionRequest{
-		Contacts:          true,
-		MessageUsers:      true,
-		MessageChats:      true,
-		MessageMegagroups: true,
-		MessageChannels:   true,
-		Files:             true,
-		FileMaxSize:       4000 * 1024 * 1024,
+		Contacts:          scopes.Contacts,
+		MessageUsers:      scopes.MessageUsers,
+		MessageChats:      scopes.MessageChats,
+		MessageMegagroups: scopes.MessageMegagroups,
+		MessageChannels:   scopes.MessageChannels,
+		Files:             scopes.Files,
+	}
+	if scopes.Files {
+		req.FileMaxSize = scopes.FileMaxSize
 	}
 	req.SetFlags()
 
@@ -25,9 +57,54 @@ func Takeout(ctx context.Context, invoker tg.Invoker) (int64, error) {
 	return session.ID, nil
 }
 
+// InitDelay returns the delay of TAKEOUT_INIT_DELAY_X error, after which takeout session can be initialized.
+// Telegram asks user to confirm the export in official apps, then it can be initialized before the delay.
+func InitDelay(err error) (time.Duration, bool) {
+	rpcErr, ok := tgerr.AsType(err, tg.ErrTakeoutInitDelay)
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(rpcErr.Argument) * time.Second, true
+}
+
+// InitWait is like Init, but retries on TAKEOUT_INIT_DELAY every interval(or the delay if it's shorter)
+// until ctx is done, so that takeout session is initialized once user confirms the export.
+// onDelay is called with the delay before each wait if not nil.
+func InitWait(ctx context.Context, invoker tg.Invoker, scopes Scopes, interval time.Duration, onDelay func(delay time.Duration)) (int64, error) {
+	for {
+		id, err := Init(ctx, invoker, scopes)
+		delay, ok := InitDelay(err)
+		if !ok {
+			return id, err
+		}
+
+		if onDelay != nil {
+			onDelay(delay)
+		}
+
+		wait := interval
+		if delay > 0 && delay < wait {
+			wait = delay
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
 // UnTakeout should be called with takeout wrapper invoker
 func UnTakeout(ctx context.Context, invoker tg.Invoker) error {
-	req := &tg.AccountFinishTakeoutSessionRequest{Success: true}
+	return Finish(ctx, invoker, true)
+}
+
+// Finish finishes takeout session, and success reports whether the export is completed.
+// It should be called with takeout wrapper invoker.
+func Finish(ctx context.Context, invoker tg.Invoker, success bool) error {
+	req := &tg.AccountFinishTakeoutSessionRequest{Success: success}
 	req.SetFlags()
 
 	_, err := tg.NewClient(invoker).AccountFinishTakeoutSession(ctx, req)
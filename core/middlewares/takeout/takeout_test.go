@@ -0,0 +1,74 @@
+package takeout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initInvoker fails account.initTakeoutSession with TAKEOUT_INIT_DELAY for delays times
+type initInvoker struct {
+	delays int
+	calls  int
+	req    *tg.AccountInitTakeoutSessionRequest
+}
+
+func (i *initInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	req, ok := input.(*tg.AccountInitTakeoutSessionRequest)
+	if !ok {
+		return tgerr.New(400, "METHOD_INVALID")
+	}
+	i.calls++
+	i.req = req
+	if i.calls <= i.delays {
+		return tgerr.New(420, "TAKEOUT_INIT_DELAY_86400")
+	}
+
+	*output.(*tg.AccountTakeout) = tg.AccountTakeout{ID: 42}
+	return nil
+}
+
+func TestInit(t *testing.T) {
+	inv := &initInvoker{}
+	id, err := Init(context.Background(), inv, Scopes{MessageChannels: true, FileMaxSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+	assert.True(t, inv.req.MessageChannels)
+	assert.False(t, inv.req.MessageUsers)
+	assert.Zero(t, inv.req.FileMaxSize, "file max size is only set with files scope")
+}
+
+func TestInitDelay(t *testing.T) {
+	d, ok := InitDelay(tgerr.New(420, "TAKEOUT_INIT_DELAY_3600"))
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, d)
+
+	_, ok = InitDelay(tgerr.New(420, "FLOOD_WAIT_3"))
+	assert.False(t, ok)
+	_, ok = InitDelay(nil)
+	assert.False(t, ok)
+}
+
+func TestInitWait(t *testing.T) {
+	inv := &initInvoker{delays: 2}
+	delays := make([]time.Duration, 0)
+	id, err := InitWait(context.Background(), inv, DefaultScopes, time.Millisecond, func(d time.Duration) {
+		delays = append(delays, d)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+	assert.Equal(t, 3, inv.calls)
+	assert.Equal(t, []time.Duration{24 * time.Hour, 24 * time.Hour}, delays)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	inv = &initInvoker{delays: 100}
+	_, err = InitWait(ctx, inv, DefaultScopes, time.Hour, func(time.Duration) { cancel() })
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, inv.calls)
+}
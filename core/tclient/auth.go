@@ -0,0 +1,150 @@
+package tclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/middlewares/recovery"
+)
+
+// ErrNotAuthorized is returned when session of client is not authorized.
+var ErrNotAuthorized = errors.New("not authorized. please login first")
+
+// ErrAuthStatusUnknown is returned by RunWithAuth when auth status can't be checked after retries,
+// which usually means network is down rather than session is not authorized.
+var ErrAuthStatusUnknown = errors.New("could not verify auth status (network?)")
+
+const (
+	// authStatusTimeout is the timeout of each auth status check in RunWithAuth
+	authStatusTimeout = 15 * time.Second
+	// authStatusRetries is the max number of retries of auth status check after timeout or network error
+	authStatusRetries = 2
+	// authStatusRetryDelay is the delay between auth status retries
+	authStatusRetryDelay = time.Second
+)
+
+// WhoAmI returns the authorized user of client, or ErrNotAuthorized if session is not authorized.
+// It must be called in client.Run callback.
+func WhoAmI(ctx context.Context, client *telegram.Client) (*tg.User, error) {
+	return whoAmI(ctx, client.Auth().Status)
+}
+
+func whoAmI(ctx context.Context, status func(ctx context.Context) (*auth.Status, error)) (*tg.User, error) {
+	s, err := status(ctx)
+	if err != nil {
+		if errors.Is(err, ErrAuthStatusUnknown) {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "get auth status")
+	}
+	if !s.Authorized || s.User == nil {
+		return nil, ErrNotAuthorized
+	}
+
+	return s.User, nil
+}
+
+// retryStatus bounds each call of status by timeout, and retries timeouts and network errors, so that
+// checking auth on a flaky connection doesn't block forever. RPC errors are returned immediately.
+// ErrAuthStatusUnknown is returned with the last error if all attempts fail.
+func retryStatus(status func(ctx context.Context) (*auth.Status, error), timeout time.Duration, retries int, delay time.Duration) func(ctx context.Context) (*auth.Status, error) {
+	return func(ctx context.Context) (*auth.Status, error) {
+		var err error
+		for i := 0; i <= retries; i++ {
+			if i > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(delay):
+				}
+			}
+
+			var s *auth.Status
+			if s, err = statusWithTimeout(ctx, status, timeout); err == nil {
+				return s, nil
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !recovery.Recoverable(err) {
+				return nil, err
+			}
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrAuthStatusUnknown, err)
+	}
+}
+
+func statusWithTimeout(ctx context.Context, status func(ctx context.Context) (*auth.Status, error), timeout time.Duration) (*auth.Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return status(ctx)
+}
+
+// AccountMismatchError is returned by AssertAccount when the authorized account is not the expected one.
+type AccountMismatchError struct {
+	Expected string
+	// User is the actual authorized user
+	User *tg.User
+}
+
+func (e *AccountMismatchError) Error() string {
+	return fmt.Sprintf("account mismatch: expected %q, but authorized as id %d(@%s)", e.Expected, e.User.ID, e.User.Username)
+}
+
+// AssertAccount returns *AccountMismatchError if the authorized account of client doesn't match expected,
+// which is a user id, username or phone number, so that operations never run against a wrong session.
+// "@" of usernames and "+" of phone numbers are optional, and usernames are case-insensitive.
+// It must be called in client.Run callback.
+func AssertAccount(ctx context.Context, client *telegram.Client, expected string) error {
+	return assertAccount(ctx, client.Auth().Status, expected)
+}
+
+func assertAccount(ctx context.Context, status func(ctx context.Context) (*auth.Status, error), expected string) error {
+	u, err := whoAmI(ctx, status)
+	if err != nil {
+		return err
+	}
+	if !accountMatch(u, expected) {
+		return &AccountMismatchError{Expected: expected, User: u}
+	}
+	return nil
+}
+
+// accountMatch reports whether expected is id, one of usernames or phone of u
+func accountMatch(u *tg.User, expected string) bool {
+	expected = strings.TrimSpace(expected)
+	if expected == "" {
+		return false
+	}
+
+	if id, err := strconv.ParseInt(expected, 10, 64); err == nil && id == u.ID {
+		return true
+	}
+
+	phone := strings.NewReplacer("+", "", " ", "", "-", "").Replace(expected)
+	if u.Phone != "" && phone == u.Phone {
+		return true
+	}
+
+	username := strings.TrimPrefix(expected, "@")
+	if u.Username != "" && strings.EqualFold(username, u.Username) {
+		return true
+	}
+	for _, un := range u.Usernames {
+		if strings.EqualFold(username, un.Username) {
+			return true
+		}
+	}
+
+	return false
+}
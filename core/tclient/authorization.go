@@ -0,0 +1,102 @@
+package tclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+var (
+	// ErrCurrentAuthorization is returned when resetting the session used by the client itself.
+	ErrCurrentAuthorization = errors.New("can't reset current session, please logout instead")
+	// ErrAuthorizationNotFound is returned when the hash doesn't match any active session.
+	ErrAuthorizationNotFound = errors.New("session not found")
+)
+
+// Authorization is an active session of the account.
+type Authorization struct {
+	// Hash identifies the session in ResetAuthorization, and it's zero for current session
+	Hash    int64
+	Current bool
+
+	Device   string // device model
+	Platform string // platform and system version
+	App      string // app name and version
+	IP       string
+	Country  string
+
+	Created time.Time
+	Active  time.Time
+}
+
+// ListAuthorizations returns active sessions of the authorized account, including the current one.
+func ListAuthorizations(ctx context.Context, client *telegram.Client) ([]Authorization, error) {
+	return listAuthorizations(ctx, client.API())
+}
+
+func listAuthorizations(ctx context.Context, api *tg.Client) ([]Authorization, error) {
+	r, err := api.AccountGetAuthorizations(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get authorizations")
+	}
+
+	auths := make([]Authorization, 0, len(r.Authorizations))
+	for _, a := range r.Authorizations {
+		auths = append(auths, Authorization{
+			Hash:     a.Hash,
+			Current:  a.Current,
+			Device:   a.DeviceModel,
+			Platform: joinNonEmpty(a.Platform, a.SystemVersion),
+			App:      joinNonEmpty(a.AppName, a.AppVersion),
+			IP:       a.IP,
+			Country:  a.Country,
+			Created:  time.Unix(int64(a.DateCreated), 0),
+			Active:   time.Unix(int64(a.DateActive), 0),
+		})
+	}
+
+	return auths, nil
+}
+
+// ResetAuthorization terminates the active session of hash. The session is checked against active sessions
+// first, so that current session is never revoked by mistake, which returns ErrCurrentAuthorization.
+func ResetAuthorization(ctx context.Context, client *telegram.Client, hash int64) error {
+	return resetAuthorization(ctx, client.API(), hash)
+}
+
+func resetAuthorization(ctx context.Context, api *tg.Client, hash int64) error {
+	auths, err := listAuthorizations(ctx, api)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range auths {
+		if a.Hash != hash {
+			continue
+		}
+		if a.Current {
+			return ErrCurrentAuthorization
+		}
+
+		if _, err = api.AccountResetAuthorization(ctx, hash); err != nil {
+			return errors.Wrapf(err, "reset authorization %d", hash)
+		}
+		return nil
+	}
+
+	return errors.Wrapf(ErrAuthorizationNotFound, "hash %d", hash)
+}
+
+func joinNonEmpty(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + " " + b
+	}
+}
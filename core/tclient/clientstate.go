@@ -0,0 +1,56 @@
+package tclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+)
+
+// clientState is per-client state created by New, which is used by RunWithAuth and helpers of client.
+// It's owned by the outermost middleware of client, so it's freed together with client no matter how
+// client is run, and there are no process-wide registries to clean up.
+type clientState struct {
+	pingInterval time.Duration
+	updates      *updates.Manager
+	dispatcher   *updateDispatcher
+	region       *regionDialer
+	test         bool
+	warmer       *warmer
+}
+
+// stateRequest is answered by middleware of clientState, and never sent to Telegram
+type stateRequest struct {
+	state *clientState
+}
+
+func (*stateRequest) Encode(*bin.Buffer) error {
+	return errors.New("client state request can't be sent")
+}
+
+func (s *clientState) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if req, ok := input.(*stateRequest); ok {
+			req.state = s
+			return nil
+		}
+		return next.Invoke(ctx, input, output)
+	}
+}
+
+// stateOf returns state of client created by New, or empty state of other clients
+func stateOf(client *telegram.Client) *clientState {
+	// clients not created by New pass the request to connection, which fails fast with canceled ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := &stateRequest{}
+	if err := client.Invoke(ctx, req, nil); err != nil || req.state == nil {
+		return &clientState{}
+	}
+	return req.state
+}
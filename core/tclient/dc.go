@@ -0,0 +1,139 @@
+package tclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// DefaultConfigTTL is the default cache window of DCConfig.
+const DefaultConfigTTL = time.Minute
+
+// DCInfo is a read-only snapshot of the datacenter which client is connected to.
+type DCInfo struct {
+	// DC is the current datacenter ID.
+	DC int
+	// Config is the server config returned by help.getConfig.
+	Config tg.Config
+	// FetchedAt is the time when Config was fetched.
+	FetchedAt time.Time
+}
+
+// DCConfig fetches DCInfo of a connected client and caches it for ttl,
+// to avoid repeated help.getConfig requests in a short window.
+type DCConfig struct {
+	fetch func(ctx context.Context) (*tg.Config, error)
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu   sync.Mutex
+	info *DCInfo
+}
+
+// NewDCConfig creates DCConfig of given client. Zero ttl means DefaultConfigTTL.
+func NewDCConfig(client *telegram.Client, ttl time.Duration) *DCConfig {
+	return newDCConfig(client.API().HelpGetConfig, ttl)
+}
+
+func newDCConfig(fetch func(ctx context.Context) (*tg.Config, error), ttl time.Duration) *DCConfig {
+	if ttl <= 0 {
+		ttl = DefaultConfigTTL
+	}
+
+	return &DCConfig{
+		fetch: fetch,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// Get returns cached DCInfo, or fetches it if cache is expired.
+func (d *DCConfig) Get(ctx context.Context) (DCInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.info != nil && d.now().Sub(d.info.FetchedAt) < d.ttl {
+		return *d.info, nil
+	}
+
+	cfg, err := d.fetch(ctx)
+	if err != nil {
+		return DCInfo{}, errors.Wrap(err, "get config")
+	}
+
+	d.info = &DCInfo{
+		DC:        cfg.ThisDC,
+		Config:    *cfg,
+		FetchedAt: d.now(),
+	}
+
+	return *d.info, nil
+}
+
+// Invalidate drops cached DCInfo, e.g. after client migrated to another DC.
+func (d *DCConfig) Invalidate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.info = nil
+}
+
+// dcInvokers are lazily created connections of client to other DCs, which are used to migrate requests.
+// Connections are bound to client, and closed by it when it stops.
+type dcInvokers struct {
+	mu       sync.Mutex
+	dial     func(ctx context.Context, dc int) (tg.Invoker, error)
+	invokers map[int]tg.Invoker
+}
+
+func newDCInvokers() *dcInvokers {
+	return &dcInvokers{invokers: make(map[int]tg.Invoker)}
+}
+
+// bind connects d to client, it's called after client is created, as middlewares are required by creation
+func (d *dcInvokers) bind(client *telegram.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dial = func(ctx context.Context, dc int) (tg.Invoker, error) {
+		return client.DC(ctx, dc, 1)
+	}
+}
+
+// resolve returns invoker of dc, and dials it without lock, so that other DCs are not blocked
+func (d *dcInvokers) resolve(ctx context.Context, dc int) (tg.Invoker, error) {
+	d.mu.Lock()
+	invoker, ok := d.invokers[dc]
+	dial := d.dial
+	d.mu.Unlock()
+
+	if ok {
+		return invoker, nil
+	}
+	if dial == nil {
+		return nil, errors.New("dc invokers are not bound to client")
+	}
+
+	invoker, err := dial(ctx, dc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dial dc %d", dc)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// concurrent dial of the same DC, the redundant connection is closed
+	if prev, ok := d.invokers[dc]; ok {
+		if c, ok := invoker.(telegram.CloseInvoker); ok {
+			_ = c.Close()
+		}
+		return prev, nil
+	}
+	d.invokers[dc] = invoker
+
+	return invoker, nil
+}
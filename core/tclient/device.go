@@ -0,0 +1,56 @@
+package tclient
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+)
+
+// JSONValue converts v to tg.JSONValueClass by its JSON encoding, e.g. for DeviceConfig.Params of initConnection.
+// Object keys are sorted, so that the same v always produces the same value.
+func JSONValue(v any) (tg.JSONValueClass, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal")
+	}
+
+	var raw any
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+
+	return jsonValue(raw), nil
+}
+
+func jsonValue(v any) tg.JSONValueClass {
+	switch v := v.(type) {
+	case bool:
+		return &tg.JSONBool{Value: v}
+	case float64:
+		return &tg.JSONNumber{Value: v}
+	case string:
+		return &tg.JSONString{Value: v}
+	case []any:
+		r := &tg.JSONArray{Value: make([]tg.JSONValueClass, 0, len(v))}
+		for _, e := range v {
+			r.Value = append(r.Value, jsonValue(e))
+		}
+		return r
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		r := &tg.JSONObject{Value: make([]tg.JSONObjectValue, 0, len(v))}
+		for _, k := range keys {
+			r.Value = append(r.Value, tg.JSONObjectValue{Key: k, Value: jsonValue(v[k])})
+		}
+		return r
+	default: // nil
+		return &tg.JSONNull{}
+	}
+}
@@ -0,0 +1,134 @@
+package tclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// DispatchStats are stats of update dispatcher.
+type DispatchStats struct {
+	// Queued is the number of updates waiting for a free worker.
+	Queued int
+	// Dropped is the number of updates dropped because the queue is full, see Options.UpdateDropOnFull.
+	Dropped int64
+}
+
+// UpdateDispatchStats returns stats of update dispatcher of client, and false if client is created
+// without Options.UpdateConcurrency.
+func UpdateDispatchStats(client *telegram.Client) (DispatchStats, bool) {
+	d := stateOf(client).dispatcher
+	if d == nil {
+		return DispatchStats{}, false
+	}
+	return d.Stats(), true
+}
+
+// DefaultUpdateQueueSize is the default Options.UpdateQueueSize.
+const DefaultUpdateQueueSize = 100
+
+// updateDispatcher queues updates and calls handler by a bounded number of workers, so that
+// slow handler applies backpressure to(or drops updates of) the connection instead of piling up goroutines.
+type updateDispatcher struct {
+	handler     telegram.UpdateHandler
+	concurrency int
+	drop        bool
+	queue       chan tg.UpdatesClass
+	dropped     *atomic.Int64
+	running     *atomic.Bool
+	log         *zap.Logger
+}
+
+func newUpdateDispatcher(handler telegram.UpdateHandler, concurrency, queueSize int, drop bool, log *zap.Logger) *updateDispatcher {
+	if queueSize <= 0 {
+		queueSize = DefaultUpdateQueueSize
+	}
+
+	return &updateDispatcher{
+		handler:     handler,
+		concurrency: concurrency,
+		drop:        drop,
+		queue:       make(chan tg.UpdatesClass, queueSize),
+		dropped:     atomic.NewInt64(0),
+		running:     atomic.NewBool(false),
+		log:         log,
+	}
+}
+
+// Handle enqueues u, and blocks until it's queued or ctx is done, unless drop is set.
+// Updates are never blocked if workers are not running, e.g. client is run without RunWithAuth,
+// and they are dropped when the queue is full. Errors of handler are logged by workers, as they are returned after Handle.
+func (d *updateDispatcher) Handle(ctx context.Context, u tg.UpdatesClass) error {
+	if d.drop || !d.running.Load() {
+		select {
+		case d.queue <- u:
+		default:
+			d.log.Warn("Update queue is full, drop update",
+				zap.String("type", u.TypeName()),
+				zap.Int64("dropped", d.dropped.Inc()))
+		}
+		return nil
+	}
+
+	select {
+	case d.queue <- u:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run starts workers of d until ctx is done, and queued updates are kept for the next run
+func (d *updateDispatcher) run(ctx context.Context) {
+	d.running.Store(true)
+	defer d.running.Store(false)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < d.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case u := <-d.queue:
+					if err := d.handler.Handle(ctx, u); err != nil && ctx.Err() == nil {
+						d.log.Warn("Handle update", zap.String("type", u.TypeName()), zap.Error(err))
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *updateDispatcher) Stats() DispatchStats {
+	return DispatchStats{
+		Queued:  len(d.queue),
+		Dropped: d.dropped.Load(),
+	}
+}
+
+// startDispatcher starts update dispatcher d in background if not nil, and returns the stop function
+func startDispatcher(ctx context.Context, d *updateDispatcher) func() {
+	if d == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.run(ctx)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
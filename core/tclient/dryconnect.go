@@ -0,0 +1,149 @@
+package tclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/dcs"
+
+	"github.com/iyear/tdl/core/util/netutil"
+)
+
+// ConnectStage is the stage of DryConnect.
+type ConnectStage string
+
+const (
+	// StageClock queries time source of Options.NTP.
+	StageClock ConnectStage = "clock"
+	// StageProxy dials DC through Options.Proxy.
+	StageProxy ConnectStage = "proxy dial"
+	// StageHandshake exchanges auth key and sends initConnection.
+	StageHandshake ConnectStage = "handshake"
+	// StageConfig requests help.getConfig on the initialized connection.
+	StageConfig ConnectStage = "config"
+)
+
+// ConnectError is returned by DryConnect with the failing stage.
+type ConnectError struct {
+	Stage ConnectStage
+	Err   error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// DryConnect validates network config(NTP, proxy, DC connectivity) of Options by connecting to Telegram
+// with a temporary in-memory session, and stops after initConnection and help.getConfig, so that
+// neither a valid session nor authorization is required. Session of Options is never read or written.
+// Failure is returned as *ConnectError with the failing stage. ctx should have a deadline, as
+// transport reconnects until Options.ReconnectTimeout.
+func DryConnect(ctx context.Context, o Options) error {
+	if _, err := newClock(ctx, o); err != nil {
+		return &ConnectError{Stage: StageClock, Err: err}
+	}
+
+	// MTProto over WebSocket is dialed by resolver in handshake
+	if !netutil.IsWebsocket(o.Proxy) {
+		if err := dryDial(ctx, o); err != nil {
+			return &ConnectError{Stage: StageProxy, Err: err}
+		}
+	}
+
+	o.Session = &session.StorageMemory{}
+	o.ReadOnlySession = false
+	o.UpdateHandler, o.UpdateState, o.RegionProxy = nil, nil, nil
+	o.UpdateConcurrency = 0
+	o.DisableRecovery = true
+
+	client, err := New(ctx, o)
+	if err != nil {
+		return &ConnectError{Stage: StageHandshake, Err: err}
+	}
+
+	return dryRun(ctx, client)
+}
+
+// dryRun runs client until connection is initialized, and requests config
+func dryRun(ctx context.Context, client *telegram.Client) error {
+	connected := false
+	err := client.Run(ctx, func(ctx context.Context) error {
+		connected = true
+		if _, err := client.API().HelpGetConfig(ctx); err != nil {
+			return &ConnectError{Stage: StageConfig, Err: err}
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	var cerr *ConnectError
+	if errors.As(err, &cerr) {
+		return cerr
+	}
+	if !connected {
+		return &ConnectError{Stage: StageHandshake, Err: err}
+	}
+	return &ConnectError{Stage: StageConfig, Err: err}
+}
+
+// dryDial dials the default DC through proxy of o
+func dryDial(ctx context.Context, o Options) error {
+	dialer, err := newKeepAliveDialer(o.Proxy, o.KeepAlive)
+	if err != nil {
+		return err
+	}
+
+	list, err := newDCList(o)
+	if err != nil {
+		return err
+	}
+	dc := DC
+	switch {
+	case o.Test:
+		dc = TestDC
+		if list.Zero() {
+			list = dcs.Test()
+		}
+	case list.Zero():
+		list = dcs.Prod()
+	}
+
+	addr, ok := dcAddr(list, dc)
+	if !ok {
+		return errors.Errorf("no address of DC %d", dc)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "dial DC %d(%s)", dc, addr)
+	}
+	return conn.Close()
+}
+
+// dcAddr returns the first general IPv4 address of dc, or of any DC if dc is zero
+func dcAddr(list dcs.List, dc int) (string, bool) {
+	for _, opt := range list.Options {
+		if opt.Ipv6 || opt.MediaOnly || opt.CDN || opt.TCPObfuscatedOnly {
+			continue
+		}
+		if dc != 0 && opt.ID != dc {
+			continue
+		}
+		return net.JoinHostPort(opt.IPAddress, strconv.Itoa(opt.Port)), true
+	}
+	return "", false
+}
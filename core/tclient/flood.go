@@ -0,0 +1,46 @@
+package tclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// FloodWaitError is returned by clients with Options.ManualFloodWait when request hits FLOOD_WAIT,
+// so that callers can decide whether and how to wait, e.g. showing a countdown.
+type FloodWaitError struct {
+	// Duration is the required wait duration before retrying
+	Duration time.Duration
+	Err      error
+}
+
+func (e *FloodWaitError) Error() string {
+	return fmt.Sprintf("flood wait for %s: %v", e.Duration, e.Err)
+}
+
+func (e *FloodWaitError) Unwrap() error {
+	return e.Err
+}
+
+// AsFloodWait returns wait duration if err is caused by FLOOD_WAIT.
+func AsFloodWait(err error) (time.Duration, bool) {
+	return tgerr.AsFloodWait(err)
+}
+
+// manualFloodWait returns FLOOD_WAIT errors as *FloodWaitError without waiting
+func manualFloodWait() telegram.MiddlewareFunc {
+	return func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			err := next.Invoke(ctx, input, output)
+			if d, ok := tgerr.AsFloodWait(err); ok {
+				return &FloodWaitError{Duration: d, Err: err}
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package tclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// ErrAccountLimited is matched by *AccountLimitedError, which is returned when the authorized account
+// is frozen, restricted or spam-limited by Telegram without a hard ban.
+var ErrAccountLimited = errors.New("account is limited")
+
+// limitedErrors are RPC errors of operations which are rejected because the account is limited,
+// e.g. sending messages to strangers by a spam-limited account
+var limitedErrors = []string{
+	"PEER_FLOOD",
+	tg.ErrUserRestricted,
+	"FROZEN_METHOD_INVALID",
+	"FROZEN_PARTICIPANT_MISSING",
+}
+
+// AccountLimitedError is the detail of limited account.
+type AccountLimitedError struct {
+	// Reasons are human-readable restrictions
+	Reasons []string
+	// Err is the RPC error which reveals the limitation, nil if detected by CheckAccount
+	Err error
+}
+
+func (e *AccountLimitedError) Error() string {
+	msg := fmt.Sprintf("%v: %s", ErrAccountLimited, strings.Join(e.Reasons, "; "))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *AccountLimitedError) Is(target error) bool {
+	return target == ErrAccountLimited
+}
+
+func (e *AccountLimitedError) Unwrap() error {
+	return e.Err
+}
+
+// LimitedError returns *AccountLimitedError wrapping err if err is rejected because the account is
+// limited(PEER_FLOOD, USER_RESTRICTED or frozen errors), otherwise err is returned as is.
+func LimitedError(err error) error {
+	rpcErr, ok := tgerr.As(err)
+	if !ok || !rpcErr.IsOneOf(limitedErrors...) {
+		return err
+	}
+
+	reason := "account is restricted by Telegram"
+	switch {
+	case rpcErr.Type == "PEER_FLOOD":
+		reason = "account is spam-limited, check status with @SpamBot"
+	case strings.HasPrefix(rpcErr.Type, "FROZEN_"):
+		reason = "account is frozen"
+	}
+	return &AccountLimitedError{Reasons: []string{reason}, Err: err}
+}
+
+// AccountHealth is the consolidated status of the authorized account.
+type AccountHealth struct {
+	User *tg.User
+	// TTLDays is the days of inactivity after which the account is deleted
+	TTLDays int
+	// Restricted is set by Telegram with RestrictionReasons, e.g. on some platforms
+	Restricted         bool
+	RestrictionReasons []tg.RestrictionReason
+	Scam               bool
+	Fake               bool
+	// FrozenSince and FrozenUntil are zero if the account is not frozen, and frozen accounts can only
+	// read data until appeal by FrozenAppealURL is accepted
+	FrozenSince     time.Time
+	FrozenUntil     time.Time
+	FrozenAppealURL string
+}
+
+// Frozen reports whether the account is frozen.
+func (h *AccountHealth) Frozen() bool {
+	return !h.FrozenSince.IsZero()
+}
+
+// Err returns *AccountLimitedError with all detected restrictions, or nil if the account is healthy.
+func (h *AccountHealth) Err() error {
+	var reasons []string
+	if h.Frozen() {
+		reason := "account is frozen since " + h.FrozenSince.Format(time.DateOnly)
+		if !h.FrozenUntil.IsZero() {
+			reason += " until " + h.FrozenUntil.Format(time.DateOnly)
+		}
+		if h.FrozenAppealURL != "" {
+			reason += ", appeal at " + h.FrozenAppealURL
+		}
+		reasons = append(reasons, reason)
+	}
+	if h.Restricted {
+		if len(h.RestrictionReasons) == 0 {
+			reasons = append(reasons, "account is restricted")
+		}
+		for _, r := range h.RestrictionReasons {
+			reasons = append(reasons, fmt.Sprintf("account is restricted on %s: %s", r.Platform, r.Text))
+		}
+	}
+	if h.Scam {
+		reasons = append(reasons, "account is marked as scam")
+	}
+	if h.Fake {
+		reasons = append(reasons, "account is marked as fake")
+	}
+
+	if len(reasons) == 0 {
+		return nil
+	}
+	return &AccountLimitedError{Reasons: reasons}
+}
+
+// CheckAccount queries restrictions of the authorized account, including flags of user, account TTL and
+// frozen status of app config. Spam limits(PEER_FLOOD) can only be revealed by failed operations, see LimitedError.
+// It must be called in client.Run callback, and Err of result reports the detected restrictions.
+func CheckAccount(ctx context.Context, client *telegram.Client) (*AccountHealth, error) {
+	user, err := WhoAmI(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return checkAccount(ctx, client.API(), user)
+}
+
+func checkAccount(ctx context.Context, api *tg.Client, user *tg.User) (*AccountHealth, error) {
+	h := &AccountHealth{
+		User:               user,
+		Restricted:         user.Restricted,
+		RestrictionReasons: user.RestrictionReason,
+		Scam:               user.Scam,
+		Fake:               user.Fake,
+	}
+
+	ttl, err := api.AccountGetAccountTTL(ctx)
+	if err != nil {
+		if limited := LimitedError(err); limited != err {
+			return nil, limited
+		}
+		return nil, errors.Wrap(err, "get account ttl")
+	}
+	h.TTLDays = ttl.Days
+
+	cfg, err := api.HelpGetAppConfig(ctx, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "get app config")
+	}
+	if c, ok := cfg.(*tg.HelpAppConfig); ok {
+		applyFrozenConfig(h, c.Config)
+	}
+
+	return h, nil
+}
+
+// applyFrozenConfig reads freeze_* fields of app config, which are only present for frozen accounts
+func applyFrozenConfig(h *AccountHealth, config tg.JSONValueClass) {
+	obj, ok := config.(*tg.JSONObject)
+	if !ok {
+		return
+	}
+
+	for _, v := range obj.Value {
+		switch value := v.Value.(type) {
+		case *tg.JSONNumber:
+			switch v.Key {
+			case "freeze_since_date":
+				h.FrozenSince = time.Unix(int64(value.Value), 0)
+			case "freeze_until_date":
+				h.FrozenUntil = time.Unix(int64(value.Value), 0)
+			}
+		case *tg.JSONString:
+			if v.Key == "freeze_appeal_url" {
+				h.FrozenAppealURL = value.Value
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package tclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gotd/td/telegram/query/messages"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/middlewares/recovery"
+)
+
+// MessageIter is the iterator of messages from newest to oldest, e.g. *messages.Iterator.
+type MessageIter interface {
+	Next(ctx context.Context) bool
+	Value() messages.Elem
+	Err() error
+}
+
+// ResumableIter is MessageIter which survives transient disconnects of long iterations. After a recoverable
+// error(see recovery.Recoverable), the current page is fetched again by a new iterator from the last yielded
+// message, instead of failing the whole iteration.
+type ResumableIter struct {
+	newIter func(offsetID int) MessageIter
+	backoff backoff.BackOff
+
+	iter   MessageIter
+	last   int // ID of the last yielded message, zero if nothing is yielded
+	resume bool
+	err    error
+}
+
+// NewResumableIter returns ResumableIter of iterators created by newIter. offsetID is zero for the first
+// iterator, which can have its own offset(e.g. OffsetDate), and then it's ID of the last yielded message,
+// so that the iterator starts from the next older message, e.g. messages.Iterator.OffsetID(offsetID).
+// Iteration fails if an interruption is not recovered within timeout, the same as Options.ReconnectTimeout,
+// and the timeout is restarted once a message is yielded again.
+func NewResumableIter(newIter func(offsetID int) MessageIter, timeout time.Duration) *ResumableIter {
+	return newResumableIter(newIter, newBackoff(timeout, 0))
+}
+
+func newResumableIter(newIter func(offsetID int) MessageIter, b backoff.BackOff) *ResumableIter {
+	return &ResumableIter{
+		newIter: newIter,
+		backoff: b,
+		iter:    newIter(0),
+	}
+}
+
+func (r *ResumableIter) Next(ctx context.Context) bool {
+	if r.err != nil {
+		return false
+	}
+
+	for {
+		if r.resume {
+			r.iter, r.resume = r.newIter(r.last), false
+		}
+
+		if r.iter.Next(ctx) {
+			r.last = r.iter.Value().Msg.GetID()
+			r.backoff.Reset()
+			return true
+		}
+
+		err := r.iter.Err()
+		if err == nil {
+			return false
+		}
+		if ctx.Err() != nil || !recovery.Recoverable(err) {
+			r.err = err
+			return false
+		}
+
+		wait := r.backoff.NextBackOff()
+		if wait == backoff.Stop {
+			r.err = err
+			return false
+		}
+		logctx.From(ctx).Warn("Iteration interrupted, resume after recovery",
+			zap.Int("offset_id", r.last),
+			zap.Duration("wait", wait),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			r.err = ctx.Err()
+			return false
+		case <-time.After(wait):
+		}
+		r.resume = true
+	}
+}
+
+func (r *ResumableIter) Value() messages.Elem {
+	return r.iter.Value()
+}
+
+func (r *ResumableIter) Err() error {
+	return r.err
+}
@@ -0,0 +1,115 @@
+package tclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/beevik/ntp"
+	"github.com/go-faster/errors"
+	"github.com/gotd/contrib/clock"
+	tdclock "github.com/gotd/td/clock"
+
+	"github.com/iyear/tdl/core/util/netutil"
+)
+
+// ntpTimeout is the timeout of querying time source in New
+const ntpTimeout = 10 * time.Second
+
+// IsHTTPTimeSource reports whether NTP option is an HTTP(S) url, whose Date header of
+// response is used as time source instead of NTP, e.g. https://www.google.com
+func IsHTTPTimeSource(ntpOption string) bool {
+	return strings.HasPrefix(ntpOption, "http://") || strings.HasPrefix(ntpOption, "https://")
+}
+
+// newClock returns network clock of Options.NTP. Time source is queried through Options.Proxy,
+// so that no traffic leaks outside the proxy: NTP is sent by SOCKS5 UDP ASSOCIATE, and HTTP time source
+// is requested by the same dialer as Telegram connections.
+func newClock(ctx context.Context, o Options) (tdclock.Clock, error) {
+	switch {
+	case o.NTP == "":
+		return tdclock.System, nil
+	case IsHTTPTimeSource(o.NTP):
+		client, err := NewHTTPClient(o, ntpTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return newHTTPClock(ctx, client, o.NTP)
+	case o.Proxy == "":
+		return clock.NewNTP(o.NTP)
+	default:
+		return newProxyNTPClock(ctx, o.Proxy, o.NTP)
+	}
+}
+
+func newProxyNTPClock(ctx context.Context, proxyURL, host string) (tdclock.Clock, error) {
+	if netutil.IsWebsocket(proxyURL) {
+		return nil, errors.Wrap(ErrWebsocketProxy, "ntp through proxy")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ntpTimeout)
+	defer cancel()
+
+	resp, err := ntp.QueryWithOptions(host, ntp.QueryOptions{
+		Timeout: ntpTimeout,
+		Dialer: func(_, remoteAddress string) (net.Conn, error) {
+			return netutil.DialUDP(ctx, proxyURL, remoteAddress)
+		},
+	})
+	if err != nil {
+		if errors.Is(err, netutil.ErrProxyNoUDP) {
+			return nil, errors.Wrap(err, "ntp through proxy, use an HTTP time source instead, e.g. --ntp https://www.google.com")
+		}
+		return nil, errors.Wrap(err, "query ntp through proxy")
+	}
+	if err = resp.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validate ntp response")
+	}
+
+	return &offsetClock{offset: resp.ClockOffset}, nil
+}
+
+// newHTTPClock estimates clock offset by Date header of HTTP response, which is of second precision
+func newHTTPClock(ctx context.Context, client *http.Client, url string) (tdclock.Clock, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "request http time source")
+	}
+	_ = resp.Body.Close()
+	end := time.Now()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse Date header of %s", url)
+	}
+
+	// Date is truncated to seconds, so the middle of the second is closer on average
+	remote := date.Add(500 * time.Millisecond)
+	local := start.Add(end.Sub(start) / 2)
+	return &offsetClock{offset: remote.Sub(local)}, nil
+}
+
+// offsetClock is system clock with fixed offset
+type offsetClock struct {
+	offset time.Duration
+}
+
+func (c *offsetClock) Now() time.Time {
+	return time.Now().Add(c.offset)
+}
+
+func (c *offsetClock) Timer(d time.Duration) tdclock.Timer {
+	return tdclock.System.Timer(d)
+}
+
+func (c *offsetClock) Ticker(d time.Duration) tdclock.Ticker {
+	return tdclock.System.Ticker(d)
+}
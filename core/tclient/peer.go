@@ -0,0 +1,209 @@
+package tclient
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram/peers"
+	"github.com/gotd/td/tg"
+
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/storage/keygen"
+	"github.com/iyear/tdl/core/util/tutil"
+)
+
+// ErrInviteNotJoined is returned when resolving invite link of chat which is not joined by current account.
+var ErrInviteNotJoined = errors.New("invite link chat is not joined")
+
+// PeerResolver resolves peer references(@username, t.me links, invite links, ids) to input peers,
+// and caches results in memory, so that repeated references don't call contacts.resolveUsername again.
+type PeerResolver struct {
+	kv storage.Storage // nil means in-memory only
+
+	mu    sync.Mutex
+	cache map[string]tg.InputPeerClass
+}
+
+// NewPeerResolver creates PeerResolver. If kv is not nil, results are also persisted to kv, and
+// access hashes are stored by storage.NewPeers(kv), which is shared with other commands.
+func NewPeerResolver(kv storage.Storage) *PeerResolver {
+	return &PeerResolver{
+		kv:    kv,
+		cache: make(map[string]tg.InputPeerClass),
+	}
+}
+
+// Resolve returns input peer of ref, which can be username(with or without @), t.me link,
+// invite link(t.me/+hash, t.me/joinchat/hash), phone number or id of user, chat or channel.
+func (r *PeerResolver) Resolve(ctx context.Context, api *tg.Client, ref string) (tg.InputPeerClass, error) {
+	key := normalizePeerRef(ref)
+	if key == "" {
+		return nil, errors.Errorf("empty peer reference %q", ref)
+	}
+
+	if p, ok := r.lookup(ctx, key); ok {
+		return p, nil
+	}
+
+	p, err := r.resolve(ctx, api, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve %q", ref)
+	}
+
+	if err = r.store(ctx, key, p); err != nil {
+		return nil, errors.Wrap(err, "store peer")
+	}
+	return p, nil
+}
+
+func (r *PeerResolver) resolve(ctx context.Context, api *tg.Client, key string) (tg.InputPeerClass, error) {
+	opts := peers.Options{}
+	if r.kv != nil {
+		opts.Storage = storage.NewPeers(r.kv)
+	}
+	manager := opts.Build(api)
+
+	if phone, ok := strings.CutPrefix(key, "+"); ok {
+		if !isDigits(phone) {
+			return resolveInvite(ctx, api, phone)
+		}
+
+		u, err := manager.ResolvePhone(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return u.InputPeer(), nil
+	}
+
+	p, err := tutil.GetInputPeer(ctx, manager, key)
+	if err != nil {
+		return nil, err
+	}
+	return p.InputPeer(), nil
+}
+
+func resolveInvite(ctx context.Context, api *tg.Client, hash string) (tg.InputPeerClass, error) {
+	invite, err := api.MessagesCheckChatInvite(ctx, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "check chat invite")
+	}
+
+	var chat tg.ChatClass
+	switch i := invite.(type) {
+	case *tg.ChatInviteAlready:
+		chat = i.Chat
+	case *tg.ChatInvitePeek:
+		chat = i.Chat
+	default:
+		return nil, ErrInviteNotJoined
+	}
+
+	switch c := chat.(type) {
+	case *tg.Chat:
+		return &tg.InputPeerChat{ChatID: c.ID}, nil
+	case *tg.Channel:
+		return &tg.InputPeerChannel{ChannelID: c.ID, AccessHash: c.AccessHash}, nil
+	default:
+		return nil, errors.Errorf("unexpected invite chat type %T", chat)
+	}
+}
+
+func (r *PeerResolver) lookup(ctx context.Context, key string) (tg.InputPeerClass, bool) {
+	r.mu.Lock()
+	p, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok || r.kv == nil {
+		return p, ok
+	}
+
+	data, err := r.kv.Get(ctx, peerRefKey(key))
+	if err != nil {
+		return nil, false
+	}
+	// broken cache is ignored and resolved again
+	if p, err = tg.DecodeInputPeer(&bin.Buffer{Buf: data}); err != nil {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	r.cache[key] = p
+	r.mu.Unlock()
+	return p, true
+}
+
+func (r *PeerResolver) store(ctx context.Context, key string, p tg.InputPeerClass) error {
+	r.mu.Lock()
+	r.cache[key] = p
+	r.mu.Unlock()
+
+	if r.kv == nil {
+		return nil
+	}
+
+	buf := &bin.Buffer{}
+	if err := p.Encode(buf); err != nil {
+		return errors.Wrap(err, "encode peer")
+	}
+	return r.kv.Set(ctx, peerRefKey(key), buf.Buf)
+}
+
+// Forget removes cached result of ref, e.g. after username is changed.
+func (r *PeerResolver) Forget(ctx context.Context, ref string) error {
+	key := normalizePeerRef(ref)
+
+	r.mu.Lock()
+	delete(r.cache, key)
+	r.mu.Unlock()
+
+	if r.kv == nil {
+		return nil
+	}
+	if err := r.kv.Delete(ctx, peerRefKey(key)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func peerRefKey(key string) string {
+	return keygen.New("peers", "ref", key)
+}
+
+// normalizePeerRef returns cache key of ref, where usernames are lower-cased without @,
+// and invite links are in form of "+hash"
+func normalizePeerRef(ref string) string {
+	ref = strings.TrimSpace(ref)
+
+	if u, err := url.Parse(ref); err == nil && (u.Host == "t.me" || u.Host == "telegram.me") {
+		ref = strings.Trim(u.Path, "/")
+	} else {
+		for _, prefix := range []string{"t.me/", "telegram.me/"} {
+			ref = strings.TrimPrefix(ref, prefix)
+		}
+	}
+
+	if hash, ok := strings.CutPrefix(ref, "joinchat/"); ok {
+		return "+" + hash
+	}
+	if strings.HasPrefix(ref, "+") {
+		// invite hash is case-sensitive
+		return ref
+	}
+
+	return strings.ToLower(strings.TrimPrefix(ref, "@"))
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package tclient
+
+import (
+	"context"
+	"time"
+
+	tdclock "github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+)
+
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// runPinger pings every interval until ctx is done, so that idle connections are kept alive
+// behind NAT and dead connections are detected before the next real request.
+func runPinger(ctx context.Context, p pinger, interval time.Duration, clock tdclock.Clock, log *zap.Logger) {
+	ticker := clock.Ticker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			pctx, cancel := context.WithTimeout(ctx, interval)
+			if err := p.Ping(pctx); err != nil && ctx.Err() == nil {
+				log.Warn("Keepalive ping failed", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+// startPinger starts pinger of client in background if interval is positive, and returns the stop function
+func startPinger(ctx context.Context, client *telegram.Client, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runPinger(ctx, client, interval, tdclock.System, logctx.From(ctx).Named("td").Named("ping"))
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,87 @@
+package tclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"go.uber.org/multierr"
+)
+
+// AccountError is the error of one account in Pool
+type AccountError struct {
+	Label string
+	Err   error
+}
+
+func (e *AccountError) Error() string {
+	return fmt.Sprintf("account %s: %v", e.Label, e.Err)
+}
+
+func (e *AccountError) Unwrap() error {
+	return e.Err
+}
+
+// Account is a client of Pool
+type Account struct {
+	// Label is Options.LogLabel, or index of options if it's empty
+	Label  string
+	Client *telegram.Client
+}
+
+// Pool manages clients of multiple accounts, which run concurrently and independently.
+type Pool struct {
+	accounts []Account
+	run      func(ctx context.Context, client *telegram.Client, f func(ctx context.Context) error) error
+}
+
+// NewPool creates clients of each options by New. Each client logs under its own namespace, e.g. "td.<label>".
+func NewPool(ctx context.Context, opts []Options) (*Pool, error) {
+	accounts := make([]Account, 0, len(opts))
+	for i, o := range opts {
+		if o.LogLabel == "" {
+			o.LogLabel = strconv.Itoa(i)
+		}
+
+		client, err := New(ctx, o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create client of account %s", o.LogLabel)
+		}
+		accounts = append(accounts, Account{Label: o.LogLabel, Client: client})
+	}
+
+	return &Pool{accounts: accounts, run: RunWithAuth}, nil
+}
+
+// Accounts returns all accounts in creation order
+func (p *Pool) Accounts() []Account {
+	return p.accounts
+}
+
+// RunWithAuth runs all clients concurrently by RunWithAuth, and calls f for each account.
+// Failure of one account doesn't stop others. It returns after all accounts finish,
+// and errors are combined as *AccountError, which can be split by multierr.Errors.
+func (p *Pool) RunWithAuth(ctx context.Context, f func(ctx context.Context, account Account) error) error {
+	errs := make([]error, len(p.accounts))
+	wg := sync.WaitGroup{}
+
+	for i, account := range p.accounts {
+		wg.Add(1)
+		go func(i int, account Account) {
+			defer wg.Done()
+
+			err := p.run(ctx, account.Client, func(ctx context.Context) error {
+				return f(ctx, account)
+			})
+			if err != nil {
+				errs[i] = &AccountError{Label: account.Label, Err: err}
+			}
+		}(i, account)
+	}
+	wg.Wait()
+
+	return multierr.Combine(errs...)
+}
@@ -0,0 +1,125 @@
+package tclient
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/dcs"
+	"go.uber.org/zap"
+	"golang.org/x/net/proxy"
+)
+
+// probeTimeout is the max duration of probing one DC
+const probeTimeout = 5 * time.Second
+
+// DCLatency is the probe result of one DC.
+type DCLatency struct {
+	DC      int
+	Addr    string
+	Latency time.Duration
+	// Err is not nil if DC is unreachable, and Latency is meaningless.
+	Err error
+}
+
+// ProbeDCs measures TCP connect latency to every production DC through the proxy in Options,
+// which reflects the real network path even if IP geolocation is wrong (e.g. behind VPN).
+// DCs of Options.DCList are probed instead if it's provided.
+// Results are sorted by latency, and unreachable DCs are placed last.
+func ProbeDCs(ctx context.Context, o Options) ([]DCLatency, error) {
+	dialer, err := newDialer(o.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := newDCList(o)
+	if err != nil {
+		return nil, err
+	}
+	if list.Zero() {
+		list = dcs.Prod()
+	}
+
+	return probeDCs(ctx, dialer, list), nil
+}
+
+func probeDCs(ctx context.Context, dialer proxy.ContextDialer, list dcs.List) []DCLatency {
+	// pick the first general IPv4 address of each DC
+	addrs := make(map[int]string)
+	for _, opt := range list.Options {
+		if opt.Ipv6 || opt.MediaOnly || opt.CDN || opt.TCPObfuscatedOnly {
+			continue
+		}
+		if _, ok := addrs[opt.ID]; ok {
+			continue
+		}
+		addrs[opt.ID] = net.JoinHostPort(opt.IPAddress, strconv.Itoa(opt.Port))
+	}
+
+	results := make([]DCLatency, 0, len(addrs))
+	mu, wg := &sync.Mutex{}, &sync.WaitGroup{}
+	for id, addr := range addrs {
+		wg.Add(1)
+		go func(id int, addr string) {
+			defer wg.Done()
+
+			r := DCLatency{DC: id, Addr: addr}
+			r.Latency, r.Err = probe(ctx, dialer, addr)
+
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		}(id, addr)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.Err == nil) != (b.Err == nil) {
+			return a.Err == nil
+		}
+		if a.Latency != b.Latency {
+			return a.Latency < b.Latency
+		}
+		return a.DC < b.DC
+	})
+
+	return results
+}
+
+func probe(ctx context.Context, dialer proxy.ContextDialer, addr string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+
+	return latency, conn.Close()
+}
+
+// logNearestDC probes DCs and logs the fastest one as recommendation
+func logNearestDC(ctx context.Context, o Options, log *zap.Logger) {
+	results, err := ProbeDCs(ctx, o)
+	if err != nil {
+		log.Warn("Probe DCs failed", zap.Error(err))
+		return
+	}
+
+	for _, r := range results {
+		log.Debug("DC probed", zap.Int("dc", r.DC), zap.String("addr", r.Addr),
+			zap.Duration("latency", r.Latency), zap.Error(r.Err))
+	}
+
+	if len(results) == 0 || results[0].Err != nil {
+		log.Warn("No DC is reachable")
+		return
+	}
+	log.Info("Nearest DC", zap.Int("dc", results[0].DC), zap.Duration("latency", results[0].Latency))
+}
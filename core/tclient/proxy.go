@@ -0,0 +1,104 @@
+package tclient
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+	"golang.org/x/net/proxy"
+)
+
+// failoverDialer switches proxy after threshold consecutive dial failures, instead of
+// retrying against a dead proxy forever. Proxy dialer is re-created on each switch,
+// so proxy host is re-resolved even if there is only one proxy.
+type failoverDialer struct {
+	proxies   []string
+	threshold int
+	newDialer func(proxyURL string) (proxy.ContextDialer, error)
+	log       *zap.Logger
+
+	mu       sync.Mutex
+	cur      int
+	failures int
+	dialer   proxy.ContextDialer
+}
+
+func newFailoverDialer(proxies []string, threshold int,
+	newDialer func(proxyURL string) (proxy.ContextDialer, error), log *zap.Logger,
+) (*failoverDialer, error) {
+	// validate all proxies early
+	for _, p := range proxies {
+		if _, err := newDialer(p); err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy %q", p)
+		}
+	}
+
+	d := &failoverDialer{
+		proxies:   proxies,
+		threshold: threshold,
+		newDialer: newDialer,
+		log:       log,
+	}
+
+	dialer, err := d.newDialer(proxies[0])
+	if err != nil {
+		return nil, err
+	}
+	d.dialer = dialer
+
+	return d, nil
+}
+
+func (d *failoverDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	dialer := d.dialer
+	d.mu.Unlock()
+
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		// canceled by caller, not the fault of proxy
+		if ctx.Err() == nil {
+			d.fail(dialer)
+		}
+		return nil, err
+	}
+
+	d.mu.Lock()
+	if d.dialer == dialer {
+		d.failures = 0
+	}
+	d.mu.Unlock()
+
+	return conn, nil
+}
+
+func (d *failoverDialer) fail(dialer proxy.ContextDialer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// already switched by concurrent dials
+	if d.dialer != dialer {
+		return
+	}
+
+	d.failures++
+	if d.failures < d.threshold {
+		return
+	}
+
+	next := (d.cur + 1) % len(d.proxies)
+	nd, err := d.newDialer(d.proxies[next])
+	if err != nil {
+		d.log.Warn("Failed to switch proxy", zap.Int("index", next), zap.Error(err))
+		return
+	}
+
+	d.log.Warn("Proxy seems unavailable, switching",
+		zap.Int("failures", d.failures),
+		zap.Int("from", d.cur),
+		zap.Int("to", next))
+
+	d.cur, d.failures, d.dialer = next, 0, nd
+}
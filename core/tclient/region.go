@@ -0,0 +1,140 @@
+package tclient
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/net/proxy"
+)
+
+// PhonePrefixProxies returns Options.RegionProxy which selects proxy by the longest matched
+// calling code prefix of phone number, e.g. {"1": "socks5://us:1080", "86": "socks5://cn:1080"}.
+// "+" of prefixes is optional, and phone numbers without matched prefix keep the static proxy.
+func PhonePrefixProxies(proxies map[string]string) func(phone string) string {
+	m := make(map[string]string, len(proxies))
+	for prefix, p := range proxies {
+		m[strings.TrimPrefix(strings.TrimSpace(prefix), "+")] = p
+	}
+
+	return func(phone string) string {
+		phone = strings.TrimPrefix(phone, "+")
+		for i := len(phone); i > 0; i-- {
+			if p, ok := m[phone[:i]]; ok {
+				return p
+			}
+		}
+		return ""
+	}
+}
+
+// regionDialer dials by static dialer until routed to the regional proxy of account,
+// then connections of the previous dialer are closed, so that they are reconnected by regional proxy.
+type regionDialer struct {
+	proxy     func(phone string) string
+	newDialer func(proxyURL string) (proxy.ContextDialer, error)
+	log       *zap.Logger
+
+	mu     sync.Mutex
+	dialer proxy.ContextDialer
+	routed string // proxy url of account, empty if not routed
+	conns  map[*regionConn]struct{}
+}
+
+// regionConn is removed from conns of dialer when closed
+type regionConn struct {
+	net.Conn
+	d    *regionDialer
+	once sync.Once
+}
+
+func (c *regionConn) Close() error {
+	c.once.Do(func() {
+		c.d.mu.Lock()
+		delete(c.d.conns, c)
+		c.d.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+func (d *regionDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	dialer := d.dialer
+	d.mu.Unlock()
+
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// routed during dialing, and the stale connection should not be used
+	if d.dialer != dialer {
+		_ = conn.Close()
+		return nil, errors.New("proxy changed during dialing")
+	}
+
+	rc := &regionConn{Conn: conn, d: d}
+	d.conns[rc] = struct{}{}
+	return rc, nil
+}
+
+// route switches to the regional proxy of phone, and reports whether it's switched
+func (d *regionDialer) route(phone string) (bool, error) {
+	p := d.proxy(phone)
+
+	d.mu.Lock()
+	if p == "" || p == d.routed {
+		d.mu.Unlock()
+		return false, nil
+	}
+	d.mu.Unlock()
+
+	nd, err := d.newDialer(p)
+	if err != nil {
+		return false, errors.Wrap(err, "create regional proxy dialer")
+	}
+
+	d.mu.Lock()
+	d.dialer, d.routed = nd, p
+	stale := make([]*regionConn, 0, len(d.conns))
+	for c := range d.conns {
+		stale = append(stale, c)
+	}
+	d.mu.Unlock()
+
+	for _, c := range stale {
+		_ = c.Close()
+	}
+
+	return true, nil
+}
+
+// routeRegion routes client to the regional proxy of self by d of Options.RegionProxy, nil d is no-op
+func routeRegion(ctx context.Context, client *telegram.Client, d *regionDialer, self *tg.User) error {
+	if d == nil {
+		return nil
+	}
+
+	switched, err := d.route(self.Phone)
+	if err != nil {
+		return err
+	}
+	if !switched {
+		return nil
+	}
+
+	d.log.Info("Reconnect through regional proxy of account")
+	// wait for reconnection, so that f never races with closed connections
+	if _, err = client.API().HelpGetNearestDC(ctx); err != nil {
+		return errors.Wrap(err, "reconnect through regional proxy")
+	}
+	return nil
+}
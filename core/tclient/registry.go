@@ -0,0 +1,125 @@
+package tclient
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+)
+
+// ErrMiddlewareRegistered is returned when registering a middleware with a name which is already registered.
+var ErrMiddlewareRegistered = errors.New("middleware is already registered")
+
+// MiddlewareFactory creates middleware for client created by New with o, and nil result skips the client,
+// e.g. when the plugin is disabled by o.
+type MiddlewareFactory func(ctx context.Context, o Options) telegram.Middleware
+
+// Middleware orders of registered middlewares. Registered middlewares are chained after default
+// middlewares and Options.OnState, and before Options.Middlewares, in ascending order, then in order of
+// registration for the same order. The former middleware is the outer one, which sees requests first.
+const (
+	OrderFirst   = -100
+	OrderDefault = 0
+	OrderLast    = 100
+)
+
+// MiddlewareRegistry holds middlewares contributed by in-process plugins, e.g. packages compiled into tdl
+// which register themselves in init. It's safe for concurrent use, and changes take effect on clients
+// created by New afterward.
+type MiddlewareRegistry struct {
+	mu      sync.Mutex
+	entries []registeredMiddleware
+	seq     int
+}
+
+type registeredMiddleware struct {
+	name    string
+	order   int
+	seq     int
+	factory MiddlewareFactory
+}
+
+// DefaultMiddlewareRegistry is used by New if Options.MiddlewareRegistry is nil.
+var DefaultMiddlewareRegistry = NewMiddlewareRegistry()
+
+func NewMiddlewareRegistry() *MiddlewareRegistry {
+	return &MiddlewareRegistry{}
+}
+
+// RegisterMiddleware registers factory to DefaultMiddlewareRegistry, see MiddlewareRegistry.Register.
+func RegisterMiddleware(name string, order int, factory MiddlewareFactory) error {
+	return DefaultMiddlewareRegistry.Register(name, order, factory)
+}
+
+// Register adds factory by unique name with order, see OrderDefault for the chain order.
+func (r *MiddlewareRegistry) Register(name string, order int, factory MiddlewareFactory) error {
+	if name == "" {
+		return errors.New("empty middleware name")
+	}
+	if factory == nil {
+		return errors.Errorf("nil factory of middleware %q", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.entries {
+		if e.name == name {
+			return errors.Wrap(ErrMiddlewareRegistered, name)
+		}
+	}
+
+	r.seq++
+	r.entries = append(r.entries, registeredMiddleware{name: name, order: order, seq: r.seq, factory: factory})
+	sort.Slice(r.entries, func(i, j int) bool {
+		if r.entries[i].order != r.entries[j].order {
+			return r.entries[i].order < r.entries[j].order
+		}
+		return r.entries[i].seq < r.entries[j].seq
+	})
+	return nil
+}
+
+// Unregister removes middleware of name, and reports whether it's registered.
+func (r *MiddlewareRegistry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, e := range r.entries {
+		if e.name == name {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns names of registered middlewares in chain order.
+func (r *MiddlewareRegistry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.entries))
+	for _, e := range r.entries {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// Middlewares creates middlewares of client created with o in chain order.
+func (r *MiddlewareRegistry) Middlewares(ctx context.Context, o Options) []telegram.Middleware {
+	r.mu.Lock()
+	entries := append([]registeredMiddleware(nil), r.entries...)
+	r.mu.Unlock()
+
+	// factories are called without lock, so that they can use the registry
+	middlewares := make([]telegram.Middleware, 0, len(entries))
+	for _, e := range entries {
+		if m := e.factory(ctx, o); m != nil {
+			middlewares = append(middlewares, m)
+		}
+	}
+	return middlewares
+}
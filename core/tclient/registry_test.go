@@ -0,0 +1,78 @@
+package tclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedMiddleware records its name to calls when invoked
+type namedMiddleware struct {
+	name  string
+	calls *[]string
+}
+
+func (m namedMiddleware) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		*m.calls = append(*m.calls, m.name)
+		return next.Invoke(ctx, input, output)
+	}
+}
+
+func TestMiddlewareRegistry(t *testing.T) {
+	r := NewMiddlewareRegistry()
+	calls := make([]string, 0)
+	factory := func(name string) MiddlewareFactory {
+		return func(context.Context, Options) telegram.Middleware {
+			return namedMiddleware{name: name, calls: &calls}
+		}
+	}
+
+	require.NoError(t, r.Register("late", OrderLast, factory("late")))
+	require.NoError(t, r.Register("a", OrderDefault, factory("a")))
+	require.NoError(t, r.Register("b", OrderDefault, factory("b")))
+	require.NoError(t, r.Register("early", OrderFirst, factory("early")))
+	require.NoError(t, r.Register("skip", OrderDefault, func(context.Context, Options) telegram.Middleware { return nil }))
+
+	assert.ErrorIs(t, r.Register("a", OrderFirst, factory("a")), ErrMiddlewareRegistered)
+	assert.Error(t, r.Register("", OrderDefault, factory("")))
+	assert.Error(t, r.Register("nil", OrderDefault, nil))
+
+	assert.Equal(t, []string{"early", "a", "b", "skip", "late"}, r.Names())
+	assert.True(t, r.Unregister("skip"))
+	assert.False(t, r.Unregister("skip"))
+
+	ctx := context.Background()
+	o := Options{MiddlewareRegistry: r, DisableRecovery: true, DisableRetry: true}
+	o.Middlewares = []telegram.Middleware{namedMiddleware{name: "options", calls: &calls}}
+
+	middlewares := newMiddlewares(ctx, o)
+	require.Len(t, middlewares, len(NewDefaultMiddlewaresWith(ctx, o))+5)
+
+	// the former middleware is the outer one
+	var invoker tg.Invoker = telegram.InvokeFunc(func(context.Context, bin.Encoder, bin.Decoder) error { return nil })
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		invoker = middlewares[i].Handle(invoker)
+	}
+	require.NoError(t, invoker.Invoke(ctx, &tg.HelpGetConfigRequest{}, &tg.Config{}))
+	assert.Equal(t, []string{"early", "a", "b", "late", "options"}, calls)
+}
+
+func TestNewMiddlewares_DefaultRegistry(t *testing.T) {
+	ctx := context.Background()
+	base := len(newMiddlewares(ctx, Options{}))
+
+	calls := make([]string, 0)
+	require.NoError(t, RegisterMiddleware("test", OrderDefault, func(context.Context, Options) telegram.Middleware {
+		return namedMiddleware{name: "test", calls: &calls}
+	}))
+	t.Cleanup(func() { DefaultMiddlewareRegistry.Unregister("test") })
+
+	assert.Len(t, newMiddlewares(ctx, Options{}), base+1)
+	assert.Len(t, newMiddlewares(ctx, Options{MiddlewareRegistry: NewMiddlewareRegistry()}), base)
+}
@@ -0,0 +1,134 @@
+package tclient
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+)
+
+// ErrEmptySession is returned when there is no session to migrate.
+var ErrEmptySession = errors.New("session is empty")
+
+// DefaultSessionBackups is the default number of kept backups of Options.SessionBackupDir.
+const DefaultSessionBackups = 10
+
+const (
+	sessionBackupPrefix = "session-"
+	sessionBackupSuffix = ".bak"
+	// sessionBackupLayout is of fixed width, so that names of backups are sorted by time
+	sessionBackupLayout = "20060102T150405.000000000"
+)
+
+// readOnlySession loads session from underlying storage, but never writes back
+type readOnlySession struct {
+	storage telegram.SessionStorage
+}
+
+// NewReadOnlySession wraps storage so that session updates(e.g. salts, auth keys) are dropped,
+// which protects a canonical session from being modified.
+func NewReadOnlySession(storage telegram.SessionStorage) telegram.SessionStorage {
+	return readOnlySession{storage: storage}
+}
+
+func (r readOnlySession) LoadSession(ctx context.Context) ([]byte, error) {
+	return r.storage.LoadSession(ctx)
+}
+
+func (r readOnlySession) StoreSession(context.Context, []byte) error {
+	return nil
+}
+
+// MigrateSession copies session from one storage to another, so that users can switch
+// storage backends without re-login. Destination is validated by loading it back.
+func MigrateSession(ctx context.Context, from, to telegram.SessionStorage) error {
+	data, err := from.LoadSession(ctx)
+	if err != nil {
+		if errors.Is(err, session.ErrNotFound) {
+			return ErrEmptySession
+		}
+		return errors.Wrap(err, "load source session")
+	}
+	if len(data) == 0 {
+		return ErrEmptySession
+	}
+
+	if err = to.StoreSession(ctx, data); err != nil {
+		return errors.Wrap(err, "store destination session")
+	}
+
+	stored, err := to.LoadSession(ctx)
+	if err != nil {
+		return errors.Wrap(err, "load destination session")
+	}
+	if !bytes.Equal(data, stored) {
+		return errors.New("destination session mismatch after migration")
+	}
+
+	return nil
+}
+
+// BackupSession writes a timestamped copy of session to dir, and removes the oldest backups in dir
+// so that only the last keep ones are kept. Zero keep means DefaultSessionBackups. Empty session is
+// not backed up, and empty path is returned.
+func BackupSession(ctx context.Context, storage telegram.SessionStorage, dir string, keep int) (string, error) {
+	data, err := storage.LoadSession(ctx)
+	if err != nil && !errors.Is(err, session.ErrNotFound) {
+		return "", errors.Wrap(err, "load session")
+	}
+	if len(data) == 0 {
+		return "", nil
+	}
+
+	// sessions are credentials, which are only readable by owner
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return "", errors.Wrap(err, "create session backup dir")
+	}
+
+	path := filepath.Join(dir, sessionBackupPrefix+time.Now().UTC().Format(sessionBackupLayout)+sessionBackupSuffix)
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		return "", errors.Wrap(err, "write session backup")
+	}
+
+	if err = rotateSessionBackups(dir, keep); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// rotateSessionBackups removes the oldest backups in dir except the last keep ones
+func rotateSessionBackups(dir string, keep int) error {
+	if keep <= 0 {
+		keep = DefaultSessionBackups
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "read session backup dir")
+	}
+
+	backups := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), sessionBackupPrefix) && strings.HasSuffix(e.Name(), sessionBackupSuffix) {
+			backups = append(backups, e.Name())
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-keep] {
+		if err = os.Remove(filepath.Join(dir, name)); err != nil {
+			return errors.Wrapf(err, "remove old session backup %q", name)
+		}
+	}
+	return nil
+}
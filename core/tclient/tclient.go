@@ -2,22 +2,28 @@ package tclient
 
 import (
 	"context"
-	"fmt"
+	"net"
+	"net/http"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/go-faster/errors"
-	"github.com/gotd/contrib/clock"
 	"github.com/gotd/contrib/middleware/floodwait"
-	tdclock "github.com/gotd/td/clock"
 	"github.com/gotd/td/exchange"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
 	"golang.org/x/net/proxy"
 
 	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/middlewares/breaker"
+	"github.com/iyear/tdl/core/middlewares/floodstats"
+	"github.com/iyear/tdl/core/middlewares/migrate"
 	"github.com/iyear/tdl/core/middlewares/recovery"
 	"github.com/iyear/tdl/core/middlewares/retry"
+	"github.com/iyear/tdl/core/middlewares/state"
 	"github.com/iyear/tdl/core/util/netutil"
 	"github.com/iyear/tdl/core/util/tutil"
 )
@@ -29,6 +35,29 @@ var (
 	PublicKeys []exchange.PublicKey
 )
 
+// ErrEmptyDCList is returned when Options.DCList is provided without any DC.
+var ErrEmptyDCList = errors.New("dc list is empty")
+
+// ErrWebsocketProxy is returned when WebSocket Proxy is used by other connections than Telegram ones,
+// e.g. HTTP requests, DC probing and NTP, as WebSocket endpoints only tunnel MTProto.
+var ErrWebsocketProxy = errors.New("websocket proxy only tunnels Telegram connections")
+
+// DefaultBackoffRandomizationFactor is the default jitter applied to reconnection backoff intervals,
+// which avoids many clients reconnecting in lockstep after a shared outage.
+const DefaultBackoffRandomizationFactor = 0.2
+
+// FloodStatsWindow is the sliding window of FloodStats.
+const FloodStatsWindow = 10 * time.Minute
+
+var floodRecorder = floodstats.New(FloodStatsWindow)
+
+// FloodStats returns count and total wait time of FLOOD_WAIT errors in recent FloodStatsWindow,
+// which are recorded by default middlewares of all clients in current process.
+// Callers can use it to throttle requests to avoid bans.
+func FloodStats() floodstats.Stats {
+	return floodRecorder.Stats()
+}
+
 type Options struct {
 	AppID            int
 	AppHash          string
@@ -37,83 +66,524 @@ type Options struct {
 	Proxy            string
 	NTP              string
 	ReconnectTimeout time.Duration
-	UpdateHandler    telegram.UpdateHandler
+	// BackoffRandomizationFactor is the jitter applied to reconnection backoff intervals.
+	// Zero means DefaultBackoffRandomizationFactor, and negative disables jitter.
+	BackoffRandomizationFactor float64
+	UpdateHandler              telegram.UpdateHandler
+	// Device overrides non-empty fields of default device config(tutil.Device).
+	Device telegram.DeviceConfig
+	// OnState will be called on connection state changes(connected, disconnected, flood wait) if not nil.
+	OnState state.Handler
+	// MiddlewareRegistry contributes middlewares of in-process plugins, which are chained before
+	// Middlewares, see OrderDefault. Nil means DefaultMiddlewareRegistry.
+	MiddlewareRegistry *MiddlewareRegistry
+	// ProxyFallbacks are tried in order after Proxy fails ProxyFailThreshold times consecutively.
+	ProxyFallbacks []string
+	// ProxyFailThreshold is the number of consecutive dial failures before switching to the next proxy.
+	// Zero disables switching, and the same proxy is always used.
+	ProxyFailThreshold int
+	// LogLabel is appended to the logger name of client, e.g. "td.account1",
+	// to distinguish logs of multiple clients in one process. Empty means "td".
+	LogLabel string
+	// SessionBackupDir is the dir where New writes a timestamped copy of Session before connecting, so that
+	// session corrupted by later writes can be recovered. Empty disables backups, and read-only sessions
+	// are never backed up as they are never written.
+	SessionBackupDir string
+	// SessionBackups is the number of kept backups in SessionBackupDir. Zero means DefaultSessionBackups.
+	SessionBackups int
+	// ReadOnlySession never writes back to Session. Client still works, but updated auth state
+	// (e.g. server salts, new auth keys after migration) is not persisted, so next run may be slower
+	// or require re-login if the original session becomes invalid.
+	ReadOnlySession bool
+	// DisableRecovery removes the default recovery middleware, so that connection errors fail fast
+	// instead of being recovered, which is useful for one-shot runs.
+	DisableRecovery bool
+	// DisableRetry removes the default retry middleware of Telegram internal errors.
+	DisableRetry bool
+	// DisableMigrate removes the default migrate middleware(core/middlewares/migrate), which retries requests
+	// failed with *_MIGRATE_X errors on connections of client to the target DC.
+	DisableMigrate bool
+	// ManualFloodWait disables the default auto-sleep on FLOOD_WAIT, and such errors are returned
+	// as *FloodWaitError, so that callers can handle them, e.g. show a countdown in interactive UI.
+	ManualFloodWait bool
+	// ProbeDC probes latency of all DCs in New and logs the nearest one, which adds startup latency.
+	// Accounts and files are bound to their own DCs, so it's a recommendation for routing rather than forced.
+	ProbeDC bool
+	// KeepAlive is the TCP keepalive period of connections. Zero means default(15s), and negative disables it.
+	KeepAlive time.Duration
+	// PingInterval is the interval of application-level pings in RunWithAuth, which keeps idle connections
+	// alive behind aggressive NAT and detects dead connections faster. Zero disables it.
+	PingInterval time.Duration
+	// DCList replaces the DC configuration of resolver if not zero, e.g. self-hosted or staging servers,
+	// and it takes precedence over global DCList. It must contain at least one DC option or domain.
+	DCList dcs.List
+	// BreakerThreshold opens the circuit after such number of auth-level failures(breaker.DefaultErrors,
+	// e.g. AUTH_KEY_UNREGISTERED, USER_DEACTIVATED_BAN) in BreakerWindow, then all requests fail with
+	// breaker.ErrOpen instead of reconnecting forever with a dead account. Zero disables it.
+	BreakerThreshold int
+	// BreakerWindow is the sliding window of BreakerThreshold. Zero means DefaultBreakerWindow.
+	BreakerWindow time.Duration
+	// UpdateState persists update state(pts/qts/seq) of UpdateHandler, so that missed updates are
+	// fetched after restart. UpdateHandler is wrapped by gotd update manager, which is run by RunWithAuth,
+	// and UpdateHandler receives updates in order without gaps. It requires UpdateHandler.
+	UpdateState updates.StateStorage
+	// Test connects to Telegram test DCs with Session, e.g. session exported by NewTestClient.
+	// Test accounts are wiped by Telegram periodically, then RunWithAuth fails with ErrTestSessionExpired.
+	Test bool
+	// InitConnection customizes the device config sent by initConnection after Device is applied,
+	// e.g. setting Params(see JSONValue) or Proxy, or clearing default fields. gotd only exposes
+	// these fields of initConnection, and other ones(e.g. api_id, layer) can't be changed.
+	InitConnection func(d *telegram.DeviceConfig)
+	// CompressThreshold gzip-packs requests larger than such bytes. Zero means the standard threshold
+	// of gotd(1KB), and negative disables compression of requests. Compressed responses are decided by
+	// Telegram and always unpacked by transport, before middlewares(e.g. flood wait, retry) see them.
+	CompressThreshold int
+	// RegionProxy selects proxy url by phone number of the authorized account, e.g. PhonePrefixProxies.
+	// RunWithAuth reconnects through the selected proxy after login, instead of the static Proxy(and
+	// ProxyFallbacks). Empty result keeps the static one. It's ignored with WebSocket Proxy.
+	RegionProxy func(phone string) string
+	// UpdateConcurrency dispatches updates to UpdateHandler by such number of workers through a queue,
+	// instead of calling it synchronously, so that busy accounts don't stall the connection. Updates are
+	// not in order if it's larger than 1. Workers are run by RunWithAuth, and updates received while they are
+	// not running are queued without blocking, or dropped if the queue is full. Zero disables dispatching.
+	UpdateConcurrency int
+	// UpdateQueueSize is the number of updates which can be queued for workers of UpdateConcurrency.
+	// Full queue blocks receiving updates(backpressure), unless UpdateDropOnFull is set.
+	// Zero means DefaultUpdateQueueSize.
+	UpdateQueueSize int
+	// UpdateDropOnFull drops updates instead of blocking when the queue is full, and dropped ones are
+	// counted by UpdateDispatchStats.
+	UpdateDropOnFull bool
+
+	// region is created by New if RegionProxy is set
+	region *regionDialer
+	// dispatcher is created by New if UpdateConcurrency is set
+	dispatcher *updateDispatcher
+	// dcs are connections of client to other DCs, which are created by New unless DisableMigrate is set
+	dcs *dcInvokers
 }
 
+// DefaultBreakerWindow is the default sliding window of Options.BreakerThreshold.
+const DefaultBreakerWindow = 10 * time.Minute
+
 // New creates new telegram client with given options.
 // Default middlewares(retry, recovery, flood wait) always added.
 func New(ctx context.Context, o Options) (*telegram.Client, error) {
+	if o.SessionBackupDir != "" && o.Session != nil && !o.ReadOnlySession {
+		if _, err := BackupSession(ctx, o.Session, o.SessionBackupDir, o.SessionBackups); err != nil {
+			return nil, errors.Wrap(err, "backup session")
+		}
+	}
+
+	return newClient(ctx, o)
+}
+
+// newClient creates client of o with per-client state, and Session is used as is
+func newClient(ctx context.Context, o Options) (*telegram.Client, error) {
+	if o.RegionProxy != nil && !netutil.IsWebsocket(o.Proxy) {
+		o.region = &regionDialer{
+			proxy: o.RegionProxy,
+			newDialer: func(proxyURL string) (proxy.ContextDialer, error) {
+				return newKeepAliveDialer(proxyURL, o.KeepAlive)
+			},
+			log:   newLogger(ctx, o).Named("region"),
+			conns: make(map[*regionConn]struct{}),
+		}
+	}
+
+	if o.UpdateHandler != nil && o.UpdateConcurrency > 0 {
+		o.dispatcher = newUpdateDispatcher(o.UpdateHandler, o.UpdateConcurrency, o.UpdateQueueSize,
+			o.UpdateDropOnFull, newLogger(ctx, o).Named("dispatch"))
+	}
+
+	if !o.DisableMigrate {
+		o.dcs = newDCInvokers()
+	}
+
+	opts, err := newOptions(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.ProbeDC {
+		logNearestDC(ctx, o, newLogger(ctx, o).Named("probe"))
+	}
+
+	st := &clientState{
+		pingInterval: o.PingInterval,
+		dispatcher:   o.dispatcher,
+		region:       o.region,
+		test:         o.Test,
+	}
+	if mgr, ok := opts.UpdateHandler.(*updates.Manager); ok {
+		st.updates = mgr
+	}
+	// outermost, so that state requests are never seen by other middlewares
+	opts.Middlewares = append([]telegram.Middleware{st}, opts.Middlewares...)
+
+	client := telegram.NewClient(o.AppID, o.AppHash, opts)
+	st.warmer = newClientWarmer(client)
+	if o.dcs != nil {
+		o.dcs.bind(client)
+	}
+
+	return client, nil
+}
+
+func newOptions(ctx context.Context, o Options) (telegram.Options, error) {
 	// process clock
-	tclock := tdclock.System
-	if ntp := o.NTP; ntp != "" {
-		var err error
-		tclock, err = clock.NewNTP(ntp)
-		if err != nil {
-			return nil, errors.Wrap(err, "create network clock")
+	tclock, err := newClock(ctx, o)
+	if err != nil {
+		return telegram.Options{}, errors.Wrap(err, "create network clock")
+	}
+
+	list, err := newDCList(o)
+	if err != nil {
+		return telegram.Options{}, err
+	}
+
+	handler := o.UpdateHandler
+	if o.dispatcher != nil {
+		handler = o.dispatcher
+	}
+	if o.UpdateState != nil {
+		if handler == nil {
+			return telegram.Options{}, ErrNoUpdateHandler
 		}
+		handler = newUpdateManager(o.UpdateState, handler, newLogger(ctx, o).Named("updates"))
 	}
 
 	// process proxy
-	var dialer dcs.DialFunc = proxy.Direct.DialContext
-	if p := o.Proxy; p != "" {
-		d, err := netutil.NewProxy(p)
-		if err != nil {
-			return nil, errors.Wrap(err, "get dialer")
-		}
-		dialer = d.DialContext
+	resolver, err := newResolver(ctx, o)
+	if err != nil {
+		return telegram.Options{}, err
 	}
 
 	opts := telegram.Options{
-		Resolver: dcs.Plain(dcs.PlainOptions{
-			Dial: dialer,
-		}),
+		Resolver: resolver,
 		ReconnectionBackoff: func() backoff.BackOff {
-			return newBackoff(o.ReconnectTimeout)
+			return newBackoff(o.ReconnectTimeout, o.BackoffRandomizationFactor)
 		},
 		DC:             DC,
-		DCList:         DCList,
+		DCList:         list,
 		PublicKeys:     PublicKeys,
-		UpdateHandler:  o.UpdateHandler,
-		Device:         tutil.Device,
-		SessionStorage: o.Session,
+		UpdateHandler:  handler,
+		Device:         newDevice(o),
+		SessionStorage: newSessionStorage(o),
 		RetryInterval:  5 * time.Second,
 		MaxRetries:     -1, // infinite retries
 		DialTimeout:    10 * time.Second,
-		Middlewares:    append(NewDefaultMiddlewares(ctx, o.ReconnectTimeout), o.Middlewares...),
+		Middlewares:    newMiddlewares(ctx, o),
 		Clock:          tclock,
-		Logger:         logctx.From(ctx).Named("td"),
+		Logger:         newLogger(ctx, o),
+
+		CompressThreshold: o.CompressThreshold,
+	}
+	if o.Test {
+		opts.DC, opts.PublicKeys = TestDC, nil
+		if o.DCList.Zero() {
+			opts.DCList = dcs.Test()
+		}
+	}
+
+	return opts, nil
+}
+
+// newDCList returns DC list of o, or global DCList if it's not provided
+func newDCList(o Options) (dcs.List, error) {
+	if o.DCList.Zero() {
+		return DCList, nil
+	}
+	if len(o.DCList.Options) == 0 && len(o.DCList.Domains) == 0 {
+		return dcs.List{}, ErrEmptyDCList
+	}
+	return o.DCList, nil
+}
+
+func newResolver(ctx context.Context, o Options) (dcs.Resolver, error) {
+	// MTProto over WebSocket doesn't need a dialer
+	if netutil.IsWebsocket(o.Proxy) {
+		resolver, err := netutil.NewWebsocketResolver(o.Proxy)
+		if err != nil {
+			return nil, errors.Wrap(err, "get websocket resolver")
+		}
+		return resolver, nil
 	}
 
-	return telegram.NewClient(o.AppID, o.AppHash, opts), nil
+	dialer, err := newRoutedDialer(ctx, o)
+	if err != nil {
+		return nil, errors.Wrap(err, "get dialer")
+	}
+
+	return dcs.Plain(dcs.PlainOptions{
+		Dial: dialer.DialContext,
+	}), nil
+}
+
+func newClientDialer(ctx context.Context, o Options) (proxy.ContextDialer, error) {
+	newDialer := func(proxyURL string) (proxy.ContextDialer, error) {
+		return newKeepAliveDialer(proxyURL, o.KeepAlive)
+	}
+	if o.ProxyFailThreshold <= 0 {
+		return newDialer(o.Proxy)
+	}
+
+	proxies := append([]string{o.Proxy}, o.ProxyFallbacks...)
+	return newFailoverDialer(proxies, o.ProxyFailThreshold, newDialer, newLogger(ctx, o).Named("proxy"))
+}
+
+// newRoutedDialer wraps static dialer of o by region dialer if it's set
+func newRoutedDialer(ctx context.Context, o Options) (proxy.ContextDialer, error) {
+	dialer, err := newClientDialer(ctx, o)
+	if err != nil || o.region == nil {
+		return dialer, err
+	}
+
+	o.region.dialer = dialer
+	return o.region, nil
+}
+
+func newLogger(ctx context.Context, o Options) *zap.Logger {
+	l := logctx.From(ctx).Named("td")
+	if o.LogLabel != "" {
+		l = l.Named(o.LogLabel)
+	}
+	return l
+}
+
+// newDialer returns dialer of other connections than Telegram ones, which can't be WebSocket proxy
+func newDialer(proxyURL string) (proxy.ContextDialer, error) {
+	if netutil.IsWebsocket(proxyURL) {
+		return nil, ErrWebsocketProxy
+	}
+	return newKeepAliveDialer(proxyURL, 0)
 }
 
+func newKeepAliveDialer(proxyURL string, keepAlive time.Duration) (proxy.ContextDialer, error) {
+	if keepAlive == 0 {
+		if proxyURL == "" {
+			return proxy.Direct, nil
+		}
+		return netutil.NewProxy(proxyURL)
+	}
+
+	forward := &net.Dialer{KeepAlive: keepAlive}
+	if proxyURL == "" {
+		return forward, nil
+	}
+	return netutil.NewProxyWithForward(proxyURL, forward)
+}
+
+// NewHTTPClient returns http client which dials through the same proxy(Options.Proxy)
+// as Telegram connections, so that all outbound traffic has the same egress behavior.
+// Zero timeout means no timeout.
+func NewHTTPClient(o Options, timeout time.Duration) (*http.Client, error) {
+	dialer, err := newDialer(o.Proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "get dialer")
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		Timeout: timeout,
+	}, nil
+}
+
+func newSessionStorage(o Options) telegram.SessionStorage {
+	if o.ReadOnlySession && o.Session != nil {
+		return NewReadOnlySession(o.Session)
+	}
+	return o.Session
+}
+
+func newDevice(o Options) telegram.DeviceConfig {
+	d, override := tutil.Device, o.Device
+
+	set := func(to *string, value string) {
+		if value != "" {
+			*to = value
+		}
+	}
+
+	set(&d.DeviceModel, override.DeviceModel)
+	set(&d.SystemVersion, override.SystemVersion)
+	set(&d.AppVersion, override.AppVersion)
+	set(&d.SystemLangCode, override.SystemLangCode)
+	set(&d.LangPack, override.LangPack)
+	set(&d.LangCode, override.LangCode)
+
+	if override.Proxy != (tg.InputClientProxy{}) {
+		d.Proxy = override.Proxy
+	}
+	if override.Params != nil {
+		d.Params = override.Params
+	}
+
+	if o.InitConnection != nil {
+		o.InitConnection(&d)
+	}
+
+	return d
+}
+
+func newMiddlewares(ctx context.Context, o Options) []telegram.Middleware {
+	middlewares := NewDefaultMiddlewaresWith(ctx, o)
+	if o.OnState != nil {
+		// after flood wait middleware to observe raw errors
+		middlewares = append(middlewares, state.New(o.OnState))
+	}
+
+	registry := o.MiddlewareRegistry
+	if registry == nil {
+		registry = DefaultMiddlewareRegistry
+	}
+	middlewares = append(middlewares, registry.Middlewares(ctx, o)...)
+
+	return append(middlewares, o.Middlewares...)
+}
+
+// NewDefaultMiddlewares returns recovery, retry and flood wait middlewares with reconnection timeout.
+// Migration of requests to other DCs(core/middlewares/migrate) needs connections of client, so it's
+// only included in middlewares of clients created by New, and dcpool applies it to pooled connections.
 func NewDefaultMiddlewares(ctx context.Context, timeout time.Duration) []telegram.Middleware {
-	return []telegram.Middleware{
-		recovery.New(ctx, newBackoff(timeout)),
-		retry.New(5),
-		floodwait.NewSimpleWaiter(),
+	return NewDefaultMiddlewaresWith(ctx, Options{ReconnectTimeout: timeout})
+}
+
+// NewDefaultMiddlewaresWith is like NewDefaultMiddlewares, but honors ReconnectTimeout, BackoffRandomizationFactor,
+// DisableRecovery, DisableRetry, ManualFloodWait and BreakerThreshold of Options. Migration is
+// included if Options are passed by New, unless DisableMigrate is set.
+func NewDefaultMiddlewaresWith(ctx context.Context, o Options) []telegram.Middleware {
+	middlewares := make([]telegram.Middleware, 0, 6)
+	if o.BreakerThreshold > 0 {
+		window := o.BreakerWindow
+		if window <= 0 {
+			window = DefaultBreakerWindow
+		}
+		// outermost, so that open circuit rejects requests before recovery and retry
+		middlewares = append(middlewares, breaker.New(o.BreakerThreshold, window))
 	}
+	if !o.DisableRecovery {
+		middlewares = append(middlewares, recovery.New(ctx, newBackoff(o.ReconnectTimeout, o.BackoffRandomizationFactor)))
+	}
+	if !o.DisableRetry {
+		middlewares = append(middlewares, retry.New(5))
+	}
+
+	if o.ManualFloodWait {
+		middlewares = append(middlewares, manualFloodWait())
+	} else {
+		middlewares = append(middlewares, floodwait.NewSimpleWaiter())
+	}
+
+	middlewares = append(middlewares, floodRecorder)
+	if o.dcs != nil && !o.DisableMigrate {
+		middlewares = append(middlewares, migrate.New(o.dcs.resolve))
+	}
+
+	return middlewares
+}
+
+// newBackoff returns backoff with jitter factor, zero means DefaultBackoffRandomizationFactor and negative disables it
+func newBackoff(timeout time.Duration, factor float64) backoff.BackOff {
+	return newBackoffWithClock(timeout, factor, backoff.SystemClock)
 }
 
-func newBackoff(timeout time.Duration) backoff.BackOff {
+// newBackoffWithClock is the seam for tests to advance time without sleeping
+func newBackoffWithClock(timeout time.Duration, factor float64, clock backoff.Clock) backoff.BackOff {
+	switch {
+	case factor == 0:
+		factor = DefaultBackoffRandomizationFactor
+	case factor < 0:
+		factor = 0
+	}
+
 	b := backoff.NewExponentialBackOff()
 
 	b.Multiplier = 1.1
+	b.RandomizationFactor = factor
 	b.MaxElapsedTime = timeout
 	b.MaxInterval = 10 * time.Second
+	b.Clock = clock
+	b.Reset() // start elapsed time from the clock
 	return b
 }
 
+// RunWithAuth runs client and calls f if the session is authorized.
 func RunWithAuth(ctx context.Context, client *telegram.Client, f func(ctx context.Context) error) error {
 	return client.Run(ctx, func(ctx context.Context) error {
-		status, err := client.Auth().Status(ctx)
-		if err != nil {
-			return err
-		}
-		if !status.Authorized {
-			return fmt.Errorf("not authorized. please login first")
-		}
+		return RunWithAuthInSession(ctx, client, f)
+	})
+}
+
+// RunWithAuthInSession is like RunWithAuth, but assumes ctx is already inside Run of client, so it
+// only checks authorization and calls f without dialing again. It's used to compose multiple operations in one session.
+// Pinger, update dispatcher and manager of client are started the same as RunWithAuth, and stopped when f returns.
+func RunWithAuthInSession(ctx context.Context, client *telegram.Client, f func(ctx context.Context) error) error {
+	st := stateOf(client)
+
+	return runInSession(ctx, client, st, func(ctx context.Context) (*tg.User, error) {
+		return checkAuth(ctx, client, st.test)
+	}, f)
+}
+
+// runInSession checks authorization by check, and calls f with per-client state st of client started
+func runInSession(ctx context.Context, client *telegram.Client, st *clientState,
+	check func(ctx context.Context) (*tg.User, error),
+	f func(ctx context.Context) error,
+) error {
+	self, err := check(ctx)
+	if err != nil {
+		return err
+	}
+	if err = routeRegion(ctx, client, st.region, self); err != nil {
+		return err
+	}
+
+	stop := startPinger(ctx, client, st.pingInterval)
+	defer stop()
+
+	stopDispatcher := startDispatcher(ctx, st.dispatcher)
+	defer stopDispatcher()
+
+	return runUpdates(ctx, client, st.updates, self, f)
+}
+
+// RunWithAuthGrace is like RunWithAuth, but when ctx is canceled, client keeps connected for at most
+// grace duration after f observes the cancellation, so that f can flush and clean up before disconnecting.
+// Zero grace is the same as RunWithAuth.
+func RunWithAuthGrace(ctx context.Context, client *telegram.Client, grace time.Duration, f func(ctx context.Context) error) error {
+	return runWithGrace(ctx, grace, func(ctx context.Context, f func(ctx context.Context) error) error {
+		return RunWithAuth(ctx, client, f)
+	}, f)
+}
+
+func runWithGrace(ctx context.Context, grace time.Duration,
+	run func(ctx context.Context, f func(ctx context.Context) error) error,
+	f func(ctx context.Context) error,
+) error {
+	if grace <= 0 {
+		return run(ctx, f)
+	}
+
+	// detach client lifetime from ctx, and cancel it after grace period
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	stop := context.AfterFunc(ctx, func() { time.AfterFunc(grace, cancel) })
+	defer stop()
+
+	return run(runCtx, func(runCtx context.Context) error {
+		fctx, fcancel := context.WithCancel(runCtx)
+		defer fcancel()
+
+		// f observes the cancellation immediately
+		stopF := context.AfterFunc(ctx, fcancel)
+		defer stopF()
 
-		return f(ctx)
+		return f(fctx)
 	})
 }
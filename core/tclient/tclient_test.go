@@ -0,0 +1,1331 @@
+package tclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	tdclock "github.com/gotd/td/clock"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/net/proxy"
+
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/util/netutil"
+)
+
+// fakeRun simulates telegram.Client.Run, which returns when ctx is canceled
+func fakeRun(ctx context.Context, f func(ctx context.Context) error) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- f(ctx) }()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errCh:
+		return err
+	}
+}
+
+func TestRunWithGrace(t *testing.T) {
+	t.Run("clean up within grace", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		cleaned := false
+		err := runWithGrace(ctx, time.Second, fakeRun, func(fctx context.Context) error {
+			<-fctx.Done()
+			assert.ErrorIs(t, fctx.Err(), context.Canceled)
+
+			// simulate flushing state
+			time.Sleep(100 * time.Millisecond)
+			cleaned = true
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, cleaned)
+	})
+
+	t.Run("exceed grace", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		err := runWithGrace(ctx, 100*time.Millisecond, fakeRun, func(fctx context.Context) error {
+			<-fctx.Done()
+			time.Sleep(time.Second) // ignore grace period
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("no grace", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := runWithGrace(ctx, 0, fakeRun, func(fctx context.Context) error {
+			<-fctx.Done()
+			return fctx.Err()
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestMigrateSession(t *testing.T) {
+	ctx := context.Background()
+
+	from, to := &session.StorageMemory{}, &session.StorageMemory{}
+	assert.ErrorIs(t, MigrateSession(ctx, from, to), ErrEmptySession)
+
+	require.NoError(t, from.StoreSession(ctx, []byte(`{"Version":1}`)))
+	require.NoError(t, MigrateSession(ctx, from, to))
+
+	data, err := to.LoadSession(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`{"Version":1}`), data)
+}
+
+func TestBackupSession(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "backups")
+	s := &session.StorageMemory{}
+
+	// nothing to back up
+	path, err := BackupSession(ctx, s, dir, 3)
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	// unrelated files are never removed
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "note.txt"), nil, 0o600))
+
+	paths := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.StoreSession(ctx, []byte(strconv.Itoa(i))))
+		path, err = BackupSession(ctx, s, dir, 3)
+		require.NoError(t, err)
+		paths = append(paths, path)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{filepath.Base(paths[2]), filepath.Base(paths[3]), filepath.Base(paths[4]), "note.txt"}, names)
+
+	data, err := os.ReadFile(paths[4])
+	require.NoError(t, err)
+	assert.Equal(t, "4", string(data))
+}
+
+func TestDCConfig(t *testing.T) {
+	calls := 0
+	d := newDCConfig(func(ctx context.Context) (*tg.Config, error) {
+		calls++
+		return &tg.Config{ThisDC: 4}, nil
+	}, time.Minute)
+
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	info, err := d.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 4, info.DC)
+	assert.Equal(t, 4, info.Config.ThisDC)
+
+	// cached
+	_, err = d.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	// expired
+	now = now.Add(time.Minute)
+	_, err = d.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	d.Invalidate()
+	_, err = d.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+type fakeDialer struct {
+	name string
+	err  error
+}
+
+func (f *fakeDialer) DialContext(_ context.Context, _, _ string) (net.Conn, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func TestFailoverDialer(t *testing.T) {
+	dialers := map[string]*fakeDialer{
+		"a": {name: "a", err: errors.New("dead")},
+		"b": {name: "b"},
+	}
+
+	d := &failoverDialer{
+		proxies:   []string{"a", "b"},
+		threshold: 2,
+		newDialer: func(p string) (proxy.ContextDialer, error) { return dialers[p], nil },
+		log:       zap.NewNop(),
+		dialer:    dialers["a"],
+	}
+
+	ctx := context.Background()
+
+	_, err := d.DialContext(ctx, "tcp", "addr")
+	require.Error(t, err)
+	assert.Equal(t, 0, d.cur)
+
+	_, err = d.DialContext(ctx, "tcp", "addr")
+	require.Error(t, err)
+	assert.Equal(t, 1, d.cur) // switched after threshold
+
+	conn, err := d.DialContext(ctx, "tcp", "addr")
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// wrap around to the first one
+	dialers["b"].err = errors.New("dead")
+	_, _ = d.DialContext(ctx, "tcp", "addr")
+	_, _ = d.DialContext(ctx, "tcp", "addr")
+	assert.Equal(t, 0, d.cur)
+}
+
+func TestNewLogger(t *testing.T) {
+	ctx := logctx.With(context.Background(), zap.NewNop())
+
+	assert.Equal(t, "td", newLogger(ctx, Options{}).Name())
+	assert.Equal(t, "td.account1", newLogger(ctx, Options{LogLabel: "account1"}).Name())
+}
+
+type delayDialer map[string]time.Duration
+
+func (d delayDialer) DialContext(ctx context.Context, _, addr string) (net.Conn, error) {
+	delay, ok := d[addr]
+	if !ok {
+		return nil, errors.New("unreachable")
+	}
+	time.Sleep(delay)
+
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func TestProbeDCs(t *testing.T) {
+	list := dcs.List{Options: []tg.DCOption{
+		{ID: 1, IPAddress: "1.1.1.1", Port: 443},
+		{ID: 1, IPAddress: "1.1.1.2", Port: 443}, // only the first one is probed
+		{ID: 2, IPAddress: "2.2.2.2", Port: 443},
+		{ID: 2, IPAddress: "2.2.2.3", Port: 443, MediaOnly: true},
+		{ID: 3, IPAddress: "::1", Port: 443, Ipv6: true},
+		{ID: 4, IPAddress: "4.4.4.4", Port: 443},
+	}}
+
+	results := probeDCs(context.Background(), delayDialer{
+		"1.1.1.1:443": 60 * time.Millisecond,
+		"1.1.1.2:443": 0,
+		"2.2.2.2:443": 10 * time.Millisecond,
+	}, list)
+
+	require.Len(t, results, 3)
+	assert.Equal(t, 2, results[0].DC)
+	assert.Equal(t, 1, results[1].DC)
+	assert.Equal(t, 4, results[2].DC)
+	assert.Error(t, results[2].Err)
+}
+
+func TestReadOnlySession(t *testing.T) {
+	ctx := context.Background()
+	storage := &session.StorageMemory{}
+	require.NoError(t, storage.StoreSession(ctx, []byte("canonical")))
+
+	opts, err := newOptions(ctx, Options{Session: storage, ReadOnlySession: true})
+	require.NoError(t, err)
+
+	require.NoError(t, opts.SessionStorage.StoreSession(ctx, []byte("updated")))
+
+	data, err := opts.SessionStorage.LoadSession(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("canonical"), data)
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func TestBackoff_MaxElapsedTime(t *testing.T) {
+	clk := &fakeClock{now: time.Now()}
+	b := newBackoffWithClock(time.Minute, 0, clk)
+
+	elapsed := time.Duration(0)
+	for {
+		d := b.NextBackOff()
+		if d == backoff.Stop {
+			break
+		}
+		assert.LessOrEqual(t, d, 10*time.Second+time.Duration(float64(10*time.Second)*DefaultBackoffRandomizationFactor))
+
+		clk.now = clk.now.Add(d)
+		elapsed += d
+		require.Less(t, elapsed, 2*time.Minute, "backoff should stop after max elapsed time")
+	}
+	assert.GreaterOrEqual(t, elapsed, time.Minute-10*time.Second)
+
+	// infinite if timeout is zero
+	b = newBackoffWithClock(0, 0, clk)
+	for i := 0; i < 100; i++ {
+		clk.now = clk.now.Add(time.Hour)
+		require.NotEqual(t, backoff.Stop, b.NextBackOff())
+	}
+
+	// negative factor disables jitter
+	b = newBackoffWithClock(time.Minute, -1, clk)
+	assert.Equal(t, backoff.DefaultInitialInterval, b.NextBackOff())
+}
+
+func TestNewDefaultMiddlewaresWith(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Len(t, NewDefaultMiddlewares(ctx, time.Minute), 4)
+	assert.Len(t, NewDefaultMiddlewaresWith(ctx, Options{DisableRecovery: true}), 3)
+	assert.Len(t, NewDefaultMiddlewaresWith(ctx, Options{DisableRecovery: true, DisableRetry: true}), 2)
+	assert.Len(t, NewDefaultMiddlewaresWith(ctx, Options{BreakerThreshold: 3}), 5)
+	assert.Len(t, NewDefaultMiddlewaresWith(ctx, Options{dcs: newDCInvokers()}), 5)
+	assert.Len(t, NewDefaultMiddlewaresWith(ctx, Options{dcs: newDCInvokers(), DisableMigrate: true}), 4)
+}
+
+func TestDefaultMiddlewares_Migrate(t *testing.T) {
+	ctx := context.Background()
+
+	var dialed, calls []int
+	dcInvoker := func(dc int) tg.Invoker {
+		return telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			calls = append(calls, dc)
+			if dc != 4 {
+				return tgerr.New(303, "FILE_MIGRATE_4")
+			}
+			return nil
+		})
+	}
+
+	dcs := newDCInvokers()
+	dcs.dial = func(_ context.Context, dc int) (tg.Invoker, error) {
+		dialed = append(dialed, dc)
+		return dcInvoker(dc), nil
+	}
+
+	// like connection of client to DC 2
+	invoker := dcInvoker(2)
+	middlewares := NewDefaultMiddlewaresWith(ctx, Options{dcs: dcs})
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		invoker = middlewares[i].Handle(invoker)
+	}
+
+	require.NoError(t, invoker.Invoke(ctx, &tg.UploadGetFileRequest{}, nil))
+	require.NoError(t, invoker.Invoke(ctx, &tg.UploadGetFileRequest{}, nil))
+	assert.Equal(t, []int{2, 4, 2, 4}, calls, "retried on target DC")
+	assert.Equal(t, []int{4}, dialed, "connection of target DC is reused")
+
+	// not bound to client
+	_, err := newDCInvokers().resolve(ctx, 4)
+	assert.Error(t, err)
+}
+
+func TestAssertAccount(t *testing.T) {
+	ctx := context.Background()
+	user := &tg.User{ID: 1234, Username: "Foo", Phone: "8613800000000", Usernames: []tg.Username{{Username: "bar"}}}
+	status := func(context.Context) (*auth.Status, error) { return &auth.Status{Authorized: true, User: user}, nil }
+
+	for _, expected := range []string{"1234", "foo", "@FOO", "@bar", "+86 138-0000-0000", "8613800000000"} {
+		assert.NoError(t, assertAccount(ctx, status, expected), expected)
+	}
+
+	for _, expected := range []string{"", "12345", "@baz", "+1 8613800000000"} {
+		err := assertAccount(ctx, status, expected)
+		var mismatch *AccountMismatchError
+		require.ErrorAs(t, err, &mismatch, expected)
+		assert.Equal(t, user, mismatch.User)
+	}
+
+	err := assertAccount(ctx, func(context.Context) (*auth.Status, error) { return &auth.Status{}, nil }, "1234")
+	assert.ErrorIs(t, err, ErrNotAuthorized)
+}
+
+func TestWhoAmI(t *testing.T) {
+	ctx := context.Background()
+	status := func(s *auth.Status, err error) func(context.Context) (*auth.Status, error) {
+		return func(context.Context) (*auth.Status, error) { return s, err }
+	}
+
+	user := &tg.User{ID: 1, Username: "foo", Phone: "123"}
+	u, err := whoAmI(ctx, status(&auth.Status{Authorized: true, User: user}, nil))
+	require.NoError(t, err)
+	assert.Equal(t, user, u)
+
+	_, err = whoAmI(ctx, status(&auth.Status{Authorized: false}, nil))
+	assert.ErrorIs(t, err, ErrNotAuthorized)
+
+	_, err = whoAmI(ctx, status(nil, errors.New("network")))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotAuthorized)
+}
+
+func TestRetryStatus(t *testing.T) {
+	ctx := context.Background()
+
+	calls := 0
+	hang := func(ctx context.Context) (*auth.Status, error) {
+		calls++
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	_, err := whoAmI(ctx, retryStatus(hang, 10*time.Millisecond, 2, 0))
+	assert.ErrorIs(t, err, ErrAuthStatusUnknown)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrNotAuthorized)
+	assert.Equal(t, 3, calls)
+
+	// recovered after a network error
+	calls = 0
+	flaky := func(context.Context) (*auth.Status, error) {
+		if calls++; calls == 1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return &auth.Status{}, nil
+	}
+	_, err = whoAmI(ctx, retryStatus(flaky, time.Second, 2, 0))
+	assert.ErrorIs(t, err, ErrNotAuthorized, "genuine unauthorized is kept")
+	assert.Equal(t, 2, calls)
+
+	// RPC errors are not retried
+	calls = 0
+	rpc := func(context.Context) (*auth.Status, error) {
+		calls++
+		return nil, tgerr.New(401, "SESSION_REVOKED")
+	}
+	_, err = whoAmI(ctx, retryStatus(rpc, time.Second, 2, 0))
+	assert.True(t, tgerr.Is(err, "SESSION_REVOKED"))
+	assert.NotErrorIs(t, err, ErrAuthStatusUnknown)
+	assert.Equal(t, 1, calls)
+}
+
+// stateStorage is never called until update manager runs
+type stateStorage struct{ updates.StateStorage }
+
+func TestNewOptions_UpdateState(t *testing.T) {
+	ctx := context.Background()
+	handler := telegram.UpdateHandlerFunc(func(context.Context, tg.UpdatesClass) error { return nil })
+
+	_, err := newOptions(ctx, Options{UpdateState: stateStorage{}})
+	assert.ErrorIs(t, err, ErrNoUpdateHandler)
+
+	opts, err := newOptions(ctx, Options{UpdateHandler: handler})
+	require.NoError(t, err)
+	assert.IsType(t, handler, opts.UpdateHandler, "handler is used directly without state")
+
+	opts, err = newOptions(ctx, Options{UpdateHandler: handler, UpdateState: stateStorage{}})
+	require.NoError(t, err)
+	assert.IsType(t, &updates.Manager{}, opts.UpdateHandler)
+}
+
+func TestNewDCList(t *testing.T) {
+	list, err := newDCList(Options{})
+	require.NoError(t, err)
+	assert.Equal(t, DCList, list)
+
+	custom := dcs.List{Options: []tg.DCOption{{ID: 2, IPAddress: "127.0.0.1", Port: 443}}}
+	list, err = newDCList(Options{DCList: custom})
+	require.NoError(t, err)
+	assert.Equal(t, custom, list)
+
+	_, err = newDCList(Options{DCList: dcs.List{Options: []tg.DCOption{}}})
+	assert.ErrorIs(t, err, ErrEmptyDCList)
+
+	_, err = New(context.Background(), Options{DCList: dcs.List{Test: true}})
+	assert.ErrorIs(t, err, ErrEmptyDCList)
+}
+
+func TestRunInSession(t *testing.T) {
+	ctx := context.Background()
+	called := 0
+	f := func(context.Context) error { called++; return nil }
+
+	check := func(s *auth.Status) func(context.Context) (*tg.User, error) {
+		return func(ctx context.Context) (*tg.User, error) {
+			return whoAmI(ctx, func(context.Context) (*auth.Status, error) { return s, nil })
+		}
+	}
+
+	// client without per-client state of New
+	client := telegram.NewClient(1, "hash", telegram.Options{})
+
+	authorized := check(&auth.Status{Authorized: true, User: &tg.User{ID: 1}})
+	require.NoError(t, runInSession(ctx, client, &clientState{}, authorized, f))
+	require.NoError(t, runInSession(ctx, client, &clientState{}, authorized, f))
+	assert.Equal(t, 2, called)
+
+	assert.ErrorIs(t, runInSession(ctx, client, &clientState{}, check(&auth.Status{}), f), ErrNotAuthorized)
+	assert.Equal(t, 2, called, "f should not be called without authorization")
+}
+
+func TestTestAuthenticator(t *testing.T) {
+	ctx := context.Background()
+
+	phone, err := testAuthenticator("").Phone(ctx)
+	require.NoError(t, err)
+	assert.Regexp(t, `^999662\d{4}$`, phone)
+
+	a := testAuthenticator("9996621234")
+	phone, err = a.Phone(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "9996621234", phone)
+	code, err := a.Code(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "22222", code)
+}
+
+func TestNewTestClient_Handoff(t *testing.T) {
+	ctx := context.Background()
+	o := Options{
+		PingInterval:      time.Minute,
+		UpdateConcurrency: 1,
+		UpdateHandler: telegram.UpdateHandlerFunc(func(context.Context, tg.UpdatesClass) error {
+			return nil
+		}),
+	}
+
+	storage := &session.StorageMemory{}
+	var authClient *telegram.Client
+	client, data, err := newTestClient(ctx, o, storage, func(ctx context.Context, client *telegram.Client) error {
+		authClient = client
+		return storage.StoreSession(ctx, []byte(`{"Version":1}`))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`{"Version":1}`), data)
+
+	// temporary client only logs in
+	require.NotNil(t, authClient)
+	assert.NotSame(t, authClient, client)
+	assert.Equal(t, &clientState{test: true, warmer: stateOf(authClient).warmer}, stateOf(authClient))
+
+	// per-client options are honored by the returned client
+	st := stateOf(client)
+	assert.True(t, st.test)
+	assert.Equal(t, time.Minute, st.pingInterval)
+	assert.NotNil(t, st.dispatcher)
+
+	// not authorized
+	_, _, err = newTestClient(ctx, o, &session.StorageMemory{}, func(context.Context, *telegram.Client) error {
+		return nil
+	})
+	assert.Error(t, err)
+
+	authErr := errors.New("auth")
+	_, _, err = newTestClient(ctx, o, &session.StorageMemory{}, func(context.Context, *telegram.Client) error {
+		return authErr
+	})
+	assert.ErrorIs(t, err, authErr)
+}
+
+func TestTestAuthError(t *testing.T) {
+	err := testAuthError(ErrNotAuthorized)
+	assert.ErrorIs(t, err, ErrTestSessionExpired)
+	assert.ErrorIs(t, err, ErrNotAuthorized)
+
+	assert.ErrorIs(t, testAuthError(tgerr.New(401, "AUTH_KEY_UNREGISTERED")), ErrTestSessionExpired)
+
+	network := errors.New("network")
+	assert.Equal(t, network, testAuthError(network), "other errors are kept")
+}
+
+func TestNewOptions_Test(t *testing.T) {
+	opts, err := newOptions(context.Background(), Options{Test: true})
+	require.NoError(t, err)
+	assert.Equal(t, TestDC, opts.DC)
+	assert.Equal(t, dcs.Test(), opts.DCList)
+	assert.Nil(t, opts.PublicKeys)
+}
+
+func TestNewOptions_CompressThreshold(t *testing.T) {
+	ctx := context.Background()
+
+	def, err := newOptions(ctx, Options{})
+	require.NoError(t, err)
+	assert.Zero(t, def.CompressThreshold, "gotd default is used")
+
+	for _, threshold := range []int{-1, 4096} {
+		opts, err := newOptions(ctx, Options{CompressThreshold: threshold})
+		require.NoError(t, err)
+		assert.Equal(t, threshold, opts.CompressThreshold)
+		assert.Len(t, opts.Middlewares, len(def.Middlewares), "middlewares are not affected")
+	}
+}
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+
+	p, err := NewPool(ctx, []Options{
+		{AppID: 1, AppHash: "a", LogLabel: "foo"},
+		{AppID: 1, AppHash: "a"},
+		{AppID: 1, AppHash: "a", LogLabel: "bar"},
+	})
+	require.NoError(t, err)
+	require.Len(t, p.Accounts(), 3)
+	assert.Equal(t, "1", p.Accounts()[1].Label)
+
+	p.run = func(ctx context.Context, _ *telegram.Client, f func(ctx context.Context) error) error {
+		return f(ctx)
+	}
+
+	var (
+		mu  sync.Mutex
+		ran []string
+	)
+	err = p.RunWithAuth(ctx, func(ctx context.Context, account Account) error {
+		mu.Lock()
+		ran = append(ran, account.Label)
+		mu.Unlock()
+
+		if account.Label == "foo" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.ElementsMatch(t, []string{"foo", "1", "bar"}, ran)
+
+	errs := multierr.Errors(err)
+	require.Len(t, errs, 1)
+	var accErr *AccountError
+	require.ErrorAs(t, errs[0], &accErr)
+	assert.Equal(t, "foo", accErr.Label)
+	assert.EqualError(t, err, "account foo: failed")
+}
+
+type fakeTicker struct {
+	c chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+func (t *fakeTicker) Stop()               {}
+func (t *fakeTicker) Reset(time.Duration) {}
+
+type tickerClock struct {
+	tdclock.Clock
+	interval chan time.Duration
+	ticker   *fakeTicker
+}
+
+func (c *tickerClock) Ticker(d time.Duration) tdclock.Ticker {
+	c.interval <- d
+	return c.ticker
+}
+
+type countPinger struct {
+	pings chan struct{}
+}
+
+func (p *countPinger) Ping(context.Context) error {
+	p.pings <- struct{}{}
+	return nil
+}
+
+func TestRunPinger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	clk := &tickerClock{
+		Clock:    tdclock.System,
+		interval: make(chan time.Duration, 1),
+		ticker:   &fakeTicker{c: make(chan time.Time)},
+	}
+	p := &countPinger{pings: make(chan struct{})}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runPinger(ctx, p, 30*time.Second, clk, zap.NewNop())
+	}()
+
+	assert.Equal(t, 30*time.Second, <-clk.interval)
+
+	// each tick sends one ping
+	for i := 0; i < 3; i++ {
+		clk.ticker.c <- time.Now()
+		select {
+		case <-p.pings:
+		case <-time.After(time.Second):
+			t.Fatal("ping not sent after tick")
+		}
+	}
+
+	// no ping without tick
+	select {
+	case <-p.pings:
+		t.Fatal("unexpected ping")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	<-done
+}
+
+func TestNewKeepAliveDialer(t *testing.T) {
+	d, err := newKeepAliveDialer("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, proxy.Direct, d)
+
+	d, err = newKeepAliveDialer("", 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, &net.Dialer{KeepAlive: 10 * time.Second}, d)
+
+	_, err = newKeepAliveDialer("socks5://localhost:1080", 10*time.Second)
+	require.NoError(t, err)
+}
+
+func TestNewOptions_Websocket(t *testing.T) {
+	_, err := newOptions(context.Background(), Options{Proxy: "wss://example.com/apiws/{dc}"})
+	require.NoError(t, err)
+
+	_, err = newOptions(context.Background(), Options{Proxy: "unknown://example.com"})
+	assert.Error(t, err)
+}
+
+func TestWebsocketProxy_NonTelegram(t *testing.T) {
+	ctx := context.Background()
+	o := Options{Proxy: "wss://example.com/apiws/{dc}"}
+
+	_, err := NewHTTPClient(o, 0)
+	assert.ErrorIs(t, err, ErrWebsocketProxy)
+
+	_, err = ProbeDCs(ctx, o)
+	assert.ErrorIs(t, err, ErrWebsocketProxy)
+
+	_, err = newProxyNTPClock(ctx, o.Proxy, "pool.ntp.org")
+	assert.ErrorIs(t, err, ErrWebsocketProxy)
+}
+
+func TestManualFloodWait(t *testing.T) {
+	ctx := context.Background()
+	assert.Len(t, NewDefaultMiddlewaresWith(ctx, Options{ManualFloodWait: true}), 4)
+
+	calls := 0
+	inv := manualFloodWait().Handle(telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		calls++
+		if calls == 1 {
+			return tgerr.New(420, "FLOOD_WAIT_3")
+		}
+		return tgerr.New(400, "CHANNEL_INVALID")
+	}))
+
+	err := inv.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil)
+	var floodErr *FloodWaitError
+	require.ErrorAs(t, err, &floodErr)
+	assert.Equal(t, 3*time.Second, floodErr.Duration)
+	d, ok := AsFloodWait(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+	assert.Equal(t, 1, calls, "should not wait and retry")
+
+	err = inv.Invoke(ctx, &tg.HelpGetConfigRequest{}, nil)
+	assert.False(t, errors.As(err, &floodErr))
+	assert.True(t, tgerr.Is(err, "CHANNEL_INVALID"))
+}
+
+func TestNewOptions_InitConnection(t *testing.T) {
+	params, err := JSONValue(map[string]any{"tz_offset": 3600, "app": []any{"x", true, nil}})
+	require.NoError(t, err)
+	assert.Equal(t, &tg.JSONObject{Value: []tg.JSONObjectValue{
+		{Key: "app", Value: &tg.JSONArray{Value: []tg.JSONValueClass{
+			&tg.JSONString{Value: "x"}, &tg.JSONBool{Value: true}, &tg.JSONNull{},
+		}}},
+		{Key: "tz_offset", Value: &tg.JSONNumber{Value: 3600}},
+	}}, params)
+
+	opts, err := newOptions(context.Background(), Options{
+		Device: telegram.DeviceConfig{DeviceModel: "model"},
+		InitConnection: func(d *telegram.DeviceConfig) {
+			assert.Equal(t, "model", d.DeviceModel, "device should be applied before")
+			d.Params = params
+			d.Proxy = tg.InputClientProxy{Address: "127.0.0.1", Port: 443}
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, params, opts.Device.Params)
+	assert.Equal(t, tg.InputClientProxy{Address: "127.0.0.1", Port: 443}, opts.Device.Proxy)
+}
+
+func TestPhonePrefixProxies(t *testing.T) {
+	p := PhonePrefixProxies(map[string]string{"1": "us", "+44": "uk", "4420": "london"})
+
+	assert.Equal(t, "us", p("15550100"))
+	assert.Equal(t, "uk", p("+447700900000"))
+	assert.Equal(t, "london", p("442079460000"), "longest prefix wins")
+	assert.Equal(t, "", p("8613800000000"))
+	assert.Equal(t, "", p(""))
+}
+
+func TestRegionDialer(t *testing.T) {
+	dialers := map[string]*fakeDialer{"static": {name: "static"}, "uk": {name: "uk"}}
+	d := &regionDialer{
+		proxy:     PhonePrefixProxies(map[string]string{"44": "uk"}),
+		newDialer: func(p string) (proxy.ContextDialer, error) { return dialers[p], nil },
+		log:       zap.NewNop(),
+		dialer:    dialers["static"],
+		conns:     make(map[*regionConn]struct{}),
+	}
+	ctx := context.Background()
+
+	static, err := d.DialContext(ctx, "tcp", "addr")
+	require.NoError(t, err)
+	closed, err := d.DialContext(ctx, "tcp", "addr")
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+	assert.Len(t, d.conns, 1, "closed connections are not tracked")
+
+	switched, err := d.route("8613800000000")
+	require.NoError(t, err)
+	assert.False(t, switched, "static proxy is kept without matched region")
+
+	switched, err = d.route("447700900000")
+	require.NoError(t, err)
+	assert.True(t, switched)
+	assert.Equal(t, dialers["uk"], d.dialer)
+	assert.Empty(t, d.conns)
+
+	// connections of static proxy are closed to reconnect
+	_, err = static.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+
+	conn, err := d.DialContext(ctx, "tcp", "addr")
+	require.NoError(t, err)
+
+	switched, err = d.route("447700900000")
+	require.NoError(t, err)
+	assert.False(t, switched, "already routed")
+	assert.Len(t, d.conns, 1)
+	require.NoError(t, conn.Close())
+}
+
+// authsInvoker serves account.getAuthorizations by auths, and records reset hashes
+type authsInvoker struct {
+	auths []tg.Authorization
+	reset []int64
+}
+
+func (i *authsInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	switch req := input.(type) {
+	case *tg.AccountGetAuthorizationsRequest:
+		output.(*tg.AccountAuthorizations).Authorizations = i.auths
+	case *tg.AccountResetAuthorizationRequest:
+		i.reset = append(i.reset, req.Hash)
+		output.(*tg.BoolBox).Bool = &tg.BoolTrue{}
+	default:
+		return errors.Errorf("unexpected request %T", input)
+	}
+	return nil
+}
+
+func TestAuthorizations(t *testing.T) {
+	ctx := context.Background()
+	inv := &authsInvoker{auths: []tg.Authorization{
+		{Current: true, DeviceModel: "tdl", Platform: "linux", AppName: "tdl", AppVersion: "v0.18.0"},
+		{Hash: 42, DeviceModel: "Pixel 8", Platform: "Android", SystemVersion: "14", IP: "1.2.3.4", Country: "US", DateActive: 1700000000},
+	}}
+	api := tg.NewClient(inv)
+
+	auths, err := listAuthorizations(ctx, api)
+	require.NoError(t, err)
+	require.Len(t, auths, 2)
+	assert.True(t, auths[0].Current)
+	assert.Equal(t, "linux", auths[0].Platform)
+	assert.Equal(t, "tdl v0.18.0", auths[0].App)
+	assert.Equal(t, Authorization{
+		Hash:     42,
+		Device:   "Pixel 8",
+		Platform: "Android 14",
+		IP:       "1.2.3.4",
+		Country:  "US",
+		Created:  time.Unix(0, 0),
+		Active:   time.Unix(1700000000, 0),
+	}, auths[1])
+
+	assert.ErrorIs(t, resetAuthorization(ctx, api, 0), ErrCurrentAuthorization)
+	assert.ErrorIs(t, resetAuthorization(ctx, api, 43), ErrAuthorizationNotFound)
+	assert.Empty(t, inv.reset)
+
+	require.NoError(t, resetAuthorization(ctx, api, 42))
+	assert.Equal(t, []int64{42}, inv.reset)
+}
+
+func TestNewClock(t *testing.T) {
+	c, err := newClock(context.Background(), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, tdclock.System, c)
+
+	_, err = newClock(context.Background(), Options{Proxy: "http://127.0.0.1:8080", NTP: "pool.ntp.org"})
+	assert.ErrorIs(t, err, netutil.ErrProxyNoUDP)
+}
+
+func TestNewHTTPClock(t *testing.T) {
+	remote := time.Now().Add(time.Hour)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", remote.UTC().Format(http.TimeFormat))
+	}))
+	defer srv.Close()
+
+	assert.True(t, IsHTTPTimeSource(srv.URL))
+	c, err := newClock(context.Background(), Options{NTP: srv.URL})
+	require.NoError(t, err)
+	assert.WithinDuration(t, remote, c.Now(), 2*time.Second)
+}
+
+// blockingHandler blocks each update until release is closed, and counts concurrent calls
+type blockingHandler struct {
+	release chan struct{}
+	mu      sync.Mutex
+	cur     int
+	max     int
+	handled int
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, _ tg.UpdatesClass) error {
+	h.mu.Lock()
+	h.cur++
+	if h.cur > h.max {
+		h.max = h.cur
+	}
+	h.mu.Unlock()
+
+	select {
+	case <-h.release:
+	case <-ctx.Done():
+	}
+
+	h.mu.Lock()
+	h.cur--
+	h.handled++
+	h.mu.Unlock()
+	return nil
+}
+
+func TestUpdateDispatcher_Drop(t *testing.T) {
+	h := &blockingHandler{release: make(chan struct{})}
+	d := newUpdateDispatcher(h, 2, 3, true, zap.NewNop())
+
+	// no workers are running, so only queue size of updates are queued
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Handle(context.Background(), &tg.UpdatesTooLong{}))
+	}
+	assert.Equal(t, DispatchStats{Queued: 3, Dropped: 2}, d.Stats())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.run(ctx)
+	}()
+
+	close(h.release)
+	require.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.handled == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	assert.LessOrEqual(t, h.max, 2)
+}
+
+func TestUpdateDispatcher_Block(t *testing.T) {
+	h := &blockingHandler{release: make(chan struct{})}
+	d := newUpdateDispatcher(h, 1, 1, false, zap.NewNop())
+
+	rctx, rcancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.run(rctx)
+	}()
+	defer func() {
+		close(h.release)
+		rcancel()
+		<-done
+	}()
+	require.Eventually(t, d.running.Load, 5*time.Second, time.Millisecond)
+
+	// the only worker is busy with the first update, and the second one fills the queue
+	require.NoError(t, d.Handle(context.Background(), &tg.UpdatesTooLong{}))
+	require.Eventually(t, func() bool { return d.Stats().Queued == 0 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, d.Handle(context.Background(), &tg.UpdatesTooLong{}))
+
+	// queue is full, so Handle blocks until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Handle(ctx, &tg.UpdatesTooLong{}), context.DeadlineExceeded)
+	assert.Equal(t, DispatchStats{Queued: 1}, d.Stats())
+}
+
+func TestUpdateDispatcher_NotRunning(t *testing.T) {
+	h := &blockingHandler{release: make(chan struct{})}
+	d := newUpdateDispatcher(h, 1, 0, false, zap.NewNop())
+
+	// updates never block the connection without workers, e.g. before RunWithAuth starts them
+	for i := 0; i < DefaultUpdateQueueSize+1; i++ {
+		require.NoError(t, d.Handle(context.Background(), &tg.UpdatesTooLong{}))
+	}
+	assert.Equal(t, DispatchStats{Queued: DefaultUpdateQueueSize, Dropped: 1}, d.Stats())
+}
+
+// memStorage is storage.Storage in memory
+type memStorage struct {
+	m map[string][]byte
+}
+
+func (s *memStorage) Get(_ context.Context, key string) ([]byte, error) {
+	v, ok := s.m[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *memStorage) Set(_ context.Context, key string, value []byte) error {
+	s.m[key] = value
+	return nil
+}
+
+func (s *memStorage) Delete(_ context.Context, key string) error {
+	delete(s.m, key)
+	return nil
+}
+
+// resolveInvoker serves contacts.resolveUsername and messages.checkChatInvite, and counts calls
+type resolveInvoker struct {
+	calls int
+}
+
+func (i *resolveInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	i.calls++
+
+	channel := &tg.Channel{ID: 1, AccessHash: 2, Username: "tdl"}
+	switch input.(type) {
+	case *tg.ContactsResolveUsernameRequest:
+		*output.(*tg.ContactsResolvedPeer) = tg.ContactsResolvedPeer{
+			Peer:  &tg.PeerChannel{ChannelID: channel.ID},
+			Chats: []tg.ChatClass{channel},
+		}
+	case *tg.MessagesCheckChatInviteRequest:
+		output.(*tg.ChatInviteBox).ChatInvite = &tg.ChatInviteAlready{Chat: channel}
+	default:
+		return errors.Errorf("unexpected request %T", input)
+	}
+	return nil
+}
+
+func TestNormalizePeerRef(t *testing.T) {
+	tests := map[string]string{
+		"@TDL":                       "tdl",
+		" tdl ":                      "tdl",
+		"https://t.me/TDL":           "tdl",
+		"t.me/tdl":                   "tdl",
+		"https://t.me/+AbCd":         "+AbCd",
+		"https://t.me/joinchat/AbCd": "+AbCd",
+		"+8613800000000":             "+8613800000000",
+		"-1001234":                   "-1001234",
+		"https://telegram.me/tdl/":   "tdl",
+	}
+	for ref, expected := range tests {
+		assert.Equal(t, expected, normalizePeerRef(ref), ref)
+	}
+}
+
+func TestPeerResolver(t *testing.T) {
+	ctx := context.Background()
+	kv := &memStorage{m: map[string][]byte{}}
+	inv := &resolveInvoker{}
+	api := tg.NewClient(inv)
+	expected := &tg.InputPeerChannel{ChannelID: 1, AccessHash: 2}
+
+	r := NewPeerResolver(kv)
+	for _, ref := range []string{"@tdl", "https://t.me/TDL", "tdl"} {
+		p, err := r.Resolve(ctx, api, ref)
+		require.NoError(t, err)
+		assert.Equal(t, expected, p)
+	}
+	assert.Equal(t, 1, inv.calls)
+
+	p, err := r.Resolve(ctx, api, "https://t.me/+AbCd")
+	require.NoError(t, err)
+	assert.Equal(t, expected, p)
+	assert.Equal(t, 2, inv.calls)
+
+	// persisted results are reused by another resolver
+	p, err = NewPeerResolver(kv).Resolve(ctx, api, "tdl")
+	require.NoError(t, err)
+	assert.Equal(t, expected, p)
+	assert.Equal(t, 2, inv.calls)
+
+	require.NoError(t, r.Forget(ctx, "@tdl"))
+	_, err = NewPeerResolver(kv).Resolve(ctx, api, "tdl")
+	require.NoError(t, err)
+	assert.Equal(t, 3, inv.calls)
+}
+
+func TestDryConnect(t *testing.T) {
+	ctx := context.Background()
+
+	// closed port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	var cerr *ConnectError
+	err = DryConnect(ctx, Options{Proxy: "socks5://" + closed, NTP: "pool.ntp.org"})
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, StageClock, cerr.Stage)
+
+	err = DryConnect(ctx, Options{Proxy: "socks5://" + closed})
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, StageProxy, cerr.Stage)
+
+	// DC accepts connections but never responds to handshake
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	err = DryConnect(ctx, Options{
+		AppID:   1,
+		AppHash: "hash",
+		DCList: dcs.List{Options: []tg.DCOption{
+			{ID: 2, IPAddress: addr.IP.String(), Port: addr.Port},
+		}},
+	})
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, StageHandshake, cerr.Stage)
+}
+
+// flakyIter yields messages of ids older than offset, and fails once at fail-th message
+type flakyIter struct {
+	ids  []int
+	fail int
+	err  error
+
+	cur     int
+	value   messages.Elem
+	iterErr error
+}
+
+func (i *flakyIter) Next(context.Context) bool {
+	if i.cur >= len(i.ids) {
+		return false
+	}
+	if i.cur == i.fail && i.err != nil {
+		i.iterErr = i.err
+		return false
+	}
+
+	i.value = messages.Elem{Msg: &tg.Message{ID: i.ids[i.cur]}}
+	i.cur++
+	return true
+}
+
+func (i *flakyIter) Value() messages.Elem { return i.value }
+
+func (i *flakyIter) Err() error { return i.iterErr }
+
+func TestResumableIter(t *testing.T) {
+	ctx := context.Background()
+	all := []int{10, 9, 8, 7, 6, 5}
+
+	newIters := func(fail int, errs ...error) (func(offsetID int) MessageIter, *[]int) {
+		offsets := &[]int{}
+		return func(offsetID int) MessageIter {
+			*offsets = append(*offsets, offsetID)
+
+			ids := all
+			if offsetID != 0 {
+				for j, id := range all {
+					if id < offsetID {
+						ids = all[j:]
+						break
+					}
+				}
+			}
+
+			it := &flakyIter{ids: ids, fail: fail}
+			if n := len(*offsets) - 1; n < len(errs) {
+				it.err = errs[n]
+			}
+			return it
+		}, offsets
+	}
+
+	collect := func(it *ResumableIter) []int {
+		var ids []int
+		for it.Next(ctx) {
+			ids = append(ids, it.Value().Msg.GetID())
+		}
+		return ids
+	}
+
+	// disconnected twice mid-iteration, and resumed from the last yielded message
+	disconnect := io.ErrUnexpectedEOF
+	newIter, offsets := newIters(2, disconnect, disconnect)
+	it := newResumableIter(newIter, backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3))
+	assert.Equal(t, all, collect(it))
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []int{0, 9, 7}, *offsets)
+
+	// business errors are not recovered
+	newIter, offsets = newIters(2, tgerr.New(400, "CHANNEL_INVALID"))
+	it = newResumableIter(newIter, backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3))
+	assert.Equal(t, []int{10, 9}, collect(it))
+	assert.True(t, tgerr.Is(it.Err(), "CHANNEL_INVALID"))
+	assert.Equal(t, []int{0}, *offsets)
+
+	// recovery is given up if backoff is exhausted without progress
+	newIter, _ = newIters(0, disconnect, disconnect, disconnect)
+	it = newResumableIter(newIter, backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 1))
+	assert.Empty(t, collect(it))
+	assert.ErrorIs(t, it.Err(), disconnect)
+}
+
+type healthInvoker struct {
+	config tg.JSONValueClass
+}
+
+func (i *healthInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	switch input.(type) {
+	case *tg.AccountGetAccountTTLRequest:
+		*output.(*tg.AccountDaysTTL) = tg.AccountDaysTTL{Days: 365}
+	case *tg.HelpGetAppConfigRequest:
+		output.(*tg.HelpAppConfigBox).AppConfig = &tg.HelpAppConfig{Config: i.config}
+	default:
+		return errors.Errorf("unexpected request %T", input)
+	}
+	return nil
+}
+
+func TestCheckAccount(t *testing.T) {
+	ctx := context.Background()
+
+	h, err := checkAccount(ctx, tg.NewClient(&healthInvoker{config: &tg.JSONObject{}}), &tg.User{ID: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 365, h.TTLDays)
+	assert.False(t, h.Frozen())
+	assert.NoError(t, h.Err())
+
+	frozen := &tg.JSONObject{Value: []tg.JSONObjectValue{
+		{Key: "freeze_since_date", Value: &tg.JSONNumber{Value: 1700000000}},
+		{Key: "freeze_until_date", Value: &tg.JSONNumber{Value: 1800000000}},
+		{Key: "freeze_appeal_url", Value: &tg.JSONString{Value: "https://t.me/spambot"}},
+	}}
+	user := &tg.User{ID: 1, Restricted: true, RestrictionReason: []tg.RestrictionReason{{Platform: "ios", Text: "blocked"}}}
+	h, err = checkAccount(ctx, tg.NewClient(&healthInvoker{config: frozen}), user)
+	require.NoError(t, err)
+	assert.True(t, h.Frozen())
+	assert.Equal(t, "https://t.me/spambot", h.FrozenAppealURL)
+
+	err = h.Err()
+	assert.ErrorIs(t, err, ErrAccountLimited)
+	var limited *AccountLimitedError
+	require.ErrorAs(t, err, &limited)
+	assert.Len(t, limited.Reasons, 2)
+	assert.Contains(t, limited.Reasons[1], "blocked")
+}
+
+func TestLimitedError(t *testing.T) {
+	err := LimitedError(tgerr.New(400, "PEER_FLOOD"))
+	assert.ErrorIs(t, err, ErrAccountLimited)
+	assert.True(t, tgerr.Is(err, "PEER_FLOOD"))
+	assert.Contains(t, err.Error(), "@SpamBot")
+
+	assert.ErrorIs(t, LimitedError(errors.Wrap(tgerr.New(420, "FROZEN_METHOD_INVALID"), "send")), ErrAccountLimited)
+
+	other := tgerr.New(400, "CHANNEL_INVALID")
+	assert.Equal(t, other, LimitedError(other))
+	assert.NoError(t, LimitedError(nil))
+}
+
+func TestClientState(t *testing.T) {
+	client, err := New(context.Background(), Options{
+		AppID:             1,
+		AppHash:           "hash",
+		PingInterval:      time.Minute,
+		Test:              true,
+		RegionProxy:       PhonePrefixProxies(nil),
+		UpdateConcurrency: 1,
+		UpdateState:       stateStorage{},
+		UpdateHandler: telegram.UpdateHandlerFunc(func(context.Context, tg.UpdatesClass) error {
+			return nil
+		}),
+	})
+	require.NoError(t, err)
+
+	// state is owned by client, and found without running it
+	st := stateOf(client)
+	assert.Equal(t, time.Minute, st.pingInterval)
+	assert.True(t, st.test)
+	assert.NotNil(t, st.updates)
+	assert.NotNil(t, st.dispatcher)
+	assert.NotNil(t, st.region)
+	assert.NotNil(t, st.warmer)
+	assert.Same(t, st, stateOf(client))
+
+	_, ok := UpdateDispatchStats(client)
+	assert.True(t, ok)
+
+	// clients not created by New have empty state, and lookup doesn't block
+	other := telegram.NewClient(1, "hash", telegram.Options{})
+	assert.Equal(t, &clientState{}, stateOf(other))
+	_, ok = UpdateDispatchStats(other)
+	assert.False(t, ok)
+}
@@ -0,0 +1,104 @@
+package tclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/crypto"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	"github.com/iyear/tdl/core/middlewares/breaker"
+)
+
+// TestDC is the Telegram test DC used by test clients.
+const TestDC = 2
+
+// ErrTestSessionExpired is returned by RunWithAuth of test clients when the session is no longer authorized,
+// as test accounts are wiped by Telegram test servers periodically. Regenerate the session by NewTestClient.
+// Malformed sessions fail earlier when they are loaded.
+var ErrTestSessionExpired = errors.New("test session is expired on Telegram test servers, please regenerate it")
+
+// checkAuth is WhoAmI with bounded retries of auth status, and friendly error of expired sessions of test clients
+func checkAuth(ctx context.Context, client *telegram.Client, test bool) (*tg.User, error) {
+	user, err := whoAmI(ctx, retryStatus(client.Auth().Status, authStatusTimeout, authStatusRetries, authStatusRetryDelay))
+	if err != nil {
+		if test {
+			return nil, testAuthError(err)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func testAuthError(err error) error {
+	if errors.Is(err, ErrNotAuthorized) || tgerr.Is(err, breaker.DefaultErrors...) {
+		return fmt.Errorf("%w: %w", ErrTestSessionExpired, err)
+	}
+	return err
+}
+
+// NewTestClient registers or logs into an account on Telegram test DCs, and returns
+// an authorized client with the exported session.
+//
+// Documented test login flow is used: phone is 99966XYYYY(X = dc id, Y = random digits)
+// and code is X repeated. Random phone is used if phone is empty. Test app credentials
+// are used if AppID is not set, and o.Session is ignored because session is kept in memory.
+// The returned client is created the same as New, so per-client options(e.g. PingInterval) are honored.
+func NewTestClient(ctx context.Context, o Options, phone string) (*telegram.Client, []byte, error) {
+	authenticator := testAuthenticator(phone)
+
+	return newTestClient(ctx, o, &session.StorageMemory{}, func(ctx context.Context, client *telegram.Client) error {
+		return client.Run(ctx, func(ctx context.Context) error {
+			return client.Auth().IfNecessary(ctx, auth.NewFlow(authenticator, auth.SendCodeOptions{}))
+		})
+	})
+}
+
+// testAuthenticator returns authenticator of test phone, and random test phone is used if it's empty
+func testAuthenticator(phone string) auth.UserAuthenticator {
+	if phone == "" {
+		return auth.Test(crypto.DefaultRand(), TestDC)
+	}
+	return auth.TestUser(phone, TestDC)
+}
+
+// newTestClient authorizes a temporary client of o with storage by authorize, then hands the authorized
+// session over to a new client, as client can't be run twice
+func newTestClient(ctx context.Context, o Options, storage *session.StorageMemory,
+	authorize func(ctx context.Context, client *telegram.Client) error,
+) (*telegram.Client, []byte, error) {
+	if o.AppID == 0 {
+		o.AppID, o.AppHash = telegram.TestAppID, telegram.TestAppHash
+	}
+
+	o.Session = storage
+	o.Test = true
+
+	// temporary client only logs in, and never handles updates or keeps the connection
+	authOpts := o
+	authOpts.UpdateHandler, authOpts.UpdateState, authOpts.UpdateConcurrency = nil, nil, 0
+	authOpts.RegionProxy, authOpts.PingInterval = nil, 0
+
+	client, err := newClient(ctx, authOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = authorize(ctx, client); err != nil {
+		return nil, nil, errors.Wrap(err, "auth test account")
+	}
+
+	data, err := storage.LoadSession(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "load test session")
+	}
+
+	if client, err = newClient(ctx, o); err != nil {
+		return nil, nil, err
+	}
+	return client, data, nil
+}
@@ -0,0 +1,58 @@
+package tclient
+
+import (
+	"context"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrNoUpdateHandler is returned when Options.UpdateState is set without Options.UpdateHandler.
+var ErrNoUpdateHandler = errors.New("update state requires update handler")
+
+// newUpdateManager wraps handler with gotd update manager, which persists pts/qts/seq to state
+// and recovers gaps on restart. Channel access hashes are also persisted if state implements
+// updates.ChannelAccessHasher, otherwise they are kept in memory and channel gaps may not be recovered.
+func newUpdateManager(state updates.StateStorage, handler telegram.UpdateHandler, log *zap.Logger) *updates.Manager {
+	cfg := updates.Config{
+		Handler: handler,
+		Storage: state,
+		Logger:  log,
+	}
+	if hasher, ok := state.(updates.ChannelAccessHasher); ok {
+		cfg.AccessHasher = hasher
+	}
+
+	return updates.New(cfg)
+}
+
+// runUpdates runs update manager mgr of client with f if not nil, and stops it after f returns
+func runUpdates(ctx context.Context, client *telegram.Client, mgr *updates.Manager, self *tg.User, f func(ctx context.Context) error) error {
+	if mgr == nil {
+		return f(ctx)
+	}
+	// updates received after f returns are passed to handler directly
+	defer mgr.Reset()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg, wgctx := errgroup.WithContext(ctx)
+	wg.Go(func() error {
+		err := mgr.Run(wgctx, client.API(), self.ID, updates.AuthOptions{IsBot: self.Bot})
+		if err != nil && ctx.Err() == nil {
+			return errors.Wrap(err, "run update manager")
+		}
+		return nil
+	})
+	wg.Go(func() error {
+		defer cancel()
+		return f(wgctx)
+	})
+
+	return wg.Wait()
+}
@@ -0,0 +1,119 @@
+package tclient
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/iyear/tdl/core/logctx"
+)
+
+// warmer warms each DC once, and concurrent warming of the same DC is shared
+type warmer struct {
+	warm func(ctx context.Context, dc int) error
+
+	mu     sync.Mutex
+	warmed map[int]struct{}
+	group  singleflight.Group
+}
+
+func newWarmer(warm func(ctx context.Context, dc int) error) *warmer {
+	return &warmer{
+		warm:   warm,
+		warmed: make(map[int]struct{}),
+	}
+}
+
+// newClientWarmer returns warmer of DC connections of client
+func newClientWarmer(client *telegram.Client) *warmer {
+	return newWarmer(func(ctx context.Context, dc int) error {
+		invoker, err := client.DC(ctx, dc, 1)
+		if err != nil {
+			return err
+		}
+		return invoker.Close()
+	})
+}
+
+func (w *warmer) isWarmed(dc int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.warmed[dc]
+	return ok
+}
+
+func (w *warmer) run(ctx context.Context, log *zap.Logger, dcIDs ...int) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		rerr error
+	)
+
+	for _, dc := range dcIDs {
+		if w.isWarmed(dc) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(dc int) {
+			defer wg.Done()
+
+			_, err, _ := w.group.Do(strconv.Itoa(dc), func() (any, error) {
+				if w.isWarmed(dc) {
+					return nil, nil
+				}
+
+				start := time.Now()
+				log.Info("Warming DC", zap.Int("dc", dc))
+				if err := w.warm(ctx, dc); err != nil {
+					log.Warn("Warm DC failed", zap.Int("dc", dc), zap.Error(err))
+					return nil, errors.Wrapf(err, "warm dc %d", dc)
+				}
+				log.Info("DC warmed", zap.Int("dc", dc), zap.Duration("took", time.Since(start)))
+
+				w.mu.Lock()
+				w.warmed[dc] = struct{}{}
+				w.mu.Unlock()
+				return nil, nil
+			})
+
+			mu.Lock()
+			rerr = multierr.Append(rerr, err)
+			mu.Unlock()
+		}(dc)
+	}
+
+	wg.Wait()
+	return rerr
+}
+
+// WarmDCs connects to given DCs ahead of time, so that their auth keys are generated and cached by client,
+// which reduces latency of the first request to non-home DCs, e.g. media DCs of downloads.
+// Client must be running, and the current DC is skipped.
+//
+// It's idempotent and safe to call concurrently, as each DC is warmed only once per client created by New.
+// Failed DCs are retried by next call.
+func WarmDCs(ctx context.Context, client *telegram.Client, dcIDs ...int) error {
+	w := stateOf(client).warmer
+	if w == nil { // client not created by New, DCs are only shared by this call
+		w = newClientWarmer(client)
+	}
+
+	current := client.Config().ThisDC
+	targets := make([]int, 0, len(dcIDs))
+	for _, dc := range dcIDs {
+		if dc != current {
+			targets = append(targets, dc)
+		}
+	}
+
+	return w.run(ctx, logctx.From(ctx).Named("td").Named("warm"), targets...)
+}
@@ -0,0 +1,62 @@
+package tclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestWarmer(t *testing.T) {
+	var (
+		calls  sync.Map // dc -> *atomic.Int32
+		failDC atomic.Int32
+	)
+	failDC.Store(4)
+
+	w := newWarmer(func(ctx context.Context, dc int) error {
+		v, _ := calls.LoadOrStore(dc, &atomic.Int32{})
+		v.(*atomic.Int32).Add(1)
+		if int32(dc) == failDC.Load() {
+			return errors.New("dial failed")
+		}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- w.run(context.Background(), zap.NewNop(), 2, 4, 5, 2)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.ErrorContains(t, err, "warm dc 4")
+	}
+
+	count := func(dc int) int32 {
+		v, ok := calls.Load(dc)
+		if !ok {
+			return 0
+		}
+		return v.(*atomic.Int32).Load()
+	}
+	assert.Equal(t, int32(1), count(2), "warmed DC should not be warmed again")
+	assert.Equal(t, int32(1), count(5))
+
+	// failed DC is retried
+	failDC.Store(0)
+	before := count(4)
+	assert.NoError(t, w.run(context.Background(), zap.NewNop(), 2, 4, 5))
+	assert.Equal(t, before+1, count(4))
+	assert.Equal(t, int32(1), count(2))
+}
@@ -0,0 +1,98 @@
+package uploader
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/tg"
+)
+
+type albumItem struct {
+	elem  Elem
+	media message.MultiMediaOption
+	r     *resumer
+}
+
+// uploadAlbum uploads elems of album in order, and sends uploaded ones in one grouped message.
+// Elems which fail to upload are reported and skipped, and others are still sent.
+func (u *Uploader) uploadAlbum(ctx context.Context, album AlbumElem) error {
+	elems := album.Album()
+	if len(elems) > MaxAlbumSize {
+		err := errors.Errorf("album has %d elems, more than %d", len(elems), MaxAlbumSize)
+		for _, elem := range elems {
+			u.opts.Progress.OnAdd(elem)
+			u.opts.Progress.OnDone(elem, err)
+		}
+		return nil
+	}
+
+	items := make([]albumItem, 0, len(elems))
+	for _, elem := range elems {
+		u.opts.Progress.OnAdd(elem)
+	}
+	for _, elem := range elems {
+		if err := ctx.Err(); err != nil {
+			u.opts.Progress.OnDone(elem, err)
+			continue
+		}
+
+		media, r, err := u.uploadMedia(ctx, elem)
+		if err != nil {
+			u.opts.Progress.OnDone(elem, err)
+			continue
+		}
+		items = append(items, albumItem{elem: elem, media: media, r: r})
+	}
+	if len(items) == 0 {
+		return ctx.Err()
+	}
+
+	media, resumers := make([]message.MultiMediaOption, 0, len(items)), make([]*resumer, 0, len(items))
+	for _, item := range items {
+		media = append(media, item.media)
+		resumers = append(resumers, item.r)
+	}
+
+	updates, err := u.sender(album).Album(ctx, media[0], media[1:]...)
+	if err = u.afterSend(ctx, err, resumers...); err != nil {
+		err = errors.Wrap(err, "send album")
+	}
+
+	msgs := sentMessages(updates)
+	sp, ok := u.opts.Progress.(SentProgress)
+	for i, item := range items {
+		// messages of album have ascending IDs in order of media
+		if err == nil && ok && len(msgs) == len(items) {
+			sp.OnSent(item.elem, msgs[i])
+		}
+		u.opts.Progress.OnDone(item.elem, err)
+	}
+
+	return err
+}
+
+// sentMessages extracts new messages from updates of sending in ascending order of IDs
+func sentMessages(updates tg.UpdatesClass) []SentMessage {
+	var list []tg.UpdateClass
+	switch u := updates.(type) {
+	case *tg.Updates:
+		list = u.Updates
+	case *tg.UpdatesCombined:
+		list = u.Updates
+	}
+
+	msgs := make([]SentMessage, 0, len(list))
+	for _, update := range list {
+		switch u := update.(type) {
+		case *tg.UpdateNewMessage:
+			msgs = append(msgs, newSentMessage(u.Message))
+		case *tg.UpdateNewChannelMessage:
+			msgs = append(msgs, newSentMessage(u.Message))
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+
+	return msgs
+}
@@ -0,0 +1,70 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentMessages(t *testing.T) {
+	updates := &tg.Updates{Updates: []tg.UpdateClass{
+		&tg.UpdateMessageID{ID: 3},
+		&tg.UpdateNewChannelMessage{Message: &tg.Message{ID: 12, Date: 1700000001}},
+		&tg.UpdateNewChannelMessage{Message: &tg.Message{ID: 11, Date: 1700000000}},
+		&tg.UpdateReadChannelInbox{},
+	}}
+	assert.Equal(t, []SentMessage{
+		{ID: 11, Date: time.Unix(1700000000, 0)},
+		{ID: 12, Date: time.Unix(1700000001, 0)},
+	}, sentMessages(updates))
+	assert.Empty(t, sentMessages(nil))
+}
+
+func TestSentMessage(t *testing.T) {
+	msg, ok := sentMessage(&tg.UpdateShortSentMessage{ID: 5, Date: 1700000000})
+	assert.True(t, ok)
+	assert.Equal(t, SentMessage{ID: 5, Date: time.Unix(1700000000, 0)}, msg)
+
+	msg, ok = sentMessage(&tg.Updates{Updates: []tg.UpdateClass{
+		&tg.UpdateNewMessage{Message: &tg.MessageEmpty{ID: 6}},
+	}})
+	assert.True(t, ok)
+	assert.Equal(t, SentMessage{ID: 6}, msg, "date is unknown")
+
+	_, ok = sentMessage(nil)
+	assert.False(t, ok)
+}
+
+type albumElem struct {
+	Elem
+	elems []Elem
+}
+
+func (a *albumElem) Album() []Elem { return a.elems }
+
+type doneProgress struct {
+	nopProgress
+	errs map[Elem]error
+}
+
+func (p *doneProgress) OnDone(elem Elem, err error) { p.errs[elem] = err }
+
+func TestUploadAlbum_TooLarge(t *testing.T) {
+	album := &albumElem{}
+	for i := 0; i <= MaxAlbumSize; i++ {
+		album.elems = append(album.elems, &memElem{})
+	}
+	album.Elem = album.elems[0]
+
+	progress := &doneProgress{errs: map[Elem]error{}}
+	u := New(Options{Progress: progress})
+	assert.NoError(t, u.uploadAlbum(context.Background(), album))
+
+	assert.Len(t, progress.errs, len(album.elems))
+	for _, err := range progress.errs {
+		assert.ErrorContains(t, err, "more than")
+	}
+}
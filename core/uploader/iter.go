@@ -3,6 +3,7 @@ package uploader
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/gotd/td/tg"
 )
@@ -19,9 +20,80 @@ type File interface {
 	Size() int64
 }
 
+// MIMEFile is an optional interface of File to provide already detected MIME type,
+// so that uploader doesn't need to read the file again. Empty MIME means unknown.
+type MIMEFile interface {
+	File
+	MIME() string
+}
+
 type Elem interface {
 	File() File
 	Thumb() (File, bool)
 	To() tg.InputPeerClass
 	AsPhoto() bool
 }
+
+// MaxAlbumSize is the max number of media in an album, refer to https://core.telegram.org/api/files#albums-grouped-media
+const MaxAlbumSize = 10
+
+// AlbumElem is an optional interface of Elem to send Album elems in one grouped message, and its own
+// File and Thumb are never used. Elems are uploaded in order and reported to Progress separately.
+// Telegram only groups photos with videos, and documents or audios of the same kind, at most MaxAlbumSize.
+type AlbumElem interface {
+	Elem
+	Album() []Elem
+}
+
+// CaptionElem is an optional interface of Elem to override the default caption(file name and MIME type).
+type CaptionElem interface {
+	Elem
+	// Caption returns plain text caption of the message, and false means the default caption.
+	Caption() (string, bool)
+}
+
+// VideoInfo is attributes of uploaded video, and zero fields are unknown.
+type VideoInfo struct {
+	Duration          time.Duration
+	Width             int
+	Height            int
+	SupportsStreaming bool
+}
+
+// Merge fills unknown fields of v by fallback, e.g. explicit values are merged with probed ones.
+func (v VideoInfo) Merge(fallback VideoInfo) VideoInfo {
+	if v.Duration == 0 {
+		v.Duration = fallback.Duration
+	}
+	if v.Width == 0 {
+		v.Width = fallback.Width
+	}
+	if v.Height == 0 {
+		v.Height = fallback.Height
+	}
+	v.SupportsStreaming = v.SupportsStreaming || fallback.SupportsStreaming
+	return v
+}
+
+// VideoElem is an optional interface of Elem to provide video attributes, e.g. probed by ffprobe or set by user.
+// Unknown fields are filled by MP4 header if possible, and videos without dimensions are uploaded as documents.
+type VideoElem interface {
+	Elem
+	// Video returns attributes of video, and false means unknown.
+	Video() (VideoInfo, bool)
+}
+
+// DocumentElem is an optional interface of Elem to force sending file as a plain document, so that
+// images are not recompressed and videos or audios are not shown as media. It takes precedence over AsPhoto.
+type DocumentElem interface {
+	Elem
+	AsDocument() bool
+}
+
+// TopicElem is an optional interface of Elem to send file into a forum topic, and album elems are sent
+// into the topic of AlbumElem itself.
+type TopicElem interface {
+	Elem
+	// Topic returns ID of forum topic, which is the ID of its first message. Zero means the General topic.
+	Topic() int
+}
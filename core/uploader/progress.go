@@ -2,6 +2,7 @@ package uploader
 
 import (
 	"context"
+	"time"
 
 	"github.com/gotd/td/telegram/uploader"
 )
@@ -13,6 +14,18 @@ type Progress interface {
 	// TODO: OnLog to log something that is not an error but should be sent to the user
 }
 
+// SentProgress is an optional interface of Progress, which is notified with the sent
+// message after elem is uploaded, and before OnDone is called.
+type SentProgress interface {
+	OnSent(elem Elem, msg SentMessage)
+}
+
+// SentMessage is the message sent with uploaded elem.
+type SentMessage struct {
+	ID   int
+	Date time.Time // zero if not returned by Telegram
+}
+
 type ProgressState struct {
 	Uploaded int64
 	Total    int64
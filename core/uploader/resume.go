@@ -0,0 +1,307 @@
+package uploader
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/multierr"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/storage/keygen"
+)
+
+// bigFileSize is the minimum size of files uploaded by upload.saveBigFilePart,
+// refer to https://core.telegram.org/api/files#uploading-files
+const bigFileSize = 10 * 1024 * 1024
+
+const (
+	// resumeTTL is the max age of resume state, as uploaded parts are only kept by Telegram for a while
+	resumeTTL = 24 * time.Hour
+	// resumeSaveInterval throttles persisting of resume state
+	resumeSaveInterval = time.Second
+)
+
+// errResumeMismatch is returned when content of acknowledged parts is changed since last upload
+var errResumeMismatch = errors.New("file changed since last upload")
+
+// resumeState is the persisted progress of a big file upload
+type resumeState struct {
+	ID       int64          `json:"id"`
+	PartSize int            `json:"part_size"`
+	Parts    int            `json:"parts"`
+	Acked    map[int]uint32 `json:"acked"` // part -> crc32 of part content
+	Updated  time.Time      `json:"updated"`
+}
+
+// resumer records acknowledged parts of an upload to storage by fingerprint of file
+type resumer struct {
+	store    storage.Storage
+	key      string
+	partSize int
+
+	mu    sync.Mutex
+	state resumeState
+	saved time.Time
+}
+
+func resumeKey(fingerprint string) string {
+	return keygen.New("upload", "resume", fingerprint)
+}
+
+// fingerprint identifies file by name, size and content of the last and first parts,
+// which is cheap for big files. Content of acknowledged parts is still verified when resuming.
+//
+// The last part is read first, so streams which can't seek fail before being consumed.
+func fingerprint(f File) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(f.Name()))
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(f.Size())))
+
+	for _, offset := range []int64{max(f.Size()-MaxPartSize, 0), 0} {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return "", errors.Wrap(err, "seek file")
+		}
+		if _, err := io.CopyN(h, f, MaxPartSize); err != nil && !errors.Is(err, io.EOF) {
+			return "", errors.Wrap(err, "read file")
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", errors.Wrap(err, "seek file")
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadResumer loads previous progress of f, or starts a new one if it's missing, expired or of other part size
+func loadResumer(ctx context.Context, store storage.Storage, f File, partSize int) (*resumer, error) {
+	fp, err := fingerprint(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "fingerprint")
+	}
+
+	r := &resumer{store: store, key: resumeKey(fp), partSize: partSize}
+
+	parts := int((f.Size() + int64(partSize) - 1) / int64(partSize))
+
+	data, err := store.Get(ctx, r.key)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+	case err != nil:
+		return nil, errors.Wrap(err, "get resume state")
+	default:
+		if err = json.Unmarshal(data, &r.state); err == nil &&
+			r.state.PartSize == partSize && r.state.Parts == parts &&
+			time.Since(r.state.Updated) < resumeTTL {
+			return r, nil
+		}
+	}
+
+	if err = r.reset(parts); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *resumer) reset(parts int) error {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return errors.Wrap(err, "generate file id")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state = resumeState{
+		ID:       int64(binary.LittleEndian.Uint64(id[:])),
+		PartSize: r.partSize,
+		Parts:    parts,
+		Acked:    make(map[int]uint32),
+	}
+	return nil
+}
+
+// acked reports whether part is acknowledged, and errResumeMismatch if its content is changed
+func (r *resumer) acked(part int, sum uint32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, ok := r.state.Acked[part]
+	if ok && prev != sum {
+		return false, errors.Wrapf(errResumeMismatch, "part %d", part)
+	}
+	return ok, nil
+}
+
+func (r *resumer) ack(ctx context.Context, part int, sum uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.Acked[part] = sum
+	if time.Since(r.saved) < resumeSaveInterval {
+		return nil
+	}
+	return r.saveLocked(ctx)
+}
+
+func (r *resumer) save(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.saveLocked(ctx)
+}
+
+func (r *resumer) saveLocked(ctx context.Context) error {
+	r.state.Updated = time.Now()
+	data, err := json.Marshal(r.state)
+	if err != nil {
+		return errors.Wrap(err, "marshal resume state")
+	}
+	if err = r.store.Set(ctx, r.key, data); err != nil {
+		return errors.Wrap(err, "save resume state")
+	}
+
+	r.saved = r.state.Updated
+	return nil
+}
+
+func (r *resumer) delete(ctx context.Context) error {
+	return r.store.Delete(ctx, r.key)
+}
+
+type filePart struct {
+	id  int
+	buf []byte
+	sum uint32
+}
+
+// uploadResumable uploads big file by parts, and skips parts acknowledged by previous uploads
+// of the same file, so that interrupted uploads are resumed instead of restarting from byte zero.
+func (u *Uploader) uploadResumable(ctx context.Context, elem Elem, r *resumer) (tg.InputFileClass, error) {
+	f := elem.File()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "seek file")
+	}
+
+	var (
+		uploaded   int64
+		uploadedMu sync.Mutex
+	)
+	report := func(n int) {
+		uploadedMu.Lock()
+		defer uploadedMu.Unlock()
+
+		uploaded += int64(n)
+		u.opts.Progress.OnUpload(elem, ProgressState{Uploaded: uploaded, Total: f.Size()})
+	}
+
+	threads := max(u.opts.Threads, 1)
+	wg, wgctx := errgroup.WithContext(ctx)
+	toSend := make(chan filePart, threads)
+
+	wg.Go(func() error {
+		defer close(toSend)
+
+		for i := 0; i < r.state.Parts; i++ {
+			buf := make([]byte, r.state.PartSize)
+			n, err := io.ReadFull(f, buf)
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return errors.Wrapf(err, "read part %d", i)
+			}
+			p := filePart{id: i, buf: buf[:n], sum: crc32.ChecksumIEEE(buf[:n])}
+
+			ok, err := r.acked(p.id, p.sum)
+			if err != nil {
+				return err
+			}
+			if ok {
+				report(n)
+				continue
+			}
+
+			select {
+			case toSend <- p:
+			case <-wgctx.Done():
+				return wgctx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < threads; i++ {
+		wg.Go(func() error {
+			for p := range toSend {
+				if err := u.opts.Limiter.WaitN(wgctx, len(p.buf)); err != nil {
+					return err
+				}
+				if err := u.savePart(wgctx, r.state.ID, r.state.Parts, p); err != nil {
+					return err
+				}
+				if err := r.ack(wgctx, p.id, p.sum); err != nil {
+					return err
+				}
+				report(len(p.buf))
+			}
+			return nil
+		})
+	}
+
+	if err := wg.Wait(); err != nil {
+		// keep progress for next retry, and the context may be already canceled
+		return nil, multierr.Append(err, r.save(context.WithoutCancel(ctx)))
+	}
+
+	return &tg.InputFileBig{
+		ID:    r.state.ID,
+		Parts: r.state.Parts,
+		Name:  f.Name(),
+	}, nil
+}
+
+// savePartDelay is the base delay between attempts of saving a part refused by Telegram, which is doubled per attempt
+var savePartDelay = 500 * time.Millisecond
+
+// savePart saves p, and retries at most Options.Retries times with backoff if Telegram refuses it
+func (u *Uploader) savePart(ctx context.Context, id int64, parts int, p filePart) error {
+	for attempt := 0; ; attempt++ {
+		ok, err := u.opts.Client.UploadSaveBigFilePart(ctx, &tg.UploadSaveBigFilePartRequest{
+			FileID:         id,
+			FilePart:       p.id,
+			FileTotalParts: parts,
+			Bytes:          p.buf,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "save part %d", p.id)
+		}
+		if ok {
+			return nil
+		}
+
+		// Telegram returns false if saving is failed, so we retry
+		if attempt >= u.opts.Retries {
+			return errors.Errorf("save part %d: refused by Telegram after %d attempts", p.id, attempt+1)
+		}
+		select {
+		case <-time.After(savePartDelay << min(attempt, 5)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// isPartsExpired reports whether err is caused by uploaded parts which are missing on Telegram side
+func isPartsExpired(err error) bool {
+	return tgerr.Is(err, "FILE_PART_MISSING", "FILE_PARTS_INVALID")
+}
@@ -0,0 +1,235 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/core/storage"
+)
+
+type memStorage struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func (s *memStorage) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.m[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *memStorage) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.m[key] = value
+	return nil
+}
+
+func (s *memStorage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.m, key)
+	return nil
+}
+
+type memFile struct {
+	*bytes.Reader
+	name string
+}
+
+func (f *memFile) Name() string { return f.name }
+
+type memElem struct{ file *memFile }
+
+func (e *memElem) File() File                 { return e.file }
+func (e *memElem) Thumb() (File, bool)        { return nil, false }
+func (e *memElem) To() tg.InputPeerClass      { return &tg.InputPeerSelf{} }
+func (e *memElem) AsPhoto() bool              { return false }
+func (e *memElem) reset(data []byte) *memElem { e.file.Reset(data); return e }
+
+type nopProgress struct{}
+
+func (nopProgress) OnAdd(Elem)                   {}
+func (nopProgress) OnUpload(Elem, ProgressState) {}
+func (nopProgress) OnDone(Elem, error)           {}
+
+// partsInvoker records saved parts, and fails the calls reported by fail
+type partsInvoker struct {
+	mu    sync.Mutex
+	calls int
+	fail  func(call int) bool
+	// refuse reports the calls which are answered with false
+	refuse func(call int) bool
+	saved  map[int64][]int // file id -> parts
+}
+
+func (i *partsInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	req, ok := input.(*tg.UploadSaveBigFilePartRequest)
+	if !ok {
+		return errors.Errorf("unexpected request %T", input)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.calls++
+	if i.fail != nil && i.fail(i.calls) {
+		return errors.New("network blip")
+	}
+	if i.refuse != nil && i.refuse(i.calls) {
+		output.(*tg.BoolBox).Bool = &tg.BoolFalse{}
+		return nil
+	}
+	i.saved[req.FileID] = append(i.saved[req.FileID], req.FilePart)
+
+	output.(*tg.BoolBox).Bool = &tg.BoolTrue{}
+	return nil
+}
+
+func TestUploadResumable(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, bigFileSize+3*MaxPartSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	elem := &memElem{file: &memFile{Reader: bytes.NewReader(data), name: "big.bin"}}
+	parts := (len(data) + MaxPartSize - 1) / MaxPartSize
+
+	store := &memStorage{m: map[string][]byte{}}
+	inv := &partsInvoker{fail: func(call int) bool { return call > 5 }, saved: map[int64][]int{}}
+	u := New(Options{Client: tg.NewClient(inv), Threads: 1, Progress: nopProgress{}, Resume: store})
+
+	// interrupted
+	r, err := loadResumer(ctx, store, elem.File(), MaxPartSize)
+	require.NoError(t, err)
+	_, err = u.uploadResumable(ctx, elem, r)
+	require.Error(t, err)
+	id := r.state.ID
+
+	// resumed by a new process, and only the rest parts are sent with the same file id
+	inv.fail = nil
+	r, err = loadResumer(ctx, store, elem.reset(data).File(), MaxPartSize)
+	require.NoError(t, err)
+	assert.Equal(t, id, r.state.ID)
+
+	f, err := u.uploadResumable(ctx, elem, r)
+	require.NoError(t, err)
+	assert.Equal(t, &tg.InputFileBig{ID: id, Parts: parts, Name: "big.bin"}, f)
+
+	sent := inv.saved[id]
+	assert.ElementsMatch(t, sent[:5], []int{0, 1, 2, 3, 4})
+	assert.Len(t, sent, parts, "acknowledged parts should not be sent again")
+
+	// content of acknowledged part changed
+	changed := bytes.Clone(data)
+	changed[MaxPartSize+1]++
+	_, err = u.uploadResumable(ctx, elem.reset(changed), r)
+	assert.ErrorIs(t, err, errResumeMismatch)
+
+	require.NoError(t, r.delete(ctx))
+	assert.Empty(t, store.m)
+}
+
+func TestUploadFile_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	data := make([]byte, bigFileSize+MaxPartSize)
+	elem := &memElem{file: &memFile{Reader: bytes.NewReader(data), name: "big.bin"}}
+
+	inv := &partsInvoker{fail: func(call int) bool { return call == 4 }, saved: map[int64][]int{}}
+	u := New(Options{
+		Client:   tg.NewClient(inv),
+		Threads:  2,
+		Progress: nopProgress{},
+		Resume:   &memStorage{m: map[string][]byte{}},
+		Retries:  1,
+	})
+
+	_, r, err := u.uploadFile(ctx, elem, nil)
+	require.NoError(t, err)
+
+	// the retry resumes the same upload, and each part is saved once
+	require.Len(t, inv.saved, 1)
+	expected := make([]int, 0, r.state.Parts)
+	for i := 0; i < r.state.Parts; i++ {
+		expected = append(expected, i)
+	}
+	assert.ElementsMatch(t, expected, inv.saved[r.state.ID])
+}
+
+func TestSavePart_Refused(t *testing.T) {
+	ctx := context.Background()
+	delay := savePartDelay
+	savePartDelay = time.Millisecond
+	t.Cleanup(func() { savePartDelay = delay })
+
+	part := filePart{id: 1, buf: []byte("part")}
+
+	// refused once, then saved by retry
+	inv := &partsInvoker{refuse: func(call int) bool { return call == 1 }, saved: map[int64][]int{}}
+	u := New(Options{Client: tg.NewClient(inv), Retries: 2})
+	require.NoError(t, u.savePart(ctx, 1, 2, part))
+	assert.Equal(t, 2, inv.calls)
+	assert.Equal(t, []int{1}, inv.saved[1])
+
+	// always refused, attempts are bounded
+	inv = &partsInvoker{refuse: func(int) bool { return true }, saved: map[int64][]int{}}
+	u = New(Options{Client: tg.NewClient(inv), Retries: 2})
+	assert.Error(t, u.savePart(ctx, 1, 2, part))
+	assert.Equal(t, 3, inv.calls)
+
+	// canceled while waiting
+	savePartDelay = time.Hour
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, u.savePart(cctx, 1, 2, part), context.DeadlineExceeded)
+}
+
+// streamMemFile only supports querying current offset, like a stdin stream
+type streamMemFile struct {
+	*memFile
+	read int64
+}
+
+func (f *streamMemFile) Read(p []byte) (int, error) {
+	n, err := f.memFile.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+func (f *streamMemFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.read, nil
+	}
+	return 0, errors.New("stream is not seekable")
+}
+
+func TestSeekable(t *testing.T) {
+	f := &memFile{Reader: bytes.NewReader([]byte("data")), name: "a.bin"}
+	_, err := f.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+
+	assert.True(t, seekable(f))
+	cur, err := f.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cur, "probe should restore offset")
+
+	assert.False(t, seekable(&streamMemFile{memFile: f}))
+}
@@ -11,8 +11,11 @@ import (
 	"github.com/gotd/td/telegram/message/styling"
 	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
+	"go.uber.org/multierr"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/util/bandwidth"
 	"github.com/iyear/tdl/core/util/fsutil"
 	"github.com/iyear/tdl/core/util/mediautil"
 )
@@ -20,6 +23,12 @@ import (
 // MaxPartSize refer to https://core.telegram.org/api/files#uploading-files
 const MaxPartSize = 512 * 1024
 
+// MaxFileSize is the max size of uploaded file of premium accounts(8000 parts), and other accounts are limited to its half.
+const MaxFileSize = 8000 * MaxPartSize
+
+// ErrInvalidPartSize is returned when Options.PartSize is not accepted by Telegram.
+var ErrInvalidPartSize = errors.New("invalid part size")
+
 type Uploader struct {
 	opts Options
 }
@@ -29,32 +38,75 @@ type Options struct {
 	Threads  int
 	Iter     Iter
 	Progress Progress
+	// Limiter caps total upload bandwidth, nil means unlimited. It can be shared with downloader.
+	Limiter *bandwidth.Limiter
+	// Resume persists acknowledged parts of big files keyed by file fingerprint, so interrupted
+	// uploads are resumed from the last acknowledged part, even after process restart. Nil means disabled.
+	Resume storage.Storage
+	// Retries is the max number of retries of uploading a file after failure, e.g. network blips,
+	// and also of saving each part of big files refused by Telegram.
+	Retries int
+	// PartSize is the size of each uploaded part, which must be divisible by 1KB and divide MaxPartSize(512KB).
+	// Zero means MaxPartSize, which needs the fewest requests.
+	PartSize int
 }
 
 func New(o Options) *Uploader {
 	return &Uploader{opts: o}
 }
 
+// ValidatePartSize reports ErrInvalidPartSize if size is not accepted by Telegram, and zero is valid as MaxPartSize.
+func ValidatePartSize(size int) error {
+	if size == 0 {
+		return nil
+	}
+	if size < 0 || size%1024 != 0 || MaxPartSize%size != 0 {
+		return errors.Wrapf(ErrInvalidPartSize, "%d bytes, must be divisible by 1KB and divide 512KB", size)
+	}
+	return nil
+}
+
+func (u *Uploader) partSize() int {
+	if u.opts.PartSize == 0 {
+		return MaxPartSize
+	}
+	return u.opts.PartSize
+}
+
 func (u *Uploader) Upload(ctx context.Context, limit int) error {
+	if err := ValidatePartSize(u.opts.PartSize); err != nil {
+		return err
+	}
+
 	wg, wgctx := errgroup.WithContext(ctx)
 	wg.SetLimit(limit)
 
 	for u.opts.Iter.Next(wgctx) {
 		elem := u.opts.Iter.Value()
 
-		wg.Go(func() (rerr error) {
-			u.opts.Progress.OnAdd(elem)
-			defer func() { u.opts.Progress.OnDone(elem, rerr) }()
-
-			if err := u.upload(wgctx, elem); err != nil {
+		if album, ok := elem.(AlbumElem); ok {
+			wg.Go(func() error {
 				// canceled by user, so we directly return error to stop all
-				if errors.Is(err, context.Canceled) {
-					return errors.Wrap(err, "upload")
+				if err := u.uploadAlbum(wgctx, album); errors.Is(err, context.Canceled) {
+					return errors.Wrap(err, "upload album")
 				}
+				return nil
+			})
+			continue
+		}
+
+		wg.Go(func() error {
+			u.opts.Progress.OnAdd(elem)
+
+			err := u.upload(wgctx, elem)
+			u.opts.Progress.OnDone(elem, err)
 
-				// don't return error, just log it
+			// canceled by user, so we directly return error to stop all
+			if errors.Is(err, context.Canceled) {
+				return errors.Wrap(err, "upload")
 			}
 
+			// don't return error, just log it by progress
 			return nil
 		})
 	}
@@ -73,34 +125,81 @@ func (u *Uploader) upload(ctx context.Context, elem Elem) error {
 	default:
 	}
 
+	media, r, err := u.uploadMedia(ctx, elem)
+	if err != nil {
+		return err
+	}
+
+	updates, err := u.sender(elem).Media(ctx, media)
+	if err = u.afterSend(ctx, err, r); err != nil {
+		return errors.Wrap(err, "send message")
+	}
+
+	if sp, ok := u.opts.Progress.(SentProgress); ok {
+		if msg, ok := sentMessage(updates); ok {
+			sp.OnSent(elem, msg)
+		}
+	}
+
+	return nil
+}
+
+// sender returns message builder to peer of elem, which replies to topic of TopicElem if set
+func (u *Uploader) sender(elem Elem) *message.Builder {
+	b := &message.NewSender(u.opts.Client).To(elem.To()).Builder
+	if te, ok := elem.(TopicElem); ok && te.Topic() > 0 {
+		b = b.Reply(te.Topic())
+	}
+	return b
+}
+
+// afterSend cleans up resume states of sent files, and returns err of sending
+func (u *Uploader) afterSend(ctx context.Context, err error, resumers ...*resumer) error {
+	if err != nil && !isPartsExpired(err) {
+		return err
+	}
+
+	// uploaded parts are consumed or expired, so the file must be uploaded from scratch next time
+	for _, r := range resumers {
+		if r != nil {
+			err = multierr.Append(err, r.delete(context.WithoutCancel(ctx)))
+		}
+	}
+	return err
+}
+
+// uploadMedia uploads file and thumbnail of elem, and returns media to send
+func (u *Uploader) uploadMedia(ctx context.Context, elem Elem) (message.MultiMediaOption, *resumer, error) {
 	up := uploader.NewUploader(u.opts.Client).
-		WithPartSize(MaxPartSize).
+		WithPartSize(u.partSize()).
 		WithThreads(u.opts.Threads).
 		WithProgress(&wrapProcess{
 			elem:    elem,
 			process: u.opts.Progress,
 		})
 
-	f, err := up.Upload(ctx, uploader.NewUpload(elem.File().Name(), elem.File(), elem.File().Size()))
+	f, r, err := u.uploadFile(ctx, elem, up)
 	if err != nil {
-		return errors.Wrap(err, "upload file")
+		return nil, nil, errors.Wrap(err, "upload file")
 	}
 
-	if _, err = elem.File().Seek(0, io.SeekStart); err != nil {
-		return errors.Wrap(err, "seek file")
-	}
-	mime, err := mimetype.DetectReader(elem.File())
+	mime, err := detectMIME(elem.File())
 	if err != nil {
-		return errors.Wrap(err, "detect mime")
+		return nil, nil, errors.Wrap(err, "detect mime")
 	}
 
 	caption := []message.StyledTextOption{
 		styling.Code(elem.File().Name()),
 		styling.Plain(" - "),
-		styling.Code(mime.String()),
+		styling.Code(mime),
+	}
+	if ce, ok := elem.(CaptionElem); ok {
+		if text, ok := ce.Caption(); ok {
+			caption = []message.StyledTextOption{styling.Plain(text)}
+		}
 	}
 	doc := message.UploadedDocument(f, caption...).
-		MIME(mime.String()).
+		MIME(mime).
 		Filename(elem.File().Name())
 	// upload thumbnail TODO(iyear): maybe still unavailable
 	if thumb, ok := elem.Thumb(); ok {
@@ -110,39 +209,162 @@ func (u *Uploader) upload(ctx context.Context, elem Elem) error {
 		}
 	}
 
-	var media message.MediaOption = doc
+	var media message.MultiMediaOption = doc
+
+	if de, ok := elem.(DocumentElem); ok && de.AsDocument() {
+		return doc.ForceFile(true), r, nil
+	}
 
 	switch {
-	case mediautil.IsImage(mime.String()) && elem.AsPhoto():
+	case mediautil.IsImage(mime) && elem.AsPhoto():
 		// webp should be uploaded as document
-		if mime.String() == "image/webp" {
+		if mime == "image/webp" {
 			break
 		}
 		// upload as photo
 		media = message.UploadedPhoto(f, caption...)
-	case mediautil.IsVideo(mime.String()):
-		// reset reader
-		if _, err = elem.File().Seek(0, io.SeekStart); err != nil {
-			return errors.Wrap(err, "seek file")
+	case mediautil.IsVideo(mime):
+		if info, ok := videoInfo(elem); ok {
+			video := doc.Video().
+				Duration(info.Duration).
+				Resolution(info.Width, info.Height)
+			if info.SupportsStreaming {
+				video = video.SupportsStreaming()
+			}
+			media = video
 		}
-		if dur, w, h, err := mediautil.GetMP4Info(elem.File()); err == nil {
+	case mediautil.IsAudio(mime):
+		media = doc.Audio().Title(fsutil.GetNameWithoutExt(elem.File().Name()))
+	}
+
+	return media, r, nil
+}
+
+// videoInfo returns attributes of video elem provided by VideoElem, and unknown fields are parsed from
+// MP4 header, which also marks streaming support. False means dimensions are unknown, and it should be uploaded as document.
+func videoInfo(elem Elem) (VideoInfo, bool) {
+	var info VideoInfo
+	if ve, ok := elem.(VideoElem); ok {
+		info, _ = ve.Video()
+	}
+
+	if info.Duration == 0 || info.Width == 0 || info.Height == 0 || !info.SupportsStreaming {
+		// reset reader, and streams which are not seekable are uploaded without parsed attributes
+		if _, err := elem.File().Seek(0, io.SeekStart); err == nil {
 			// #132. There may be some errors, but we can still upload the file
-			media = doc.Video().
-				Duration(time.Duration(dur)*time.Second).
-				Resolution(w, h).
-				SupportsStreaming()
+			if dur, w, h, err := mediautil.GetMP4Info(elem.File()); err == nil {
+				info = info.Merge(VideoInfo{
+					Duration:          time.Duration(dur) * time.Second,
+					Width:             w,
+					Height:            h,
+					SupportsStreaming: true,
+				})
+			}
+		}
+	}
+
+	return info, info.Width > 0 && info.Height > 0
+}
+
+// uploadFile uploads file of elem with retries, and returns resumer if the file is uploaded resumably.
+func (u *Uploader) uploadFile(ctx context.Context, elem Elem, up *uploader.Uploader) (tg.InputFileClass, *resumer, error) {
+	var (
+		r   *resumer
+		err error
+	)
+	if u.opts.Resume != nil && elem.File().Size() > bigFileSize && seekable(elem.File()) {
+		if r, err = loadResumer(ctx, u.opts.Resume, elem.File(), u.partSize()); err != nil {
+			return nil, nil, errors.Wrap(err, "load resume state")
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		var f tg.InputFileClass
+		if r != nil {
+			f, err = u.uploadResumable(ctx, elem, r)
+			if errors.Is(err, errResumeMismatch) {
+				// stale progress of changed file, restart from scratch
+				if err = r.reset(r.state.Parts); err != nil {
+					return nil, nil, err
+				}
+				f, err = u.uploadResumable(ctx, elem, r)
+			}
+		} else {
+			f, err = up.Upload(ctx, uploader.NewUpload(elem.File().Name(),
+				u.opts.Limiter.Reader(ctx, elem.File()), elem.File().Size()))
+		}
+		if err == nil {
+			return f, r, nil
+		}
+
+		if attempt >= u.opts.Retries || ctx.Err() != nil {
+			return nil, nil, err
+		}
+		// retry needs to read file again
+		if _, serr := elem.File().Seek(0, io.SeekStart); serr != nil {
+			return nil, nil, err
 		}
-	case mediautil.IsAudio(mime.String()):
-		media = doc.Audio().Title(fsutil.GetNameWithoutExt(elem.File().Name()))
 	}
+}
 
-	_, err = message.NewSender(u.opts.Client).
-		WithUploader(up).
-		To(elem.To()).
-		Media(ctx, media)
+// seekable reports whether f can be read again from any offset.
+// Streams may accept querying current offset only, so it probes with a real seek round trip.
+func seekable(f File) bool {
+	cur, err := f.Seek(0, io.SeekCurrent)
 	if err != nil {
-		return errors.Wrap(err, "send message")
+		return false
 	}
+	if _, err = f.Seek(0, io.SeekEnd); err != nil {
+		return false
+	}
+	_, err = f.Seek(cur, io.SeekStart)
+	return err == nil
+}
 
-	return nil
+// sentMessage extracts the new message from updates of sending
+func sentMessage(updates tg.UpdatesClass) (SentMessage, bool) {
+	var list []tg.UpdateClass
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		return SentMessage{ID: u.ID, Date: time.Unix(int64(u.Date), 0)}, true
+	case *tg.Updates:
+		list = u.Updates
+	case *tg.UpdatesCombined:
+		list = u.Updates
+	}
+
+	for _, update := range list {
+		switch u := update.(type) {
+		case *tg.UpdateNewMessage:
+			return newSentMessage(u.Message), true
+		case *tg.UpdateNewChannelMessage:
+			return newSentMessage(u.Message), true
+		}
+	}
+
+	return SentMessage{}, false
+}
+
+func newSentMessage(msg tg.MessageClass) SentMessage {
+	sent := SentMessage{ID: msg.GetID()}
+	if m, ok := msg.(interface{ GetDate() int }); ok {
+		sent.Date = time.Unix(int64(m.GetDate()), 0)
+	}
+	return sent
+}
+
+func detectMIME(f File) (string, error) {
+	if mf, ok := f.(MIMEFile); ok && mf.MIME() != "" {
+		return mf.MIME(), nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", errors.Wrap(err, "seek file")
+	}
+	mime, err := mimetype.DetectReader(f)
+	if err != nil {
+		return "", err
+	}
+
+	return mime.String(), nil
 }
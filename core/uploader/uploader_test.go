@@ -0,0 +1,80 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpload_InvalidPartSize(t *testing.T) {
+	for _, size := range []int{0, 1024, 128 * 1024, MaxPartSize} {
+		assert.NoError(t, ValidatePartSize(size), size)
+	}
+
+	for _, size := range []int{-1024, 1000, 3 * 1024, 1024 * 1024} {
+		assert.ErrorIs(t, ValidatePartSize(size), ErrInvalidPartSize, size)
+
+		// nil client and iter are never used
+		err := New(Options{PartSize: size}).Upload(context.Background(), 1)
+		assert.ErrorIs(t, err, ErrInvalidPartSize, size)
+	}
+}
+
+type videoElem struct {
+	*memElem
+	info *VideoInfo
+}
+
+func (e *videoElem) Video() (VideoInfo, bool) {
+	if e.info == nil {
+		return VideoInfo{}, false
+	}
+	return *e.info, true
+}
+
+func TestVideoInfo(t *testing.T) {
+	newElem := func(info *VideoInfo) Elem {
+		// not a MP4 file, so that attributes can't be parsed from header
+		file := &memFile{Reader: bytes.NewReader([]byte("not a video")), name: "video.mkv"}
+		return &videoElem{memElem: &memElem{file: file}, info: info}
+	}
+
+	full := VideoInfo{Duration: 90 * time.Second, Width: 1920, Height: 1080, SupportsStreaming: true}
+	info, ok := videoInfo(newElem(&full))
+	assert.True(t, ok)
+	assert.Equal(t, full, info)
+
+	// dimensions are required to be sent as video
+	_, ok = videoInfo(newElem(&VideoInfo{Duration: time.Minute}))
+	assert.False(t, ok)
+	_, ok = videoInfo(newElem(nil))
+	assert.False(t, ok)
+
+	// duration is optional
+	info, ok = videoInfo(newElem(&VideoInfo{Width: 640, Height: 480}))
+	assert.True(t, ok)
+	assert.Equal(t, VideoInfo{Width: 640, Height: 480}, info)
+
+	// header is still parsed for streaming support if explicit attributes are complete
+	file := &memFile{Reader: bytes.NewReader([]byte("not a video")), name: "video.mp4"}
+	explicit := VideoInfo{Duration: time.Minute, Width: 640, Height: 480}
+	info, ok = videoInfo(&videoElem{memElem: &memElem{file: file}, info: &explicit})
+	assert.True(t, ok)
+	assert.Equal(t, explicit, info)
+	assert.Less(t, file.Len(), len("not a video"), "header should be read")
+}
+
+func TestVideoInfo_Merge(t *testing.T) {
+	probed := VideoInfo{Duration: time.Minute, Width: 1280, Height: 720, SupportsStreaming: true}
+
+	assert.Equal(t, probed, VideoInfo{}.Merge(probed))
+	assert.Equal(t,
+		VideoInfo{Duration: 2 * time.Minute, Width: 1280, Height: 720, SupportsStreaming: true},
+		VideoInfo{Duration: 2 * time.Minute}.Merge(probed))
+	assert.Equal(t,
+		VideoInfo{Duration: time.Minute, Width: 640, Height: 480},
+		VideoInfo{Width: 640, Height: 480}.Merge(VideoInfo{Duration: time.Minute}))
+}
@@ -0,0 +1,68 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter caps the total throughput of all readers and writers sharing it by token bucket.
+// Nil Limiter means unlimited.
+type Limiter struct {
+	l *rate.Limiter
+}
+
+// New returns Limiter of bytesPerSec, and nil if bytesPerSec is not positive.
+func New(bytesPerSec int64) *Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+
+	// burst of one second allows the first part to be transferred immediately
+	return &Limiter{l: rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec))}
+}
+
+// WaitN blocks until n bytes are allowed to be transferred or ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	// rate.Limiter doesn't allow waiting more than burst at once
+	for n > 0 {
+		chunk := min(n, l.l.Burst())
+		if err := l.l.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+
+	return nil
+}
+
+// Reader wraps r so that reading is limited by l.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &reader{ctx: ctx, r: r, l: l}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
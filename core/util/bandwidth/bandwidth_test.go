@@ -0,0 +1,57 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	const rate = 100 * 1024 // 100KB/s
+
+	l := New(rate)
+
+	// 4 concurrent readers share the same cap: 1 second burst + 2 seconds
+	const total = 3 * rate
+	start := time.Now()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			n, err := io.Copy(io.Discard, l.Reader(context.Background(), bytes.NewReader(make([]byte, total/4))))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(total/4), n)
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 1900*time.Millisecond, "throughput exceeds the rate")
+	assert.Less(t, elapsed, 4*time.Second)
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	assert.Nil(t, New(0))
+
+	var l *Limiter
+	r := bytes.NewReader(make([]byte, 10))
+	assert.Equal(t, io.Reader(r), l.Reader(context.Background(), r))
+	assert.NoError(t, l.WaitN(context.Background(), 1<<30))
+}
+
+func TestLimiter_Cancel(t *testing.T) {
+	l := New(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.Error(t, l.WaitN(ctx, 100))
+}
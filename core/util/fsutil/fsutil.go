@@ -1,9 +1,15 @@
 package fsutil
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
 )
 
 func GetNameWithoutExt(path string) string {
@@ -15,10 +21,28 @@ func PathExists(path string) bool {
 	return err == nil || os.IsExist(err)
 }
 
-// AddPrefixDot add prefix dot if extension don't have
+// AddPrefixDot add prefix dot if extension don't have, and empty extension is kept as is
 func AddPrefixDot(ext string) string {
+	if ext == "" {
+		return ""
+	}
 	if !strings.HasPrefix(ext, ".") {
 		return "." + ext
 	}
 	return ext
 }
+
+// HashFile returns hex sha256 of file content
+func HashFile(path string) (_ string, rerr error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "open file")
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(f))
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", errors.Wrap(err, "hash file")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
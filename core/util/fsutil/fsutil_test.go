@@ -0,0 +1,42 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddPrefixDot(t *testing.T) {
+	tests := []struct {
+		ext      string
+		expected string
+	}{
+		{ext: "mp4", expected: ".mp4"},
+		{ext: ".mp4", expected: ".mp4"},
+		{ext: "", expected: ""},
+		{ext: "tar.gz", expected: ".tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			assert.Equal(t, tt.expected, AddPrefixDot(tt.ext))
+			// idempotent
+			assert.Equal(t, tt.expected, AddPrefixDot(AddPrefixDot(tt.ext)))
+		})
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o644))
+
+	hash, err := HashFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hash)
+
+	_, err = HashFile(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -1,12 +1,28 @@
 package logutil
 
 import (
+	"github.com/go-faster/errors"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// Log formats of New. Child loggers, e.g. the "td" logger of tclient, share the same encoder.
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// Formats are all available log formats.
+var Formats = []string{FormatConsole, FormatJSON}
+
 func New(level zapcore.LevelEnabler, path string) *zap.Logger {
+	l, _ := NewWithFormat(level, path, FormatConsole)
+	return l
+}
+
+// NewWithFormat is like New, but encodes logs in given format, e.g. FormatJSON for log aggregators.
+func NewWithFormat(level zapcore.LevelEnabler, path, format string) (*zap.Logger, error) {
 	rotate := &lumberjack.Logger{
 		Filename:   path,
 		MaxSize:    10,
@@ -16,12 +32,27 @@ func New(level zapcore.LevelEnabler, path string) *zap.Logger {
 		Compress:   true,
 	}
 
-	writer := zapcore.AddSync(rotate)
+	encoder, err := newEncoder(format)
+	if err != nil {
+		return nil, err
+	}
 
-	config := zap.NewDevelopmentEncoderConfig()
-	config.EncodeTime = zapcore.TimeEncoderOfLayout("2006-01-02 15:04:05")
-	config.EncodeLevel = zapcore.CapitalLevelEncoder
+	core := zapcore.NewCore(encoder, zapcore.AddSync(rotate), level)
+	return zap.New(core, zap.AddCaller()), nil
+}
 
-	core := zapcore.NewCore(zapcore.NewConsoleEncoder(config), writer, level)
-	return zap.New(core, zap.AddCaller())
+func newEncoder(format string) (zapcore.Encoder, error) {
+	switch format {
+	case FormatConsole, "":
+		config := zap.NewDevelopmentEncoderConfig()
+		config.EncodeTime = zapcore.TimeEncoderOfLayout("2006-01-02 15:04:05")
+		config.EncodeLevel = zapcore.CapitalLevelEncoder
+		return zapcore.NewConsoleEncoder(config), nil
+	case FormatJSON:
+		config := zap.NewProductionEncoderConfig()
+		config.EncodeTime = zapcore.ISO8601TimeEncoder
+		return zapcore.NewJSONEncoder(config), nil
+	default:
+		return nil, errors.Errorf("unknown log format %q, available: %v", format, Formats)
+	}
 }
@@ -0,0 +1,39 @@
+package logutil
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNewWithFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+
+	l, err := NewWithFormat(zap.InfoLevel, path, FormatJSON)
+	require.NoError(t, err)
+
+	l.Debug("hidden")
+	l.Named("td").Named("account").Info("slow rpc", zap.String("method", "messages.getHistory"))
+	require.NoError(t, l.Sync())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 1)
+
+	entry := make(map[string]any)
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "td.account", entry["logger"])
+	assert.Equal(t, "slow rpc", entry["msg"])
+	assert.Equal(t, "messages.getHistory", entry["method"])
+
+	_, err = NewWithFormat(zap.InfoLevel, path, "xml")
+	assert.Error(t, err)
+}
@@ -1,25 +1,108 @@
 package netutil
 
 import (
+	"context"
+	"net"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-faster/errors"
-	"github.com/iyear/connectproxy"
 	"golang.org/x/net/proxy"
 )
 
 func init() {
-	connectproxy.Register(&connectproxy.Config{
-		InsecureSkipVerify: true,
-	})
+	proxy.RegisterDialerType("http", newConnectDialer)
+	proxy.RegisterDialerType("https", newConnectDialer)
 }
 
+// ErrProxyUnresolvable is returned when host of proxy can't be resolved, which is usually a typo or DNS issue.
+var ErrProxyUnresolvable = errors.New("proxy host can't be resolved")
+
+// resolveTimeout is the timeout of resolving proxy host eagerly
+const resolveTimeout = 5 * time.Second
+
+// lookupHost is the seam for tests
+var lookupHost = net.DefaultResolver.LookupHost
+
+// ProxySeparator separates hops of chained proxies, e.g. http://corp:8080,socks5://remote:1080
+const ProxySeparator = ","
+
+// ErrUnsupportedProxyScheme is returned when scheme of proxy url is not one of ProxySchemes, e.g. socks4 or typos.
+var ErrUnsupportedProxyScheme = errors.New("unsupported proxy scheme")
+
+// ProxySchemes are schemes supported by NewProxy, which can also tunnel connections to next hop of proxy chain.
+// WebSocket proxies are served by NewWebsocketResolver instead.
+var ProxySchemes = []string{"socks5", "socks5h", "http", "https"}
+
+// NewProxy returns dialer of proxy url. Proxies can be chained by ProxySeparator, and each
+// hop is dialed through the previous one, so the first hop is the nearest to local.
 func NewProxy(proxyUrl string) (proxy.ContextDialer, error) {
+	return NewProxyWithForward(proxyUrl, proxy.Direct)
+}
+
+// NewProxyWithForward is like NewProxy, but connects to proxy server(first hop) by forward dialer,
+// e.g. a net.Dialer with custom keepalive.
+//
+// Host of the first hop is resolved eagerly, and ErrProxyUnresolvable is returned if it fails.
+// Hosts of the following hops are resolved by previous hops, and target addresses are still resolved lazily.
+func NewProxyWithForward(proxyUrl string, forward proxy.Dialer) (proxy.ContextDialer, error) {
+	hops := strings.Split(proxyUrl, ProxySeparator)
+
+	// validate all hops before resolving and building, so that config errors are reported immediately
+	for i, hop := range hops {
+		if err := checkScheme(strings.TrimSpace(hop)); err != nil {
+			if len(hops) == 1 {
+				return nil, err
+			}
+			return nil, errors.Wrapf(err, "hop %d of proxy chain", i)
+		}
+	}
+
+	if err := resolveProxy(strings.TrimSpace(hops[0])); err != nil {
+		return nil, err
+	}
+
+	if len(hops) == 1 {
+		return newHop(proxyUrl, forward)
+	}
+
+	var dialer proxy.ContextDialer
+	for i, hop := range hops {
+		d, err := newHop(strings.TrimSpace(hop), forward)
+		if err != nil {
+			return nil, errors.Wrapf(err, "hop %d of proxy chain", i)
+		}
+
+		fw, ok := d.(proxy.Dialer)
+		if !ok {
+			return nil, errors.Errorf("hop %d of proxy chain: dialer can't be forwarded: %T", i, d)
+		}
+		dialer, forward = d, fw
+	}
+
+	return dialer, nil
+}
+
+// checkScheme returns ErrUnsupportedProxyScheme if scheme of proxyUrl is not one of ProxySchemes
+func checkScheme(proxyUrl string) error {
+	u, err := url.Parse(proxyUrl)
+	if err != nil {
+		return errors.Wrap(err, "parse proxy url")
+	}
+	if !slices.Contains(ProxySchemes, u.Scheme) {
+		return errors.Wrapf(ErrUnsupportedProxyScheme, "scheme %q, available: %s", u.Scheme, strings.Join(ProxySchemes, ", "))
+	}
+	return nil
+}
+
+func newHop(proxyUrl string, forward proxy.Dialer) (proxy.ContextDialer, error) {
 	u, err := url.Parse(proxyUrl)
 	if err != nil {
 		return nil, errors.Wrap(err, "parse proxy url")
 	}
-	dialer, err := proxy.FromURL(u, proxy.Direct)
+	dialer, err := proxy.FromURL(u, forward)
 	if err != nil {
 		return nil, errors.Wrap(err, "proxy from url")
 	}
@@ -30,3 +113,28 @@ func NewProxy(proxyUrl string) (proxy.ContextDialer, error) {
 
 	return nil, errors.New("proxy dialer is not ContextDialer")
 }
+
+func resolveProxy(proxyUrl string) error {
+	u, err := url.Parse(proxyUrl)
+	if err != nil {
+		return errors.Wrap(err, "parse proxy url")
+	}
+
+	host := u.Hostname()
+	if host == "" || net.ParseIP(host) != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	if _, err = lookupHost(ctx, host); err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return errors.Wrapf(ErrProxyUnresolvable, "host %q: %v", host, dnsErr)
+		}
+		return errors.Wrapf(err, "resolve proxy host %q", host)
+	}
+
+	return nil
+}
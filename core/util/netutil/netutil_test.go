@@ -0,0 +1,379 @@
+package netutil
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProxy is an HTTP CONNECT proxy requiring basic auth, which echoes tunneled data back
+func fakeProxy(t *testing.T, user, password string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	return serveFakeProxy(t, l, user, password)
+}
+
+// fakeTLSProxy is like fakeProxy, but serves with self-signed certificate
+func fakeTLSProxy(t *testing.T, user, password string) string {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	config := srv.TLS.Clone()
+	srv.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+
+	return serveFakeProxy(t, l, user, password)
+}
+
+func serveFakeProxy(t *testing.T, l net.Listener, user, password string) string {
+	t.Cleanup(func() { _ = l.Close() })
+
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer func() { _ = conn.Close() }()
+
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != expected {
+					_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic\r\n\r\n")
+					return
+				}
+
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				_, _ = io.Copy(conn, br)
+			}(conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestNewProxy_HTTPAuth(t *testing.T) {
+	addr := fakeProxy(t, "user", "p@ss")
+
+	tests := []struct {
+		name    string
+		url     string
+		authErr bool
+	}{
+		{name: "valid", url: "http://user:p%40ss@" + addr, authErr: false},
+		{name: "invalid", url: "http://user:wrong@" + addr, authErr: true},
+		{name: "missing", url: "http://" + addr, authErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewProxy(tt.url)
+			require.NoError(t, err)
+
+			conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+			if tt.authErr {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrProxyAuth))
+				return
+			}
+			require.NoError(t, err)
+			defer func() { _ = conn.Close() }()
+
+			_, err = io.WriteString(conn, "ping")
+			require.NoError(t, err)
+
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(conn, buf)
+			require.NoError(t, err)
+			assert.Equal(t, "ping", string(buf))
+		})
+	}
+}
+
+func TestNewProxy_HTTPSVerify(t *testing.T) {
+	addr := fakeTLSProxy(t, "user", "pass")
+
+	tests := []struct {
+		name string
+		url  string
+		err  bool
+	}{
+		{name: "verify", url: "https://user:pass@" + addr, err: true},
+		{name: "insecure", url: "https://user:pass@" + addr + "?insecure=true", err: false},
+		{name: "secure", url: "https://user:pass@" + addr + "?insecure=false", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewProxy(tt.url)
+			require.NoError(t, err)
+
+			conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+			if tt.err {
+				var certErr *tls.CertificateVerificationError
+				require.True(t, errors.As(err, &certErr), "expected certificate error, got %v", err)
+				return
+			}
+			require.NoError(t, err)
+			_ = conn.Close()
+		})
+	}
+
+	_, err := NewProxy("https://" + addr + "?insecure=maybe")
+	assert.Error(t, err)
+}
+
+func TestIsWebsocket(t *testing.T) {
+	assert.True(t, IsWebsocket("ws://localhost:8080/apiws"))
+	assert.True(t, IsWebsocket("wss://example.com/apiws/{dc}"))
+	assert.False(t, IsWebsocket("socks5://localhost:1080"))
+	assert.False(t, IsWebsocket(""))
+}
+
+func TestWebsocketResolver(t *testing.T) {
+	paths := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	_, err := NewWebsocketResolver(srv.URL)
+	assert.Error(t, err)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/apiws/" + DCPlaceholder
+	r, err := NewWebsocketResolver(wsURL)
+	require.NoError(t, err)
+
+	_, err = r.Primary(context.Background(), 2, dcs.Prod())
+	assert.Error(t, err) // not a real websocket server
+	assert.Equal(t, "/apiws/2", <-paths)
+}
+
+// forwardProxy is an HTTP CONNECT proxy which tunnels to requested hosts, and records them
+func forwardProxy(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	hosts := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer func() { _ = conn.Close() }()
+
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				hosts <- req.Host
+
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer func() { _ = upstream.Close() }()
+
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go func() { _, _ = io.Copy(upstream, br) }()
+				_, _ = io.Copy(conn, upstream)
+			}(conn)
+		}
+	}()
+
+	return l.Addr().String(), hosts
+}
+
+func TestNewProxy_Chain(t *testing.T) {
+	first, hosts := forwardProxy(t)
+	last := fakeProxy(t, "user", "pass")
+
+	d, err := NewProxy("http://" + first + ", http://user:pass@" + last)
+	require.NoError(t, err)
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	assert.Equal(t, last, <-hosts, "first hop should tunnel to the last hop")
+
+	_, err = io.WriteString(conn, "ping")
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = NewProxy("http://" + first + ",ws://example.com/apiws")
+	assert.ErrorIs(t, err, ErrUnsupportedProxyScheme)
+	assert.ErrorContains(t, err, `hop 1 of proxy chain: scheme "ws"`)
+
+	_, err = NewProxy("http://" + first + ",socks5://localhost:1080")
+	assert.NoError(t, err)
+}
+
+func TestNewProxy_Unresolvable(t *testing.T) {
+	lookups := make([]string, 0)
+	lookupHost = func(_ context.Context, host string) ([]string, error) {
+		lookups = append(lookups, host)
+		if host == "typo.invalid" {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+	t.Cleanup(func() { lookupHost = net.DefaultResolver.LookupHost })
+
+	_, err := NewProxy("socks5://typo.invalid:1080")
+	require.ErrorIs(t, err, ErrProxyUnresolvable)
+	assert.ErrorContains(t, err, `"typo.invalid"`)
+
+	// only the first hop is resolved locally
+	_, err = NewProxy("http://corp.example:8080,socks5://typo.invalid:1080")
+	require.NoError(t, err)
+
+	// IP is not resolved
+	_, err = NewProxy("socks5://127.0.0.1:1080")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"typo.invalid", "corp.example"}, lookups)
+}
+
+func TestNewProxy_Scheme(t *testing.T) {
+	lookupHost = func(context.Context, string) ([]string, error) { return []string{"127.0.0.1"}, nil }
+	t.Cleanup(func() { lookupHost = net.DefaultResolver.LookupHost })
+
+	tests := []struct {
+		url       string
+		supported bool
+	}{
+		{url: "socks5://localhost:1080", supported: true},
+		{url: "socks5h://localhost:1080", supported: true},
+		{url: "http://localhost:8080", supported: true},
+		{url: "https://localhost:8443", supported: true},
+		{url: "SOCKS5://localhost:1080", supported: true},
+		{url: "socks4://localhost:1080"},
+		{url: "sock5://localhost:1080"},
+		{url: "ftp://localhost:21"},
+		{url: "ws://localhost/apiws"},
+		{url: "localhost:1080"},
+		{url: "http://localhost:8080,socks4://localhost:1080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := NewProxy(tt.url)
+			if tt.supported {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrUnsupportedProxyScheme)
+			assert.ErrorContains(t, err, "available: socks5, socks5h, http, https")
+		})
+	}
+}
+
+// fakeSocks5UDP is a no-auth SOCKS5 proxy which only accepts UDP ASSOCIATE, and echoes datagrams
+// back with the same header
+func fakeSocks5UDP(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = relay.Close() })
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := relay.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_, _ = relay.WriteToUDP(buf[:n], addr)
+		}
+	}()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		greeting := make([]byte, 3)
+		if _, err = io.ReadFull(conn, greeting); err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte{socks5Version, socks5NoAuth})
+
+		req := make([]byte, 10)
+		if _, err = io.ReadFull(conn, req); err != nil || req[1] != socks5UDPAssociate {
+			return
+		}
+		resp := []byte{socks5Version, 0x00, 0x00, socks5IPv4, 0, 0, 0, 0}
+		resp = binary.BigEndian.AppendUint16(resp, uint16(relay.LocalAddr().(*net.UDPAddr).Port))
+		_, _ = conn.Write(resp)
+
+		_, _ = io.Copy(io.Discard, conn) // keep association until client closes
+	}()
+
+	return l.Addr().String()
+}
+
+func TestDialUDP(t *testing.T) {
+	conn, err := DialUDP(context.Background(), "socks5://"+fakeSocks5UDP(t), "time.example.com:123")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf[:n]))
+}
+
+func TestDialUDP_NoUDP(t *testing.T) {
+	for _, proxyURL := range []string{
+		"http://127.0.0.1:8080",
+		"https://127.0.0.1:8080",
+		"ws://127.0.0.1:8080",
+		"socks5://127.0.0.1:1080,socks5://127.0.0.1:1081",
+	} {
+		_, err := DialUDP(context.Background(), proxyURL, "pool.ntp.org:123")
+		assert.ErrorIs(t, err, ErrProxyNoUDP, proxyURL)
+	}
+}
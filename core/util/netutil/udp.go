@@ -0,0 +1,270 @@
+package netutil
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+)
+
+// ErrProxyNoUDP is returned when proxy can't carry UDP, e.g. HTTP(S), WebSocket proxies and proxy chains,
+// or SOCKS5 proxies which reject UDP ASSOCIATE.
+var ErrProxyNoUDP = errors.New("proxy can't carry UDP")
+
+// socks5 constants, refer to https://datatracker.ietf.org/doc/html/rfc1928
+const (
+	socks5Version      = 0x05
+	socks5NoAuth       = 0x00
+	socks5UserPass     = 0x02
+	socks5NoAcceptable = 0xff
+	socks5UDPAssociate = 0x03
+	socks5CmdNotSupp   = 0x07
+
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+)
+
+// DialUDP returns UDP conn to addr through SOCKS5 proxy by UDP ASSOCIATE, and the association is kept
+// until the conn is closed. ErrProxyNoUDP is returned if proxy can't carry UDP. Host of addr is resolved
+// by proxy if it's not an IP, so that no DNS query leaks outside the proxy.
+func DialUDP(ctx context.Context, proxyUrl, addr string) (_ net.Conn, rerr error) {
+	if IsWebsocket(proxyUrl) {
+		return nil, errors.Wrap(ErrProxyNoUDP, "websocket proxy")
+	}
+	if strings.Contains(proxyUrl, ProxySeparator) {
+		return nil, errors.Wrap(ErrProxyNoUDP, "proxy chain")
+	}
+	if err := checkScheme(proxyUrl); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(proxyUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse proxy url")
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, errors.Wrapf(ErrProxyNoUDP, "scheme %q", u.Scheme)
+	}
+
+	header, err := socks5Header(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctrl, err := (&net.Dialer{}).DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial proxy")
+	}
+	defer func() {
+		if rerr != nil {
+			_ = ctrl.Close()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = ctrl.SetDeadline(deadline); err != nil {
+			return nil, errors.Wrap(err, "set deadline")
+		}
+	}
+
+	if err = socks5Auth(ctrl, u.User); err != nil {
+		return nil, err
+	}
+	relay, err := socks5Associate(ctrl)
+	if err != nil {
+		return nil, err
+	}
+	// unspecified relay address means the same host as proxy
+	if relay.IP.IsUnspecified() {
+		relay.IP = ctrl.RemoteAddr().(*net.TCPAddr).IP
+	}
+	if err = ctrl.SetDeadline(time.Time{}); err != nil {
+		return nil, errors.Wrap(err, "reset deadline")
+	}
+
+	conn, err := net.DialUDP("udp", nil, relay)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial udp relay")
+	}
+
+	return &socks5UDPConn{UDPConn: conn, ctrl: ctrl, header: header}, nil
+}
+
+func socks5Auth(conn net.Conn, user *url.Userinfo) error {
+	methods := []byte{socks5NoAuth}
+	if user != nil {
+		methods = []byte{socks5NoAuth, socks5UserPass}
+	}
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return errors.Wrap(err, "write greeting")
+	}
+
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return errors.Wrap(err, "read greeting")
+	}
+	if resp[0] != socks5Version {
+		return errors.Errorf("unexpected socks version %d", resp[0])
+	}
+
+	switch resp[1] {
+	case socks5NoAuth:
+		return nil
+	case socks5UserPass:
+		if user == nil {
+			return ErrProxyAuth
+		}
+		password, _ := user.Password()
+		req := []byte{0x01, byte(len(user.Username()))}
+		req = append(req, user.Username()...)
+		req = append(append(req, byte(len(password))), password...)
+		if _, err := conn.Write(req); err != nil {
+			return errors.Wrap(err, "write credentials")
+		}
+
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return errors.Wrap(err, "read auth status")
+		}
+		if resp[1] != 0x00 {
+			return ErrProxyAuth
+		}
+		return nil
+	case socks5NoAcceptable:
+		return ErrProxyAuth
+	default:
+		return errors.Errorf("unsupported socks auth method %d", resp[1])
+	}
+}
+
+// socks5Associate requests UDP ASSOCIATE on conn, and returns the relay address
+func socks5Associate(conn net.Conn) (*net.UDPAddr, error) {
+	// client address is unknown before dialing the relay
+	req := []byte{socks5Version, socks5UDPAssociate, 0x00, socks5IPv4, 0, 0, 0, 0, 0, 0}
+	if _, err := conn.Write(req); err != nil {
+		return nil, errors.Wrap(err, "write udp associate")
+	}
+
+	resp := make([]byte, 4)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, errors.Wrap(err, "read udp associate")
+	}
+	switch resp[1] {
+	case 0x00:
+	case socks5CmdNotSupp:
+		return nil, errors.Wrap(ErrProxyNoUDP, "udp associate is not supported by proxy")
+	default:
+		return nil, errors.Errorf("udp associate rejected by proxy, code %d", resp[1])
+	}
+
+	var ip net.IP
+	switch resp[3] {
+	case socks5IPv4:
+		ip = make(net.IP, net.IPv4len)
+	case socks5IPv6:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil, errors.Errorf("unsupported relay address type %d", resp[3])
+	}
+	if _, err := io.ReadFull(conn, ip); err != nil {
+		return nil, errors.Wrap(err, "read relay address")
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, errors.Wrap(err, "read relay port")
+	}
+
+	return &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(port))}, nil
+}
+
+// socks5Header returns the header of UDP datagrams to addr
+func socks5Header(addr string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "split address")
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid port %q", portStr)
+	}
+
+	b := []byte{0x00, 0x00, 0x00} // RSV, FRAG
+	switch ip := net.ParseIP(host); {
+	case ip == nil:
+		if len(host) > 255 {
+			return nil, errors.Errorf("host %q is too long", host)
+		}
+		b = append(append(b, socks5Domain, byte(len(host))), host...)
+	case ip.To4() != nil:
+		b = append(append(b, socks5IPv4), ip.To4()...)
+	default:
+		b = append(append(b, socks5IPv6), ip.To16()...)
+	}
+
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+// socks5UDPConn sends datagrams to a fixed target through UDP relay of SOCKS5 proxy
+type socks5UDPConn struct {
+	*net.UDPConn
+	ctrl   net.Conn // the association is terminated when it's closed
+	header []byte
+}
+
+func (c *socks5UDPConn) Write(b []byte) (int, error) {
+	if _, err := c.UDPConn.Write(append(c.header[:len(c.header):len(c.header)], b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *socks5UDPConn) Read(b []byte) (int, error) {
+	buf := make([]byte, len(b)+262) // max header is of 255 bytes domain
+	n, err := c.UDPConn.Read(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := socks5HeaderLen(buf[:n])
+	if err != nil {
+		return 0, err
+	}
+	return copy(b, buf[offset:n]), nil
+}
+
+func socks5HeaderLen(b []byte) (int, error) {
+	if len(b) < 4 {
+		return 0, errors.New("short socks5 udp datagram")
+	}
+	if b[2] != 0x00 {
+		return 0, errors.New("fragmented socks5 udp datagram is not supported")
+	}
+
+	n := 0
+	switch b[3] {
+	case socks5IPv4:
+		n = 4 + net.IPv4len + 2
+	case socks5IPv6:
+		n = 4 + net.IPv6len + 2
+	case socks5Domain:
+		if len(b) < 5 {
+			return 0, errors.New("short socks5 udp datagram")
+		}
+		n = 4 + 1 + int(b[4]) + 2
+	default:
+		return 0, errors.Errorf("unsupported address type %d", b[3])
+	}
+	if len(b) < n {
+		return 0, errors.New("short socks5 udp datagram")
+	}
+	return n, nil
+}
+
+func (c *socks5UDPConn) Close() error {
+	return multierr.Combine(c.UDPConn.Close(), c.ctrl.Close())
+}
@@ -0,0 +1,76 @@
+package netutil
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/transport"
+)
+
+// DCPlaceholder in WebSocket proxy URL is replaced with DC ID, e.g. wss://example.com/apiws/{dc}
+const DCPlaceholder = "{dc}"
+
+// websocketDCs are DC IDs that WebSocket transport can connect to
+var websocketDCs = []int{1, 2, 3, 4, 5}
+
+// IsWebsocket reports whether proxy URL is a ws:// or wss:// endpoint, which can't be chained
+func IsWebsocket(proxyUrl string) bool {
+	if strings.Contains(proxyUrl, ProxySeparator) {
+		return false
+	}
+
+	u, err := url.Parse(proxyUrl)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "ws" || u.Scheme == "wss"
+}
+
+// NewWebsocketResolver returns DC resolver which tunnels MTProto over WebSocket through proxy URL,
+// for networks which only allow outbound WebSocket.
+//
+// The endpoint must speak Telegram WebSocket transport(https://core.telegram.org/mtproto/transports#websocket),
+// e.g. a reverse proxy to wss://<name>.web.telegram.org/apiws. DCPlaceholder in URL is replaced with DC ID,
+// otherwise all DCs share the same endpoint, which routes by DC ID in obfuscated handshake.
+// Only primary connections are supported, so media-only DCs and CDNs are not available.
+func NewWebsocketResolver(proxyUrl string) (dcs.Resolver, error) {
+	if !IsWebsocket(proxyUrl) {
+		return nil, errors.Errorf("not a websocket url: %s", proxyUrl)
+	}
+
+	domains := make(map[int]string, len(websocketDCs))
+	for _, dc := range websocketDCs {
+		domains[dc] = strings.ReplaceAll(proxyUrl, DCPlaceholder, strconv.Itoa(dc))
+	}
+
+	return wsResolver{
+		Resolver: dcs.Websocket(dcs.WebsocketOptions{}),
+		domains:  domains,
+	}, nil
+}
+
+// wsResolver overrides DC domains with proxy endpoints
+type wsResolver struct {
+	dcs.Resolver
+	domains map[int]string
+}
+
+func (r wsResolver) Primary(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	list.Domains = r.domains
+	return r.Resolver.Primary(ctx, dc, list)
+}
+
+func (r wsResolver) MediaOnly(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	list.Domains = r.domains
+	return r.Resolver.MediaOnly(ctx, dc, list)
+}
+
+func (r wsResolver) CDN(ctx context.Context, dc int, list dcs.List) (transport.Conn, error) {
+	list.Domains = r.domains
+	return r.Resolver.CDN(ctx, dc, list)
+}
@@ -7,19 +7,35 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 
 	"github.com/go-faster/errors"
 	"github.com/gotd/td/session"
 	"github.com/gotd/td/telegram"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/middlewares/methodfilter"
 	"github.com/iyear/tdl/core/tclient"
 	"github.com/iyear/tdl/core/util/logutil"
 )
 
 const EnvKey = "TDL_EXTENSION"
 
+// Environment variables injected into extension process by tdl. Extensions which are
+// not built with this package can read them directly instead of parsing flags.
+// Session is not included as it's a credential, read it from the file of EnvKey instead.
+const (
+	EnvName      = "TDL_NAME"      // extension name
+	EnvNamespace = "TDL_NAMESPACE" // tdl namespace
+	EnvDataDir   = "TDL_DATA_DIR"  // data directory for extension
+	EnvNTP       = "TDL_NTP"       // ntp server host
+	EnvProxy     = "TDL_PROXY"     // proxy URL
+	EnvPool      = "TDL_POOL"      // pool size
+	EnvDebug     = "TDL_DEBUG"     // debug mode enabled, "true" or "false"
+)
+
 type Env struct {
 	Name      string `json:"name"`
 	Namespace string `json:"namespace"`
@@ -31,6 +47,45 @@ type Env struct {
 	Proxy     string `json:"proxy"`
 	Pool      int64  `json:"pool"`
 	Debug     bool   `json:"debug"`
+	LogFormat string `json:"log_format,omitempty"`
+	LogLevel  string `json:"log_level,omitempty"` // overridden by Debug, empty means info
+
+	// AllowMethods and DenyMethods are MTProto method policy of extension, see methodfilter.New.
+	AllowMethods []string `json:"allow_methods,omitempty"`
+	DenyMethods  []string `json:"deny_methods,omitempty"`
+}
+
+// Environ returns non-credential fields of Env as "key=value" environment variables.
+func (e *Env) Environ() []string {
+	return []string{
+		EnvName + "=" + e.Name,
+		EnvNamespace + "=" + e.Namespace,
+		EnvDataDir + "=" + e.DataDir,
+		EnvNTP + "=" + e.NTP,
+		EnvProxy + "=" + e.Proxy,
+		EnvPool + "=" + strconv.FormatInt(e.Pool, 10),
+		EnvDebug + "=" + strconv.FormatBool(e.Debug),
+	}
+}
+
+// ReadEnv reads Env from the file specified by EnvKey environment variable.
+func ReadEnv() (*Env, error) {
+	envFile := os.Getenv(EnvKey)
+	if envFile == "" {
+		return nil, errors.New("please launch extension with `tdl EXTENSION_NAME`")
+	}
+
+	extEnv, err := os.ReadFile(envFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read env file")
+	}
+
+	env := &Env{}
+	if err = json.Unmarshal(extEnv, env); err != nil {
+		return nil, errors.Wrap(err, "unmarshal extension environment")
+	}
+
+	return env, nil
 }
 
 type Options struct {
@@ -38,9 +93,10 @@ type Options struct {
 	UpdateHandler telegram.UpdateHandler
 	// Middlewares will be passed to telegram.Client Options,
 	// and recovery,retry,flood-wait will be used if nil.
+	// Method filter is always appended if tdl passes a method policy.
 	Middlewares []telegram.Middleware
 	// Logger will be used as extension logger,
-	// and default logger(write to extension data dir) will be used if nil.
+	// and default logger(write to extension data dir in tdl log format and level) will be used if nil.
 	Logger *zap.Logger
 }
 
@@ -100,27 +156,24 @@ func New(o Options) func(h Handler) {
 }
 
 func buildExtension(ctx context.Context, o Options) (*Extension, *telegram.Client, error) {
-	envFile := os.Getenv(EnvKey)
-	if envFile == "" {
-		return nil, nil, errors.New("please launch extension with `tdl EXTENSION_NAME`")
-	}
-
-	extEnv, err := os.ReadFile(envFile)
+	env, err := ReadEnv()
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "read env file")
-	}
-
-	env := &Env{}
-	if err = json.Unmarshal(extEnv, env); err != nil {
-		return nil, nil, errors.Wrap(err, "unmarshal extension environment")
+		return nil, nil, err
 	}
 
 	if o.Logger == nil {
 		level := zap.InfoLevel
+		if env.LogLevel != "" {
+			if level, err = zapcore.ParseLevel(env.LogLevel); err != nil {
+				return nil, nil, errors.Wrap(err, "parse log level")
+			}
+		}
 		if env.Debug {
 			level = zap.DebugLevel
 		}
-		o.Logger = logutil.New(level, filepath.Join(env.DataDir, "log", "latest.log"))
+		if o.Logger, err = logutil.NewWithFormat(level, filepath.Join(env.DataDir, "log", "latest.log"), env.LogFormat); err != nil {
+			return nil, nil, errors.Wrap(err, "create logger")
+		}
 	}
 
 	// save logger to context
@@ -129,6 +182,9 @@ func buildExtension(ctx context.Context, o Options) (*Extension, *telegram.Clien
 	if o.Middlewares == nil {
 		o.Middlewares = tclient.NewDefaultMiddlewares(ctx, 0)
 	}
+	if len(env.AllowMethods) > 0 || len(env.DenyMethods) > 0 {
+		o.Middlewares = append(o.Middlewares, methodfilter.New(env.AllowMethods, env.DenyMethods))
+	}
 
 	client, err := buildClient(ctx, env, o)
 	if err != nil {
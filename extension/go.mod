@@ -19,7 +19,6 @@ require (
 	github.com/gotd/contrib v0.20.0 // indirect
 	github.com/gotd/ige v0.2.2 // indirect
 	github.com/gotd/neo v0.1.5 // indirect
-	github.com/iyear/connectproxy v0.1.1 // indirect
 	github.com/klauspost/compress v1.17.8 // indirect
 	github.com/segmentio/asm v1.2.0 // indirect
 	go.opentelemetry.io/otel v1.26.0 // indirect
@@ -11,6 +11,7 @@ import (
 	"go.etcd.io/bbolt"
 
 	"github.com/iyear/tdl/cmd"
+	"github.com/iyear/tdl/pkg/kv"
 )
 
 func main() {
@@ -19,6 +20,7 @@ func main() {
 
 	humanizeErrors := map[error]string{
 		bbolt.ErrTimeout:        "Current database is used by another process, please terminate it first",
+		kv.ErrSessionInUse:      "Current session is used by another process, please terminate it first or set 'lock_timeout' storage option to wait",
 		surveyterm.InterruptErr: "Interrupted",
 	}
 
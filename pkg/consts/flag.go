@@ -5,12 +5,23 @@ const (
 	FlagProxy            = "proxy"
 	FlagNamespace        = "ns"
 	FlagDebug            = "debug"
+	FlagLogFormat        = "log-format"
+	FlagLogLevel         = "log-level"
 	FlagPartSize         = "size" // Deprecated: all part size should be set to maximum by default
 	FlagThreads          = "threads"
 	FlagLimit            = "limit"
 	FlagPoolSize         = "pool"
+	FlagMaxConns         = "max-conns"
 	FlagDelay            = "delay"
 	FlagNTP              = "ntp"
 	FlagReconnectTimeout = "reconnect-timeout"
+	FlagSessionBackupDir = "session-backup-dir"
+	FlagSessionBackups   = "session-backups"
 	FlagDlTemplate       = "template"
+	FlagDlDirTemplate    = "dir-template"
+	FlagBandwidth        = "bandwidth"
+	FlagExtMemory        = "ext-memory"
+	FlagExtTimeout       = "ext-timeout"
+	FlagExtAllowMethods  = "ext-allow-methods"
+	FlagExtDenyMethods   = "ext-deny-methods"
 )
@@ -0,0 +1,170 @@
+package extensions
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// ErrAliasConflict is returned when alias is a built-in command, another extension or alias of another extension.
+var ErrAliasConflict = errors.New("alias conflicts with existing command")
+
+// aliasesName is the file of alias -> extension name(without Prefix) mapping in extensions dir
+const aliasesName = ".aliases"
+
+// SetReserved sets names and aliases of built-in tdl commands, which can't be used as extension aliases.
+func (m *Manager) SetReserved(names ...string) {
+	m.reserved = make(map[string]struct{}, len(names))
+	for _, n := range names {
+		m.reserved[n] = struct{}{}
+	}
+}
+
+// Alias adds alias of ext, so that it can be invoked as `tdl <alias>`. Adding an existing alias of ext is a no-op.
+// ErrAliasConflict is returned if alias is reserved by SetReserved, the name of an installed extension,
+// or alias of another extension.
+func (m *Manager) Alias(ctx context.Context, ext Extension, alias string) error {
+	if err := validateAlias(alias); err != nil {
+		return err
+	}
+	if _, ok := m.reserved[alias]; ok {
+		return errors.Wrapf(ErrAliasConflict, "%q is a built-in command", alias)
+	}
+
+	exts, err := m.List(ctx, false)
+	if err != nil {
+		return err
+	}
+	for _, e := range exts {
+		if alias == e.Name() || alias == Prefix+e.Name() {
+			return errors.Wrapf(ErrAliasConflict, "%q is the name of extension %s", alias, Prefix+e.Name())
+		}
+	}
+
+	aliases, err := m.loadAliases()
+	if err != nil {
+		return err
+	}
+	if name, ok := aliases[alias]; ok {
+		if name == ext.Name() {
+			return nil
+		}
+		if _, err = m.Get(ctx, name); err == nil {
+			return errors.Wrapf(ErrAliasConflict, "%q is alias of extension %s", alias, Prefix+name)
+		}
+		// alias of removed extension is overwritten
+	}
+
+	if m.dryRun {
+		return nil
+	}
+
+	aliases[alias] = ext.Name()
+	return m.writeAliases(aliases)
+}
+
+// Unalias removes alias, and returns ErrNotInstalled if alias doesn't exist.
+func (m *Manager) Unalias(_ context.Context, alias string) error {
+	aliases, err := m.loadAliases()
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases[alias]; !ok {
+		return errors.Wrapf(ErrNotInstalled, "alias %s", alias)
+	}
+
+	if m.dryRun {
+		return nil
+	}
+
+	delete(aliases, alias)
+	return m.writeAliases(aliases)
+}
+
+// Aliases returns sorted aliases of installed extensions by extension name(without Prefix).
+// Aliases of removed extensions are ignored.
+func (m *Manager) Aliases(ctx context.Context) (map[string][]string, error) {
+	aliases, err := m.loadAliases()
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(map[string][]string)
+	for alias, name := range aliases {
+		if _, err = m.Get(ctx, name); err != nil {
+			continue
+		}
+		r[name] = append(r[name], alias)
+	}
+	for _, a := range r {
+		sort.Strings(a)
+	}
+	return r, nil
+}
+
+// removeAliases removes all aliases of extension name
+func (m *Manager) removeAliases(name string) error {
+	aliases, err := m.loadAliases()
+	if err != nil {
+		return err
+	}
+
+	n := len(aliases)
+	for alias, ext := range aliases {
+		if ext == name {
+			delete(aliases, alias)
+		}
+	}
+	if len(aliases) == n {
+		return nil
+	}
+	return m.writeAliases(aliases)
+}
+
+func (m *Manager) loadAliases() (map[string]string, error) {
+	aliases := make(map[string]string)
+
+	data, err := os.ReadFile(filepath.Join(m.dir, aliasesName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return aliases, nil
+		}
+		return nil, errors.Wrap(err, "read aliases")
+	}
+
+	if err = json.Unmarshal(data, &aliases); err != nil {
+		return nil, errors.Wrap(err, "unmarshal aliases")
+	}
+	return aliases, nil
+}
+
+func (m *Manager) writeAliases(aliases map[string]string) error {
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal aliases")
+	}
+
+	if err = os.MkdirAll(m.dir, 0o755); err != nil {
+		return errors.Wrap(err, "create extensions dir")
+	}
+	if err = os.WriteFile(filepath.Join(m.dir, aliasesName), data, 0o644); err != nil {
+		return errors.Wrap(err, "write aliases")
+	}
+	return nil
+}
+
+// validateAlias checks alias is a valid command name
+func validateAlias(alias string) error {
+	if alias == "" {
+		return errors.New("empty alias")
+	}
+	if strings.HasPrefix(alias, "-") || strings.ContainsAny(alias, " \t\n/\\") {
+		return errors.Errorf("invalid alias %q, which must not start with '-' or contain spaces or slashes", alias)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package extensions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_Alias(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"tdl-foo", "tdl-bar"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name, name), []byte("#!/bin/sh"), 0o755))
+	}
+
+	ctx := context.Background()
+	m := NewManager(dir)
+	m.SetReserved("dl", "download", "up")
+
+	foo, err := m.Get(ctx, "foo")
+	require.NoError(t, err)
+	bar, err := m.Get(ctx, "bar")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Alias(ctx, foo, "f"))
+	require.NoError(t, m.Alias(ctx, foo, "f"), "existing alias of the same extension")
+	require.NoError(t, m.Alias(ctx, foo, "fo"))
+
+	assert.ErrorIs(t, m.Alias(ctx, bar, "dl"), ErrAliasConflict, "built-in command")
+	assert.ErrorIs(t, m.Alias(ctx, bar, "foo"), ErrAliasConflict, "extension name")
+	assert.ErrorIs(t, m.Alias(ctx, bar, "tdl-foo"), ErrAliasConflict, "extension name with prefix")
+	assert.ErrorIs(t, m.Alias(ctx, bar, "f"), ErrAliasConflict, "alias of another extension")
+	assert.Error(t, m.Alias(ctx, bar, "-b"))
+	assert.Error(t, m.Alias(ctx, bar, "a/b"))
+
+	// persisted and listed by extension
+	aliases, err := NewManager(dir).Aliases(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"foo": {"f", "fo"}}, aliases)
+
+	require.NoError(t, m.Unalias(ctx, "fo"))
+	assert.ErrorIs(t, m.Unalias(ctx, "fo"), ErrNotInstalled)
+
+	// aliases are removed with extension
+	require.NoError(t, m.Remove(foo))
+	aliases, err = m.Aliases(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, aliases)
+	require.NoError(t, m.Alias(ctx, bar, "f"))
+
+	// dry run never writes
+	m.SetDryRun(true)
+	require.NoError(t, m.Alias(ctx, bar, "b"))
+	aliases, err = m.Aliases(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"bar": {"f"}}, aliases)
+}
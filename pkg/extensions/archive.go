@@ -0,0 +1,140 @@
+package extensions
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+)
+
+// isArchive reports whether path is a supported archive of extension release
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractExecutable extracts the only file with Prefix in archive to dir, and returns its path.
+// Only base names of entries are used, so entries can't escape dir.
+func extractExecutable(archive, dir string) (_ string, rerr error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", errors.Wrapf(err, "open archive %s", archive)
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(f))
+
+	var (
+		found string
+		names []string
+	)
+	extract := func(name string, mode os.FileMode, r io.Reader) error {
+		name = filepath.Base(name)
+		names = append(names, name)
+		if !strings.HasPrefix(name, Prefix) {
+			return nil
+		}
+		if found != "" {
+			return errors.Errorf("multiple extension executables found in archive: %q, %q", filepath.Base(found), name)
+		}
+
+		found = filepath.Join(dir, name)
+		return writeFile(found, mode|0o700, r)
+	}
+
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		err = extractZip(f, extract)
+	} else {
+		err = extractTarGz(f, extract)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if found == "" {
+		return "", errors.Errorf("no extension executable with prefix %q found in archive, entries: [%s]",
+			Prefix, strings.Join(names, ", "))
+	}
+
+	return found, nil
+}
+
+func extractTarGz(f *os.File, extract func(name string, mode os.FileMode, r io.Reader) error) error {
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrap(err, "open gzip")
+	}
+	defer func() { _ = gz.Close() }()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "read tar")
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err = extract(h.Name, h.FileInfo().Mode().Perm(), tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(f *os.File, extract func(name string, mode os.FileMode, r io.Reader) error) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "stat zip")
+	}
+
+	zr, err := zip.NewReader(f, stat.Size())
+	if err != nil {
+		return errors.Wrap(err, "open zip")
+	}
+
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		if err = func() (rerr error) {
+			r, err := zf.Open()
+			if err != nil {
+				return errors.Wrapf(err, "open %s in zip", zf.Name)
+			}
+			defer multierr.AppendInvoke(&rerr, multierr.Close(r))
+
+			return extract(zf.Name, zf.Mode().Perm(), r)
+		}(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFile(path string, mode os.FileMode, r io.Reader) (rerr error) {
+	w, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return errors.Wrapf(err, "open file %s", path)
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(w))
+
+	if _, err = io.Copy(w, r); err != nil {
+		return errors.Wrapf(err, "write file %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package extensions
+
+import (
+	"path"
+	"strings"
+)
+
+// AssetPicker returns index of the release asset in names for goos and goarch, or -1 if none matches.
+// goarch of 32-bit ARM is with version, e.g. armv7.
+type AssetPicker func(names []string, goos, goarch string) int
+
+// osAliases are names of OS used in asset names by common release tools
+var osAliases = map[string][]string{
+	"linux":   {"linux"},
+	"darwin":  {"darwin", "macos", "mac", "osx", "apple"},
+	"windows": {"windows", "win"},
+	"freebsd": {"freebsd"},
+}
+
+// archAliases are names of arch used in asset names by common release tools
+var archAliases = map[string][]string{
+	"amd64": {"amd64", "x86_64", "x64"},
+	"386":   {"386", "i386", "i686", "x86"},
+	"arm64": {"arm64", "aarch64"},
+	"armv7": {"armv7", "armv7l", "armhf"},
+	"armv6": {"armv6", "armv6l", "armel"},
+}
+
+// ignoredAssetSuffixes are assets published along with binaries, which are never executables
+var ignoredAssetSuffixes = []string{".sha256", ".sha512", ".md5", ".sig", ".asc", ".pem", ".sbom", ".json", ".txt", ".deb", ".rpm", ".apk"}
+
+// DefaultAssetPicker matches assets ending with "<goos>-<goarch>[.exe]" first for compatibility, then
+// matches OS and arch aliases(e.g. x86_64, aarch64, macos) as separate words of names, which are split
+// by '-', '_' and '.'. Checksums and signatures are ignored, and binaries are preferred over archives.
+func DefaultAssetPicker(names []string, goos, goarch string) int {
+	platform, ext := platformBinaryName(goos, goarch)
+	for i, name := range names {
+		if strings.HasSuffix(name, platform+ext) {
+			return i
+		}
+	}
+
+	archive := -1
+	for i, name := range names {
+		lower := strings.ToLower(name)
+		if ignoredAsset(lower) || !matchPlatform(lower, goos, goarch) {
+			continue
+		}
+		if isArchive(lower) {
+			if archive < 0 {
+				archive = i
+			}
+			continue
+		}
+		if goos == "windows" && !strings.HasSuffix(lower, ".exe") {
+			continue
+		}
+		return i
+	}
+	return archive
+}
+
+// GlobAssetPicker matches asset names by glob pattern of path.Match, e.g. "*_linux_x86_64.tar.gz",
+// for releases which can't be matched by DefaultAssetPicker. Both goos and goarch are ignored.
+func GlobAssetPicker(pattern string) AssetPicker {
+	return func(names []string, _, _ string) int {
+		for i, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return i
+			}
+		}
+		return -1
+	}
+}
+
+func ignoredAsset(lower string) bool {
+	for _, suffix := range ignoredAssetSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPlatform reports whether words of lower-cased asset name contain aliases of goos and goarch
+func matchPlatform(lower, goos, goarch string) bool {
+	// x86_64 would be split into two words
+	lower = strings.NewReplacer("x86_64", "amd64", "x86-64", "amd64").Replace(lower)
+	words := make(map[string]struct{})
+	for _, w := range strings.FieldsFunc(lower, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+		words[w] = struct{}{}
+	}
+
+	return matchWords(words, goos, osAliases) && matchWords(words, goarch, archAliases)
+}
+
+func matchWords(words map[string]struct{}, name string, aliases map[string][]string) bool {
+	candidates, ok := aliases[name]
+	if !ok {
+		candidates = []string{name}
+	}
+	for _, c := range candidates {
+		if _, ok = words[c]; ok {
+			return true
+		}
+	}
+	return false
+}
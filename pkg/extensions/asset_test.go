@@ -0,0 +1,113 @@
+package extensions
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultAssetPicker(t *testing.T) {
+	tests := []struct {
+		name     string
+		assets   []string
+		goos     string
+		goarch   string
+		expected int
+	}{
+		{"standard", []string{"tdl-foo_darwin-amd64", "tdl-foo_linux-amd64"}, "linux", "amd64", 1},
+		{"standard windows", []string{"tdl-foo_windows-amd64", "tdl-foo_windows-amd64.exe"}, "windows", "amd64", 1},
+		{"x86_64", []string{"ext_darwin_x86_64.tar.gz", "ext_linux_x86_64.tar.gz"}, "linux", "amd64", 1},
+		{"aarch64", []string{"ext-linux-x86_64", "ext-linux-aarch64"}, "linux", "arm64", 1},
+		{"macos", []string{"ext-linux-arm64.zip", "ext-macos-arm64.zip"}, "darwin", "arm64", 1},
+		{"arm is not arm64", []string{"ext-linux-arm64", "ext-linux-armv7l"}, "linux", "armv7", 1},
+		{"arm64 is not arm", []string{"ext-linux-armv7", "ext-linux-arm64"}, "linux", "arm64", 1},
+		{"i386", []string{"ext_Linux_i386", "ext_Linux_x86_64"}, "linux", "386", 0},
+		{"case-insensitive", []string{"EXT-Linux-X86_64"}, "linux", "amd64", 0},
+		{"checksums are ignored", []string{"ext-linux-amd64.sha256", "ext-linux-amd64.tar.gz"}, "linux", "amd64", 1},
+		{"binary over archive", []string{"ext-linux-amd64.tar.gz", "ext-linux-amd64"}, "linux", "amd64", 1},
+		{"windows requires exe", []string{"ext-win-x64", "ext-win-x64.exe"}, "windows", "amd64", 1},
+		{"windows archive", []string{"ext-windows-amd64.zip"}, "windows", "amd64", 0},
+		{"no os", []string{"ext-amd64"}, "linux", "amd64", -1},
+		{"no arch", []string{"ext-linux-arm64", "ext-darwin-amd64"}, "linux", "amd64", -1},
+		{"empty", nil, "linux", "amd64", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DefaultAssetPicker(tt.assets, tt.goos, tt.goarch))
+		})
+	}
+}
+
+func TestGlobAssetPicker(t *testing.T) {
+	names := []string{"ext_linux_x86_64.tar.gz", "ext_linux_x86_64.tar.gz.sha256"}
+	assert.Equal(t, 0, GlobAssetPicker("*_linux_x86_64.tar.gz")(names, "", ""))
+	assert.Equal(t, 1, GlobAssetPicker("*.sha256")(names, "", ""))
+	assert.Equal(t, -1, GlobAssetPicker("*darwin*")(names, "", ""))
+}
+
+func TestManager_InstallGitHubArchive(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	content := "#!/bin/sh"
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dist/tdl-foo", Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(content))}))
+	_, err := tw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/releases/latest"):
+			_, _ = w.Write([]byte(`{"tag_name":"v1.0.0","assets":[` +
+				`{"id":1,"name":"ext_linux_x86_64.tar.gz.sha256"},{"id":2,"name":"ext_linux_x86_64.tar.gz"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/releases/assets/2"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(buf.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	m := NewManager(t.TempDir())
+	m.SetPlatform("linux", "amd64")
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+	m.github.BaseURL = base
+
+	ctx := context.Background()
+	require.NoError(t, m.Install(ctx, "owner/tdl-foo", false))
+
+	e, err := m.Get(ctx, "foo")
+	require.NoError(t, err)
+	b, err := os.ReadFile(e.Path())
+	require.NoError(t, err)
+	assert.Equal(t, content, string(b))
+
+	// only executable and manifest are kept
+	entries, err := os.ReadDir(filepath.Dir(e.Path()))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// no asset matches custom picker, and available ones are listed
+	m.SetAssetPicker(GlobAssetPicker("*darwin*"))
+	err = m.Install(ctx, "owner/tdl-foo", true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ext_linux_x86_64.tar.gz.sha256, ext_linux_x86_64.tar.gz")
+}
@@ -0,0 +1,58 @@
+package extensions
+
+import "io"
+
+// EventType is the step of extension installation
+type EventType string
+
+const (
+	// EventResolve is fetching release metadata of GitHub extension
+	EventResolve EventType = "resolve"
+	// EventVerify is checking compatibility with running tdl
+	EventVerify EventType = "verify"
+	// EventDownload is downloading release asset, reported with bytes progress
+	EventDownload EventType = "download"
+	// EventExtract is extracting executable from release archive
+	EventExtract EventType = "extract"
+	// EventInstall is writing extension files to extensions dir
+	EventInstall EventType = "install"
+)
+
+// Event is the progress of installing an extension
+type Event struct {
+	Type EventType
+	// Target is the target passed to Install(or name of upgraded extension)
+	Target string
+	// Done and Total are bytes progress of EventDownload. Total is negative if unknown.
+	Done, Total int64
+}
+
+// EventHandler is called synchronously on each installation event, so it should return quickly.
+type EventHandler func(e Event)
+
+// SetEventHandler sets handler of Install and Upgrade events, nil means no events.
+func (m *Manager) SetEventHandler(h EventHandler) {
+	m.onEvent = h
+}
+
+func (m *Manager) emit(e Event) {
+	if m.onEvent != nil {
+		m.onEvent(e)
+	}
+}
+
+// progressReader emits EventDownload for bytes read
+type progressReader struct {
+	r     io.Reader
+	emit  func(e Event)
+	event Event
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.event.Done += int64(n)
+		p.emit(p.event)
+	}
+	return n, err
+}
@@ -21,7 +21,9 @@ type Extension interface {
 	Owner() string
 	CurrentVersion() string
 	LatestVersion(ctx context.Context) string
+	CachedLatestVersion() string // latest version seen by last install, upgrade or LatestVersion, without network
 	UpdateAvailable(ctx context.Context) bool
+	MinTDLVersion() string // min tdl version required by extension, empty means no constraint
 }
 
 type baseExtension struct {
@@ -42,4 +44,9 @@ type manifest struct {
 	Owner string `json:"owner,omitempty"`
 	Repo  string `json:"repo,omitempty"`
 	Tag   string `json:"tag,omitempty"`
+
+	MinTDLVersion string `json:"min_tdl_version,omitempty"`
+
+	// Latest is the cached latest tag, which may be outdated
+	Latest string `json:"latest,omitempty"`
 }
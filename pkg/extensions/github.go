@@ -56,6 +56,14 @@ func (e *githubExtension) CurrentVersion() string {
 	return ""
 }
 
+func (e *githubExtension) MinTDLVersion() string {
+	if mf, err := e.loadManifest(); err == nil {
+		return mf.MinTDLVersion
+	}
+
+	return ""
+}
+
 func (e *githubExtension) LatestVersion(ctx context.Context) string {
 	e.mu.RLock()
 	if e.latestVersion != "" {
@@ -78,9 +86,48 @@ func (e *githubExtension) LatestVersion(ctx context.Context) string {
 	e.latestVersion = release.GetTagName()
 	e.mu.Unlock()
 
+	// offline listing is best-effort, so failures of caching are ignored
+	_ = e.cacheLatest(release.GetTagName())
+
 	return e.latestVersion
 }
 
+func (e *githubExtension) CachedLatestVersion() string {
+	if mf, err := e.loadManifest(); err == nil {
+		return mf.Latest
+	}
+
+	return ""
+}
+
+// cacheLatest writes latest tag to manifest, so that it's available without network
+func (e *githubExtension) cacheLatest(tag string) error {
+	mf, err := e.loadManifest()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if mf.Latest == tag {
+		return nil
+	}
+	updated := *mf
+	updated.Latest = tag
+
+	mfb, err := json.Marshal(updated)
+	if err != nil {
+		return errors.Wrap(err, "marshal manifest")
+	}
+	if err = os.WriteFile(filepath.Join(filepath.Dir(e.Path()), manifestName), mfb, 0o644); err != nil {
+		return errors.Wrap(err, "write manifest")
+	}
+
+	e.mf = &updated
+	return nil
+}
+
 func (e *githubExtension) loadManifest() (*manifest, error) {
 	e.mu.RLock()
 	if e.mf != nil {
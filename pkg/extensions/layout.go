@@ -0,0 +1,159 @@
+package extensions
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+
+	"github.com/iyear/tdl/core/logctx"
+)
+
+// LayoutVersion is the layout of extensions dir written by running tdl: each extension is in its own
+// Prefix+name dir with the executable, and GitHub extensions have a manifest in it.
+const LayoutVersion = 1
+
+// layoutName is the marker of layout version in extensions dir, dirs without it are of version 0
+const layoutName = ".layout"
+
+// stagingPrefix is the name prefix of temp dirs created by stage
+const stagingPrefix = ".install-"
+
+// layoutMigrations[i] upgrades extensions dir from layout version i to i+1
+var layoutMigrations = []func(m *Manager, ctx context.Context) error{
+	(*Manager).migrateFlatLayout,
+}
+
+type layout struct {
+	Version int `json:"version"`
+}
+
+// Migrate upgrades extensions dir written by older tdl to LayoutVersion in place, and installed extensions
+// are kept with their manifests. Each step is persisted, so interrupted migrations continue from the failed
+// step on next call. Dirs of newer layout are left untouched, so that downgraded tdl never breaks them.
+// Nothing is created if extensions dir doesn't exist. It's called by Manager before the first access of
+// extensions dir, so callers don't need to call it explicitly.
+func (m *Manager) Migrate(ctx context.Context) error {
+	if _, err := os.Stat(m.dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	v, err := m.layoutVersion()
+	if err != nil {
+		return err
+	}
+	if v > LayoutVersion {
+		logctx.From(ctx).Warn("Extensions dir is of newer layout, please upgrade tdl",
+			zap.Int("layout", v),
+			zap.Int("supported", LayoutVersion))
+		return nil
+	}
+
+	for ; v < LayoutVersion; v++ {
+		logctx.From(ctx).Info("Migrate extensions dir layout",
+			zap.String("dir", m.dir),
+			zap.Int("from", v),
+			zap.Int("to", v+1))
+
+		if err = layoutMigrations[v](m, ctx); err != nil {
+			return errors.Wrapf(err, "migrate layout from version %d", v)
+		}
+		if err = m.writeLayout(v + 1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrate runs Migrate once, and failures are logged and retried on next run
+func (m *Manager) migrate(ctx context.Context) {
+	m.migrated.Do(func() {
+		if err := m.Migrate(ctx); err != nil {
+			logctx.From(ctx).Warn("Failed to migrate extensions dir",
+				zap.Error(err))
+		}
+	})
+}
+
+func (m *Manager) layoutVersion() (int, error) {
+	data, err := os.ReadFile(filepath.Join(m.dir, layoutName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "read layout")
+	}
+
+	l := layout{}
+	if err = json.Unmarshal(data, &l); err != nil {
+		return 0, errors.Wrap(err, "unmarshal layout")
+	}
+	return l.Version, nil
+}
+
+func (m *Manager) writeLayout(version int) error {
+	data, err := json.Marshal(layout{Version: version})
+	if err != nil {
+		return errors.Wrap(err, "marshal layout")
+	}
+
+	if err = os.MkdirAll(m.dir, 0o755); err != nil {
+		return errors.Wrap(err, "create extensions dir")
+	}
+	if err = os.WriteFile(filepath.Join(m.dir, layoutName), data, 0o644); err != nil {
+		return errors.Wrap(err, "write layout")
+	}
+	return nil
+}
+
+// migrateFlatLayout moves executables in the root of extensions dir, which are ignored by List since
+// version 1, into their own dirs, and removes staging dirs left by killed installs.
+func (m *Manager) migrateFlatLayout(ctx context.Context) error {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return errors.Wrap(err, "read dir entries")
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		path := filepath.Join(m.dir, name)
+
+		switch {
+		case e.IsDir() && strings.HasPrefix(name, stagingPrefix):
+			logctx.From(ctx).Info("Remove stale staging dir",
+				zap.String("path", path))
+
+			if err = os.RemoveAll(path); err != nil {
+				return errors.Wrapf(err, "remove staging dir %q", name)
+			}
+		case e.Type().IsRegular() && strings.HasPrefix(name, Prefix):
+			// targetDir is the executable itself if it has no extension, which is moved before stage replaces it
+			targetDir := filepath.Join(m.dir, strings.TrimSuffix(name, filepath.Ext(name)))
+			if info, err := os.Lstat(targetDir); err == nil && info.IsDir() {
+				logctx.From(ctx).Warn("Skip flat extension which is also installed in its own dir",
+					zap.String("path", path))
+				continue
+			}
+
+			logctx.From(ctx).Info("Move flat extension into its own dir",
+				zap.String("path", path),
+				zap.String("dir", targetDir))
+
+			if err = m.stage(targetDir, func(dir string) error {
+				return os.Rename(path, filepath.Join(dir, name))
+			}); err != nil {
+				return errors.Wrapf(err, "move extension %q", name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package extensions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_Migrate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// simulated layout of version 0
+	write := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0o755))
+	}
+	write("tdl-flat", "#!/bin/sh")
+	write("tdl-both.sh", "flat")
+	write("tdl-both/tdl-both", "dir")
+	write("tdl-gh/tdl-gh", "#!/bin/sh")
+	write("tdl-gh/"+manifestName, `{"owner":"iyear","repo":"tdl-gh","tag":"v1.0.0"}`)
+	write(".install-123/tdl-partial", "partial")
+
+	m := NewManager(dir)
+	require.NoError(t, m.Migrate(ctx))
+
+	v, err := m.layoutVersion()
+	require.NoError(t, err)
+	assert.Equal(t, LayoutVersion, v)
+
+	exts, err := m.List(ctx, false)
+	require.NoError(t, err)
+	names := make([]string, 0, len(exts))
+	for _, e := range exts {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"flat", "both", "gh"}, names)
+
+	// metadata is preserved
+	gh, err := m.Get(ctx, "gh")
+	require.NoError(t, err)
+	assert.Equal(t, ExtensionTypeGithub, gh.Type())
+	assert.Equal(t, "v1.0.0", gh.CurrentVersion())
+
+	flat, err := os.ReadFile(filepath.Join(dir, "tdl-flat", "tdl-flat"))
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh", string(flat))
+
+	both, err := os.ReadFile(filepath.Join(dir, "tdl-both", "tdl-both"))
+	require.NoError(t, err)
+	assert.Equal(t, "dir", string(both), "installed extension should not be overwritten")
+	assert.FileExists(t, filepath.Join(dir, "tdl-both.sh"))
+	assert.NoDirExists(t, filepath.Join(dir, ".install-123"))
+
+	// migrated dir is untouched
+	write("tdl-late", "#!/bin/sh")
+	require.NoError(t, m.Migrate(ctx))
+	assert.FileExists(t, filepath.Join(dir, "tdl-late"))
+
+	// newer layout is left for newer tdl
+	require.NoError(t, m.writeLayout(LayoutVersion+1))
+	require.NoError(t, m.Migrate(ctx))
+	v, err = m.layoutVersion()
+	require.NoError(t, err)
+	assert.Equal(t, LayoutVersion+1, v)
+}
+
+func TestManager_MigrateLazily(t *testing.T) {
+	ctx := context.Background()
+
+	// nothing is created without extensions dir
+	missing := filepath.Join(t.TempDir(), "extensions")
+	require.NoError(t, NewManager(missing).Migrate(ctx))
+	assert.NoDirExists(t, missing)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tdl-flat"), []byte("#!/bin/sh"), 0o755))
+
+	// migrated before the first access
+	exts, err := NewManager(dir).List(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, exts, 1)
+	assert.Equal(t, "flat", exts[0].Name())
+	assert.FileExists(t, filepath.Join(dir, layoutName))
+}
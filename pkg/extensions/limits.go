@@ -0,0 +1,124 @@
+package extensions
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// ErrLimitExceeded is returned when extension is killed for exceeding resource limits.
+var ErrLimitExceeded = errors.New("extension exceeded resource limit")
+
+const (
+	// memCheckInterval is the interval of polling memory usage of extension process
+	memCheckInterval = 200 * time.Millisecond
+	// killWaitDelay bounds waiting for I/O of killed extension, whose children may still hold the pipes
+	killWaitDelay = time.Second
+)
+
+// Limits are resource limits of extension processes. Zero values mean no limit.
+type Limits struct {
+	// Memory is the max resident memory in bytes, which is only supported on Linux.
+	// Only the extension process itself is counted, and processes spawned by it are not.
+	Memory uint64
+	// Timeout is the max running time.
+	Timeout time.Duration
+}
+
+// SetLimits sets resource limits of extension processes started by Dispatch.
+// Runaway processes are killed by a watchdog. Default has no limits.
+func (m *Manager) SetLimits(l Limits) {
+	m.limits = l
+}
+
+func (m *Manager) run(name string, cmd *exec.Cmd) error {
+	l := m.limits
+	if l == (Limits{}) {
+		return cmd.Run()
+	}
+
+	if l.Memory > 0 {
+		if _, err := memoryUsage(os.Getpid()); err != nil {
+			return errors.Errorf("memory limit is not supported on %s", runtime.GOOS)
+		}
+	}
+
+	cmd.WaitDelay = killWaitDelay
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done, exceeded := make(chan struct{}), make(chan error, 1)
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		watch(cmd.Process, l, done, exceeded)
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	// watchdog either killed the process or observed done
+	<-watched
+
+	select {
+	case lerr := <-exceeded:
+		// process which finished normally right before being killed is not reported
+		if err == nil {
+			return nil
+		}
+		return errors.Wrapf(lerr, "extension %s killed", name)
+	default:
+		return err
+	}
+}
+
+func watch(p *os.Process, l Limits, done <-chan struct{}, exceeded chan<- error) {
+	var timeout <-chan time.Time
+	if l.Timeout > 0 {
+		timer := time.NewTimer(l.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var tick <-chan time.Time
+	if l.Memory > 0 {
+		ticker := time.NewTicker(memCheckInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	kill := func(err error) {
+		select {
+		case <-done: // exited while checking limits
+			return
+		default:
+		}
+		// process is already finished if kill fails
+		if p.Kill() == nil {
+			exceeded <- err
+		}
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-timeout:
+			kill(fmt.Errorf("%w: running time exceeds %s", ErrLimitExceeded, l.Timeout))
+			return
+		case <-tick:
+			usage, err := memoryUsage(p.Pid)
+			if err != nil { // process may have exited
+				continue
+			}
+			if usage > l.Memory {
+				kill(fmt.Errorf("%w: memory usage %d bytes exceeds %d bytes", ErrLimitExceeded, usage, l.Memory))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package extensions
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// memoryUsage returns resident memory of process in bytes
+func memoryUsage(pid int) (uint64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// format: "VmRSS:     1234 kB"
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || fields[0] != "VmRSS:" {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, errors.Wrap(err, "parse VmRSS")
+		}
+		return kb * 1024, nil
+	}
+	if err = sc.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("VmRSS not found")
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package extensions
+
+import "github.com/go-faster/errors"
+
+func memoryUsage(int) (uint64, error) {
+	return 0, errors.New("not supported")
+}
@@ -0,0 +1,70 @@
+package extensions
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/extension"
+)
+
+func TestManager_Limits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script extensions are not supported on windows")
+	}
+
+	dir := t.TempDir()
+	script := func(name, content string) Extension {
+		path := filepath.Join(dir, Prefix+name)
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+content+"\n"), 0o755))
+		return &localExtension{baseExtension: baseExtension{path: path}}
+	}
+	dispatch := func(m *Manager, ext Extension) error {
+		return m.Dispatch(ext, nil, &extension.Env{}, nil, io.Discard, io.Discard)
+	}
+
+	sleep, quick := script("sleep", "sleep 5"), script("quick", "exit 0")
+
+	t.Run("no limits", func(t *testing.T) {
+		assert.NoError(t, dispatch(NewManager(dir), quick))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		m := NewManager(dir)
+		m.SetLimits(Limits{Timeout: 100 * time.Millisecond})
+
+		start := time.Now()
+		err := dispatch(m, sleep)
+		assert.ErrorIs(t, err, ErrLimitExceeded)
+		assert.ErrorContains(t, err, "extension sleep killed")
+		assert.Less(t, time.Since(start), 3*time.Second)
+
+		assert.NoError(t, dispatch(m, quick))
+	})
+
+	t.Run("finished before killed", func(t *testing.T) {
+		cmd := exec.Command(quick.Path())
+		require.NoError(t, cmd.Run())
+
+		exceeded := make(chan error, 1)
+		watch(cmd.Process, Limits{Timeout: time.Millisecond}, make(chan struct{}), exceeded)
+		assert.Empty(t, exceeded, "finished process is not reported as killed")
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("memory limit is only supported on linux")
+		}
+
+		m := NewManager(dir)
+		m.SetLimits(Limits{Memory: 1})
+		assert.ErrorIs(t, dispatch(m, sleep), ErrLimitExceeded)
+	})
+}
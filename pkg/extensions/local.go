@@ -29,6 +29,14 @@ func (l *localExtension) LatestVersion(_ context.Context) string {
 	return ""
 }
 
+func (l *localExtension) CachedLatestVersion() string {
+	return ""
+}
+
 func (l *localExtension) UpdateAvailable(_ context.Context) bool {
 	return false
 }
+
+func (l *localExtension) MinTDLVersion() string {
+	return ""
+}
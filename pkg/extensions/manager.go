@@ -24,31 +24,79 @@ import (
 var (
 	ErrAlreadyUpToDate = errors.New("already up to date")
 	ErrOnlyGitHub      = errors.New("only GitHub extension can be upgraded by tdl")
+	// ErrIncompatibleVersion is returned when running tdl is older than the min version required by extension.
+	ErrIncompatibleVersion = errors.New("incompatible tdl version")
+	// ErrRateLimited is returned when GitHub API rate limit is exceeded.
+	ErrRateLimited = errors.New("GitHub API rate limit exceeded")
+	// ErrNotInstalled is returned when extension is not installed.
+	ErrNotInstalled = errors.New("extension not installed")
 )
 
+// githubTokenEnvs are environment variables to read GitHub token from, in priority order.
+// Authenticated requests have a much higher rate limit.
+var githubTokenEnvs = []string{"GITHUB_TOKEN", "GH_TOKEN"}
+
 type Manager struct {
 	dir    string
 	http   *http.Client
 	github *github.Client
 
-	dryRun bool
+	dryRun     bool
+	tdlVersion string
+
+	// target platform of release assets, empty means current runtime
+	goos   string
+	goarch string
+	picker AssetPicker
+
+	limits  Limits
+	onEvent EventHandler
+
+	// names of built-in commands, which can't be used as aliases
+	reserved map[string]struct{}
+
+	// migrated runs Migrate once before extensions dir is accessed
+	migrated sync.Once
 }
 
 func NewManager(dir string) *Manager {
 	return &Manager{
 		dir:    dir,
 		http:   http.DefaultClient,
-		github: newGhClient(http.DefaultClient),
+		github: newGhClient(http.DefaultClient, ""),
 		dryRun: false,
 	}
 }
 
-func newGhClient(c *http.Client) *github.Client {
-	ghToken := os.Getenv("GITHUB_TOKEN")
-	if ghToken == "" {
-		return github.NewClient(c)
+func newGhClient(c *http.Client, version string) *github.Client {
+	client := github.NewClient(c)
+	client.UserAgent = userAgent(version)
+
+	for _, env := range githubTokenEnvs {
+		if token := os.Getenv(env); token != "" {
+			return client.WithAuthToken(token)
+		}
+	}
+	return client
+}
+
+func userAgent(version string) string {
+	if version == "" {
+		version = "unknown"
+	}
+	return "tdl-extension-manager/" + version
+}
+
+// wrapGitHubError wraps rate limit errors with ErrRateLimited, so that callers can suggest setting a token.
+func wrapGitHubError(err error) error {
+	var (
+		rateErr  *github.RateLimitError
+		abuseErr *github.AbuseRateLimitError
+	)
+	if errors.As(err, &rateErr) || errors.As(err, &abuseErr) {
+		return errors.Wrapf(ErrRateLimited, "%v", err)
 	}
-	return github.NewClient(c).WithAuthToken(ghToken)
+	return err
 }
 
 func (m *Manager) SetDryRun(v bool) {
@@ -59,9 +107,28 @@ func (m *Manager) DryRun() bool {
 	return m.dryRun
 }
 
+// SetTDLVersion sets running tdl version, which is used to check compatibility of extensions.
+func (m *Manager) SetTDLVersion(v string) {
+	m.tdlVersion = v
+	m.github.UserAgent = userAgent(v)
+}
+
+// SetPlatform overrides target OS and arch used to select release assets of GitHub extensions,
+// e.g. installing arm64 extensions on amd64 host for container images. Empty means current runtime.
+func (m *Manager) SetPlatform(goos, goarch string) {
+	m.goos = goos
+	m.goarch = goarch
+}
+
+// SetAssetPicker overrides the strategy to pick release assets of GitHub extensions, e.g. GlobAssetPicker
+// for non-standard asset names. Nil means DefaultAssetPicker.
+func (m *Manager) SetAssetPicker(p AssetPicker) {
+	m.picker = p
+}
+
 func (m *Manager) SetClient(client *http.Client) {
 	m.http = client
-	m.github = newGhClient(client)
+	m.github = newGhClient(client, m.tdlVersion)
 }
 
 func (m *Manager) Dispatch(ext Extension, args []string, env *extension.Env, stdin io.Reader, stdout, stderr io.Writer) (rerr error) {
@@ -86,15 +153,18 @@ func (m *Manager) Dispatch(ext Extension, args []string, env *extension.Env, std
 	}
 
 	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", extension.EnvKey, envFile.Name()))
+	cmd.Env = append(cmd.Env, env.Environ()...)
 	cmd.Args = append([]string{Prefix + ext.Name()}, args...) // reset args[0] to extension name instead of binary path
 	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
-	return cmd.Run()
+	return m.run(ext.Name(), cmd)
 }
 
 func (m *Manager) List(ctx context.Context, includeLatestVersion bool) ([]Extension, error) {
+	m.migrate(ctx)
+
 	entries, err := os.ReadDir(m.dir)
 	if err != nil {
 		return nil, errors.Wrap(err, "read dir entries")
@@ -110,16 +180,7 @@ func (m *Manager) List(ctx context.Context, includeLatestVersion bool) ([]Extens
 			continue
 		}
 
-		if _, err = os.Stat(filepath.Join(m.dir, f.Name(), manifestName)); err == nil {
-			extensions = append(extensions, &githubExtension{
-				baseExtension: baseExtension{path: filepath.Join(m.dir, f.Name(), f.Name())},
-				client:        m.github,
-			})
-		} else {
-			extensions = append(extensions, &localExtension{
-				baseExtension: baseExtension{path: filepath.Join(m.dir, f.Name(), f.Name())},
-			})
-		}
+		extensions = append(extensions, m.load(f.Name()))
 	}
 
 	if includeLatestVersion {
@@ -129,11 +190,50 @@ func (m *Manager) List(ctx context.Context, includeLatestVersion bool) ([]Extens
 	return extensions, nil
 }
 
+// Get returns the installed extension of name, which can be with or without Prefix,
+// or ErrNotInstalled. Latest version is not populated.
+func (m *Manager) Get(ctx context.Context, name string) (Extension, error) {
+	m.migrate(ctx)
+
+	dir := Prefix + strings.TrimPrefix(name, Prefix)
+	// names are never paths, and must not escape extensions dir
+	if strings.ContainsAny(dir, `/\`) || dir == Prefix+".." {
+		return nil, errors.Wrap(ErrNotInstalled, name)
+	}
+
+	stat, err := os.Stat(filepath.Join(m.dir, dir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrap(ErrNotInstalled, name)
+		}
+		return nil, errors.Wrap(err, "stat extension dir")
+	}
+	if !stat.IsDir() {
+		return nil, errors.Wrap(ErrNotInstalled, name)
+	}
+
+	return m.load(dir), nil
+}
+
+// load returns extension in dir named Prefix+name
+func (m *Manager) load(dir string) Extension {
+	base := baseExtension{path: filepath.Join(m.dir, dir, dir)}
+
+	if _, err := os.Stat(filepath.Join(m.dir, dir, manifestName)); err == nil {
+		return &githubExtension{baseExtension: base, client: m.github}
+	}
+	return &localExtension{baseExtension: base}
+}
+
 // Upgrade only GitHub extension can be upgraded
 func (m *Manager) Upgrade(ctx context.Context, ext Extension) error {
 	switch e := ext.(type) {
 	case *githubExtension:
 		if !ext.UpdateAvailable(ctx) {
+			// latest version is unknown if ctx is done, which doesn't mean up-to-date
+			if err := ctx.Err(); err != nil {
+				return errors.Wrapf(err, "get latest version of %q", e.Name())
+			}
 			return ErrAlreadyUpToDate
 		}
 
@@ -142,11 +242,19 @@ func (m *Manager) Upgrade(ctx context.Context, ext Extension) error {
 			return errors.Wrapf(err, "load manifest of %q", e.Name())
 		}
 
+		// check before removing old version, otherwise user will lose the working one
+		m.emit(Event{Type: EventVerify, Target: e.Name()})
+		minVersion, err := m.fetchMinTDLVersion(ctx, mf.Owner, mf.Repo, ext.LatestVersion(ctx))
+		if err != nil {
+			return errors.Wrapf(err, "get min tdl version of %q", e.Name())
+		}
+		if err = m.checkVersion(minVersion); err != nil {
+			return err
+		}
+
 		if !m.dryRun {
-			if err = m.Remove(ext); err != nil {
-				return errors.Wrapf(err, "remove old version extension")
-			}
-			if err = m.installGitHub(ctx, mf.Owner, mf.Repo, false); err != nil {
+			// old version is replaced only after the new one is installed
+			if err = m.installGitHub(ctx, e.Name(), mf.Owner, mf.Repo, true); err != nil {
 				return errors.Wrapf(err, "install GitHub extension %q", e.Name())
 			}
 		}
@@ -157,14 +265,29 @@ func (m *Manager) Upgrade(ctx context.Context, ext Extension) error {
 	}
 }
 
+// TargetType returns the type of extension which is installed from target.
+func TargetType(target string) ExtensionType {
+	if _, err := os.Stat(target); err == nil {
+		return ExtensionTypeLocal
+	}
+	return ExtensionTypeGithub
+}
+
 // Install installs an extension by target.
 // Valid targets are:
 // - GitHub: owner/repo
-// - Local: path to executable.
+// - Local: path to executable, or release archive(.tar.gz, .tgz, .zip) containing the executable.
+//
+// Local extensions can't be upgraded by tdl.
 func (m *Manager) Install(ctx context.Context, target string, force bool) error {
+	m.migrate(ctx)
+
 	// local
-	if _, err := os.Stat(target); err == nil {
-		return m.installLocal(target, force)
+	if TargetType(target) == ExtensionTypeLocal {
+		if isArchive(target) {
+			return m.installArchive(target, force)
+		}
+		return m.installLocal(target, target, force)
 	}
 
 	// github
@@ -173,10 +296,11 @@ func (m *Manager) Install(ctx context.Context, target string, force bool) error
 		return errors.Errorf("invalid target: %q", target)
 	}
 
-	return m.installGitHub(ctx, ownerRepo[0], ownerRepo[1], force)
+	return m.installGitHub(ctx, target, ownerRepo[0], ownerRepo[1], force)
 }
 
-func (m *Manager) installLocal(path string, force bool) error {
+// installLocal installs local executable, and target is reported in events
+func (m *Manager) installLocal(target, path string, force bool) error {
 	src, err := os.Lstat(path)
 	if err != nil {
 		return errors.Wrap(err, "source extension stat")
@@ -197,63 +321,89 @@ func (m *Manager) installLocal(path string, force bool) error {
 	}
 
 	if !m.dryRun {
-		if err = os.MkdirAll(targetDir, 0o755); err != nil {
-			return errors.Wrapf(err, "create target dir %q for extension %q", targetDir, name)
-		}
-
-		if err = copyRegularFile(path, binPath); err != nil {
-			return errors.Wrapf(err, "install local extension: %q", path)
+		m.emit(Event{Type: EventInstall, Target: target})
+		if err = m.stage(targetDir, func(dir string) error {
+			if err := copyRegularFile(path, filepath.Join(dir, name)); err != nil {
+				return errors.Wrapf(err, "install local extension: %q", path)
+			}
+			return nil
+		}); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (m *Manager) installGitHub(ctx context.Context, owner, repo string, force bool) (rerr error) {
-	if !strings.HasPrefix(repo, Prefix) {
-		return errors.Errorf("invalid repo name: %q, should start with %q", repo, Prefix)
+func (m *Manager) installArchive(path string, force bool) (rerr error) {
+	tmp, err := os.MkdirTemp("", "tdl-extension-*")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir")
 	}
+	defer multierr.AppendInvoke(&rerr, multierr.Invoke(func() error { return os.RemoveAll(tmp) }))
 
-	platform, ext := platformBinaryName()
+	m.emit(Event{Type: EventExtract, Target: path})
+	bin, err := extractExecutable(path, tmp)
+	if err != nil {
+		return errors.Wrapf(err, "extract archive %q", path)
+	}
 
-	targetDir := filepath.Join(m.dir, repo)
-	binPath := filepath.Join(targetDir, repo) + ext
-	if err := m.maybeExist(binPath, force); err != nil {
-		return err
+	return m.installLocal(path, bin, force)
+}
+
+// installGitHub installs latest release of owner/repo, and target is reported in events
+func (m *Manager) installGitHub(ctx context.Context, target, owner, repo string, force bool) (rerr error) {
+	if !strings.HasPrefix(repo, Prefix) {
+		return errors.Errorf("invalid repo name: %q, should start with %q", repo, Prefix)
 	}
 
+	platform, ext := platformBinaryName(m.goos, m.goarch)
+
+	m.emit(Event{Type: EventResolve, Target: target})
 	release, _, err := m.github.Repositories.GetLatestRelease(ctx, owner, repo)
 	if err != nil {
-		return errors.Wrapf(err, "get latest release of %s/%s", owner, repo)
+		return errors.Wrapf(wrapGitHubError(err), "get latest release of %s/%s", owner, repo)
 	}
 
-	// match binary name
-	var asset *github.ReleaseAsset
-	for _, a := range release.Assets {
-		if strings.HasSuffix(a.GetName(), platform+ext) {
-			asset = a
-			break
-		}
+	m.emit(Event{Type: EventVerify, Target: target})
+	minVersion, err := m.fetchMinTDLVersion(ctx, owner, repo, release.GetTagName())
+	if err != nil {
+		return errors.Wrapf(err, "get min tdl version of %s/%s", owner, repo)
 	}
-
-	if asset == nil {
-		return errors.Errorf("no matched binary(%s) found in the release(%s)", platform+ext, release.GetHTMLURL())
+	if err = m.checkVersion(minVersion); err != nil {
+		return err
 	}
 
-	if !m.dryRun {
-		if err = os.MkdirAll(targetDir, 0o755); err != nil {
-			return errors.Wrapf(err, "create target dir %q for extension %s/%s", targetDir, owner, repo)
-		}
+	targetDir := filepath.Join(m.dir, repo)
+	binPath := filepath.Join(targetDir, repo) + ext
+	if err = m.maybeExist(binPath, force); err != nil {
+		return err
+	}
 
-		if err = m.downloadGitHubAsset(ctx, owner, repo, asset, binPath); err != nil {
-			return errors.Wrapf(err, "download github asset %s", asset.GetBrowserDownloadURL())
-		}
+	// match binary or archive name
+	names := make([]string, 0, len(release.Assets))
+	for _, a := range release.Assets {
+		names = append(names, a.GetName())
 	}
+	picker := m.picker
+	if picker == nil {
+		picker = DefaultAssetPicker
+	}
+	goos, goarch, _ := strings.Cut(platform, "-")
+	i := picker(names, goos, goarch)
+	if i < 0 || i >= len(release.Assets) {
+		return errors.Errorf("no matched binary(%s) found in the release(%s), available assets: [%s]",
+			platform+ext, release.GetHTMLURL(), strings.Join(names, ", "))
+	}
+	asset := release.Assets[i]
 
 	mf := &manifest{
 		Owner: owner,
 		Repo:  repo,
 		Tag:   release.GetTagName(),
+
+		MinTDLVersion: minVersion,
+		Latest:        release.GetTagName(),
 	}
 
 	mfb, err := json.Marshal(mf)
@@ -262,18 +412,24 @@ func (m *Manager) installGitHub(ctx context.Context, owner, repo string, force b
 	}
 
 	if !m.dryRun {
-		if err = os.WriteFile(filepath.Join(targetDir, manifestName), mfb, 0o644); err != nil {
-			return errors.Wrapf(err, "write manifest to %s", targetDir)
-		}
+		return m.stage(targetDir, func(dir string) error {
+			if err := m.installGitHubAsset(ctx, target, owner, repo, asset, dir, filepath.Base(binPath)); err != nil {
+				return err
+			}
+
+			m.emit(Event{Type: EventInstall, Target: target})
+			if err := os.WriteFile(filepath.Join(dir, manifestName), mfb, 0o644); err != nil {
+				return errors.Wrapf(err, "write manifest to %s", targetDir)
+			}
+			return nil
+		})
 	}
 
 	return nil
 }
 
+// maybeExist returns error if extension of binPath exists without force, and existing ones are replaced by stage
 func (m *Manager) maybeExist(binPath string, force bool) error {
-	targetDir := filepath.Dir(binPath)
-	extName := filepath.Base(targetDir)
-
 	if _, err := os.Lstat(binPath); err != nil {
 		return nil
 	}
@@ -282,17 +438,42 @@ func (m *Manager) maybeExist(binPath string, force bool) error {
 		return errors.Errorf("extension already exists, please remove it first")
 	}
 
-	// force remove
-	if !m.dryRun {
-		if err := os.RemoveAll(targetDir); err != nil {
-			return errors.Wrapf(err, "remove existing extension %q", extName)
-		}
+	return nil
+}
+
+// stage builds extension in a temp dir of extensions dir, which is ignored by List, and renames it to targetDir
+// only after build succeeds. So canceled or failed installs never leave partial extensions, and existing
+// extension in targetDir is kept until it's replaced.
+func (m *Manager) stage(targetDir string, build func(dir string) error) (rerr error) {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return errors.Wrap(err, "create extensions dir")
+	}
+
+	tmp, err := os.MkdirTemp(m.dir, stagingPrefix+"*")
+	if err != nil {
+		return errors.Wrap(err, "create staging dir")
+	}
+	// no-op if tmp is renamed
+	defer multierr.AppendInvoke(&rerr, multierr.Invoke(func() error { return os.RemoveAll(tmp) }))
+
+	if err = os.Chmod(tmp, 0o755); err != nil {
+		return errors.Wrap(err, "chmod staging dir")
+	}
+	if err = build(tmp); err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(targetDir); err != nil {
+		return errors.Wrapf(err, "remove existing extension %q", filepath.Base(targetDir))
+	}
+	if err = os.Rename(tmp, targetDir); err != nil {
+		return errors.Wrapf(err, "rename staging dir to %q", targetDir)
 	}
 
 	return nil
 }
 
-// Remove removes an extension by name(without prefix).
+// Remove removes an extension by name(without prefix) with its aliases.
 func (m *Manager) Remove(ext Extension) error {
 	target := Prefix + ext.Name()
 	targetDir := filepath.Join(m.dir, target)
@@ -301,7 +482,10 @@ func (m *Manager) Remove(ext Extension) error {
 	}
 
 	if !m.dryRun {
-		return os.RemoveAll(targetDir)
+		if err := os.RemoveAll(targetDir); err != nil {
+			return err
+		}
+		return m.removeAliases(ext.Name())
 	}
 
 	return nil
@@ -319,10 +503,41 @@ func (m *Manager) populateLatestVersions(ctx context.Context, exts []Extension)
 	wg.Wait()
 }
 
-func (m *Manager) downloadGitHubAsset(ctx context.Context, owner, repo string, asset *github.ReleaseAsset, dst string) (rerr error) {
+// installGitHubAsset downloads asset as executable bin in dir, and the only executable of archive asset is extracted
+func (m *Manager) installGitHubAsset(ctx context.Context, target, owner, repo string, asset *github.ReleaseAsset, dir, bin string) error {
+	if !isArchive(asset.GetName()) {
+		if err := m.downloadGitHubAsset(ctx, target, owner, repo, asset, filepath.Join(dir, bin)); err != nil {
+			return errors.Wrapf(err, "download github asset %s", asset.GetBrowserDownloadURL())
+		}
+		return nil
+	}
+
+	// archive and extracted files are in the staging dir, which is removed on failure
+	archive := filepath.Join(dir, filepath.Base(asset.GetName()))
+	if err := m.downloadGitHubAsset(ctx, target, owner, repo, asset, archive); err != nil {
+		return errors.Wrapf(err, "download github asset %s", asset.GetBrowserDownloadURL())
+	}
+
+	extracted := filepath.Join(dir, ".extract")
+	if err := os.Mkdir(extracted, 0o755); err != nil {
+		return errors.Wrap(err, "create extract dir")
+	}
+	m.emit(Event{Type: EventExtract, Target: target})
+	path, err := extractExecutable(archive, extracted)
+	if err != nil {
+		return errors.Wrapf(err, "extract archive %s", asset.GetName())
+	}
+	if err = os.Rename(path, filepath.Join(dir, bin)); err != nil {
+		return errors.Wrap(err, "move extracted executable")
+	}
+
+	return multierr.Combine(os.Remove(archive), os.RemoveAll(extracted))
+}
+
+func (m *Manager) downloadGitHubAsset(ctx context.Context, target, owner, repo string, asset *github.ReleaseAsset, dst string) (rerr error) {
 	readCloser, _, err := m.github.Repositories.DownloadReleaseAsset(ctx, owner, repo, asset.GetID(), m.http)
 	if err != nil {
-		return errors.Wrapf(err, "download release asset %s", asset.GetName())
+		return errors.Wrapf(wrapGitHubError(err), "download release asset %s", asset.GetName())
 	}
 	defer multierr.AppendInvoke(&rerr, multierr.Close(readCloser))
 
@@ -332,7 +547,18 @@ func (m *Manager) downloadGitHubAsset(ctx context.Context, owner, repo string, a
 	}
 	defer multierr.AppendInvoke(&rerr, multierr.Close(file))
 
-	if _, err = io.Copy(file, readCloser); err != nil {
+	total := int64(asset.GetSize())
+	if total <= 0 {
+		total = -1
+	}
+	r := &progressReader{
+		r:     readCloser,
+		emit:  m.emit,
+		event: Event{Type: EventDownload, Target: target, Total: total},
+	}
+	m.emit(r.event)
+
+	if _, err = io.Copy(file, r); err != nil {
 		return errors.Wrapf(err, "copy http body to %s", dst)
 	}
 	return nil
@@ -365,21 +591,30 @@ func copyRegularFile(src, dst string) (rerr error) {
 	return nil
 }
 
-func platformBinaryName() (string, string) {
+// platformBinaryName returns platform suffix and executable extension of release assets.
+// Empty goos or goarch means current runtime.
+func platformBinaryName(goos, goarch string) (string, string) {
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+
 	ext := ""
-	if runtime.GOOS == "windows" {
+	if goos == "windows" {
 		ext = ".exe"
 	}
 
-	arch := runtime.GOARCH
-	switch arch {
-	case "arm":
-		if goarm := extractGOARM(); goarm != "" {
-			arch += "v" + goarm
+	arch := goarch
+	if arch == "" {
+		arch = runtime.GOARCH
+		switch arch {
+		case "arm":
+			if goarm := extractGOARM(); goarm != "" {
+				arch += "v" + goarm
+			}
 		}
 	}
 
-	return fmt.Sprintf("%s-%s", runtime.GOOS, arch), ext
+	return fmt.Sprintf("%s-%s", goos, arch), ext
 }
 
 func extractGOARM() string {
@@ -0,0 +1,292 @@
+package extensions
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_RateLimited(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+
+	var ua string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+	}))
+	defer srv.Close()
+
+	m := NewManager(t.TempDir())
+	m.SetTDLVersion("v0.18.0")
+
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+	m.github.BaseURL = base
+
+	err = m.Install(context.Background(), "owner/tdl-foo", false)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Equal(t, "tdl-extension-manager/v0.18.0", ua)
+}
+
+func TestPlatformBinaryName(t *testing.T) {
+	platform, ext := platformBinaryName("", "")
+	assert.Equal(t, runtime.GOOS+"-", platform[:len(runtime.GOOS)+1])
+	if runtime.GOOS == "windows" {
+		assert.Equal(t, ".exe", ext)
+	}
+
+	platform, ext = platformBinaryName("linux", "arm64")
+	assert.Equal(t, "linux-arm64", platform)
+	assert.Equal(t, "", ext)
+
+	platform, ext = platformBinaryName("windows", "amd64")
+	assert.Equal(t, "windows-amd64", platform)
+	assert.Equal(t, ".exe", ext)
+}
+
+func TestManager_InstallArchive(t *testing.T) {
+	files := map[string]string{
+		"README.md":       "readme",
+		"dist/tdl-foo":    "#!/bin/sh",
+		"dist/LICENSE":    "license",
+		"dist/sub/dir/x/": "",
+	}
+
+	tests := []struct {
+		name   string
+		create func(t *testing.T, path string)
+		file   string
+	}{
+		{name: "tar.gz", file: "tdl-foo_linux_amd64.tar.gz", create: func(t *testing.T, path string) {
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			gz := gzip.NewWriter(f)
+			tw := tar.NewWriter(gz)
+			for name, content := range files {
+				if strings.HasSuffix(name, "/") {
+					require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0o755}))
+					continue
+				}
+				require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(content))}))
+				_, err = tw.Write([]byte(content))
+				require.NoError(t, err)
+			}
+			require.NoError(t, tw.Close())
+			require.NoError(t, gz.Close())
+			require.NoError(t, f.Close())
+		}},
+		{name: "zip", file: "tdl-foo_linux_amd64.zip", create: func(t *testing.T, path string) {
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			zw := zip.NewWriter(f)
+			for name, content := range files {
+				w, err := zw.Create(name)
+				require.NoError(t, err)
+				_, err = w.Write([]byte(content))
+				require.NoError(t, err)
+			}
+			require.NoError(t, zw.Close())
+			require.NoError(t, f.Close())
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), tt.file)
+			tt.create(t, archive)
+
+			m := NewManager(t.TempDir())
+			events := make([]EventType, 0)
+			m.SetEventHandler(func(e Event) {
+				assert.Equal(t, archive, e.Target)
+				events = append(events, e.Type)
+			})
+			require.NoError(t, m.Install(context.Background(), archive, false))
+			assert.Equal(t, []EventType{EventExtract, EventInstall}, events)
+
+			exts, err := m.List(context.Background(), false)
+			require.NoError(t, err)
+			require.Len(t, exts, 1)
+			assert.Equal(t, "foo", exts[0].Name())
+			assert.Equal(t, ExtensionTypeLocal, exts[0].Type())
+
+			b, err := os.ReadFile(exts[0].Path())
+			require.NoError(t, err)
+			assert.Equal(t, "#!/bin/sh", string(b))
+
+			// local extensions can't be upgraded
+			assert.ErrorIs(t, m.Upgrade(context.Background(), exts[0]), ErrOnlyGitHub)
+		})
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	events := make([]Event, 0)
+	r := &progressReader{
+		r:     strings.NewReader("hello world"),
+		emit:  func(e Event) { events = append(events, e) },
+		event: Event{Type: EventDownload, Target: "foo/tdl-bar", Total: 11},
+	}
+
+	buf := make([]byte, 4)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			break
+		}
+	}
+
+	require.Len(t, events, 3)
+	assert.Equal(t, []int64{4, 8, 11}, []int64{events[0].Done, events[1].Done, events[2].Done})
+	assert.Equal(t, int64(11), events[2].Total)
+}
+
+func TestManager_Get(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir)
+	// flat files are not migrated in current layout
+	require.NoError(t, m.writeLayout(LayoutVersion))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tdl-local"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tdl-remote"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tdl-remote", manifestName), []byte("{}"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tdl-file"), nil, 0o644))
+
+	ctx := context.Background()
+
+	e, err := m.Get(ctx, "local")
+	require.NoError(t, err)
+	assert.Equal(t, "local", e.Name())
+	assert.IsType(t, &localExtension{}, e)
+
+	e, err = m.Get(ctx, "tdl-remote")
+	require.NoError(t, err)
+	assert.Equal(t, "remote", e.Name())
+	assert.IsType(t, &githubExtension{}, e)
+
+	for _, name := range []string{"missing", "file", "../tdl-local", "tdl-.."} {
+		_, err = m.Get(ctx, name)
+		assert.ErrorIs(t, err, ErrNotInstalled, name)
+	}
+}
+
+func TestManager_InstallCanceled(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/releases/latest"):
+			_, _ = w.Write([]byte(`{"tag_name":"v1.0.0","assets":[{"id":1,"name":"tdl-foo_linux-amd64","size":1024}]}`))
+		case strings.HasSuffix(r.URL.Path, "/releases/assets/1"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			// the rest never comes until client gives up
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	old := filepath.Join(dir, "tdl-foo", "tdl-foo")
+	require.NoError(t, os.MkdirAll(filepath.Dir(old), 0o755))
+	require.NoError(t, os.WriteFile(old, []byte("old"), 0o755))
+
+	m := NewManager(dir)
+	m.SetPlatform("linux", "amd64")
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+	m.github.BaseURL = base
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.SetEventHandler(func(e Event) {
+		// cancel like Ctrl-C after receiving some bytes
+		if e.Type == EventDownload && e.Done > 0 {
+			cancel()
+		}
+	})
+
+	err = m.Install(ctx, "owner/tdl-foo", true)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// no staging dirs or partial binaries are left, and existing extension is kept
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, layoutName, entries[0].Name(), "layout is written by migration")
+	assert.Equal(t, "tdl-foo", entries[1].Name())
+
+	b, err := os.ReadFile(old)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(b))
+	_, err = os.Stat(filepath.Join(dir, "tdl-foo", manifestName))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestManager_CachedLatestVersion(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"tag_name":"v1.1.0"}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tdl-foo"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tdl-foo", manifestName),
+		[]byte(`{"owner":"owner","repo":"tdl-foo","tag":"v1.0.0","latest":"v1.0.0"}`), 0o644))
+
+	m := NewManager(dir)
+	base, err := url.Parse(srv.URL + "/")
+	require.NoError(t, err)
+	m.github.BaseURL = base
+
+	ctx := context.Background()
+
+	// offline listing never requests GitHub
+	exts, err := m.List(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, exts, 1)
+	assert.Equal(t, "v1.0.0", exts[0].CachedLatestVersion())
+	assert.Zero(t, requests)
+
+	exts, err = m.List(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", exts[0].LatestVersion(ctx))
+	assert.Equal(t, 1, requests)
+
+	// cached by remote listing
+	e, err := m.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", e.CachedLatestVersion())
+	assert.Equal(t, "v1.0.0", e.CurrentVersion())
+}
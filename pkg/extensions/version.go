@@ -0,0 +1,109 @@
+package extensions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/google/go-github/v62/github"
+)
+
+// remoteManifestName is the optional file in the root of extension repository,
+// which declares constraints of the extension.
+const remoteManifestName = "tdl-extension.json"
+
+type remoteManifest struct {
+	MinTDLVersion string `json:"min_tdl_version,omitempty"`
+}
+
+// fetchMinTDLVersion returns the min tdl version declared by repository at tag, and empty if not declared.
+func (m *Manager) fetchMinTDLVersion(ctx context.Context, owner, repo, tag string) (string, error) {
+	content, _, resp, err := m.github.Repositories.GetContents(ctx, owner, repo, remoteManifestName,
+		&github.RepositoryContentGetOptions{Ref: tag})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", errors.Wrapf(wrapGitHubError(err), "get %s of %s/%s", remoteManifestName, owner, repo)
+	}
+
+	raw, err := content.GetContent()
+	if err != nil {
+		return "", errors.Wrapf(err, "decode %s", remoteManifestName)
+	}
+
+	mf := remoteManifest{}
+	if err = json.Unmarshal([]byte(raw), &mf); err != nil {
+		return "", errors.Wrapf(err, "unmarshal %s", remoteManifestName)
+	}
+
+	return mf.MinTDLVersion, nil
+}
+
+// checkVersion checks if running tdl version satisfies the min version required by extension.
+func (m *Manager) checkVersion(min string) error {
+	if min == "" {
+		return nil
+	}
+
+	// dev builds or unknown versions are regarded as the latest
+	if _, ok := parseVersion(m.tdlVersion); !ok {
+		return nil
+	}
+
+	if compareVersion(m.tdlVersion, min) < 0 {
+		return errors.Wrapf(ErrIncompatibleVersion, "requires tdl %s or later, current is %s", min, m.tdlVersion)
+	}
+
+	return nil
+}
+
+// Compatible checks if installed extension is compatible with running tdl version.
+func (m *Manager) Compatible(ext Extension) error {
+	return m.checkVersion(ext.MinTDLVersion())
+}
+
+// compareVersion compares two versions like v1.2.3, and returns -1, 0 or 1.
+// Pre-release and build metadata are ignored.
+func compareVersion(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+
+	for i := range va {
+		switch {
+		case va[i] < vb[i]:
+			return -1
+		case va[i] > vb[i]:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var r [3]int
+
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return r, false
+	}
+
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return r, false
+		}
+		r[i] = n
+	}
+
+	return r, true
+}
@@ -0,0 +1,56 @@
+package extensions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "v0.18.3", b: "v0.18.3", expected: 0},
+		{a: "0.18.3", b: "v0.18.3", expected: 0},
+		{a: "v0.18.3", b: "v0.19.0", expected: -1},
+		{a: "v1.0.0", b: "v0.19.0", expected: 1},
+		{a: "v0.18", b: "v0.18.0", expected: 0},
+		{a: "v0.18.3-rc.1", b: "v0.18.3", expected: 0},
+		{a: "v0.9.0", b: "v0.10.0", expected: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.expected, compareVersion(tt.a, tt.b))
+		})
+	}
+}
+
+func TestManager_CheckVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		min     string
+		wantErr bool
+	}{
+		{name: "no constraint", current: "v0.18.0", min: "", wantErr: false},
+		{name: "satisfied", current: "v0.18.0", min: "v0.17.0", wantErr: false},
+		{name: "too old", current: "v0.16.0", min: "v0.17.0", wantErr: true},
+		{name: "dev build", current: "dev", min: "v0.17.0", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(t.TempDir())
+			m.SetTDLVersion(tt.current)
+
+			err := m.checkVersion(tt.min)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrIncompatibleVersion)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
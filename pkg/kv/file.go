@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/go-faster/errors"
 	"github.com/mitchellh/mapstructure"
@@ -20,40 +21,66 @@ func init() {
 
 type file struct {
 	path string
-	mu   sync.Mutex
+	// advisory lock to prevent concurrent processes from corrupting file
+	unlock func() error
+	mu     sync.Mutex
 }
 
 func newFile(opts map[string]any) (Storage, error) {
 	type options struct {
 		Path string `validate:"required" mapstructure:"path"`
+		// LockTimeout is the max duration to wait for other processes to release the file,
+		// zero means fail immediately.
+		LockTimeout time.Duration `mapstructure:"lock_timeout"`
 	}
 
 	var o options
-	if err := mapstructure.WeakDecode(opts, &o); err != nil {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &o,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create options decoder")
+	}
+	if err = decoder.Decode(opts); err != nil {
 		return nil, errors.Wrap(err, "decode options")
 	}
 
-	if err := validator.Struct(&o); err != nil {
+	if err = validator.Struct(&o); err != nil {
 		return nil, errors.Wrap(err, "validate options")
 	}
 
-	_, err := os.Stat(o.Path)
+	if err = initFile(o.Path); err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockFile(o.Path+".lock", o.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file{path: o.Path, unlock: unlock}, nil
+}
+
+func initFile(path string) error {
+	_, err := os.Stat(path)
 	if err == nil {
-		return &file{path: o.Path}, nil
+		return nil
 	}
 
 	if !os.IsNotExist(err) {
-		return nil, errors.Wrap(err, "stat file")
+		return errors.Wrap(err, "stat file")
 	}
 
-	if err = os.MkdirAll(filepath.Dir(o.Path), 0o755); err != nil {
-		return nil, errors.Wrap(err, "create file directory")
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "create file directory")
 	}
-	if err = os.WriteFile(o.Path, []byte("{}"), 0o644); err != nil {
-		return nil, errors.Wrap(err, "create file")
+	if err = os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+		return errors.Wrap(err, "create file")
 	}
 
-	return &file{path: o.Path}, nil
+	return nil
 }
 
 func (f *file) Name() string {
@@ -107,7 +134,7 @@ func (f *file) Open(ns string) (storage.Storage, error) {
 }
 
 func (f *file) Close() error {
-	return nil
+	return f.unlock()
 }
 
 func (f *file) read() (map[string]map[string][]byte, error) {
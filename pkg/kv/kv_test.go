@@ -3,8 +3,10 @@ package kv
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -154,3 +156,74 @@ func TestStorage_MigrateFrom(t *testing.T) {
 		}
 	})
 }
+
+func TestFile_Lock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.json")
+
+	f1, err := New(DriverFile, map[string]any{"path": path})
+	require.NoError(t, err)
+
+	// reentrant in current process
+	f2, err := New(DriverFile, map[string]any{"path": path, "lock_timeout": "100ms"})
+	require.NoError(t, err)
+
+	// simulate another process by locking with a different file descriptor
+	other, err := os.OpenFile(path+".lock", os.O_RDWR, 0o644)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = other.Close() })
+
+	ok, err := tryLock(other)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, f1.Close())
+	require.NoError(t, f2.Close())
+
+	ok, err = tryLock(other)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = New(DriverFile, map[string]any{"path": path, "lock_timeout": "100ms"})
+	assert.ErrorIs(t, err, ErrSessionInUse)
+
+	require.NoError(t, unlock(other))
+}
+
+func TestLockFile_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	contended, free := filepath.Join(dir, "a.lock"), filepath.Join(dir, "b.lock")
+
+	// simulate another process holding the lock
+	other, err := os.OpenFile(contended, os.O_CREATE|os.O_RDWR, 0o644)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = other.Close() })
+	ok, err := tryLock(other)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	waited := make(chan error, 1)
+	go func() {
+		release, err := lockFile(contended, 5*time.Second)
+		if err == nil {
+			err = release()
+		}
+		waited <- err
+	}()
+	time.Sleep(2 * lockRetryInterval) // wait for contention
+
+	// other paths are not blocked by the waiting one
+	start := time.Now()
+	release, err := lockFile(free, 0)
+	require.NoError(t, err)
+	require.NoError(t, release())
+	assert.Less(t, time.Since(start), time.Second)
+
+	select {
+	case err = <-waited:
+		t.Fatalf("contended lock is acquired: %v", err)
+	default:
+	}
+
+	require.NoError(t, unlock(other))
+	assert.NoError(t, <-waited)
+}
@@ -0,0 +1,125 @@
+package kv
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// ErrSessionInUse is returned when storage is locked by another tdl process.
+var ErrSessionInUse = errors.New("session in use by another process")
+
+const lockRetryInterval = 50 * time.Millisecond
+
+type heldLock struct {
+	f    *os.File
+	refs int
+}
+
+// advisory locks only guard against other processes, so locks held by current process are reentrant
+var (
+	locksMu = &sync.Mutex{}
+	locks   = make(map[string]*heldLock)
+)
+
+// lockFile acquires an advisory lock on path and returns the release function.
+// If timeout is zero, it fails immediately when the lock is held by another process.
+func lockFile(path string, timeout time.Duration) (func() error, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "get absolute lock path")
+	}
+
+	// held by current process
+	if acquireHeld(path) {
+		return releaseFunc(path), nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open lock file")
+	}
+
+	// locksMu is not held while waiting, so that other paths can be locked and released meanwhile
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, errors.Wrap(err, "lock file")
+		}
+		if ok {
+			break
+		}
+
+		// locked by another goroutine of current process while waiting
+		if acquireHeld(path) {
+			_ = f.Close()
+			return releaseFunc(path), nil
+		}
+
+		if time.Now().After(deadline) {
+			_ = f.Close()
+			return nil, errors.Wrapf(ErrSessionInUse, "lock %s", path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+
+	locksMu.Lock()
+	defer locksMu.Unlock()
+
+	// another goroutine may win the race if locks are not exclusive between descriptors of one process
+	if l, ok := locks[path]; ok {
+		_ = unlock(f)
+		_ = f.Close()
+		l.refs++
+		return releaseFunc(path), nil
+	}
+
+	locks[path] = &heldLock{f: f, refs: 1}
+	return releaseFunc(path), nil
+}
+
+// acquireHeld increases references of lock on path if it's held by current process
+func acquireHeld(path string) bool {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+
+	l, ok := locks[path]
+	if ok {
+		l.refs++
+	}
+	return ok
+}
+
+func releaseFunc(path string) func() error {
+	once := &sync.Once{}
+
+	return func() (err error) {
+		once.Do(func() {
+			locksMu.Lock()
+			defer locksMu.Unlock()
+
+			l, ok := locks[path]
+			if !ok {
+				return
+			}
+			if l.refs--; l.refs > 0 {
+				return
+			}
+			delete(locks, path)
+
+			if err = unlock(l.f); err != nil {
+				_ = l.f.Close()
+				err = errors.Wrap(err, "unlock file")
+				return
+			}
+			err = l.f.Close()
+		})
+
+		return err
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows && !plan9 && !solaris && !aix && !js && !wasip1
+
+package kv
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/go-faster/errors"
+)
+
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,216 @@
+// Package splitfile splits files larger than Telegram limit into parts, and reassembles them by index.
+package splitfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+)
+
+// DefaultPartSize is the max size of files uploaded by accounts without premium, which is 2000MB.
+const DefaultPartSize = 2000 * 1024 * 1024
+
+// IndexExt is the extension of index file, which is appended to the name of split file.
+const IndexExt = ".index.json"
+
+// ErrMismatch is returned when size or hash of a part or reassembled file mismatches index.
+var ErrMismatch = errors.New("split file mismatch")
+
+// Index describes parts of a split file, which is uploaded along with parts.
+type Index struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Parts  []Part `json:"parts"`
+}
+
+// Part is a chunk of split file, whose offset is the total size of previous parts.
+type Part struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// PartName returns name of the nth(from 1) part of name, e.g. file.part001.
+func PartName(name string, n int) string {
+	return fmt.Sprintf("%s.part%03d", name, n)
+}
+
+// IndexName returns name of index file of name, e.g. file.index.json.
+func IndexName(name string) string {
+	return name + IndexExt
+}
+
+// IsIndex reports whether name is of an index file.
+func IsIndex(name string) bool {
+	return strings.HasSuffix(name, IndexExt) && len(name) > len(IndexExt)
+}
+
+// IsPart reports whether name is of a part file, e.g. file.part001.
+func IsPart(name string) bool {
+	i := strings.LastIndex(name, ".part")
+	if i <= 0 {
+		return false
+	}
+
+	n := name[i+len(".part"):]
+	if len(n) < 3 {
+		return false
+	}
+	for _, c := range n {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Split reads file of path and returns its index of parts which are at most partSize,
+// and hashes of parts and file are computed. Content is not copied, parts are read from the file by offsets.
+func Split(path string, partSize int64) (_ *Index, rerr error) {
+	if partSize <= 0 {
+		return nil, errors.Errorf("invalid part size %d", partSize)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file")
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(f))
+
+	name := filepath.Base(path)
+	idx := &Index{Name: name}
+	whole := sha256.New()
+	for {
+		h := sha256.New()
+		n, err := io.CopyN(io.MultiWriter(whole, h), f, partSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, errors.Wrapf(err, "read %s", path)
+		}
+		if n == 0 {
+			break
+		}
+
+		idx.Parts = append(idx.Parts, Part{
+			Name:   PartName(name, len(idx.Parts)+1),
+			Offset: idx.Size,
+			Size:   n,
+			SHA256: sum(h),
+		})
+		idx.Size += n
+
+		if n < partSize {
+			break
+		}
+	}
+	idx.SHA256 = sum(whole)
+
+	return idx, nil
+}
+
+// ReadIndex reads index of path, and names of file and parts are validated,
+// so that they can't escape the directory of index.
+func ReadIndex(path string) (*Index, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read index")
+	}
+
+	idx := &Index{}
+	if err = json.Unmarshal(b, idx); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal index %s", path)
+	}
+
+	if !validName(idx.Name) {
+		return nil, errors.Errorf("invalid file name %q of index %s", idx.Name, path)
+	}
+	offset := int64(0)
+	for _, p := range idx.Parts {
+		if !validName(p.Name) {
+			return nil, errors.Errorf("invalid part name %q of index %s", p.Name, path)
+		}
+		if p.Offset != offset || p.Size < 0 {
+			return nil, errors.Errorf("invalid range of part %s of index %s", p.Name, path)
+		}
+		offset += p.Size
+	}
+	if offset != idx.Size {
+		return nil, errors.Errorf("size of parts %d doesn't match %d of index %s", offset, idx.Size, path)
+	}
+
+	return idx, nil
+}
+
+// Reassemble concatenates parts of idx to dst after verifying size and hash of each part,
+// and partPath returns local path of part. dst is written to a temp file, which is renamed when it's verified.
+func Reassemble(idx *Index, dst string, partPath func(p Part) string) (rerr error) {
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "create file")
+	}
+	defer func() {
+		if rerr != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	whole := sha256.New()
+	for _, p := range idx.Parts {
+		if err = copyPart(io.MultiWriter(f, whole), partPath(p), p); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err = f.Close(); err != nil {
+		return errors.Wrap(err, "close file")
+	}
+
+	if s := sum(whole); s != idx.SHA256 {
+		return errors.Wrapf(ErrMismatch, "sha256 of %s is %s, expected %s", idx.Name, s, idx.SHA256)
+	}
+
+	if err = os.Rename(tmp, dst); err != nil {
+		return errors.Wrap(err, "rename file")
+	}
+	return nil
+}
+
+func copyPart(w io.Writer, path string, p Part) (rerr error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "open part %s", p.Name)
+	}
+	defer multierr.AppendInvoke(&rerr, multierr.Close(f))
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), f)
+	if err != nil {
+		return errors.Wrapf(err, "copy part %s", p.Name)
+	}
+	if n != p.Size {
+		return errors.Wrapf(ErrMismatch, "size of part %s is %d, expected %d", p.Name, n, p.Size)
+	}
+	if s := sum(h); s != p.SHA256 {
+		return errors.Wrapf(ErrMismatch, "sha256 of part %s is %s, expected %s", p.Name, s, p.SHA256)
+	}
+	return nil
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
+
+func sum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,127 @@
+package splitfile
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRandom(t *testing.T, path string, size int) []byte {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return data
+}
+
+// writeParts writes parts of idx read from src to dir, as uploaded and downloaded
+func writeParts(t *testing.T, src string, idx *Index, dir string) {
+	f, err := os.Open(src)
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, p := range idx.Parts {
+		b, err := io.ReadAll(io.NewSectionReader(f, p.Offset, p.Size))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, p.Name), b, 0o644))
+	}
+}
+
+func TestSplitReassemble(t *testing.T) {
+	for _, size := range []int{0, 1, 1023, 1024, 1025, 4096 + 7} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "file.bin")
+		data := writeRandom(t, src, size)
+
+		idx, err := Split(src, 1024)
+		require.NoError(t, err)
+		assert.Equal(t, "file.bin", idx.Name)
+		assert.Equal(t, int64(size), idx.Size)
+		assert.Len(t, idx.Parts, (size+1023)/1024)
+		for i, p := range idx.Parts {
+			assert.Equal(t, PartName("file.bin", i+1), p.Name)
+			assert.LessOrEqual(t, p.Size, int64(1024))
+		}
+
+		out := t.TempDir()
+		writeParts(t, src, idx, out)
+
+		b, err := json.Marshal(idx)
+		require.NoError(t, err)
+		index := filepath.Join(out, IndexName(idx.Name))
+		require.NoError(t, os.WriteFile(index, b, 0o644))
+
+		read, err := ReadIndex(index)
+		require.NoError(t, err)
+		assert.Equal(t, idx, read)
+
+		dst := filepath.Join(out, idx.Name)
+		require.NoError(t, Reassemble(read, dst, func(p Part) string { return filepath.Join(out, p.Name) }))
+
+		got, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, data, got, "size %d", size)
+	}
+}
+
+func TestReassemble_Mismatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "file.bin")
+	writeRandom(t, src, 3000)
+
+	idx, err := Split(src, 1024)
+	require.NoError(t, err)
+	writeParts(t, src, idx, dir)
+
+	part := filepath.Join(dir, idx.Parts[1].Name)
+	b, err := os.ReadFile(part)
+	require.NoError(t, err)
+	b[0] ^= 0xff
+	require.NoError(t, os.WriteFile(part, b, 0o644))
+
+	dst := filepath.Join(dir, "out.bin")
+	err = Reassemble(idx, dst, func(p Part) string { return filepath.Join(dir, p.Name) })
+	assert.ErrorIs(t, err, ErrMismatch)
+	assert.NoFileExists(t, dst)
+	assert.NoFileExists(t, dst+".tmp")
+}
+
+func TestReadIndex_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, idx := range map[string]Index{
+		"escaped name": {Name: "../file", Parts: []Part{}},
+		"escaped part": {Name: "file", Size: 1, Parts: []Part{{Name: "../file.part001", Size: 1}}},
+		"bad offset":   {Name: "file", Size: 2, Parts: []Part{{Name: "a", Size: 1}, {Name: "b", Offset: 0, Size: 1}}},
+		"bad size":     {Name: "file", Size: 3, Parts: []Part{{Name: "a", Size: 1}}},
+	} {
+		b, err := json.Marshal(idx)
+		require.NoError(t, err)
+		path := filepath.Join(dir, "index.json")
+		require.NoError(t, os.WriteFile(path, b, 0o644))
+
+		_, err = ReadIndex(path)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestIsIndex(t *testing.T) {
+	assert.True(t, IsIndex("file.bin.index.json"))
+	assert.False(t, IsIndex(IndexExt))
+	assert.False(t, IsIndex("file.bin.part001"))
+}
+
+func TestIsPart(t *testing.T) {
+	assert.True(t, IsPart("file.bin.part001"))
+	assert.True(t, IsPart(PartName("file.bin", 1000)))
+	assert.False(t, IsPart(".part001"))
+	assert.False(t, IsPart("file.bin.part01"))
+	assert.False(t, IsPart("file.bin.part001.tmp"))
+	assert.False(t, IsPart("file.bin.index.json"))
+}
@@ -0,0 +1,116 @@
+package tclient
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+
+	"github.com/iyear/tdl/core/logctx"
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/core/tclient"
+	"github.com/iyear/tdl/pkg/kv"
+)
+
+// AccountResult is the result of running an operation against the account of a namespace.
+type AccountResult struct {
+	Namespace string
+	Err       error
+}
+
+// Accounts returns sorted namespaces of engine which have logged-in sessions.
+func Accounts(ctx context.Context, engine kv.Storage) ([]string, error) {
+	namespaces, err := engine.Namespaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "list namespaces")
+	}
+
+	accounts := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		kvd, err := engine.Open(ns)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open namespace %q", ns)
+		}
+		data, err := storage.NewSession(kvd, false).LoadSession(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "load session of namespace %q", ns)
+		}
+		if len(data) > 0 {
+			accounts = append(accounts, ns)
+		}
+	}
+
+	sort.Strings(accounts)
+	return accounts, nil
+}
+
+// RunAccounts runs f against the authorized client of each namespace by New and RunWithAuth,
+// with at most concurrency accounts at a time, and zero means sequentially. KV of o is replaced by the
+// storage of each namespace, SessionBackupDir of o is the root dir of backups of each namespace, and logger
+// of ctx is named by namespace. Failures of accounts don't stop
+// others, and results are in order of namespaces.
+func RunAccounts(ctx context.Context, engine kv.Storage, namespaces []string, o Options, concurrency int,
+	f func(ctx context.Context, ns string, c *telegram.Client, kvd storage.Storage) error,
+	middlewares ...telegram.Middleware,
+) []AccountResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]AccountResult, len(namespaces))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for i, ns := range namespaces {
+		results[i].Namespace = ns
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(r *AccountResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r.Err = runAccount(logctx.Named(ctx, r.Namespace), engine, r.Namespace, o, f, middlewares...)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results
+}
+
+func runAccount(ctx context.Context, engine kv.Storage, ns string, o Options,
+	f func(ctx context.Context, ns string, c *telegram.Client, kvd storage.Storage) error,
+	middlewares ...telegram.Middleware,
+) error {
+	kvd, err := engine.Open(ns)
+	if err != nil {
+		return errors.Wrap(err, "open kv storage")
+	}
+	o.KV = kvd
+	if o.SessionBackupDir != "" {
+		o.SessionBackupDir = filepath.Join(o.SessionBackupDir, ns)
+	}
+
+	client, err := New(ctx, o, false, middlewares...)
+	if err != nil {
+		return errors.Wrap(err, "create client")
+	}
+
+	return tclient.RunWithAuth(ctx, client, func(ctx context.Context) error {
+		return f(ctx, ns, client, kvd)
+	})
+}
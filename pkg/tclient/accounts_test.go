@@ -0,0 +1,42 @@
+package tclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iyear/tdl/core/storage"
+	"github.com/iyear/tdl/pkg/kv"
+)
+
+func TestAccounts(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := kv.New(kv.DriverBolt, map[string]any{"path": t.TempDir()})
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, engine.Close()) }()
+
+	for _, ns := range []string{"work", "empty", "default"} {
+		kvd, err := engine.Open(ns)
+		require.NoError(t, err)
+		if ns != "empty" {
+			require.NoError(t, storage.NewSession(kvd, false).StoreSession(ctx, []byte("session")))
+		}
+	}
+
+	accounts, err := Accounts(ctx, engine)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default", "work"}, accounts)
+
+	// canceled accounts are never run
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	results := RunAccounts(cctx, engine, accounts, Options{}, 2, nil)
+	require.Len(t, results, 2)
+	for i, r := range results {
+		assert.Equal(t, accounts[i], r.Namespace)
+		assert.ErrorIs(t, r.Err, context.Canceled)
+	}
+}
@@ -19,6 +19,9 @@ type Options struct {
 	NTP              string
 	ReconnectTimeout time.Duration
 	UpdateHandler    telegram.UpdateHandler
+	// SessionBackupDir and SessionBackups are passed to tclient.Options, and empty dir disables backups
+	SessionBackupDir string
+	SessionBackups   int
 }
 
 func GetApp(kv storage.Storage) (App, error) {
@@ -49,5 +52,7 @@ func New(ctx context.Context, o Options, login bool, middlewares ...telegram.Mid
 		NTP:              o.NTP,
 		ReconnectTimeout: o.ReconnectTimeout,
 		UpdateHandler:    o.UpdateHandler,
+		SessionBackupDir: o.SessionBackupDir,
+		SessionBackups:   o.SessionBackups,
 	})
 }
@@ -1,6 +1,10 @@
 package utils
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type _byte struct{}
 
@@ -21,3 +25,38 @@ func (b _byte) FormatBinaryBytes(n int64) string {
 	}
 	return fmt.Sprintf("%.2f TB", float64(n)/1024/1024/1024/1024)
 }
+
+var binaryUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"T", 1024 * 1024 * 1024 * 1024},
+	{"G", 1024 * 1024 * 1024},
+	{"M", 1024 * 1024},
+	{"K", 1024},
+}
+
+// ParseBinaryBytes parses size like "512K", "1.5MB", "2 GiB" or "1024" into bytes.
+// Units are case-insensitive and binary(1K = 1024). Empty string means 0.
+func (b _byte) ParseBinaryBytes(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	if v == "" {
+		return 0, nil
+	}
+
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	unit := int64(1)
+	for _, u := range binaryUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, unit = strings.TrimSuffix(v, u.suffix), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	return int64(n * float64(unit)), nil
+}
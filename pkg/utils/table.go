@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/go-faster/errors"
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// Table styles of --style flags
+const (
+	TableStyleDark  = "dark"
+	TableStyleLight = "light"
+	TableStylePlain = "plain"
+)
+
+// TableStyles are all available table styles.
+var TableStyles = []string{TableStyleDark, TableStyleLight, TableStylePlain}
+
+type _table struct{}
+
+var Table _table
+
+// Style returns table style of name, and empty means TableStyleDark. TableStylePlain is always used
+// if colors are disabled, e.g. NO_COLOR is set or output is not a terminal.
+func (_table) Style(name string) (table.Style, error) {
+	var style table.Style
+	switch name {
+	case TableStyleDark, "":
+		style = table.StyleColoredDark
+	case TableStyleLight:
+		style = table.StyleColoredBright
+	case TableStylePlain:
+		style = table.StyleDefault
+	default:
+		return table.Style{}, errors.Errorf("unknown table style %q, available: %s", name, strings.Join(TableStyles, ", "))
+	}
+
+	if color.NoColor {
+		return table.StyleDefault, nil
+	}
+	return style, nil
+}